@@ -66,6 +66,15 @@ var DefaultBuiltins = [...]*Builtin{
 	// Arrays
 	ArrayConcat,
 
+	// Objects
+	ObjectGet,
+	ObjectRemove,
+	ObjectUnion,
+	ObjectFilter,
+	JSONFilter,
+	JSONRemove,
+	JSONPatch,
+
 	// Casting
 	ToNumber,
 	CastObject,
@@ -109,6 +118,10 @@ var DefaultBuiltins = [...]*Builtin{
 	Base64Decode,
 	Base64UrlEncode,
 	Base64UrlDecode,
+	Base32Encode,
+	Base32Decode,
+	HexEncode,
+	HexDecode,
 	URLQueryDecode,
 	URLQueryEncode,
 	URLQueryEncodeObject,
@@ -121,7 +134,18 @@ var DefaultBuiltins = [...]*Builtin{
 	JWTVerifyPS256,
 	JWTVerifyES256,
 	JWTVerifyHS256,
+	JWTVerifyRS384,
+	JWTVerifyPS384,
+	JWTVerifyES384,
+	JWTVerifyHS384,
+	JWTVerifyRS512,
+	JWTVerifyPS512,
+	JWTVerifyES512,
+	JWTVerifyHS512,
+	JWTVerifyEdDSA,
 	JWTDecodeVerify,
+	JWTEncodeSignRaw,
+	JWTEncodeSign,
 
 	// Time
 	NowNanos,
@@ -131,9 +155,23 @@ var DefaultBuiltins = [...]*Builtin{
 	Date,
 	Clock,
 	Weekday,
+	AddDate,
+	Diff,
+	Format,
 
 	// Crypto
 	CryptoX509ParseCertificates,
+	CryptoX509ParseAndVerifyCertificates,
+	CryptoX509ParseCertificateRequest,
+	CryptoX509ParseRSAPrivateKey,
+	CryptoParsePrivateKeys,
+	CryptoMd5,
+	CryptoSha1,
+	CryptoSha256,
+	CryptoSha512,
+	CryptoHmacSha256,
+	CryptoHmacSha512,
+	CryptoHmacEqual,
 
 	// Graphs
 	WalkBuiltin,
@@ -165,10 +203,24 @@ var DefaultBuiltins = [...]*Builtin{
 
 	// CIDR
 	NetCIDROverlap,
+	NetCIDRContains,
+	NetCIDRIntersects,
+	NetCIDRExpand,
+	NetCIDRMerge,
+	NetCIDRContainsMatches,
+	NetIPIsPrivate,
 
 	// Glob
 	GlobMatch,
 	GlobQuoteMeta,
+
+	// Semantic Versions
+	SemVerIsValid,
+	SemVerCompare,
+
+	// Units
+	UnitsParse,
+	UnitsParseBytes,
 }
 
 // BuiltinMap provides a convenient mapping of built-in names to
@@ -505,6 +557,115 @@ var ArrayConcat = &Builtin{
 	),
 }
 
+/**
+ * Objects
+ */
+
+// ObjectGet returns the value in the object for the key or the default value
+// if the key does not exist.
+var ObjectGet = &Builtin{
+	Name: "object.get",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.A,
+			types.A,
+		),
+		types.A,
+	),
+}
+
+// ObjectRemove returns a copy of the object with the keys removed. The keys may
+// be specified as an array, a set, or the keys of an object.
+var ObjectRemove = &Builtin{
+	Name: "object.remove",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.NewAny(
+				types.NewArray(nil, types.A),
+				types.NewSet(types.A),
+				types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			),
+		),
+		types.A,
+	),
+}
+
+// ObjectUnion recursively merges two objects. Values in the second object take
+// precedence when the keys conflict and the values are not both objects.
+var ObjectUnion = &Builtin{
+	Name: "object.union",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+		),
+		types.A,
+	),
+}
+
+// ObjectFilter returns a copy of the object containing only the keys. The keys
+// may be specified as an array, a set, or the keys of an object.
+var ObjectFilter = &Builtin{
+	Name: "object.filter",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.NewAny(
+				types.NewArray(nil, types.A),
+				types.NewSet(types.A),
+				types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			),
+		),
+		types.A,
+	),
+}
+
+// JSONFilter returns a copy of the object containing only the values found at
+// the paths. Paths are strings separated by "/" or arrays of path segments.
+var JSONFilter = &Builtin{
+	Name: "json.filter",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.NewAny(
+				types.NewArray(nil, types.NewAny(types.S, types.NewArray(nil, types.A))),
+				types.NewSet(types.NewAny(types.S, types.NewArray(nil, types.A))),
+			),
+		),
+		types.A,
+	),
+}
+
+// JSONRemove returns a copy of the object with the values found at the paths
+// removed. Paths are strings separated by "/" or arrays of path segments.
+var JSONRemove = &Builtin{
+	Name: "json.remove",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.A, types.A)),
+			types.NewAny(
+				types.NewArray(nil, types.NewAny(types.S, types.NewArray(nil, types.A))),
+				types.NewSet(types.NewAny(types.S, types.NewArray(nil, types.A))),
+			),
+		),
+		types.A,
+	),
+}
+
+// JSONPatch applies a JSON Patch (RFC 6902) to the document.
+var JSONPatch = &Builtin{
+	Name: "json.patch",
+	Decl: types.NewFunction(
+		types.Args(
+			types.A,
+			types.NewArray(nil, types.NewObject(nil, types.NewDynamicProperty(types.A, types.A))),
+		),
+		types.A,
+	),
+}
+
 /**
  * Casting
  */
@@ -880,6 +1041,42 @@ var Base64UrlDecode = &Builtin{
 	),
 }
 
+// Base32Encode serializes the input string into base32 encoding.
+var Base32Encode = &Builtin{
+	Name: "base32.encode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// Base32Decode deserializes the base32 encoded input string.
+var Base32Decode = &Builtin{
+	Name: "base32.decode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// HexEncode serializes the input string into hex encoding.
+var HexEncode = &Builtin{
+	Name: "hex.encode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// HexDecode deserializes the hex encoded input string.
+var HexDecode = &Builtin{
+	Name: "hex.decode",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
 // URLQueryDecode decodes a URL encoded input string.
 var URLQueryDecode = &Builtin{
 	Name: "urlquery.decode",
@@ -998,6 +1195,114 @@ var JWTVerifyHS256 = &Builtin{
 	),
 }
 
+// JWTVerifyRS384 verifies if a RS384 JWT signature is valid or not.
+var JWTVerifyRS384 = &Builtin{
+	Name: "io.jwt.verify_rs384",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyPS384 verifies if a PS384 JWT signature is valid or not.
+var JWTVerifyPS384 = &Builtin{
+	Name: "io.jwt.verify_ps384",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyES384 verifies if a ES384 JWT signature is valid or not.
+var JWTVerifyES384 = &Builtin{
+	Name: "io.jwt.verify_es384",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyHS384 verifies if a HS384 (secret) JWT signature is valid or not.
+var JWTVerifyHS384 = &Builtin{
+	Name: "io.jwt.verify_hs384",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyRS512 verifies if a RS512 JWT signature is valid or not.
+var JWTVerifyRS512 = &Builtin{
+	Name: "io.jwt.verify_rs512",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyPS512 verifies if a PS512 JWT signature is valid or not.
+var JWTVerifyPS512 = &Builtin{
+	Name: "io.jwt.verify_ps512",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyES512 verifies if a ES512 JWT signature is valid or not.
+var JWTVerifyES512 = &Builtin{
+	Name: "io.jwt.verify_es512",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyHS512 verifies if a HS512 (secret) JWT signature is valid or not.
+var JWTVerifyHS512 = &Builtin{
+	Name: "io.jwt.verify_hs512",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// JWTVerifyEdDSA verifies if a EdDSA JWT signature is valid or not.
+var JWTVerifyEdDSA = &Builtin{
+	Name: "io.jwt.verify_eddsa",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
 // JWTDecodeVerify verifies a JWT signature under parameterized constraints and decodes the claims if it is valid.
 var JWTDecodeVerify = &Builtin{
 	Name: "io.jwt.decode_verify",
@@ -1014,6 +1319,34 @@ var JWTDecodeVerify = &Builtin{
 	),
 }
 
+// JWTEncodeSignRaw encodes and signs a JSON Web Token. The inputs are the
+// JSON encoded JOSE header, payload and JSON Web Key used for signing.
+var JWTEncodeSignRaw = &Builtin{
+	Name: "io.jwt.encode_sign_raw",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+			types.S,
+		),
+		types.S,
+	),
+}
+
+// JWTEncodeSign encodes and signs a JSON Web Token. The inputs are the JOSE
+// header, payload and JSON Web Key used for signing.
+var JWTEncodeSign = &Builtin{
+	Name: "io.jwt.encode_sign",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		),
+		types.S,
+	),
+}
+
 /**
  * Time
  */
@@ -1058,29 +1391,81 @@ var ParseDurationNanos = &Builtin{
 	),
 }
 
-// Date returns the [year, month, day] for the nanoseconds since epoch.
+var timeWithZoneType = types.NewAny(
+	types.N,
+	types.NewArray([]types.Type{types.N, types.S}, nil),
+)
+
+// Date returns the [year, month, day] for the nanoseconds since epoch. The
+// time zone may be given as [ns, tz].
 var Date = &Builtin{
 	Name: "time.date",
 	Decl: types.NewFunction(
-		types.Args(types.N),
+		types.Args(timeWithZoneType),
 		types.NewArray([]types.Type{types.N, types.N, types.N}, nil),
 	),
 }
 
-// Clock returns the [hour, minute, second] of the day for the nanoseconds since epoch.
+// Clock returns the [hour, minute, second] of the day for the nanoseconds since
+// epoch. The time zone may be given as [ns, tz].
 var Clock = &Builtin{
 	Name: "time.clock",
 	Decl: types.NewFunction(
-		types.Args(types.N),
+		types.Args(timeWithZoneType),
 		types.NewArray([]types.Type{types.N, types.N, types.N}, nil),
 	),
 }
 
-// Weekday returns the day of the week (Monday, Tuesday, ...) for the nanoseconds since epoch.
+// Weekday returns the day of the week (Monday, Tuesday, ...) for the
+// nanoseconds since epoch. The time zone may be given as [ns, tz].
 var Weekday = &Builtin{
 	Name: "time.weekday",
 	Decl: types.NewFunction(
-		types.Args(types.N),
+		types.Args(timeWithZoneType),
+		types.S,
+	),
+}
+
+// AddDate returns the nanoseconds since epoch after adding years, months and
+// days to the nanoseconds since epoch. The time zone may be given as [ns, tz].
+var AddDate = &Builtin{
+	Name: "time.add_date",
+	Decl: types.NewFunction(
+		types.Args(
+			timeWithZoneType,
+			types.N,
+			types.N,
+			types.N,
+		),
+		types.N,
+	),
+}
+
+// Diff returns the difference [years, months, days, hours, minutes, seconds]
+// between two instants. The time zone may be given as [ns, tz].
+var Diff = &Builtin{
+	Name: "time.diff",
+	Decl: types.NewFunction(
+		types.Args(
+			timeWithZoneType,
+			timeWithZoneType,
+		),
+		types.NewArray([]types.Type{types.N, types.N, types.N, types.N, types.N, types.N}, nil),
+	),
+}
+
+// Format returns the formatted timestamp for the nanoseconds since epoch. The
+// time zone and layout may be given as [ns, tz] or [ns, tz, layout].
+var Format = &Builtin{
+	Name: "time.format",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.N,
+				types.NewArray([]types.Type{types.N, types.S}, nil),
+				types.NewArray([]types.Type{types.N, types.S, types.S}, nil),
+			),
+		),
 		types.S,
 	),
 }
@@ -1100,6 +1485,117 @@ var CryptoX509ParseCertificates = &Builtin{
 	),
 }
 
+// CryptoX509ParseAndVerifyCertificates returns the leaf certificate from the
+// given string containing PEM or base64 encoded DER certificates after
+// verifying it against the trusted root certificates given as the second
+// argument. The first certificate is the leaf and the remaining certificates
+// are intermediates.
+var CryptoX509ParseAndVerifyCertificates = &Builtin{
+	Name: "crypto.x509.parse_and_verify_certificates",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.NewArray([]types.Type{
+			types.B,
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		}, nil),
+	),
+}
+
+// CryptoX509ParseCertificateRequest returns a certificate signing request from
+// the given string containing a PEM or base64 encoded DER CSR.
+var CryptoX509ParseCertificateRequest = &Builtin{
+	Name: "crypto.x509.parse_certificate_request",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+	),
+}
+
+// CryptoX509ParseRSAPrivateKey returns a JWK for the RSA private key in the
+// given PEM encoded string.
+var CryptoX509ParseRSAPrivateKey = &Builtin{
+	Name: "crypto.x509.parse_rsa_private_key",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+	),
+}
+
+// CryptoParsePrivateKeys returns JWKs for the private keys in the given PEM
+// encoded string.
+var CryptoParsePrivateKeys = &Builtin{
+	Name: "crypto.parse_private_keys",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.NewArray(nil, types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+	),
+}
+
+// CryptoMd5 returns a string representing the input string hashed with the md5 function.
+var CryptoMd5 = &Builtin{
+	Name: "crypto.md5",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoSha1 returns a string representing the input string hashed with the sha1 function.
+var CryptoSha1 = &Builtin{
+	Name: "crypto.sha1",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoSha256 returns a string representing the input string hashed with the sha256 function.
+var CryptoSha256 = &Builtin{
+	Name: "crypto.sha256",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoSha512 returns a string representing the input string hashed with the sha512 function.
+var CryptoSha512 = &Builtin{
+	Name: "crypto.sha512",
+	Decl: types.NewFunction(
+		types.Args(types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacSha256 returns a string representing the HMAC-SHA256 of the input
+// string computed with the key.
+var CryptoHmacSha256 = &Builtin{
+	Name: "crypto.hmac.sha256",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacSha512 returns a string representing the HMAC-SHA512 of the input
+// string computed with the key.
+var CryptoHmacSha512 = &Builtin{
+	Name: "crypto.hmac.sha512",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.S,
+	),
+}
+
+// CryptoHmacEqual compares two MACs in constant time.
+var CryptoHmacEqual = &Builtin{
+	Name: "crypto.hmac.equal",
+	Decl: types.NewFunction(
+		types.Args(types.S, types.S),
+		types.B,
+	),
+}
+
 /**
  * Graphs.
  */
@@ -1352,6 +1848,62 @@ var GlobQuoteMeta = &Builtin{
 	),
 }
 
+/**
+ * Semantic Versions
+ */
+
+// SemVerIsValid validates that the input is a valid SemVer string.
+var SemVerIsValid = &Builtin{
+	Name: "semver.is_valid",
+	Decl: types.NewFunction(
+		types.Args(
+			types.A,
+		),
+		types.B,
+	),
+}
+
+// SemVerCompare compares valid SemVer formatted version strings. It returns
+// -1, 0 or 1 if the first version is less than, equal to or greater than the
+// second version.
+var SemVerCompare = &Builtin{
+	Name: "semver.compare",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.N,
+	),
+}
+
+/**
+ * Units
+ */
+
+// UnitsParse converts strings like 10G, 5K, 4M, 1500m and 2Ki into numbers.
+var UnitsParse = &Builtin{
+	Name: "units.parse",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+		),
+		types.N,
+	),
+}
+
+// UnitsParseBytes converts strings like 10GB, 5K, 4mb and 2KiB into the number
+// of bytes.
+var UnitsParseBytes = &Builtin{
+	Name: "units.parse_bytes",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+		),
+		types.N,
+	),
+}
+
 /**
  * Net CIDR
  */
@@ -1368,6 +1920,88 @@ var NetCIDROverlap = &Builtin{
 	),
 }
 
+// NetCIDRContains checks if a CIDR or IP is contained within another CIDR.
+var NetCIDRContains = &Builtin{
+	Name: "net.cidr_contains",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// NetCIDRIntersects checks if two CIDRs overlap.
+var NetCIDRIntersects = &Builtin{
+	Name: "net.cidr_intersects",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+			types.S,
+		),
+		types.B,
+	),
+}
+
+// NetCIDRExpand returns the set of IPs contained in a CIDR.
+var NetCIDRExpand = &Builtin{
+	Name: "net.cidr_expand",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+		),
+		types.NewSet(types.S),
+	),
+}
+
+// NetCIDRMerge aggregates a collection of IPs and CIDRs into the smallest set
+// of CIDRs that covers the same addresses.
+var NetCIDRMerge = &Builtin{
+	Name: "net.cidr_merge",
+	Decl: types.NewFunction(
+		types.Args(
+			types.NewAny(
+				types.NewArray(nil, types.S),
+				types.NewSet(types.S),
+			),
+		),
+		types.NewSet(types.S),
+	),
+}
+
+var cidrContainsMatchesOperandType = types.NewAny(
+	types.S,
+	types.NewArray(nil, types.NewAny(types.S, types.NewArray(nil, types.A))),
+	types.NewSet(types.NewAny(types.S, types.NewArray(nil, types.A))),
+	types.NewObject(nil, types.NewDynamicProperty(types.S, types.NewAny(types.S, types.NewArray(nil, types.A)))),
+)
+
+// NetCIDRContainsMatches returns the keys of the CIDRs in the first operand
+// that contain the CIDRs or IPs in the second operand.
+var NetCIDRContainsMatches = &Builtin{
+	Name: "net.cidr_contains_matches",
+	Decl: types.NewFunction(
+		types.Args(
+			cidrContainsMatchesOperandType,
+			cidrContainsMatchesOperandType,
+		),
+		types.NewSet(types.NewArray([]types.Type{types.A, types.A}, nil)),
+	),
+}
+
+// NetIPIsPrivate checks if an IP is in one of the private address ranges
+// defined by RFC 1918 and RFC 4193.
+var NetIPIsPrivate = &Builtin{
+	Name: "net.ip_is_private",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S,
+		),
+		types.B,
+	),
+}
+
 /**
  * Deprecated built-ins.
  */
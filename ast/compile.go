@@ -76,6 +76,7 @@ type Compiler struct {
 	// TypeEnv holds type information for values inferred by the compiler.
 	TypeEnv *TypeEnv
 
+	builtins     map[string]*Builtin
 	moduleLoader ModuleLoader
 	ruleIndices  *util.HashMap
 	stages       []func()
@@ -186,7 +187,8 @@ func NewCompiler() *Compiler {
 		}, func(x util.T) int {
 			return x.(Ref).Hash()
 		}),
-		maxErrs: CompileErrorLimitDefault,
+		maxErrs:  CompileErrorLimitDefault,
+		builtins: map[string]*Builtin{},
 	}
 
 	c.ModuleTree = NewModuleTree(nil)
@@ -254,11 +256,22 @@ func (c *Compiler) Failed() bool {
 	return len(c.Errors) > 0
 }
 
+// GetBuiltin returns the built-in function referred to by ref. Custom
+// built-ins added to the compiler take precedence over the global registry. If
+// ref does not refer to a built-in function, the return value is nil.
+func (c *Compiler) GetBuiltin(ref Ref) *Builtin {
+	name := ref.String()
+	if bi, ok := c.builtins[name]; ok {
+		return bi
+	}
+	return BuiltinMap[name]
+}
+
 // GetArity returns the number of args a function referred to by ref takes. If
 // ref refers to built-in function, the built-in declaration is consulted,
 // otherwise, the ref is used to perform a ruleset lookup.
 func (c *Compiler) GetArity(ref Ref) int {
-	if bi := BuiltinMap[ref.String()]; bi != nil {
+	if bi := c.GetBuiltin(ref); bi != nil {
 		return len(bi.Decl.Args())
 	}
 	rules := c.GetRulesExact(ref)
@@ -438,6 +451,17 @@ func (c *Compiler) WithModuleLoader(f ModuleLoader) *Compiler {
 	return c
 }
 
+// WithBuiltins adds custom built-in functions to the compiler. The built-ins
+// are only visible to this compiler and must be added before modules or
+// queries that call them are compiled.
+func (c *Compiler) WithBuiltins(builtins map[string]*Builtin) *Compiler {
+	for name, bi := range builtins {
+		c.builtins[name] = bi
+		c.TypeEnv.tree.Put(bi.Ref(), bi.Decl)
+	}
+	return c
+}
+
 // buildRuleIndices constructs indices for rules.
 func (c *Compiler) buildRuleIndices() {
 
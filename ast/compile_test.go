@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/util/test"
 )
@@ -591,6 +592,53 @@ func TestCompilerCheckTypes(t *testing.T) {
 	assertNotFailed(t, c)
 }
 
+func TestCompilerWithBuiltins(t *testing.T) {
+
+	builtins := map[string]*Builtin{
+		"test.plus_one": {
+			Name: "test.plus_one",
+			Decl: types.NewFunction(types.Args(types.N), types.N),
+		},
+	}
+
+	c := NewCompiler().WithBuiltins(builtins)
+	c.Compile(map[string]*Module{
+		"mod": MustParseModule(`package test
+
+		p = y { test.plus_one(1, y) }
+		q = test.plus_one(2)`),
+	})
+
+	assertNotFailed(t, c)
+
+	if arity := c.GetArity(MustParseRef("test.plus_one")); arity != 1 {
+		t.Fatalf("Expected arity of 1 but got: %v", arity)
+	}
+
+	c = NewCompiler().WithBuiltins(builtins)
+	c.Compile(map[string]*Module{
+		"mod": MustParseModule(`package test
+
+		p = test.plus_one("a")`),
+	})
+
+	if !c.Failed() || !strings.Contains(c.Errors.Error(), "test.plus_one: invalid argument(s)") {
+		t.Fatalf("Expected type error but got: %v", c.Errors)
+	}
+
+	// Built-ins are not shared with other compilers.
+	c = NewCompiler()
+	c.Compile(map[string]*Module{
+		"mod": MustParseModule(`package test
+
+		p = test.plus_one(1)`),
+	})
+
+	if !c.Failed() {
+		t.Fatal("Expected compilation to fail without custom built-in")
+	}
+}
+
 func TestCompilerCheckRuleConflicts(t *testing.T) {
 
 	c := getCompilerWithParsedModules(map[string]string{
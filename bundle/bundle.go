@@ -23,10 +23,12 @@ import (
 
 // Common file extensions and file names.
 const (
-	RegoExt     = ".rego"
-	jsonExt     = ".json"
-	manifestExt = ".manifest"
-	dataFile    = "data.json"
+	RegoExt        = ".rego"
+	jsonExt        = ".json"
+	manifestExt    = ".manifest"
+	dataFile       = "data.json"
+	signaturesFile = ".signatures.json"
+	patchFile      = "patch.json"
 )
 
 const bundleLimitBytes = (1024 * 1024 * 1024) + 1 // limit bundle reads to 1GB to protect against gzip bombs
@@ -34,16 +36,156 @@ const bundleLimitBytes = (1024 * 1024 * 1024) + 1 // limit bundle reads to 1GB t
 var manifestPath = []string{"system", "bundle", "manifest"}
 
 // Bundle represents a loaded bundle. The bundle can contain data and policies.
+// Delta bundles contain a patch to apply to the data instead.
 type Bundle struct {
-	Manifest Manifest
-	Data     map[string]interface{}
-	Modules  []ModuleFile
+	Signatures SignaturesConfig
+	Manifest   Manifest
+	Data       map[string]interface{}
+	Modules    []ModuleFile
+	Patch      Patch
 }
 
 // Manifest represents the manifest from a bundle. The manifest may contain
-// metadata such as the bundle revision.
+// metadata such as the bundle revision and the roots of the data document
+// owned by the bundle. Delta bundles set the type to "delta" and identify the
+// revision that the patch applies to.
 type Manifest struct {
-	Revision string `json:"revision"`
+	Revision     string    `json:"revision"`
+	Roots        *[]string `json:"roots,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	BaseRevision string    `json:"base_revision,omitempty"`
+}
+
+// Init initializes the manifest. If the manifest does not declare roots, the
+// bundle is assumed to own the entire data document.
+func (m *Manifest) Init() {
+	if m.Roots == nil {
+		defaultRoots := []string{""}
+		m.Roots = &defaultRoots
+	}
+}
+
+func (m *Manifest) validateAndInjectDefaults(b Bundle) error {
+
+	m.Init()
+
+	switch m.Type {
+	case "", SnapshotBundleType, DeltaBundleType:
+	default:
+		return fmt.Errorf("manifest has unsupported bundle type %q", m.Type)
+	}
+
+	// Validate roots in bundle.
+	roots := *m.Roots
+
+	// Standardize the roots (no starting or trailing slash)
+	for i := range roots {
+		roots[i] = strings.Trim(roots[i], "/")
+	}
+
+	for i := 0; i < len(roots)-1; i++ {
+		for j := i + 1; j < len(roots); j++ {
+			if RootPathsOverlap(roots[i], roots[j]) {
+				return fmt.Errorf("manifest has overlapped roots: %v and %v", roots[i], roots[j])
+			}
+		}
+	}
+
+	if err := b.validatePatch(roots); err != nil {
+		return err
+	}
+
+	// Validate modules in bundle.
+	for _, module := range b.Modules {
+		found := false
+		path := packagePath(module.Parsed.Package)
+		for i := range roots {
+			if rootContains(roots[i], path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("manifest roots %v do not permit '%v' in module '%v'", roots, module.Parsed.Package, module.Path)
+		}
+	}
+
+	// Validate data in bundle.
+	return dfs(b.Data, "", func(path string, node interface{}) (bool, error) {
+		path = strings.Trim(path, "/")
+		for i := range roots {
+			if rootContains(roots[i], path) {
+				return true, nil
+			}
+		}
+		if _, ok := node.(map[string]interface{}); ok {
+			for i := range roots {
+				if rootContains(path, roots[i]) {
+					return false, nil
+				}
+			}
+		}
+		return false, fmt.Errorf("manifest roots %v do not permit data at path '/%s' (hint: check bundle directory structure)", roots, path)
+	})
+}
+
+// RootPathsOverlap takes in two bundle root paths and returns true if they
+// overlap, i.e., if one of the paths is a prefix of the other.
+func RootPathsOverlap(pathA string, pathB string) bool {
+	a := rootPathSegments(pathA)
+	b := rootPathSegments(pathB)
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rootContains returns true if path is equal to or nested under root.
+func rootContains(root string, path string) bool {
+	return len(rootPathSegments(root)) <= len(rootPathSegments(path)) && RootPathsOverlap(root, path)
+}
+
+// packagePath returns the path of the package relative to the data document.
+func packagePath(pkg *ast.Package) string {
+	segments := make([]string, 0, len(pkg.Path)-1)
+	for _, term := range pkg.Path[1:] {
+		if s, ok := term.Value.(ast.String); ok {
+			segments = append(segments, string(s))
+		} else {
+			segments = append(segments, term.String())
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func rootPathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// dfs visits the nodes of the data document rooted at value in depth-first
+// order. The visitor returns true to stop descending into the node.
+func dfs(value interface{}, path string, fn func(string, interface{}) (bool, error)) error {
+	if stop, err := fn(path, value); err != nil {
+		return err
+	} else if stop {
+		return nil
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for key := range obj {
+		if err := dfs(obj[key], path+"/"+key, fn); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ModuleFile represents a single module contained a bundle.
@@ -57,6 +199,8 @@ type ModuleFile struct {
 type Reader struct {
 	r                     io.Reader
 	includeManifestInData bool
+	verificationConfig    *VerificationConfig
+	skipVerify            bool
 }
 
 // NewReader returns a new Reader.
@@ -73,6 +217,20 @@ func (r *Reader) IncludeManifestInData(includeManifestInData bool) *Reader {
 	return r
 }
 
+// WithBundleVerificationConfig sets the key configuration used to verify the
+// bundle signature. If set, bundles without a valid signature are rejected.
+func (r *Reader) WithBundleVerificationConfig(config *VerificationConfig) *Reader {
+	r.verificationConfig = config
+	return r
+}
+
+// WithSkipBundleVerification sets whether the bundle signature verification
+// should be skipped.
+func (r *Reader) WithSkipBundleVerification(skipVerify bool) *Reader {
+	r.skipVerify = skipVerify
+	return r
+}
+
 // Read returns a new Bundle loaded from the reader.
 func (r *Reader) Read() (Bundle, error) {
 
@@ -87,6 +245,8 @@ func (r *Reader) Read() (Bundle, error) {
 
 	tr := tar.NewReader(gr)
 
+	var files []file
+
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -109,6 +269,15 @@ func (r *Reader) Read() (Bundle, error) {
 
 		path := header.Name
 
+		if normalizePath(path) == signaturesFile {
+			if err := util.NewJSONDecoder(&buf).Decode(&bundle.Signatures); err != nil {
+				return bundle, errors.Wrap(err, "bundle load failed on signatures decode")
+			}
+			continue
+		}
+
+		files = append(files, file{path: normalizePath(path), raw: buf.Bytes()})
+
 		if strings.HasSuffix(path, RegoExt) {
 			module, err := ast.ParseModule(path, buf.String())
 			if err != nil {
@@ -138,27 +307,42 @@ func (r *Reader) Read() (Bundle, error) {
 				return bundle, errors.Wrapf(err, "bundle load failed on %v", path)
 			}
 
+		} else if normalizePath(path) == patchFile {
+			if err := util.NewJSONDecoder(&buf).Decode(&bundle.Patch); err != nil {
+				return bundle, errors.Wrapf(err, "bundle load failed on %v", path)
+			}
+
 		} else if strings.HasSuffix(path, manifestExt) {
 			if err := util.NewJSONDecoder(&buf).Decode(&bundle.Manifest); err != nil {
 				return bundle, errors.Wrap(err, "bundle load failed on manifest decode")
 			}
+		}
+	}
 
-			if r.includeManifestInData {
-				var metadata map[string]interface{}
-				b, err := json.Marshal(&bundle.Manifest)
-				if err != nil {
-					return bundle, errors.Wrap(err, "bundle load failed on manifest marshal")
-				}
+	if r.verificationConfig != nil && !r.skipVerify {
+		if err := verifyBundle(bundle.Signatures, files, r.verificationConfig); err != nil {
+			return bundle, errors.Wrap(err, "bundle verification failed")
+		}
+	}
 
-				err = util.UnmarshalJSON(b, &metadata)
-				if err != nil {
-					return bundle, errors.Wrap(err, "bundle load failed on manifest unmarshal")
-				}
+	if err := bundle.Manifest.validateAndInjectDefaults(bundle); err != nil {
+		return bundle, err
+	}
 
-				if err := bundle.insert(manifestPath, metadata); err != nil {
-					return bundle, errors.Wrapf(err, "bundle load failed on %v", manifestPath)
-				}
-			}
+	if r.includeManifestInData {
+		var metadata map[string]interface{}
+		b, err := json.Marshal(&bundle.Manifest)
+		if err != nil {
+			return bundle, errors.Wrap(err, "bundle load failed on manifest marshal")
+		}
+
+		err = util.UnmarshalJSON(b, &metadata)
+		if err != nil {
+			return bundle, errors.Wrap(err, "bundle load failed on manifest unmarshal")
+		}
+
+		if err := bundle.insert(manifestPath, metadata); err != nil {
+			return bundle, errors.Wrapf(err, "bundle load failed on %v", manifestPath)
 		}
 	}
 
@@ -170,42 +354,105 @@ func Write(w io.Writer, bundle Bundle) error {
 	gw := gzip.NewWriter(w)
 	tw := tar.NewWriter(gw)
 
-	var buf bytes.Buffer
-
-	if err := json.NewEncoder(&buf).Encode(bundle.Data); err != nil {
+	files, err := bundle.files()
+	if err != nil {
 		return err
 	}
 
-	if err := writeFile(tw, "data.json", buf.Bytes()); err != nil {
-		return err
+	if len(bundle.Signatures.Signatures) > 0 {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(bundle.Signatures); err != nil {
+			return err
+		}
+		files = append(files, file{path: signaturesFile, raw: buf.Bytes()})
 	}
 
-	for _, module := range bundle.Modules {
-		if err := writeFile(tw, module.Path, module.Raw); err != nil {
+	for _, f := range files {
+		if err := writeFile(tw, f.path, f.raw); err != nil {
 			return err
 		}
 	}
 
-	if err := writeManifest(tw, bundle); err != nil {
+	if err := tw.Close(); err != nil {
 		return err
 	}
 
-	if err := tw.Close(); err != nil {
+	return gw.Close()
+}
+
+// GenerateSignature generates the signature for the bundle contents using
+// the signing config. The signature covers the files written by Write.
+func (b *Bundle) GenerateSignature(signingConfig *SigningConfig, keyID string) error {
+
+	files, err := b.files()
+	if err != nil {
 		return err
 	}
 
-	return gw.Close()
+	infos := make([]FileInfo, 0, len(files))
+
+	for _, f := range files {
+		fi, err := NewFile(normalizePath(f.path), f.raw, defaultHashingAlg)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, fi)
+	}
+
+	token, err := GenerateSignedToken(infos, signingConfig, keyID)
+	if err != nil {
+		return err
+	}
+
+	b.Signatures = SignaturesConfig{Signatures: []string{token}}
+	return nil
 }
 
-func writeManifest(tw *tar.Writer, bundle Bundle) error {
+// file represents a single serialized file in the bundle.
+type file struct {
+	path string
+	raw  []byte
+}
+
+// files returns the serialized contents of the bundle (excluding signatures).
+func (b Bundle) files() ([]file, error) {
 
 	var buf bytes.Buffer
+	var files []file
+
+	if b.IsDelta() {
+		if err := json.NewEncoder(&buf).Encode(b.Patch); err != nil {
+			return nil, err
+		}
+		files = append(files, file{path: patchFile, raw: buf.Bytes()})
+	} else {
+		if err := json.NewEncoder(&buf).Encode(b.Data); err != nil {
+			return nil, err
+		}
+		files = append(files, file{path: dataFile, raw: buf.Bytes()})
+	}
+
+	for _, module := range b.Modules {
+		files = append(files, file{path: module.Path, raw: module.Raw})
+	}
 
-	if err := json.NewEncoder(&buf).Encode(bundle.Manifest); err != nil {
+	var manifest bytes.Buffer
+
+	if err := json.NewEncoder(&manifest).Encode(b.Manifest); err != nil {
+		return nil, err
+	}
+
+	return append(files, file{path: manifestExt, raw: manifest.Bytes()}), nil
+}
+
+func verifyBundle(signatures SignaturesConfig, files []file, bvc *VerificationConfig) error {
+
+	signed, err := VerifyBundleSignature(signatures, bvc)
+	if err != nil {
 		return err
 	}
 
-	return writeFile(tw, manifestExt, buf.Bytes())
+	return verifyBundleFiles(signed, files, bvc.Exclude)
 }
 
 // Equal returns true if this bundle's contents equal the other bundle's
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -86,6 +87,177 @@ func TestReadWithManifestInData(t *testing.T) {
 	}
 }
 
+func TestReadRootValidation(t *testing.T) {
+	cases := []struct {
+		note  string
+		files [][2]string
+		err   string
+	}{
+		{
+			note: "default roots",
+			files: [][2]string{
+				{"/.manifest", `{"revision": "abc"}`},
+				{"/a/data.json", `{"b": 1}`},
+			},
+		},
+		{
+			note: "data and modules under roots",
+			files: [][2]string{
+				{"/.manifest", `{"roots": ["a/b", "c"]}`},
+				{"/data.json", `{"a": {"b": {"x": 1}}}`},
+				{"/c/d/data.json", `true`},
+				{"/a/b/x.rego", `package a.b.x`},
+			},
+		},
+		{
+			note: "overlapped roots",
+			files: [][2]string{
+				{"/.manifest", `{"roots": ["a/b", "a"]}`},
+			},
+			err: "manifest has overlapped roots: a/b and a",
+		},
+		{
+			note: "data outside roots",
+			files: [][2]string{
+				{"/.manifest", `{"roots": ["a/b"]}`},
+				{"/a/c/data.json", `1`},
+			},
+			err: "manifest roots [a/b] do not permit data at path '/a/c' (hint: check bundle directory structure)",
+		},
+		{
+			note: "scalar above root",
+			files: [][2]string{
+				{"/.manifest", `{"roots": ["a/b"]}`},
+				{"/data.json", `{"a": 1}`},
+			},
+			err: "manifest roots [a/b] do not permit data at path '/a' (hint: check bundle directory structure)",
+		},
+		{
+			note: "module outside roots",
+			files: [][2]string{
+				{"/.manifest", `{"roots": ["a/b"]}`},
+				{"/x.rego", `package a`},
+			},
+			err: "manifest roots [a/b] do not permit 'package a' in module '/x.rego'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			buf := writeTarGz(tc.files)
+			_, err := NewReader(buf).Read()
+			if tc.err == "" && err != nil {
+				t.Fatal("Unexpected error:", err)
+			} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Fatalf("Expected error %q but got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestReadDeltaBundle(t *testing.T) {
+
+	files := [][2]string{
+		{"/.manifest", `{"revision": "b", "base_revision": "a", "type": "delta", "roots": ["a"]}`},
+		{"/patch.json", `{"data": [{"op": "add", "path": "/a/b", "value": 1}, {"op": "remove", "path": "/a/c"}]}`},
+	}
+
+	b, err := NewReader(writeTarGz(files)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.IsDelta() || b.Manifest.BaseRevision != "a" || len(b.Patch.Data) != 2 {
+		t.Fatalf("Unexpected bundle: %+v", b)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(b.Patch, b2.Patch) || !reflect.DeepEqual(b.Manifest, b2.Manifest) {
+		t.Fatalf("Expected %+v but got: %+v", b, b2)
+	}
+
+	cases := []struct {
+		note  string
+		files [][2]string
+		err   string
+	}{
+		{
+			note: "patch in snapshot",
+			files: [][2]string{
+				{"/patch.json", `{"data": [{"op": "add", "path": "/a", "value": 1}]}`},
+			},
+			err: "patch.json is only permitted in delta bundles",
+		},
+		{
+			note: "data in delta",
+			files: [][2]string{
+				{"/.manifest", `{"type": "delta"}`},
+				{"/data.json", `{"a": 1}`},
+			},
+			err: "delta bundles may only contain patch.json",
+		},
+		{
+			note: "unsupported op",
+			files: [][2]string{
+				{"/.manifest", `{"type": "delta"}`},
+				{"/patch.json", `{"data": [{"op": "move", "path": "/a"}]}`},
+			},
+			err: `patch operation 0: unsupported op "move"`,
+		},
+		{
+			note: "path outside roots",
+			files: [][2]string{
+				{"/.manifest", `{"type": "delta", "roots": ["a"]}`},
+				{"/patch.json", `{"data": [{"op": "add", "path": "/b", "value": 1}]}`},
+			},
+			err: "patch operation 0: manifest roots [a] do not permit path '/b'",
+		},
+		{
+			note: "unsupported type",
+			files: [][2]string{
+				{"/.manifest", `{"type": "foo"}`},
+			},
+			err: `manifest has unsupported bundle type "foo"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := NewReader(writeTarGz(tc.files)).Read()
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Expected error %q but got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRootPathsOverlap(t *testing.T) {
+	cases := []struct {
+		a, b string
+		exp  bool
+	}{
+		{"", "a", true},
+		{"a", "a/b", true},
+		{"/a/b/", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/bc", "a/b", false},
+	}
+	for _, tc := range cases {
+		if RootPathsOverlap(tc.a, tc.b) != tc.exp {
+			t.Errorf("Expected RootPathsOverlap(%q, %q) to be %v", tc.a, tc.b, tc.exp)
+		}
+	}
+}
+
 func TestReadErrorBadGzip(t *testing.T) {
 	buf := bytes.NewBufferString("bad gzip bytes")
 	_, err := NewReader(buf).Read()
@@ -0,0 +1,58 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// Supported file hashing algorithms.
+const (
+	SHA256 = "SHA-256"
+	SHA384 = "SHA-384"
+	SHA512 = "SHA-512"
+)
+
+const defaultHashingAlg = SHA256
+
+// FileInfo contains the hashing algorithm used, resulting digest etc.
+type FileInfo struct {
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
+}
+
+// NewFile returns a new FileInfo containing the hex encoded digest of bs.
+func NewFile(name string, bs []byte, alg string) (FileInfo, error) {
+
+	h, err := newHash(alg)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	h.Write(bs)
+
+	return FileInfo{
+		Name:      name,
+		Hash:      hex.EncodeToString(h.Sum(nil)),
+		Algorithm: alg,
+	}, nil
+}
+
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA384:
+		return sha512.New384(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hashing algorithm %q", alg)
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+const defaultAlg = RS256
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	RS384 = "RS384"
+	RS512 = "RS512"
+	PS256 = "PS256"
+	PS384 = "PS384"
+	PS512 = "PS512"
+	ES256 = "ES256"
+	ES384 = "ES384"
+	ES512 = "ES512"
+)
+
+var algorithms = map[string]crypto.Hash{
+	HS256: crypto.SHA256,
+	HS384: crypto.SHA384,
+	HS512: crypto.SHA512,
+	RS256: crypto.SHA256,
+	RS384: crypto.SHA384,
+	RS512: crypto.SHA512,
+	PS256: crypto.SHA256,
+	PS384: crypto.SHA384,
+	PS512: crypto.SHA512,
+	ES256: crypto.SHA256,
+	ES384: crypto.SHA384,
+	ES512: crypto.SHA512,
+}
+
+// KeyConfig holds the configuration of a key used for bundle signature
+// verification. For HMAC algorithms the key is the shared secret, otherwise
+// the key is a PEM encoded public key or certificate.
+type KeyConfig struct {
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm"`
+	Scope     string `json:"scope"`
+}
+
+// NewKeyConfig returns a new KeyConfig. If key refers to a file, the file
+// contents are used as the key.
+func NewKeyConfig(key, alg, scope string) (*KeyConfig, error) {
+
+	bs, err := readKeyMaterial(key)
+	if err != nil {
+		return nil, err
+	}
+
+	kc := &KeyConfig{
+		Key:       string(bs),
+		Algorithm: alg,
+		Scope:     scope,
+	}
+
+	return kc, kc.validateAndInjectDefaults()
+}
+
+// ParseKeysConfig returns a map of key IDs to key configurations.
+func ParseKeysConfig(raw []byte) (map[string]*KeyConfig, error) {
+
+	keys := map[string]*KeyConfig{}
+
+	if raw == nil {
+		return keys, nil
+	}
+
+	if err := util.Unmarshal(raw, &keys); err != nil {
+		return nil, err
+	}
+
+	for id, kc := range keys {
+		if kc == nil {
+			return nil, fmt.Errorf("missing configuration for key %q", id)
+		}
+		if err := kc.validateAndInjectDefaults(); err != nil {
+			return nil, fmt.Errorf("invalid configuration for key %q: %v", id, err)
+		}
+	}
+
+	return keys, nil
+}
+
+func (k *KeyConfig) validateAndInjectDefaults() error {
+
+	if k.Key == "" {
+		return fmt.Errorf("key must be specified")
+	}
+
+	if k.Algorithm == "" {
+		k.Algorithm = defaultAlg
+	}
+
+	if _, ok := algorithms[k.Algorithm]; !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", k.Algorithm)
+	}
+
+	if isHMAC(k.Algorithm) {
+		return nil
+	}
+
+	_, err := parsePublicKey(k.Algorithm, []byte(k.Key))
+	return err
+}
+
+func isHMAC(alg string) bool {
+	return alg == HS256 || alg == HS384 || alg == HS512
+}
+
+// readKeyMaterial returns the contents of the file named by key if it exists,
+// otherwise key itself.
+func readKeyMaterial(key string) ([]byte, error) {
+	if _, err := os.Stat(key); err == nil {
+		return ioutil.ReadFile(key)
+	}
+	return []byte(key), nil
+}
+
+func parsePublicKey(alg string, bs []byte) (interface{}, error) {
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM public key")
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, checkKeyType(alg, key)
+}
+
+func parsePrivateKey(alg string, bs []byte) (interface{}, error) {
+
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM private key")
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, checkKeyType(alg, key)
+}
+
+func checkKeyType(alg string, key interface{}) error {
+	switch alg {
+	case RS256, RS384, RS512, PS256, PS384, PS512:
+		switch key.(type) {
+		case *rsa.PublicKey, *rsa.PrivateKey:
+			return nil
+		}
+	case ES256, ES384, ES512:
+		switch key.(type) {
+		case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+			return nil
+		}
+	}
+	return fmt.Errorf("key type %T cannot be used with signing algorithm %q", key, alg)
+}
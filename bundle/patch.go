@@ -0,0 +1,85 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bundle types.
+const (
+	SnapshotBundleType = "snapshot"
+	DeltaBundleType    = "delta"
+)
+
+// Patch operations supported by delta bundles.
+const (
+	AddOp     = "add"
+	RemoveOp  = "remove"
+	ReplaceOp = "replace"
+)
+
+// Patch represents the patch file contained in a delta bundle.
+type Patch struct {
+	Data []PatchOperation `json:"data,omitempty"`
+}
+
+// PatchOperation represents a single JSON Patch operation applied to the data
+// document. The path is a JSON pointer relative to the root of the data
+// document.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// IsDelta returns true if the bundle is a delta bundle.
+func (b Bundle) IsDelta() bool {
+	return b.Manifest.Type == DeltaBundleType
+}
+
+func (b Bundle) validatePatch(roots []string) error {
+
+	if !b.IsDelta() {
+		if len(b.Patch.Data) > 0 {
+			return fmt.Errorf("%v is only permitted in delta bundles", patchFile)
+		}
+		return nil
+	}
+
+	if len(b.Data) > 0 || len(b.Modules) > 0 {
+		return fmt.Errorf("delta bundles may only contain %v", patchFile)
+	}
+
+	for i, op := range b.Patch.Data {
+
+		switch op.Op {
+		case AddOp, ReplaceOp, RemoveOp:
+		default:
+			return fmt.Errorf("patch operation %d: unsupported op %q", i, op.Op)
+		}
+
+		if !strings.HasPrefix(op.Path, "/") {
+			return fmt.Errorf("patch operation %d: path must begin with '/'", i)
+		}
+
+		path := strings.Trim(op.Path, "/")
+		found := false
+
+		for _, root := range roots {
+			if rootContains(root, path) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("patch operation %d: manifest roots %v do not permit path '%v'", i, roots, op.Path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+// SignaturesConfig represents the contents of the signatures file in a
+// bundle. Each signature is a JWT whose payload lists the files in the bundle
+// and their digests.
+type SignaturesConfig struct {
+	Signatures []string `json:"signatures,omitempty"`
+}
+
+// SigningConfig represents the key configuration used to generate a signed
+// token.
+type SigningConfig struct {
+	Key        string
+	Algorithm  string
+	ClaimsPath string
+}
+
+// NewSigningConfig returns a new SigningConfig. If key refers to a file, the
+// file contents are used as the key. The optional claimsPath refers to a JSON
+// file containing additional claims to include in the token.
+func NewSigningConfig(key, alg, claimsPath string) *SigningConfig {
+	if alg == "" {
+		alg = defaultAlg
+	}
+	return &SigningConfig{
+		Key:        key,
+		Algorithm:  alg,
+		ClaimsPath: claimsPath,
+	}
+}
+
+// GenerateSignedToken generates a signed token given the list of files to be
+// included in the payload and the bundle signing config. If keyID is
+// non-empty, it is included in the token as the "keyid" claim.
+func GenerateSignedToken(files []FileInfo, sc *SigningConfig, keyID string) (string, error) {
+
+	claims, err := sc.claims()
+	if err != nil {
+		return "", err
+	}
+
+	claims["files"] = files
+
+	if keyID != "" {
+		claims["keyid"] = keyID
+	}
+
+	header := map[string]interface{}{
+		"alg": sc.Algorithm,
+		"typ": "JWT",
+	}
+
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	hs, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	ps, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(hs) + "." + base64.RawURLEncoding.EncodeToString(ps)
+
+	key, err := readKeyMaterial(sc.Key)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := sign(sc.Algorithm, key, []byte(input))
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (sc *SigningConfig) claims() (map[string]interface{}, error) {
+
+	claims := map[string]interface{}{}
+
+	if sc.ClaimsPath == "" {
+		return claims, nil
+	}
+
+	bs, err := ioutil.ReadFile(sc.ClaimsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := util.UnmarshalJSON(bs, &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims file: %v", err)
+	}
+
+	return claims, nil
+}
+
+func sign(alg string, key []byte, input []byte) ([]byte, error) {
+
+	h, ok := algorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	if isHMAC(alg) {
+		mac := hmac.New(h.New, key)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+
+	priv, err := parsePrivateKey(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := h.New()
+	digest.Write(input)
+
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if alg[0] == 'P' {
+			return rsa.SignPSS(rand.Reader, priv, h, digest.Sum(nil), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.SignPKCS1v15(rand.Reader, priv, h, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		size := ecdsaKeySize(&priv.PublicKey)
+		sig := make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+		return sig, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key type %T", priv)
+}
+
+func verify(alg string, key interface{}, input []byte, sig []byte) error {
+
+	h, ok := algorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	if isHMAC(alg) {
+		mac := hmac.New(h.New, key.([]byte))
+		mac.Write(input)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+
+	digest := h.New()
+	digest.Write(input)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(pub, h, digest.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		}
+		return rsa.VerifyPKCS1v15(pub, h, digest.Sum(nil), sig)
+	case *ecdsa.PublicKey:
+		size := ecdsaKeySize(pub)
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest.Sum(nil), r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported public key type %T", key)
+}
+
+func ecdsaKeySize(pub *ecdsa.PublicKey) int {
+	return (pub.Curve.Params().BitSize + 7) / 8
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerifyBundle(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecBytes, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPriv := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	rsaPub := mustEncodePublicKey(t, &rsaKey.PublicKey)
+	ecPriv := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecBytes}))
+	ecPub := mustEncodePublicKey(t, &ecKey.PublicKey)
+
+	tests := []struct {
+		note    string
+		alg     string
+		signKey string
+		keys    map[string]*KeyConfig
+		keyID   string
+		vc      *VerificationConfig
+		modify  func(*Bundle)
+		wantErr string
+	}{
+		{
+			note:    "hmac",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			keyID:   "foo",
+		},
+		{
+			note:    "rsa",
+			alg:     RS256,
+			signKey: rsaPriv,
+			keys:    map[string]*KeyConfig{"foo": {Key: rsaPub, Algorithm: RS256}},
+			keyID:   "foo",
+		},
+		{
+			note:    "rsa pss",
+			alg:     PS384,
+			signKey: rsaPriv,
+			keys:    map[string]*KeyConfig{"foo": {Key: rsaPub, Algorithm: PS384}},
+			keyID:   "foo",
+		},
+		{
+			note:    "ecdsa",
+			alg:     ES256,
+			signKey: ecPriv,
+			keys:    map[string]*KeyConfig{"foo": {Key: ecPub, Algorithm: ES256}},
+			keyID:   "foo",
+		},
+		{
+			note:    "configured key id",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			vc:      &VerificationConfig{KeyID: "foo"},
+		},
+		{
+			note:    "missing key id",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			wantErr: "verification key ID is empty",
+		},
+		{
+			note:    "unknown key id",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			keyID:   "bar",
+			wantErr: `verification key corresponding to ID "bar" not found`,
+		},
+		{
+			note:    "wrong key",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "other", Algorithm: HS256}},
+			keyID:   "foo",
+			wantErr: "failed to verify JWT signature",
+		},
+		{
+			note:    "algorithm mismatch",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: rsaPub, Algorithm: RS256}},
+			keyID:   "foo",
+			wantErr: `signing algorithm "HS256" does not match configured algorithm "RS256"`,
+		},
+		{
+			note:    "scope mismatch",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256, Scope: "write"}},
+			keyID:   "foo",
+			wantErr: "scope mismatch",
+		},
+		{
+			note:    "tampered data",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			keyID:   "foo",
+			modify: func(b *Bundle) {
+				b.Data["a"] = "tampered"
+			},
+			wantErr: "data.json: digest mismatch",
+		},
+		{
+			note:    "extra file",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			keyID:   "foo",
+			modify: func(b *Bundle) {
+				b.Modules = append(b.Modules, ModuleFile{Path: "/extra.rego", Raw: []byte(`package extra`)})
+			},
+			wantErr: "file extra.rego not included in bundle signature",
+		},
+		{
+			note:    "excluded file",
+			alg:     HS256,
+			signKey: "secret",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			keyID:   "foo",
+			vc:      &VerificationConfig{Exclude: []string{"*.rego"}},
+			modify: func(b *Bundle) {
+				b.Modules = append(b.Modules, ModuleFile{Path: "/extra.rego", Raw: []byte(`package extra`)})
+			},
+		},
+		{
+			note:    "unsigned",
+			keys:    map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}},
+			wantErr: ".signatures.json: missing JWT",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			b := Bundle{
+				Data: map[string]interface{}{"a": "b"},
+				Modules: []ModuleFile{
+					{Path: "/x.rego", Raw: []byte(`package x`)},
+				},
+			}
+
+			if tc.signKey != "" {
+				if err := b.GenerateSignature(NewSigningConfig(tc.signKey, tc.alg, ""), tc.keyID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.modify != nil {
+				tc.modify(&b)
+			}
+
+			vc := tc.vc
+			if vc == nil {
+				vc = &VerificationConfig{}
+			}
+			vc.PublicKeys = tc.keys
+
+			var buf bytes.Buffer
+			if err := Write(&buf, b); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := NewReader(&buf).WithBundleVerificationConfig(vc).Read()
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q but got: %v", tc.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Data["a"] != "b" || len(result.Modules) != len(b.Modules) {
+				t.Fatalf("Unexpected bundle: %+v", result)
+			}
+		})
+	}
+}
+
+func TestSkipBundleVerification(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Bundle{Data: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: HS256}}, "foo", "", nil)
+
+	if _, err := NewReader(&buf).WithBundleVerificationConfig(vc).WithSkipBundleVerification(true).Read(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseKeysConfig(t *testing.T) {
+
+	keys, err := ParseKeysConfig([]byte(`{"foo": {"key": "secret", "algorithm": "HS512", "scope": "read"}, "bar": {"key": "secret2", "algorithm": "HS256"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys["foo"].Algorithm != HS512 || keys["foo"].Scope != "read" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+
+	for _, in := range []string{
+		`{"foo": {"key": "secret", "algorithm": "bad"}}`,
+		`{"foo": {"algorithm": "HS256"}}`,
+		`{"foo": {"key": "not a pem", "algorithm": "RS256"}}`,
+		`{"foo": null}`,
+	} {
+		if _, err := ParseKeysConfig([]byte(in)); err == nil {
+			t.Fatalf("Expected error for %v", in)
+		}
+	}
+}
+
+func mustEncodePublicKey(t *testing.T, key interface{}) string {
+	bs, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bs}))
+}
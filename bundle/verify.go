@@ -0,0 +1,217 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// VerificationConfig represents the key configuration used to verify a signed
+// bundle.
+type VerificationConfig struct {
+	PublicKeys map[string]*KeyConfig `json:"-"`
+	KeyID      string                `json:"keyid"`
+	Scope      string                `json:"scope"`
+	Exclude    []string              `json:"exclude_files"`
+}
+
+// NewVerificationConfig returns a new VerificationConfig.
+func NewVerificationConfig(keys map[string]*KeyConfig, id, scope string, exclude []string) *VerificationConfig {
+	return &VerificationConfig{
+		PublicKeys: keys,
+		KeyID:      id,
+		Scope:      scope,
+		Exclude:    exclude,
+	}
+}
+
+// ValidateAndInjectDefaults checks that the configured key ID (if any) refers
+// to a known key.
+func (vc *VerificationConfig) ValidateAndInjectDefaults(keys map[string]*KeyConfig) error {
+	if vc.KeyID != "" {
+		if _, ok := keys[vc.KeyID]; !ok {
+			return fmt.Errorf("key id %q not found", vc.KeyID)
+		}
+	}
+	vc.PublicKeys = keys
+	return nil
+}
+
+// DecodedSignature represents the decoded JWT payload.
+type DecodedSignature struct {
+	Files []FileInfo `json:"files"`
+	KeyID string     `json:"keyid"`
+	Scope string     `json:"scope"`
+}
+
+// VerifyBundleSignature verifies the bundle signature using the given public
+// keys or secret. If a signature is verified, it returns the list of files
+// and their digests listed in the signature.
+func VerifyBundleSignature(sc SignaturesConfig, bvc *VerificationConfig) (map[string]FileInfo, error) {
+
+	if len(sc.Signatures) == 0 {
+		return nil, fmt.Errorf(".signatures.json: missing JWT (expected exactly one)")
+	}
+
+	if len(sc.Signatures) > 1 {
+		return nil, fmt.Errorf(".signatures.json: multiple JWTs not supported (expected exactly one)")
+	}
+
+	payload, err := verifyJWTSignature(sc.Signatures[0], bvc)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]FileInfo, len(payload.Files))
+
+	for _, file := range payload.Files {
+		files[normalizePath(file.Name)] = file
+	}
+
+	return files, nil
+}
+
+func verifyJWTSignature(token string, bvc *VerificationConfig) (*DecodedSignature, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWT: expected three parts")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %v", err)
+	}
+
+	var payload DecodedSignature
+
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return nil, fmt.Errorf("invalid JWT payload: %v", err)
+	}
+
+	// The key ID in the token takes precedence over the configured key ID.
+	keyID := payload.KeyID
+	if keyID == "" {
+		keyID = header.Kid
+	}
+	if keyID == "" {
+		keyID = bvc.KeyID
+	}
+	if keyID == "" {
+		return nil, fmt.Errorf("verification key ID is empty")
+	}
+
+	kc, ok := bvc.PublicKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("verification key corresponding to ID %q not found", keyID)
+	}
+
+	if header.Alg != kc.Algorithm {
+		return nil, fmt.Errorf("signing algorithm %q does not match configured algorithm %q", header.Alg, kc.Algorithm)
+	}
+
+	var key interface{}
+
+	if isHMAC(kc.Algorithm) {
+		key = []byte(kc.Key)
+	} else {
+		var err error
+		if key, err = parsePublicKey(kc.Algorithm, []byte(kc.Key)); err != nil {
+			return nil, err
+		}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT signature: %v", err)
+	}
+
+	if err := verify(kc.Algorithm, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("failed to verify JWT signature: %v", err)
+	}
+
+	scope := bvc.Scope
+	if scope == "" {
+		scope = kc.Scope
+	}
+
+	if scope != payload.Scope {
+		return nil, fmt.Errorf("scope mismatch")
+	}
+
+	return &payload, nil
+}
+
+func decodeSegment(seg string, x interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, x)
+}
+
+// verifyBundleFiles checks that the files read from the bundle match the
+// files listed in the signature.
+func verifyBundleFiles(signed map[string]FileInfo, files []file, exclude []string) error {
+
+	for _, f := range files {
+
+		if excluded(f.path, exclude) {
+			delete(signed, f.path)
+			continue
+		}
+
+		fi, ok := signed[f.path]
+		if !ok {
+			return fmt.Errorf("file %v not included in bundle signature", f.path)
+		}
+
+		actual, err := NewFile(f.path, f.raw, fi.Algorithm)
+		if err != nil {
+			return err
+		}
+
+		if actual.Hash != fi.Hash {
+			return fmt.Errorf("%v: digest mismatch (want: %v, got: %v)", f.path, fi.Hash, actual.Hash)
+		}
+
+		delete(signed, f.path)
+	}
+
+	if len(signed) > 0 {
+		names := make([]string, 0, len(signed))
+		for name := range signed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("file(s) %v specified in bundle signature but not found in the bundle", names)
+	}
+
+	return nil
+}
+
+func excluded(name string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePath returns the path of a file in the bundle relative to the
+// bundle root without a leading slash.
+func normalizePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/runtime"
 	"github.com/open-policy-agent/opa/server"
 	"github.com/open-policy-agent/opa/util"
@@ -31,6 +32,8 @@ func init() {
 	var serverMode bool
 	var tlsCertFile, tlsPrivateKeyFile, tlsCACertFile string
 	var ignore []string
+	var verificationKey, verificationKeyID, verificationAlg, verificationScope string
+	var excludeVerifyFiles []string
 
 	authentication := util.NewEnumFlag("off", []string{"token", "tls", "off"})
 
@@ -84,11 +87,15 @@ file extensions that OPA will consider are:
 	.json          # JSON data
 	.yaml or .yml  # YAML data
 	.rego          # Rego file
+	.tar.gz        # Bundle file
 
 Data file and directory paths can be prefixed with the desired destination in
 the data document with the following syntax:
 
 	<dotted-path>:<file-path>
+
+Bundle signatures are verified if the --verification-key flag is set. Bundles
+without a valid signature are rejected.
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 
@@ -120,6 +127,16 @@ the data document with the following syntax:
 				Ignore: ignore,
 			}.Apply
 
+			if verificationKey != "" {
+				kc, err := bundle.NewKeyConfig(verificationKey, verificationAlg, verificationScope)
+				if err != nil {
+					fmt.Println("error:", err)
+					os.Exit(1)
+				}
+				keys := map[string]*bundle.KeyConfig{verificationKeyID: kc}
+				params.BundleVerificationConfig = bundle.NewVerificationConfig(keys, verificationKeyID, verificationScope, excludeVerifyFiles)
+			}
+
 			ctx := context.Background()
 
 			rt, err := runtime.NewRuntime(ctx, params)
@@ -155,6 +172,11 @@ the data document with the following syntax:
 	runCommand.Flags().VarP(logLevel, "log-level", "l", "set log level")
 	runCommand.Flags().VarP(logFormat, "log-format", "", "set log format")
 	setIgnore(runCommand.Flags(), &ignore)
+	runCommand.Flags().StringVarP(&verificationKey, "verification-key", "", "", "set the secret (HMAC) or path of the PEM file containing the public key (RSA and ECDSA) used to verify bundle signatures")
+	runCommand.Flags().StringVarP(&verificationKeyID, "verification-key-id", "", "default", "set the name assigned to the verification key")
+	runCommand.Flags().StringVarP(&verificationAlg, "signing-alg", "", "RS256", "set the name of the signing algorithm used to verify bundle signatures")
+	runCommand.Flags().StringVarP(&verificationScope, "scope", "", "", "set the scope to verify bundle signatures against")
+	runCommand.Flags().StringSliceVarP(&excludeVerifyFiles, "exclude-files-verify", "", []string{}, "set file names to exclude during bundle verification")
 
 	usageTemplate := `Usage:
   {{.UseLine}} [flags] [files]
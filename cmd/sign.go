@@ -0,0 +1,173 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/open-policy-agent/opa/bundle"
+)
+
+type signCommandParams struct {
+	key        string
+	algorithm  string
+	claimsFile string
+	keyID      string
+	outputDir  string
+}
+
+var signParams signCommandParams
+
+const signaturesFile = ".signatures.json"
+
+var signCommand = &cobra.Command{
+	Use:   "sign <path>",
+	Short: "Generate an OPA bundle signature",
+	Long: `Generate an OPA bundle signature.
+
+The 'sign' command generates a digital signature for policy bundles. The
+signature is a JWT whose payload lists every file in the bundle along with
+the file's digest. OPA verifies the signature before activating the bundle
+when a verification key is configured.
+
+If the path refers to a bundle directory, the 'sign' command writes a
+'.signatures.json' file into the directory (or the directory specified by
+--output-dir). The directory can then be packaged into a bundle:
+
+	$ opa sign --signing-key private.pem bundle/
+	$ tar czf bundle.tar.gz -C bundle .
+
+If the path refers to a bundle tarball (.tar.gz), the tarball is rewritten
+with the signature included.
+
+The --signing-key flag accepts a secret (for HMAC algorithms) or the path of
+a PEM file containing a private key (for RSA and ECDSA algorithms). Additional
+claims can be included in the JWT payload with --claims-file.`,
+	PreRunE: func(Cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("specify exactly one bundle path")
+		}
+		if signParams.key == "" {
+			return fmt.Errorf("specify the signing key with --signing-key")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := sign(args[0]); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func sign(path string) error {
+
+	sc := bundle.NewSigningConfig(signParams.key, signParams.algorithm, signParams.claimsFile)
+
+	if strings.HasSuffix(path, ".tar.gz") {
+		return signTarball(path, sc)
+	}
+
+	return signDirectory(path, sc)
+}
+
+func signTarball(path string, sc *bundle.SigningConfig) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := bundle.NewReader(f).Read()
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := b.GenerateSignature(sc, signParams.keyID); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	if err := bundle.Write(&buf, b); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func signDirectory(root string, sc *bundle.SigningConfig) error {
+
+	var files []bundle.FileInfo
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if rel == signaturesFile {
+			return nil
+		}
+
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		fi, err := bundle.NewFile(rel, bs, bundle.SHA256)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, fi)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	token, err := bundle.GenerateSignedToken(files, sc, signParams.keyID)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.MarshalIndent(bundle.SignaturesConfig{Signatures: []string{token}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	outputDir := signParams.outputDir
+	if outputDir == "" {
+		outputDir = root
+	}
+
+	return ioutil.WriteFile(filepath.Join(outputDir, signaturesFile), bs, 0644)
+}
+
+func init() {
+	signCommand.Flags().StringVarP(&signParams.key, "signing-key", "", "", "set the secret (HMAC) or path of the PEM file containing the private key (RSA and ECDSA)")
+	signCommand.Flags().StringVarP(&signParams.algorithm, "signing-alg", "", "RS256", "set the name of the signing algorithm")
+	signCommand.Flags().StringVarP(&signParams.claimsFile, "claims-file", "", "", "set path of JSON file containing optional claims")
+	signCommand.Flags().StringVarP(&signParams.keyID, "key-id", "", "", "set the key ID to include in the signature")
+	signCommand.Flags().StringVarP(&signParams.outputDir, "output-dir", "o", "", "set the directory to write the signatures file to (default: bundle directory)")
+	RootCommand.AddCommand(signCommand)
+}
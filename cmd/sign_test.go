@@ -0,0 +1,69 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestSignDirectory(t *testing.T) {
+
+	files := map[string]string{
+		"/data.json":        `{"a": 1}`,
+		"/x/y.rego":         `package x.y`,
+		"/.manifest":        `{"revision": "abc"}`,
+		"/.signatures.json": `{}`,
+	}
+
+	defer func(params signCommandParams) {
+		signParams = params
+	}(signParams)
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		signParams.key = "secret"
+		signParams.algorithm = bundle.HS256
+		signParams.keyID = "foo"
+
+		if err := sign(rootDir); err != nil {
+			t.Fatal(err)
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(rootDir, ".signatures.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sc bundle.SignaturesConfig
+		if err := util.UnmarshalJSON(bs, &sc); err != nil {
+			t.Fatal(err)
+		}
+
+		keys := map[string]*bundle.KeyConfig{
+			"foo": {Key: "secret", Algorithm: bundle.HS256},
+		}
+
+		signed, err := bundle.VerifyBundleSignature(sc, bundle.NewVerificationConfig(keys, "", "", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(signed) != 3 {
+			t.Fatalf("Expected three signed files but got: %v", signed)
+		}
+
+		for _, name := range []string{"data.json", "x/y.rego", ".manifest"} {
+			if _, ok := signed[name]; !ok {
+				t.Fatalf("Expected %v to be signed but got: %v", name, signed)
+			}
+		}
+	})
+}
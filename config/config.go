@@ -7,6 +7,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -18,12 +19,28 @@ type Config struct {
 	Services                     json.RawMessage            `json:"services"`
 	Labels                       map[string]string          `json:"labels"`
 	Discovery                    json.RawMessage            `json:"discovery"`
-	Bundle                       json.RawMessage            `json:"bundle"`
+	Bundle                       json.RawMessage            `json:"bundle"` // Deprecated: Use `bundles` instead
+	Bundles                      json.RawMessage            `json:"bundles"`
 	DecisionLogs                 json.RawMessage            `json:"decision_logs"`
 	Status                       json.RawMessage            `json:"status"`
 	Plugins                      map[string]json.RawMessage `json:"plugins"`
+	Keys                         json.RawMessage            `json:"keys"`
 	DefaultDecision              *string                    `json:"default_decision"`
 	DefaultAuthorizationDecision *string                    `json:"default_authorization_decision"`
+	PersistenceDirectory         *string                    `json:"persistence_directory"`
+	EvalLimits                   *EvalLimits                `json:"eval_limits"`
+	Caching                      json.RawMessage            `json:"caching"`
+	Storage                      *struct {
+		Disk json.RawMessage `json:"disk"`
+	} `json:"storage"`
+}
+
+// EvalLimits defines the resource limits enforced on policy evaluations
+// performed by the server. Zero values indicate the limit is not enforced.
+type EvalLimits struct {
+	MaxSteps          int64   `json:"max_steps"`
+	MaxCollectionSize int     `json:"max_collection_size"`
+	TimeoutSeconds    float64 `json:"timeout_seconds"`
 }
 
 // ParseConfig returns a valid Config object with defaults injected. The id
@@ -38,7 +55,7 @@ func ParseConfig(raw []byte, id string) (*Config, error) {
 
 // PluginsEnabled returns true if one or more plugin features are enabled.
 func (c Config) PluginsEnabled() bool {
-	return c.Bundle != nil || c.DecisionLogs != nil || c.Status != nil || len(c.Plugins) > 0
+	return c.Bundle != nil || c.Bundles != nil || c.DecisionLogs != nil || c.Status != nil || len(c.Plugins) > 0
 }
 
 // DefaultDecisionRef returns the default decision as a reference.
@@ -76,6 +93,17 @@ func (c *Config) validateAndInjectDefaults(id string) error {
 		return err
 	}
 
+	if c.PersistenceDirectory == nil {
+		s := defaultPersistenceDirectory
+		c.PersistenceDirectory = &s
+	}
+
+	if c.EvalLimits != nil {
+		if c.EvalLimits.MaxSteps < 0 || c.EvalLimits.MaxCollectionSize < 0 || c.EvalLimits.TimeoutSeconds < 0 {
+			return fmt.Errorf("eval_limits must not be negative")
+		}
+	}
+
 	if c.Labels == nil {
 		c.Labels = map[string]string{}
 	}
@@ -93,4 +121,5 @@ func parsePathToRef(s string) (ast.Ref, error) {
 const (
 	defaultDecisionPath              = "/system/main"
 	defaultAuthorizationDecisionPath = "/system/authz/allow"
+	defaultPersistenceDirectory      = ".opa"
 )
@@ -16,8 +16,9 @@ const (
 
 // PollingConfig represents polling configuration for the downloader.
 type PollingConfig struct {
-	MinDelaySeconds *int64 `json:"min_delay_seconds,omitempty"` // min amount of time to wait between successful poll attempts
-	MaxDelaySeconds *int64 `json:"max_delay_seconds,omitempty"` // max amount of time to wait between poll attempts
+	MinDelaySeconds           *int64 `json:"min_delay_seconds,omitempty"`            // min amount of time to wait between successful poll attempts
+	MaxDelaySeconds           *int64 `json:"max_delay_seconds,omitempty"`            // max amount of time to wait between poll attempts
+	LongPollingTimeoutSeconds *int64 `json:"long_polling_timeout_seconds,omitempty"` // max amount of time the server should hold a long poll request open
 }
 
 // Config represents the configuration for the downloader.
@@ -45,6 +46,10 @@ func (c *Config) ValidateAndInjectDefaults() error {
 		return fmt.Errorf("polling configuration missing 'min_delay_seconds'")
 	}
 
+	if c.Polling.LongPollingTimeoutSeconds != nil && *c.Polling.LongPollingTimeoutSeconds <= 0 {
+		return fmt.Errorf("long polling timeout must be > 0")
+	}
+
 	// scale to seconds
 	minSeconds := int64(time.Duration(min) * time.Second)
 	c.Polling.MinDelaySeconds = &minSeconds
@@ -53,6 +53,25 @@ func TestConfigValidation(t *testing.T) {
 			}`,
 			wantErr: true,
 		},
+		{
+			note: "bad long polling timeout",
+			input: `{
+				"polling": {
+					"long_polling_timeout_seconds": 0
+				}
+			}`,
+			wantErr: true,
+		},
+		{
+			note: "long polling",
+			input: `{
+				"polling": {
+					"long_polling_timeout_seconds": 10
+				}
+			}`,
+			expMin: time.Second * time.Duration(defaultMinDelaySeconds),
+			expMax: time.Second * time.Duration(defaultMaxDelaySeconds),
+		},
 		{
 			note: "user supplied",
 			input: `{
@@ -6,13 +6,18 @@
 package download
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/plugins/rest"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/pkg/errors"
@@ -21,15 +26,21 @@ import (
 
 const (
 	minRetryDelay = time.Millisecond * 100
+
+	// longPollingGracePeriod is added to the long polling timeout to allow for
+	// network latency before the request is abandoned.
+	longPollingGracePeriod = time.Second * 10
 )
 
 // Update contains the result of a download. If an error occurred, the Error
 // field will be non-nil. If a new bundle is available, the Bundle field will
-// be non-nil.
+// be non-nil and the Raw field contains the bundle as downloaded.
 type Update struct {
-	ETag   string
-	Bundle *bundle.Bundle
-	Error  error
+	ETag    string
+	Bundle  *bundle.Bundle
+	Raw     []byte
+	Error   error
+	Metrics metrics.Metrics
 }
 
 // Downloader implements low-level OPA bundle downloading. Downloader can be
@@ -44,6 +55,9 @@ type Downloader struct {
 	f        func(context.Context, Update) // callback function invoked when download updates occur
 	logAttrs [][2]string                   // optional attributes to include in log messages
 	etag     string                        // HTTP Etag for caching purposes
+	bvc      *bundle.VerificationConfig    // optional bundle signature verification configuration
+	cancel   context.CancelFunc            // cancels in-flight requests when the downloader is stopped
+	longPoll bool                          // indicates the server honoured the last long polling request
 }
 
 // New returns a new Downloader that can be started.
@@ -69,21 +83,40 @@ func (d *Downloader) WithLogAttrs(attrs [][2]string) *Downloader {
 	return d
 }
 
+// WithBundleVerificationConfig sets the key configuration used to verify the
+// signature of downloaded bundles.
+func (d *Downloader) WithBundleVerificationConfig(config *bundle.VerificationConfig) *Downloader {
+	d.bvc = config
+	return d
+}
+
+// SetCache sets the etag sent with the next download request. This is used
+// when a bundle was activated from a persisted copy.
+func (d *Downloader) SetCache(etag string) {
+	d.etag = etag
+}
+
+// ClearCache resets the etag sent with the next download request. Bundle
+// services should respond to requests without an etag with a snapshot bundle.
+func (d *Downloader) ClearCache() {
+	d.etag = ""
+}
+
 // Start tells the Downloader to begin downloading bundles.
 func (d *Downloader) Start(ctx context.Context) {
-	go d.loop()
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go d.loop(ctx)
 }
 
 // Stop tells the Downloader to stop begin downloading bundles.
 func (d *Downloader) Stop(ctx context.Context) {
 	done := make(chan struct{})
+	d.cancel()
 	d.stop <- done
 	_ = <-done
 }
 
-func (d *Downloader) loop() {
-
-	ctx, cancel := context.WithCancel(context.Background())
+func (d *Downloader) loop(ctx context.Context) {
 
 	var retry int
 
@@ -91,7 +124,11 @@ func (d *Downloader) loop() {
 		err := d.oneShot(ctx)
 		var delay time.Duration
 
-		if err == nil {
+		if err == nil && d.longPoll {
+			// The server holds the request open until a new revision is
+			// available so the next request can be issued immediately.
+			delay = 0
+		} else if err == nil {
 			min := float64(*d.config.Polling.MinDelaySeconds)
 			max := float64(*d.config.Polling.MaxDelaySeconds)
 			delay = time.Duration(((max - min) * rand.Float64()) + min)
@@ -110,7 +147,6 @@ func (d *Downloader) loop() {
 				retry = 0
 			}
 		case done := <-d.stop:
-			cancel()
 			done <- struct{}{}
 			return
 		}
@@ -119,47 +155,97 @@ func (d *Downloader) loop() {
 
 func (d *Downloader) oneShot(ctx context.Context) error {
 
-	b, etag, err := d.download(ctx)
+	m := metrics.New()
 
-	if d.f != nil {
-		d.f(ctx, Update{ETag: etag, Bundle: b, Error: err})
-	}
+	m.Timer(metrics.BundleRequest).Start()
+	b, raw, etag, err := d.download(ctx)
+	m.Timer(metrics.BundleRequest).Stop()
 
+	// The etag is updated before the callback is invoked so that the callback
+	// can clear it (e.g., to request a snapshot after a delta failed to apply.)
 	d.etag = etag
 
+	// Requests that fail because the downloader is stopping are not reported.
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+
+	if d.f != nil {
+		d.f(ctx, Update{ETag: etag, Bundle: b, Raw: raw, Error: err, Metrics: m})
+	}
+
 	return err
 }
 
-func (d *Downloader) download(ctx context.Context) (*bundle.Bundle, string, error) {
+func (d *Downloader) download(ctx context.Context) (*bundle.Bundle, []byte, string, error) {
 
 	d.logDebug("Download starting.")
 
-	resp, err := d.client.WithHeader("If-None-Match", d.etag).Do(ctx, "GET", d.path)
+	client := d.client.WithHeader("If-None-Match", d.etag)
+
+	if timeout := d.config.Polling.LongPollingTimeoutSeconds; timeout != nil {
+		client = client.WithHeader("Prefer", fmt.Sprintf("wait=%d", *timeout))
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*timeout)*time.Second+longPollingGracePeriod)
+		defer cancel()
+	}
+
+	resp, err := client.Do(ctx, "GET", d.path)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "request failed")
+		d.longPoll = false
+		return nil, nil, "", errors.Wrap(err, "request failed")
 	}
 
 	defer util.Close(resp)
 
+	// Servers that do not support long polling ignore the Prefer header. In
+	// that case, the downloader falls back to periodic polling.
+	d.longPoll = d.config.Polling.LongPollingTimeoutSeconds != nil && preferenceApplied(resp, "wait")
+
 	switch resp.StatusCode {
 	case http.StatusOK:
 		d.logDebug("Download in progress.")
 
-		b, err := bundle.NewReader(resp.Body).Read()
+		var raw bytes.Buffer
+		r := io.TeeReader(resp.Body, &raw)
+
+		b, err := bundle.NewReader(r).WithBundleVerificationConfig(d.bvc).Read()
 		if err != nil {
-			return nil, "", err
+			return nil, nil, "", err
 		}
 
-		return &b, resp.Header.Get("ETag"), nil
+		// The reader may stop before the end of the archive (e.g., padding.)
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			return nil, nil, "", err
+		}
+
+		return &b, raw.Bytes(), resp.Header.Get("ETag"), nil
 	case http.StatusNotModified:
-		return nil, resp.Header.Get("ETag"), nil
+		return nil, nil, resp.Header.Get("ETag"), nil
 	case http.StatusNotFound:
-		return nil, "", fmt.Errorf("server replied with not found")
+		return nil, nil, "", fmt.Errorf("server replied with not found")
 	case http.StatusUnauthorized:
-		return nil, "", fmt.Errorf("server replied with not authorized")
+		return nil, nil, "", fmt.Errorf("server replied with not authorized")
 	default:
-		return nil, "", fmt.Errorf("server replied with HTTP %v", resp.StatusCode)
+		return nil, nil, "", fmt.Errorf("server replied with HTTP %v", resp.StatusCode)
+	}
+}
+
+// preferenceApplied returns true if the response indicates that the server
+// applied the named preference (see RFC 7240.)
+func preferenceApplied(resp *http.Response, name string) bool {
+	for _, v := range resp.Header["Preference-Applied"] {
+		for _, pref := range strings.Split(v, ",") {
+			pref = strings.TrimSpace(pref)
+			if i := strings.Index(pref, "="); i >= 0 {
+				pref = pref[:i]
+			}
+			if strings.EqualFold(strings.TrimSpace(pref), name) {
+				return true
+			}
+		}
 	}
+	return false
 }
 
 func (d *Downloader) logError(fmt string, a ...interface{}) {
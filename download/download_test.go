@@ -64,6 +64,118 @@ func TestEtagCaching(t *testing.T) {
 	} else if len(updates) != 2 || updates[1].Bundle != nil {
 		t.Fatal("expected no change")
 	}
+
+	d.ClearCache()
+
+	err = d.oneShot(ctx)
+	if err != nil {
+		t.Fatal("Unexpected:", err)
+	} else if len(updates) != 3 || updates[2].Bundle == nil {
+		t.Fatal("expected update after cache cleared")
+	}
+}
+
+func TestLongPolling(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t)
+	defer fixture.server.stop()
+
+	timeout := int64(30)
+	config := Config{Polling: PollingConfig{LongPollingTimeoutSeconds: &timeout}}
+	if err := config.ValidateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(config, fixture.client, "/bundles/test/bundle1")
+
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	} else if fixture.server.prefer != "wait=30" {
+		t.Fatalf("Expected Prefer header but got: %q", fixture.server.prefer)
+	} else if d.longPoll {
+		t.Fatal("Expected periodic polling when server does not support long polling")
+	}
+
+	fixture.server.longPoll = true
+
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	} else if !d.longPoll {
+		t.Fatal("Expected long polling when server applied preference")
+	}
+}
+
+func TestLongPollingStartStop(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t)
+	fixture.server.longPoll = true
+	fixture.server.expEtag = "some etag value"
+	defer fixture.server.stop()
+
+	// The polling delay is long enough that the test would time out if the
+	// downloader did not re-poll immediately.
+	min, max, timeout := int64(3600), int64(3600), int64(30)
+	config := Config{Polling: PollingConfig{MinDelaySeconds: &min, MaxDelaySeconds: &max, LongPollingTimeoutSeconds: &timeout}}
+	if err := config.ValidateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	called := make(chan struct{}, 1)
+
+	d := New(config, fixture.client, "/bundles/test/bundle1").WithCallback(func(context.Context, Update) {
+		select {
+		case called <- struct{}{}:
+		default:
+		}
+	})
+
+	d.Start(ctx)
+	<-called
+	<-called
+	d.Stop(ctx)
+}
+
+func TestBundleVerification(t *testing.T) {
+
+	ctx := context.Background()
+	fixture := newTestFixture(t)
+	defer fixture.server.stop()
+
+	signed := fixture.server.bundles["test/bundle1"]
+	if err := signed.GenerateSignature(bundle.NewSigningConfig("secret", bundle.HS256, ""), "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.server.bundles["test/signed"] = signed
+
+	keys := map[string]*bundle.KeyConfig{
+		"foo": {Key: "secret", Algorithm: bundle.HS256},
+	}
+
+	vc := bundle.NewVerificationConfig(keys, "", "", nil)
+
+	var update Update
+
+	d := New(Config{}, fixture.client, "/bundles/test/signed").WithBundleVerificationConfig(vc).WithCallback(func(_ context.Context, u Update) {
+		update = u
+	})
+
+	if err := d.oneShot(ctx); err != nil {
+		t.Fatal("Unexpected:", err)
+	}
+
+	// The raw bundle can be verified again (e.g., after it was persisted.)
+	if _, err := bundle.NewReader(bytes.NewReader(update.Raw)).WithBundleVerificationConfig(vc).Read(); err != nil {
+		t.Fatal("Unexpected:", err)
+	}
+
+	d = New(Config{}, fixture.client, "/bundles/test/bundle1").WithBundleVerificationConfig(vc)
+
+	if err := d.oneShot(ctx); err == nil {
+		t.Fatal("expected error for unsigned bundle")
+	}
 }
 
 func TestFailureAuthn(t *testing.T) {
@@ -169,16 +281,24 @@ func newTestFixture(t *testing.T) testFixture {
 }
 
 type testServer struct {
-	t       *testing.T
-	expCode int
-	expEtag string
-	expAuth string
-	bundles map[string]bundle.Bundle
-	server  *httptest.Server
+	t        *testing.T
+	expCode  int
+	expEtag  string
+	expAuth  string
+	longPoll bool
+	prefer   string
+	bundles  map[string]bundle.Bundle
+	server   *httptest.Server
 }
 
 func (t *testServer) handle(w http.ResponseWriter, r *http.Request) {
 
+	t.prefer = r.Header.Get("Prefer")
+
+	if t.longPoll && strings.HasPrefix(t.prefer, "wait=") {
+		w.Header().Add("Preference-Applied", t.prefer)
+	}
+
 	if t.expCode != 0 {
 		w.WriteHeader(t.expCode)
 		return
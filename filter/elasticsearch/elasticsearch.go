@@ -0,0 +1,481 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package elasticsearch translates the results of partial evaluation into
+// Elasticsearch query DSL.
+//
+// The unknowns used for partial evaluation are expected to be collections of
+// documents under a common root (data by default). References of the form
+// data.<index>[_].<field> are translated into field names. Object fields are
+// joined with dots, e.g., data.posts[_].author.name refers to the author.name
+// field. Iteration over an array of objects, e.g.,
+// data.posts[_].comments[i].author, is translated into a nested query on the
+// comments path. Conditions that iterate the same array with the same variable
+// are combined into a single nested query.
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Query represents an Elasticsearch query. Queries can be encoded as JSON and
+// used as the query in a search request.
+type Query map[string]interface{}
+
+// Error is returned when an expression cannot be translated into a query.
+type Error struct {
+	Message  string
+	Expr     *ast.Expr
+	Location *ast.Location
+}
+
+func (e *Error) Error() string {
+
+	msg := fmt.Sprintf("%v: %v", e.Message, e.Expr)
+
+	if e.Location != nil {
+		if len(e.Location.File) > 0 {
+			return fmt.Sprintf("%v:%v: %v", e.Location.File, e.Location.Row, msg)
+		}
+		return fmt.Sprintf("%v:%v: %v", e.Location.Row, e.Location.Col, msg)
+	}
+
+	return msg
+}
+
+// Translator converts partial evaluation results into Elasticsearch queries.
+type Translator struct {
+	root ast.Ref
+}
+
+// New returns a new Translator with documents rooted under data.
+func New() *Translator {
+	return &Translator{
+		root: ast.DefaultRootRef,
+	}
+}
+
+// WithRoot sets the reference under which collections of documents are found.
+// For example, if the root is data.es, then data.es.posts[_].author refers to
+// the author field of documents in the posts collection.
+func (t *Translator) WithRoot(root ast.Ref) *Translator {
+	t.root = root
+	return t
+}
+
+// Translate returns a query that matches the documents for which the partially
+// evaluated queries are true. If there are no queries, no documents match. If
+// any query is empty, all documents match.
+func (t *Translator) Translate(pq *rego.PartialQueries) (Query, error) {
+
+	s := &state{
+		Translator: t,
+		support:    map[string][]*ast.Rule{},
+	}
+
+	for _, module := range pq.Support {
+		for _, rule := range module.Rules {
+			path := rule.Path().String()
+			s.support[path] = append(s.support[path], rule)
+		}
+	}
+
+	return s.queries(pq.Queries)
+}
+
+type state struct {
+	*Translator
+	support map[string][]*ast.Rule
+}
+
+// field identifies a document field referred to by a term. If the field is
+// contained in an array of objects, path is the nested path and iter is the
+// variable that iterates over the array.
+type field struct {
+	name  string
+	path  string
+	iter  ast.Var
+	multi bool
+}
+
+var rangeOps = map[string]string{
+	ast.LessThan.Name:      "lt",
+	ast.LessThanEq.Name:    "lte",
+	ast.GreaterThan.Name:   "gt",
+	ast.GreaterThanEq.Name: "gte",
+}
+
+// flipped contains the range operators to use when the field is on the right
+// hand side of the comparison.
+var flipped = map[string]string{
+	"lt":  "gt",
+	"lte": "gte",
+	"gt":  "lt",
+	"gte": "lte",
+}
+
+func (s *state) queries(queries []ast.Body) (Query, error) {
+
+	if len(queries) == 0 {
+		return Query{"match_none": Query{}}, nil
+	}
+
+	for _, query := range queries {
+		if len(query) == 0 {
+			return Query{"match_all": Query{}}, nil
+		}
+	}
+
+	should := make([]interface{}, len(queries))
+
+	for i := range queries {
+		q, err := s.body(queries[i])
+		if err != nil {
+			return nil, err
+		}
+		should[i] = q
+	}
+
+	if len(should) == 1 {
+		return should[0].(Query), nil
+	}
+
+	return Query{"bool": Query{"should": should, "minimum_should_match": 1}}, nil
+}
+
+// body translates a conjunction of expressions. Positive conditions are added
+// to the filter context and negated conditions are added to must_not.
+func (s *state) body(body ast.Body) (Query, error) {
+
+	var filter, mustNot []interface{}
+	nested := map[string]*nestedGroup{}
+
+	for _, expr := range body {
+
+		q, f, err := s.expr(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		if f == nil || f.path == "" {
+			if expr.Negated {
+				mustNot = append(mustNot, q)
+			} else {
+				filter = append(filter, q)
+			}
+			continue
+		}
+
+		// Group conditions on the same element of a nested array so that they
+		// must match the same object.
+		key := f.path + "|" + string(f.iter)
+		if expr.Negated || f.iter.IsWildcard() {
+			key = fmt.Sprintf("%v|%d", key, len(nested))
+		}
+
+		g, ok := nested[key]
+		if !ok {
+			g = &nestedGroup{path: f.path}
+			nested[key] = g
+			if expr.Negated {
+				mustNot = append(mustNot, g)
+			} else {
+				filter = append(filter, g)
+			}
+		}
+
+		g.queries = append(g.queries, q)
+	}
+
+	for i := range filter {
+		if g, ok := filter[i].(*nestedGroup); ok {
+			filter[i] = g.Query()
+		}
+	}
+
+	for i := range mustNot {
+		if g, ok := mustNot[i].(*nestedGroup); ok {
+			mustNot[i] = g.Query()
+		}
+	}
+
+	if len(filter) == 1 && len(mustNot) == 0 {
+		return filter[0].(Query), nil
+	}
+
+	b := Query{}
+
+	if len(filter) > 0 {
+		b["filter"] = filter
+	}
+
+	if len(mustNot) > 0 {
+		b["must_not"] = mustNot
+	}
+
+	return Query{"bool": b}, nil
+}
+
+// nestedGroup contains the conditions on a single element of a nested array.
+type nestedGroup struct {
+	path    string
+	queries []interface{}
+}
+
+func (g *nestedGroup) Query() Query {
+
+	var q interface{} = g.queries[0]
+
+	if len(g.queries) > 1 {
+		q = Query{"bool": Query{"filter": g.queries}}
+	}
+
+	return Query{"nested": Query{"path": g.path, "query": q}}
+}
+
+// expr translates a single expression. Negation is handled by the caller. If
+// the expression refers to a field inside a nested array, the field is
+// returned as well.
+func (s *state) expr(expr *ast.Expr) (Query, *field, error) {
+
+	if len(expr.With) > 0 {
+		return nil, nil, s.errorf(expr, "with keyword not supported")
+	}
+
+	switch terms := expr.Terms.(type) {
+	case *ast.Term:
+		q, err := s.rule(expr, terms)
+		return q, nil, err
+	case []*ast.Term:
+		return s.call(expr, terms)
+	}
+
+	return nil, nil, s.errorf(expr, "expression not supported")
+}
+
+// rule translates a reference to a rule in one of the support modules. The
+// rule bodies are combined with should.
+func (s *state) rule(expr *ast.Expr, term *ast.Term) (Query, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return nil, s.errorf(expr, "%v term not supported", ast.TypeName(term.Value))
+	}
+
+	rules, ok := s.support[ref.String()]
+	if !ok {
+		return nil, s.errorf(expr, "reference to %v not supported", ref)
+	}
+
+	bodies := make([]ast.Body, len(rules))
+
+	for i, rule := range rules {
+		if len(rule.Head.Args) > 0 || rule.Head.Key != nil || !ast.BooleanTerm(true).Equal(rule.Head.Value) || rule.Else != nil {
+			return nil, s.errorf(expr, "support rule %v not supported", ref)
+		}
+		bodies[i] = rule.Body
+	}
+
+	return s.queries(bodies)
+}
+
+func (s *state) call(expr *ast.Expr, terms []*ast.Term) (Query, *field, error) {
+
+	name := expr.Operator().String()
+	operands := terms[1:]
+
+	switch name {
+	case ast.Equality.Name, ast.Equal.Name, ast.NotEqual.Name:
+		if len(operands) != 2 {
+			break
+		}
+		f, value, err := s.fieldAndValue(expr, operands[0], operands[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		q := Query{"term": Query{f.name: value}}
+		if name == ast.NotEqual.Name {
+			// A must_not query on a multi-valued field would exclude documents
+			// that contain other values as well.
+			if f.multi {
+				return nil, nil, s.errorf(expr, "comparison of array elements with %v not supported", name)
+			}
+			q = Query{"bool": Query{"must_not": []interface{}{q}}}
+		}
+		return q, f, nil
+
+	case ast.LessThan.Name, ast.LessThanEq.Name, ast.GreaterThan.Name, ast.GreaterThanEq.Name:
+		if len(operands) != 2 {
+			break
+		}
+		op := rangeOps[name]
+		if _, ok := operands[1].Value.(ast.Ref); ok {
+			op = flipped[op]
+		}
+		f, value, err := s.fieldAndValue(expr, operands[0], operands[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		return Query{"range": Query{f.name: Query{op: value}}}, f, nil
+
+	case ast.StartsWith.Name, ast.EndsWith.Name, ast.Contains.Name:
+		if len(operands) != 2 {
+			break
+		}
+		f, err := s.field(expr, operands[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		str, ok := operands[1].Value.(ast.String)
+		if !ok {
+			return nil, nil, s.errorf(expr, "%v requires string constant", name)
+		}
+		switch name {
+		case ast.StartsWith.Name:
+			return Query{"prefix": Query{f.name: string(str)}}, f, nil
+		case ast.EndsWith.Name:
+			return Query{"wildcard": Query{f.name: "*" + wildcardEscaper.Replace(string(str))}}, f, nil
+		default:
+			return Query{"wildcard": Query{f.name: "*" + wildcardEscaper.Replace(string(str)) + "*"}}, f, nil
+		}
+
+	case ast.GlobMatch.Name:
+		if len(operands) != 3 {
+			break
+		}
+		return s.glob(expr, operands[0], operands[1], operands[2])
+	}
+
+	return nil, nil, s.errorf(expr, "call to %v not supported", name)
+}
+
+// glob translates glob.match calls into wildcard queries. Only patterns that
+// have the same meaning in Elasticsearch are supported, i.e., patterns without
+// delimiters that only contain * and ? wildcards.
+func (s *state) glob(expr *ast.Expr, pattern, delimiters, match *ast.Term) (Query, *field, error) {
+
+	str, ok := pattern.Value.(ast.String)
+	if !ok {
+		return nil, nil, s.errorf(expr, "glob.match requires string constant pattern")
+	}
+
+	if arr, ok := delimiters.Value.(ast.Array); !ok || len(arr) > 0 {
+		return nil, nil, s.errorf(expr, "glob.match with delimiters not supported")
+	}
+
+	if strings.ContainsAny(string(str), "[]{}") {
+		return nil, nil, s.errorf(expr, "glob.match pattern %v not supported", pattern)
+	}
+
+	f, err := s.field(expr, match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return Query{"wildcard": Query{f.name: strings.Replace(string(str), "**", "*", -1)}}, f, nil
+}
+
+// fieldAndValue returns the field and constant value from a pair of operands.
+// The field may appear on either side.
+func (s *state) fieldAndValue(expr *ast.Expr, a, b *ast.Term) (*field, interface{}, error) {
+
+	if _, ok := a.Value.(ast.Ref); !ok {
+		a, b = b, a
+	}
+
+	f, err := s.field(expr, a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := s.value(expr, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, value, nil
+}
+
+func (s *state) value(expr *ast.Expr, term *ast.Term) (interface{}, error) {
+	switch v := term.Value.(type) {
+	case ast.String:
+		return string(v), nil
+	case ast.Boolean:
+		return bool(v), nil
+	case ast.Number:
+		if i, ok := v.Int(); ok {
+			return int64(i), nil
+		}
+		f, _ := v.Float64()
+		return f, nil
+	}
+	return nil, s.errorf(expr, "%v term %v not supported", ast.TypeName(term.Value), term)
+}
+
+// field translates a reference of the form <root>.<index>[_].<field>... into a
+// field. A trailing variable refers to the elements of an array field, which
+// Elasticsearch indexes as a multi-valued field.
+func (s *state) field(expr *ast.Expr, term *ast.Term) (*field, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || !ref.HasPrefix(s.root) || len(ref) < len(s.root)+3 {
+		return nil, s.errorf(expr, "term %v is not a field reference", term)
+	}
+
+	if _, ok := ref[len(s.root)].Value.(ast.String); !ok {
+		return nil, s.errorf(expr, "term %v is not a field reference", term)
+	}
+
+	if _, ok := ref[len(s.root)+1].Value.(ast.Var); !ok {
+		return nil, s.errorf(expr, "term %v is not a field reference", term)
+	}
+
+	rest := ref[len(s.root)+2:]
+
+	f := &field{}
+
+	if _, ok := rest[len(rest)-1].Value.(ast.Var); ok {
+		rest = rest[:len(rest)-1]
+		f.multi = true
+	}
+
+	parts := make([]string, 0, len(rest))
+
+	for _, elem := range rest {
+		switch v := elem.Value.(type) {
+		case ast.String:
+			parts = append(parts, string(v))
+		case ast.Var:
+			if f.path != "" {
+				return nil, s.errorf(expr, "term %v refers to multiple levels of nested fields", term)
+			}
+			f.path = strings.Join(parts, ".")
+			f.iter = v
+		default:
+			return nil, s.errorf(expr, "term %v is not a field reference", term)
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, s.errorf(expr, "term %v is not a field reference", term)
+	}
+
+	f.name = strings.Join(parts, ".")
+
+	return f, nil
+}
+
+func (s *state) errorf(expr *ast.Expr, f string, a ...interface{}) error {
+	return &Error{
+		Message:  fmt.Sprintf(f, a...),
+		Expr:     expr,
+		Location: expr.Location,
+	}
+}
+
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
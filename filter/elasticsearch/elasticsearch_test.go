@@ -0,0 +1,223 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestTranslate(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		module string
+		input  interface{}
+	}{
+		{
+			note:   "match_none",
+			module: `allow { false }`,
+		},
+		{
+			note:   "match_all",
+			module: `allow { true }`,
+		},
+		{
+			note:   "term",
+			module: `allow { data.posts[_].author = input.user }`,
+			input:  map[string]interface{}{"user": "bob"},
+		},
+		{
+			note: "range",
+			module: `allow {
+				data.posts[x].likes > 10
+				data.posts[x].likes <= 20.5
+				input.min < data.posts[x].score
+			}`,
+			input: map[string]interface{}{"min": 3},
+		},
+		{
+			note: "not_equal",
+			module: `allow {
+				data.posts[_].author != "eve"
+			}`,
+		},
+		{
+			note: "string_matching",
+			module: `allow {
+				startswith(data.posts[x].title, "open")
+				endswith(data.posts[x].title, "*policy")
+				contains(data.posts[x].body, "agent")
+				glob.match("*.rego", [], data.posts[x].file)
+			}`,
+		},
+		{
+			note: "object_fields",
+			module: `allow {
+				data.posts[_].author.name = "bob"
+				data.posts[_].tags[_] = "public"
+			}`,
+		},
+		{
+			note: "nested",
+			module: `allow {
+				data.posts[_].comments[i].author = "bob"
+				data.posts[_].comments[i].score >= 3
+				data.posts[_].comments[_].flagged = false
+			}`,
+		},
+		{
+			note: "should",
+			module: `allow {
+				data.posts[_].author = "bob"
+			}
+
+			allow {
+				data.posts[x].public = true
+				data.posts[x].likes > 3
+			}`,
+		},
+		{
+			note: "must_not",
+			module: `allow {
+				data.posts[x].author = "bob"
+				not data.posts[x].draft = true
+				not deny
+			}
+
+			deny { data.posts[_].comments[_].flagged = true }
+			deny { data.posts[_].likes < 0 }`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			query, err := New().Translate(partial(t, tc.module, tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bs, err := json.MarshalIndent(query, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bs = append(bs, '\n')
+			golden := filepath.Join("testdata", tc.note+".json")
+
+			if *update {
+				if err := ioutil.WriteFile(golden, bs, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exp, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(bs, exp) {
+				t.Fatalf("Expected query:\n\n%s\nGot:\n\n%s", exp, bs)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		query string
+		exp   string
+	}{
+		{
+			note:  "unsupported built-in",
+			query: `re_match("a.*", data.posts[_].author)`,
+			exp:   `call to re_match not supported: re_match("a.*", data.posts[_].author)`,
+		},
+		{
+			note:  "not a field",
+			query: `data.posts = "bob"`,
+			exp:   `term data.posts is not a field reference: data.posts = "bob"`,
+		},
+		{
+			note:  "multiple levels of nesting",
+			query: `data.posts[_].comments[_].replies[_].author = "bob"`,
+			exp:   `refers to multiple levels of nested fields`,
+		},
+		{
+			note:  "not equal on array",
+			query: `data.posts[_].tags[_] != "public"`,
+			exp:   `comparison of array elements with neq not supported`,
+		},
+		{
+			note:  "glob delimiters",
+			query: `glob.match("*.rego", ["."], data.posts[_].file)`,
+			exp:   `glob.match with delimiters not supported`,
+		},
+		{
+			note:  "glob pattern",
+			query: `glob.match("[a-z].rego", [], data.posts[_].file)`,
+			exp:   `glob.match pattern "[a-z].rego" not supported`,
+		},
+		{
+			note:  "unknown reference",
+			query: `data.partial.p`,
+			exp:   `reference to data.partial.p not supported`,
+		},
+		{
+			note:  "unsupported term",
+			query: `data.posts[_].tags = ["a"]`,
+			exp:   `array term ["a"] not supported`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := New().Translate(&rego.PartialQueries{
+				Queries: []ast.Body{ast.MustParseBody(tc.query)},
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Fatalf("Expected error containing %q but got: %v", tc.exp, err)
+			}
+			if _, ok := err.(*Error); !ok {
+				t.Fatalf("Expected *Error but got %T", err)
+			}
+		})
+	}
+}
+
+func partial(t *testing.T, module string, input interface{}) *rego.PartialQueries {
+	t.Helper()
+
+	opts := []func(*rego.Rego){
+		rego.Query("data.test.allow = true"),
+		rego.Module("test.rego", "package test\n\n"+module),
+		rego.Unknowns([]string{"data.posts"}),
+	}
+
+	if input != nil {
+		opts = append(opts, rego.Input(input))
+	}
+
+	pq, err := rego.New(opts...).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
@@ -0,0 +1,447 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package sql translates the results of partial evaluation into SQL WHERE
+// clauses.
+//
+// The unknowns used for partial evaluation are expected to be tables under a
+// common root (data by default). References of the form
+// data.<table>[_].<column> are translated into column references. All
+// references to the same table are assumed to refer to the same row, so the
+// caller is responsible for joining the tables named in the clause.
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Dialect controls the syntax of the generated SQL.
+type Dialect struct {
+	// Placeholder returns the placeholder for the i-th argument. Arguments
+	// are numbered starting at 1.
+	Placeholder func(i int) string
+
+	// QuoteIdentifier quotes a table or column name.
+	QuoteIdentifier func(s string) string
+
+	// ArrayContains returns an expression that is true if the array column
+	// contains the value. If nil, membership tests on array columns are not
+	// supported.
+	ArrayContains func(column, value string) string
+
+	// LikeEscape is the string literal that specifies the backslash as the
+	// escape character of LIKE patterns. If empty, string matching is not
+	// supported.
+	LikeEscape string
+}
+
+// Built-in dialects.
+var (
+	Postgres = Dialect{
+		Placeholder: func(i int) string {
+			return "$" + strconv.Itoa(i)
+		},
+		QuoteIdentifier: quoteWith(`"`),
+		ArrayContains: func(column, value string) string {
+			return value + " = ANY(" + column + ")"
+		},
+		LikeEscape: `'\'`,
+	}
+
+	MySQL = Dialect{
+		Placeholder: func(int) string {
+			return "?"
+		},
+		QuoteIdentifier: quoteWith("`"),
+		// The backslash escapes characters in string literals by default.
+		LikeEscape: `'\\'`,
+	}
+
+	SQLite = Dialect{
+		Placeholder: func(int) string {
+			return "?"
+		},
+		QuoteIdentifier: quoteWith(`"`),
+		LikeEscape:      `'\'`,
+	}
+)
+
+// Clause represents a parameterized SQL boolean expression that can be used
+// in a WHERE clause.
+type Clause struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Error is returned when an expression cannot be translated into SQL.
+type Error struct {
+	Message  string
+	Expr     *ast.Expr
+	Location *ast.Location
+}
+
+func (e *Error) Error() string {
+
+	msg := fmt.Sprintf("%v: %v", e.Message, e.Expr)
+
+	if e.Location != nil {
+		if len(e.Location.File) > 0 {
+			return fmt.Sprintf("%v:%v: %v", e.Location.File, e.Location.Row, msg)
+		}
+		return fmt.Sprintf("%v:%v: %v", e.Location.Row, e.Location.Col, msg)
+	}
+
+	return msg
+}
+
+// Translator converts partial evaluation results into SQL.
+type Translator struct {
+	dialect Dialect
+	root    ast.Ref
+}
+
+// New returns a new Translator that generates SQL for Postgres with tables
+// rooted under data.
+func New() *Translator {
+	return &Translator{
+		dialect: Postgres,
+		root:    ast.DefaultRootRef,
+	}
+}
+
+// WithDialect sets the SQL dialect to generate.
+func (t *Translator) WithDialect(d Dialect) *Translator {
+	t.dialect = d
+	return t
+}
+
+// WithRoot sets the reference under which tables are found. For example, if
+// the root is data.db, then data.db.posts[_].author refers to the author
+// column of the posts table.
+func (t *Translator) WithRoot(root ast.Ref) *Translator {
+	t.root = root
+	return t
+}
+
+// Translate returns a clause that is satisfied by the rows for which the
+// partially evaluated queries are true. If there are no queries, the clause is
+// FALSE. If any query is empty, the clause is TRUE.
+func (t *Translator) Translate(pq *rego.PartialQueries) (*Clause, error) {
+
+	s := &state{
+		Translator: t,
+		support:    map[string][]*ast.Rule{},
+	}
+
+	for _, module := range pq.Support {
+		for _, rule := range module.Rules {
+			path := rule.Path().String()
+			s.support[path] = append(s.support[path], rule)
+		}
+	}
+
+	sql, err := s.queries(pq.Queries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Clause{SQL: sql, Args: s.args}, nil
+}
+
+// state holds the arguments accumulated during a single translation.
+type state struct {
+	*Translator
+	support map[string][]*ast.Rule
+	args    []interface{}
+}
+
+var comparisons = map[string]string{
+	ast.Equality.Name:      "=",
+	ast.Equal.Name:         "=",
+	ast.NotEqual.Name:      "<>",
+	ast.LessThan.Name:      "<",
+	ast.LessThanEq.Name:    "<=",
+	ast.GreaterThan.Name:   ">",
+	ast.GreaterThanEq.Name: ">=",
+	ast.StartsWith.Name:    "LIKE",
+	ast.EndsWith.Name:      "LIKE",
+	ast.Contains.Name:      "LIKE",
+}
+
+func (s *state) queries(queries []ast.Body) (string, error) {
+
+	if len(queries) == 0 {
+		return "FALSE", nil
+	}
+
+	for _, query := range queries {
+		if len(query) == 0 {
+			return "TRUE", nil
+		}
+	}
+
+	parts := make([]string, len(queries))
+
+	for i := range queries {
+		sql, err := s.body(queries[i])
+		if err != nil {
+			return "", err
+		}
+		if len(queries) > 1 && len(queries[i]) > 1 {
+			sql = "(" + sql + ")"
+		}
+		parts[i] = sql
+	}
+
+	return strings.Join(parts, " OR "), nil
+}
+
+func (s *state) body(body ast.Body) (string, error) {
+
+	parts := make([]string, len(body))
+
+	for i := range body {
+		sql, err := s.expr(body[i])
+		if err != nil {
+			return "", err
+		}
+		parts[i] = sql
+	}
+
+	return strings.Join(parts, " AND "), nil
+}
+
+func (s *state) expr(expr *ast.Expr) (string, error) {
+
+	if len(expr.With) > 0 {
+		return "", s.errorf(expr, "with keyword not supported")
+	}
+
+	var sql string
+	var err error
+
+	switch terms := expr.Terms.(type) {
+	case *ast.Term:
+		sql, err = s.rule(expr, terms)
+	case []*ast.Term:
+		sql, err = s.call(expr, terms)
+	default:
+		err = s.errorf(expr, "expression not supported")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if expr.Negated {
+		return "NOT (" + sql + ")", nil
+	}
+
+	return sql, nil
+}
+
+// rule translates a reference to a rule in one of the support modules. The
+// rule bodies are combined with OR.
+func (s *state) rule(expr *ast.Expr, term *ast.Term) (string, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return "", s.errorf(expr, "%v term not supported", ast.TypeName(term.Value))
+	}
+
+	rules, ok := s.support[ref.String()]
+	if !ok {
+		return "", s.errorf(expr, "reference to %v not supported", ref)
+	}
+
+	bodies := make([]ast.Body, len(rules))
+
+	for i, rule := range rules {
+		if len(rule.Head.Args) > 0 || rule.Head.Key != nil || !ast.BooleanTerm(true).Equal(rule.Head.Value) || rule.Else != nil {
+			return "", s.errorf(expr, "support rule %v not supported", ref)
+		}
+		bodies[i] = rule.Body
+	}
+
+	sql, err := s.queries(bodies)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bodies) > 1 {
+		return "(" + sql + ")", nil
+	}
+
+	return sql, nil
+}
+
+func (s *state) call(expr *ast.Expr, terms []*ast.Term) (string, error) {
+
+	name := expr.Operator().String()
+	op, ok := comparisons[name]
+
+	if !ok {
+		return "", s.errorf(expr, "call to %v not supported", name)
+	}
+
+	if len(terms) != 3 {
+		return "", s.errorf(expr, "call to %v with %d operands not supported", name, len(terms)-1)
+	}
+
+	a, b := terms[1], terms[2]
+
+	if op == "LIKE" {
+		return s.like(expr, name, a, b)
+	}
+
+	if op == "=" {
+		if isArrayColumn(a) {
+			return s.arrayContains(expr, a, b)
+		} else if isArrayColumn(b) {
+			return s.arrayContains(expr, b, a)
+		}
+	}
+
+	left, err := s.operand(expr, a)
+	if err != nil {
+		return "", err
+	}
+
+	right, err := s.operand(expr, b)
+	if err != nil {
+		return "", err
+	}
+
+	return left + " " + op + " " + right, nil
+}
+
+// like translates string matching built-ins into LIKE patterns. The pattern is
+// passed as an argument with wildcard characters escaped.
+func (s *state) like(expr *ast.Expr, name string, a, b *ast.Term) (string, error) {
+
+	if s.dialect.LikeEscape == "" {
+		return "", s.errorf(expr, "string matching not supported by dialect")
+	}
+
+	column, err := s.column(expr, a)
+	if err != nil {
+		return "", err
+	}
+
+	str, ok := b.Value.(ast.String)
+	if !ok {
+		return "", s.errorf(expr, "%v requires string constant", name)
+	}
+
+	pattern := likeEscaper.Replace(string(str))
+
+	switch name {
+	case ast.StartsWith.Name:
+		pattern = pattern + "%"
+	case ast.EndsWith.Name:
+		pattern = "%" + pattern
+	case ast.Contains.Name:
+		pattern = "%" + pattern + "%"
+	}
+
+	return column + " LIKE " + s.arg(pattern) + " ESCAPE " + s.dialect.LikeEscape, nil
+}
+
+// arrayContains translates membership in an array column, e.g.,
+// data.posts[_].tags[_] = "public".
+func (s *state) arrayContains(expr *ast.Expr, a, b *ast.Term) (string, error) {
+
+	if s.dialect.ArrayContains == nil {
+		return "", s.errorf(expr, "array membership not supported by dialect")
+	}
+
+	ref := a.Value.(ast.Ref)
+
+	column, err := s.column(expr, ast.NewTerm(ref[:len(ref)-1]))
+	if err != nil {
+		return "", err
+	}
+
+	value, err := s.operand(expr, b)
+	if err != nil {
+		return "", err
+	}
+
+	return s.dialect.ArrayContains(column, value), nil
+}
+
+func (s *state) operand(expr *ast.Expr, term *ast.Term) (string, error) {
+	switch v := term.Value.(type) {
+	case ast.Ref:
+		return s.column(expr, term)
+	case ast.String:
+		return s.arg(string(v)), nil
+	case ast.Boolean:
+		return s.arg(bool(v)), nil
+	case ast.Number:
+		if i, ok := v.Int(); ok {
+			return s.arg(int64(i)), nil
+		}
+		f, _ := v.Float64()
+		return s.arg(f), nil
+	}
+	return "", s.errorf(expr, "%v term %v not supported", ast.TypeName(term.Value), term)
+}
+
+// column translates a reference of the form <root>.<table>[_].<column> into a
+// quoted column name.
+func (s *state) column(expr *ast.Expr, term *ast.Term) (string, error) {
+
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || !ref.HasPrefix(s.root) || len(ref) != len(s.root)+3 {
+		return "", s.errorf(expr, "term %v is not a column reference", term)
+	}
+
+	table, ok1 := ref[len(s.root)].Value.(ast.String)
+	_, ok2 := ref[len(s.root)+1].Value.(ast.Var)
+	column, ok3 := ref[len(s.root)+2].Value.(ast.String)
+
+	if !ok1 || !ok2 || !ok3 {
+		return "", s.errorf(expr, "term %v is not a column reference", term)
+	}
+
+	return s.dialect.QuoteIdentifier(string(table)) + "." + s.dialect.QuoteIdentifier(string(column)), nil
+}
+
+func (s *state) arg(x interface{}) string {
+	s.args = append(s.args, x)
+	return s.dialect.Placeholder(len(s.args))
+}
+
+func (s *state) errorf(expr *ast.Expr, f string, a ...interface{}) error {
+	return &Error{
+		Message:  fmt.Sprintf(f, a...),
+		Expr:     expr,
+		Location: expr.Location,
+	}
+}
+
+// isArrayColumn returns true if term iterates over the elements of a column,
+// e.g., data.posts[_].tags[_].
+func isArrayColumn(term *ast.Term) bool {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || len(ref) < 2 {
+		return false
+	}
+	_, ok = ref[len(ref)-1].Value.(ast.Var)
+	return ok
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func quoteWith(q string) func(string) string {
+	return func(s string) string {
+		return q + strings.Replace(s, q, q+q, -1) + q
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+func TestTranslate(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		module  string
+		input   interface{}
+		expSQL  string
+		expArgs []interface{}
+	}{
+		{
+			note:   "undefined",
+			module: `allow { false }`,
+			expSQL: "FALSE",
+		},
+		{
+			note:   "unconditional",
+			module: `allow { true }`,
+			expSQL: "TRUE",
+		},
+		{
+			note:    "equality",
+			module:  `allow { data.posts[_].author = input.user }`,
+			input:   map[string]interface{}{"user": "bob"},
+			expSQL:  `$1 = "posts"."author"`,
+			expArgs: []interface{}{"bob"},
+		},
+		{
+			note: "comparisons",
+			module: `allow {
+				data.posts[x].likes > 10
+				data.posts[x].likes <= 20.5
+				data.posts[x].published == true
+				data.posts[x].author != "alice"
+			}`,
+			expSQL:  `"posts"."likes" > $1 AND "posts"."likes" <= $2 AND "posts"."published" = $3 AND "posts"."author" <> $4`,
+			expArgs: []interface{}{int64(10), 20.5, true, "alice"},
+		},
+		{
+			note: "joins",
+			module: `allow {
+				data.posts[_].author = data.users[_].name
+			}`,
+			expSQL: `"posts"."author" = "users"."name"`,
+		},
+		{
+			note: "string matching",
+			module: `allow {
+				startswith(data.posts[x].title, "100%")
+				endswith(data.posts[x].title, "_x")
+				contains(data.posts[x].body, "a\\b")
+			}`,
+			expSQL:  `"posts"."title" LIKE $1 ESCAPE '\' AND "posts"."title" LIKE $2 ESCAPE '\' AND "posts"."body" LIKE $3 ESCAPE '\'`,
+			expArgs: []interface{}{`100\%%`, `%\_x`, `%a\\b%`},
+		},
+		{
+			note: "disjunction",
+			module: `allow {
+				data.posts[_].author = "bob"
+			}
+
+			allow {
+				data.posts[x].public = true
+				data.posts[x].likes > 3
+			}`,
+			expSQL:  `"posts"."author" = $1 OR ("posts"."public" = $2 AND "posts"."likes" > $3)`,
+			expArgs: []interface{}{"bob", true, int64(3)},
+		},
+		{
+			note: "negation",
+			module: `allow {
+				data.posts[x].author = "bob"
+				not data.posts[x].draft = true
+			}`,
+			expSQL:  `"posts"."author" = $1 AND NOT ("posts"."draft" = $2)`,
+			expArgs: []interface{}{"bob", true},
+		},
+		{
+			note:    "array membership",
+			module:  `allow { data.posts[_].tags[_] = input.tag }`,
+			input:   map[string]interface{}{"tag": "public"},
+			expSQL:  `$1 = ANY("posts"."tags")`,
+			expArgs: []interface{}{"public"},
+		},
+		{
+			note: "negation with support rules",
+			module: `allow {
+				data.posts[_].author = "bob"
+				not deny
+			}
+
+			deny { data.posts[_].author == "eve" }
+			deny { data.posts[_].likes < 0 }`,
+			expSQL:  `"posts"."author" = $1 AND NOT (("posts"."author" = $2 OR "posts"."likes" < $3))`,
+			expArgs: []interface{}{"bob", "eve", int64(0)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			clause, err := New().Translate(partial(t, tc.module, tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if clause.SQL != tc.expSQL {
+				t.Fatalf("Expected SQL:\n\n%v\n\nGot:\n\n%v", tc.expSQL, clause.SQL)
+			}
+
+			if !reflect.DeepEqual(clause.Args, tc.expArgs) {
+				t.Fatalf("Expected args %v but got %v", tc.expArgs, clause.Args)
+			}
+		})
+	}
+}
+
+func TestTranslateDialect(t *testing.T) {
+
+	pq := &rego.PartialQueries{
+		Queries: []ast.Body{
+			ast.MustParseBody(`data.db.posts[_].author = "bob"; data.db.posts[_].likes > 1; startswith(data.db.posts[_].title, "a_")`),
+		},
+	}
+
+	tests := []struct {
+		dialect Dialect
+		exp     string
+	}{
+		{Postgres, `"posts"."author" = $1 AND "posts"."likes" > $2 AND "posts"."title" LIKE $3 ESCAPE '\'`},
+		{MySQL, "`posts`.`author` = ? AND `posts`.`likes` > ? AND `posts`.`title` LIKE ? ESCAPE '\\\\'"},
+		{SQLite, `"posts"."author" = ? AND "posts"."likes" > ? AND "posts"."title" LIKE ? ESCAPE '\'`},
+	}
+
+	for _, tc := range tests {
+		clause, err := New().WithDialect(tc.dialect).WithRoot(ast.MustParseRef("data.db")).Translate(pq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clause.SQL != tc.exp {
+			t.Fatalf("Expected %v but got %v", tc.exp, clause.SQL)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		query string
+		exp   string
+	}{
+		{
+			note:  "unsupported built-in",
+			query: `re_match("a.*", data.posts[_].author)`,
+			exp:   `call to re_match not supported: re_match("a.*", data.posts[_].author)`,
+		},
+		{
+			note:  "not a column",
+			query: `data.posts[_].author.name = "bob"`,
+			exp:   `term data.posts[_].author.name is not a column reference: data.posts[_].author.name = "bob"`,
+		},
+		{
+			note:  "unknown reference",
+			query: `data.partial.p`,
+			exp:   `reference to data.partial.p not supported: data.partial.p`,
+		},
+		{
+			note:  "non-constant pattern",
+			query: `startswith(data.posts[_].author, data.posts[_].title)`,
+			exp:   `startswith requires string constant`,
+		},
+		{
+			note:  "unsupported term",
+			query: `data.posts[_].tags = ["a"]`,
+			exp:   `array term ["a"] not supported`,
+		},
+		{
+			note:  "array membership",
+			query: `data.posts[_].tags[_] = "public"`,
+			exp:   `array membership not supported by dialect`,
+		},
+		{
+			note:  "with keyword",
+			query: `data.posts[_].author = "bob" with input as 1`,
+			exp:   `with keyword not supported`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := New().WithDialect(MySQL).Translate(&rego.PartialQueries{
+				Queries: []ast.Body{ast.MustParseBody(tc.query)},
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Fatalf("Expected error containing %q but got: %v", tc.exp, err)
+			}
+			if _, ok := err.(*Error); !ok {
+				t.Fatalf("Expected *Error but got %T", err)
+			}
+		})
+	}
+}
+
+func TestTranslateErrorLocation(t *testing.T) {
+
+	body := ast.MustParseBody(`re_match("a.*", data.posts[_].author)`)
+	body[0].Location.File = "policy.rego"
+
+	_, err := New().Translate(&rego.PartialQueries{Queries: []ast.Body{body}})
+	if err == nil || !strings.HasPrefix(err.Error(), "policy.rego:1: call to re_match not supported") {
+		t.Fatalf("Expected error with location but got: %v", err)
+	}
+}
+
+func partial(t *testing.T, module string, input interface{}) *rego.PartialQueries {
+	t.Helper()
+
+	opts := []func(*rego.Rego){
+		rego.Query("data.test.allow = true"),
+		rego.Module("test.rego", "package test\n\n"+module),
+		rego.Unknowns([]string{"data.posts", "data.users"}),
+	}
+
+	if input != nil {
+		opts = append(opts, rego.Input(input))
+	}
+
+	pq, err := rego.New(opts...).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
@@ -91,6 +91,13 @@ func AllRegos(paths []string) (*Result, error) {
 // paths while applying the given filters. If any filter returns true, the
 // file/directory is excluded.
 func Filtered(paths []string, filter Filter) (*Result, error) {
+	return FilteredWithBundleVerification(paths, filter, nil)
+}
+
+// FilteredWithBundleVerification behaves like Filtered except that bundles
+// found on the paths are verified using the given verification config. If the
+// config is nil, bundle signatures are not verified.
+func FilteredWithBundleVerification(paths []string, filter Filter, bvc *bundle.VerificationConfig) (*Result, error) {
 	return all(paths, filter, func(curr *Result, path string, depth int) error {
 
 		bs, err := ioutil.ReadFile(path)
@@ -98,7 +105,7 @@ func Filtered(paths []string, filter Filter) (*Result, error) {
 			return err
 		}
 
-		result, err := loadKnownTypes(path, bs)
+		result, err := loadKnownTypes(path, bs, bvc)
 		if err != nil {
 			if !isUnrecognizedFile(err) {
 				return err
@@ -270,7 +277,7 @@ func exclude(filters []Filter, path string, info os.FileInfo, depth int) bool {
 	return false
 }
 
-func loadKnownTypes(path string, bs []byte) (interface{}, error) {
+func loadKnownTypes(path string, bs []byte, bvc *bundle.VerificationConfig) (interface{}, error) {
 	switch filepath.Ext(path) {
 	case ".json":
 		return loadJSON(path, bs)
@@ -280,7 +287,7 @@ func loadKnownTypes(path string, bs []byte) (interface{}, error) {
 		return loadYAML(path, bs)
 	default:
 		if strings.HasSuffix(path, ".tar.gz") {
-			return loadBundle(bs)
+			return loadBundle(bs, bvc)
 		}
 	}
 	return nil, unrecognizedFile(path)
@@ -302,9 +309,16 @@ func loadFileForAnyType(path string, bs []byte) (interface{}, error) {
 	return nil, unrecognizedFile(path)
 }
 
-func loadBundle(bs []byte) (bundle.Bundle, error) {
-	br := bundle.NewReader(bytes.NewBuffer(bs)).IncludeManifestInData(true)
-	return br.Read()
+func loadBundle(bs []byte, bvc *bundle.VerificationConfig) (bundle.Bundle, error) {
+	br := bundle.NewReader(bytes.NewBuffer(bs)).IncludeManifestInData(true).WithBundleVerificationConfig(bvc)
+	b, err := br.Read()
+	if err != nil {
+		return b, err
+	}
+	if b.IsDelta() {
+		return b, fmt.Errorf("delta bundles cannot be loaded from files")
+	}
+	return b, nil
 }
 
 func loadRego(path string, bs []byte) (*RegoFile, error) {
@@ -187,7 +187,7 @@ func TestLoadBundle(t *testing.T) {
 		}
 
 		actualData := testBundle.Data
-		actualData["system"] = map[string]interface{}{"bundle": map[string]interface{}{"manifest": map[string]interface{}{"revision": ""}}}
+		actualData["system"] = map[string]interface{}{"bundle": map[string]interface{}{"manifest": map[string]interface{}{"revision": "", "roots": []interface{}{""}}}}
 
 		if !reflect.DeepEqual(actualData, loaded.Documents) {
 			t.Fatalf("Expected %v but got: %v", actualData, loaded.Documents)
@@ -200,6 +200,51 @@ func TestLoadBundle(t *testing.T) {
 
 }
 
+func TestLoadBundleWithVerification(t *testing.T) {
+
+	test.WithTempFS(nil, func(rootDir string) {
+
+		signed := bundle.Bundle{
+			Data: map[string]interface{}{"foo": "bar"},
+		}
+
+		if err := signed.GenerateSignature(bundle.NewSigningConfig("secret", bundle.HS256, ""), "foo"); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, b := range map[string]bundle.Bundle{"signed.tar.gz": signed, "unsigned.tar.gz": testBundle} {
+			f, err := os.Create(filepath.Join(rootDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bundle.Write(f, b); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+
+		keys := map[string]*bundle.KeyConfig{
+			"foo": {Key: "secret", Algorithm: bundle.HS256},
+		}
+
+		bvc := bundle.NewVerificationConfig(keys, "", "", nil)
+
+		loaded, err := FilteredWithBundleVerification([]string{filepath.Join(rootDir, "signed.tar.gz")}, nil, bvc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if loaded.Documents["foo"] != "bar" {
+			t.Fatalf("Expected signed bundle data but got: %v", loaded.Documents)
+		}
+
+		_, err = FilteredWithBundleVerification([]string{filepath.Join(rootDir, "unsigned.tar.gz")}, nil, bvc)
+		if err == nil || !strings.Contains(err.Error(), "bundle verification failed") {
+			t.Fatalf("Expected verification error but got: %v", err)
+		}
+	})
+}
+
 func TestLoadBundleSubDir(t *testing.T) {
 
 	test.WithTempFS(nil, func(rootDir string) {
@@ -6,13 +6,17 @@ package bundle
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/download"
 	"github.com/open-policy-agent/opa/util"
 )
 
-// ParseConfig validates the config and injects default values.
-func ParseConfig(config []byte, services []string) (*Config, error) {
+// ParseConfig validates the config and injects default values. The config
+// contains a single bundle definition. Use ParseBundlesConfig to configure
+// multiple bundles. The keys are used to verify bundle signatures.
+func ParseConfig(config []byte, services []string, keys map[string]*bundle.KeyConfig) (*Config, error) {
 
 	if config == nil {
 		return nil, nil
@@ -24,51 +28,164 @@ func ParseConfig(config []byte, services []string) (*Config, error) {
 		return nil, err
 	}
 
-	if err := parsedConfig.validateAndInjectDefaults(services); err != nil {
+	if err := parsedConfig.validateAndInjectDefaults(services, keys); err != nil {
 		return nil, err
 	}
 
 	return &parsedConfig, nil
 }
 
-// Config represents the configuration of the plugin.
+// ParseBundlesConfig validates the config and injects default values. The
+// config maps bundle names to bundle sources. The keys are used to verify
+// bundle signatures.
+func ParseBundlesConfig(config []byte, services []string, keys map[string]*bundle.KeyConfig) (*Config, error) {
+
+	if config == nil {
+		return nil, nil
+	}
+
+	var bundles map[string]*Source
+
+	if err := util.Unmarshal(config, &bundles); err != nil {
+		return nil, err
+	}
+
+	parsedConfig := Config{
+		Bundles: bundles,
+	}
+
+	if err := parsedConfig.validateAndInjectDefaults(services, keys); err != nil {
+		return nil, err
+	}
+
+	return &parsedConfig, nil
+}
+
+// Config represents the configuration of the plugin. The configuration either
+// defines a single bundle (deprecated) or a set of named bundle sources.
 type Config struct {
+	download.Config // Deprecated: Use `Bundles` instead.
+
+	Name    string                     `json:"name"`              // Deprecated: Use `Bundles` instead.
+	Service string                     `json:"service"`           // Deprecated: Use `Bundles` instead.
+	Prefix  *string                    `json:"prefix"`            // Deprecated: Use `Bundles` instead.
+	Persist bool                       `json:"persist"`           // Deprecated: Use `Bundles` instead.
+	Signing *bundle.VerificationConfig `json:"signing,omitempty"` // Deprecated: Use `Bundles` instead.
+
+	Bundles map[string]*Source `json:"-"`
+}
+
+// Source represents the configuration of a single bundle.
+type Source struct {
 	download.Config
 
-	Name    string  `json:"name"`
-	Service string  `json:"service"`
-	Prefix  *string `json:"prefix"`
+	Service  string                     `json:"service"`
+	Resource string                     `json:"resource"`
+	Signing  *bundle.VerificationConfig `json:"signing,omitempty"`
+	Persist  bool                       `json:"persist"`
 }
 
-func (c *Config) validateAndInjectDefaults(services []string) error {
+// IsMultiBundle returns true if the configuration defines named bundle
+// sources as opposed to a single (deprecated) bundle.
+func (c *Config) IsMultiBundle() bool {
+	return c.Name == ""
+}
 
-	if c.Name == "" {
-		return fmt.Errorf("invalid bundle name %q", c.Name)
-	}
+func (c *Config) validateAndInjectDefaults(services []string, keys map[string]*bundle.KeyConfig) error {
+
+	if c.Bundles == nil {
+
+		if c.Name == "" {
+			return fmt.Errorf("invalid bundle name %q", c.Name)
+		}
+
+		if c.Prefix == nil {
+			s := defaultBundlePathPrefix
+			c.Prefix = &s
+		}
 
-	if c.Prefix == nil {
-		s := defaultBundlePathPrefix
-		c.Prefix = &s
+		c.Bundles = map[string]*Source{
+			c.Name: &Source{
+				Config:   c.Config,
+				Service:  c.Service,
+				Resource: generateDownloadPath(*c.Prefix, c.Name),
+				Persist:  c.Persist,
+				Signing:  c.Signing,
+			},
+		}
 	}
 
-	if c.Service == "" && len(services) != 0 {
-		c.Service = services[0]
-	} else {
-		found := false
+	for name, source := range c.Bundles {
+
+		if name == "" {
+			return fmt.Errorf("invalid bundle name %q", name)
+		}
+
+		if source == nil {
+			return fmt.Errorf("missing configuration for bundle %q", name)
+		}
+
+		if source.Resource == "" {
+			source.Resource = generateDownloadPath(defaultBundlePathPrefix, name)
+		}
+
+		service, err := validateService(source.Service, services)
+		if err != nil {
+			return fmt.Errorf("%v in bundle %q", err, name)
+		}
+
+		source.Service = service
+
+		if err := source.Config.ValidateAndInjectDefaults(); err != nil {
+			return err
+		}
+
+		// Bundles must be signed if any keys are configured.
+		if source.Signing == nil && len(keys) > 0 {
+			source.Signing = bundle.NewVerificationConfig(nil, "", "", nil)
+		}
 
-		for _, svc := range services {
-			if svc == c.Service {
-				found = true
-				break
+		if source.Signing != nil {
+			if err := source.Signing.ValidateAndInjectDefaults(keys); err != nil {
+				return fmt.Errorf("invalid signing configuration in bundle %q: %v", name, err)
 			}
 		}
+	}
+
+	if c.Name != "" {
+		c.Service = c.Bundles[c.Name].Service
+		c.Config = c.Bundles[c.Name].Config
+		c.Signing = c.Bundles[c.Name].Signing
+	}
 
-		if !found {
-			return fmt.Errorf("invalid service name %q in bundle %q", c.Service, c.Name)
+	return nil
+}
+
+func validateService(service string, services []string) (string, error) {
+
+	if service == "" && len(services) != 0 {
+		return services[0], nil
+	}
+
+	for _, svc := range services {
+		if svc == service {
+			return service, nil
 		}
 	}
 
-	return c.ValidateAndInjectDefaults()
+	return "", fmt.Errorf("invalid service name %q", service)
+}
+
+func generateDownloadPath(prefix string, name string) string {
+	res := ""
+	trimmedPrefix := strings.Trim(prefix, "/")
+	if trimmedPrefix != "" {
+		res += trimmedPrefix + "/"
+	}
+
+	res += strings.Trim(name, "/")
+
+	return res
 }
 
 const (
@@ -7,6 +7,9 @@ package bundle
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
 )
 
 func TestConfigValidation(t *testing.T) {
@@ -39,7 +42,7 @@ func TestConfigValidation(t *testing.T) {
 
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("TestConfigValidation_case_%d", i), func(t *testing.T) {
-			_, err := ParseConfig([]byte(test.input), []string{"service1", "service2"})
+			_, err := ParseConfig([]byte(test.input), []string{"service1", "service2"}, nil)
 			if err != nil && !test.wantErr {
 				t.Fail()
 			}
@@ -54,7 +57,7 @@ func TestConfigValid(t *testing.T) {
 
 	in := `{"name": "a/b/c", "service": "service2", "prefix": "mybundle"}`
 
-	config, err := ParseConfig([]byte(in), []string{"service1", "service2"})
+	config, err := ParseConfig([]byte(in), []string{"service1", "service2"}, nil)
 	if err != nil {
 		t.Fail()
 	}
@@ -74,7 +77,7 @@ func TestConfigCorrupted(t *testing.T) {
 
 	in := `{"name": "a/b/c", "service": "service2", "prefix: mybundle"}`
 
-	config, err := ParseConfig([]byte(in), []string{"service1", "service2"})
+	config, err := ParseConfig([]byte(in), []string{"service1", "service2"}, nil)
 	if err != nil {
 		t.Fail()
 	}
@@ -89,3 +92,96 @@ func TestConfigCorrupted(t *testing.T) {
 		t.Fatalf("want %v got %v", "bundles", *(config.Prefix))
 	}
 }
+
+func TestParseBundlesConfig(t *testing.T) {
+
+	in := `{
+		"authz": {"service": "service2", "resource": "bundles/authz.tar.gz"},
+		"base": {"polling": {"min_delay_seconds": 10, "max_delay_seconds": 20}},
+		"signed": {"signing": {"keyid": "foo", "scope": "read", "exclude_files": ["*.txt"]}}
+	}`
+
+	keys := map[string]*bundle.KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}}
+
+	config, err := ParseBundlesConfig([]byte(in), []string{"service1", "service2"}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.IsMultiBundle() || len(config.Bundles) != 3 {
+		t.Fatalf("Expected three bundles but got: %v", config.Bundles)
+	}
+
+	if signing := config.Bundles["signed"].Signing; signing == nil || signing.KeyID != "foo" || signing.Scope != "read" || len(signing.Exclude) != 1 || signing.PublicKeys["foo"] != keys["foo"] {
+		t.Fatalf("Unexpected signing configuration: %+v", signing)
+	}
+
+	if authz := config.Bundles["authz"]; authz.Service != "service2" || authz.Resource != "bundles/authz.tar.gz" {
+		t.Fatalf("Unexpected authz source: %+v", authz)
+	}
+
+	if base := config.Bundles["base"]; base.Service != "service1" || base.Resource != "bundles/base" || *base.Polling.MinDelaySeconds != int64(10*time.Second) {
+		t.Fatalf("Unexpected base source: %+v", base)
+	}
+
+	for _, in := range []string{
+		`{"authz": {"service": "invalid"}}`,
+		`{"authz": null}`,
+		`{"authz": {"polling": {"min_delay_seconds": 10}}}`,
+		`{"authz": {"signing": {"keyid": "bar"}}}`,
+	} {
+		if _, err := ParseBundlesConfig([]byte(in), []string{"service1"}, keys); err == nil {
+			t.Fatalf("Expected error for %v", in)
+		}
+	}
+}
+
+func TestParseConfigLegacyBundle(t *testing.T) {
+
+	in := `{"name": "a/b/c", "service": "service2", "prefix": "mybundle"}`
+
+	config, err := ParseConfig([]byte(in), []string{"service1", "service2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.IsMultiBundle() {
+		t.Fatal("Expected legacy bundle configuration")
+	}
+
+	if source := config.Bundles["a/b/c"]; source == nil || source.Service != "service2" || source.Resource != "mybundle/a/b/c" {
+		t.Fatalf("Unexpected source: %+v", source)
+	}
+}
+
+func TestParseConfigRequiresSigningWithKeys(t *testing.T) {
+
+	keys := map[string]*bundle.KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}}
+
+	config, err := ParseBundlesConfig([]byte(`{"authz": {}}`), []string{"service1"}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signing := config.Bundles["authz"].Signing; signing == nil || signing.PublicKeys["foo"] != keys["foo"] {
+		t.Fatalf("Expected signing configuration with keys but got: %+v", signing)
+	}
+
+	config, err = ParseConfig([]byte(`{"name": "authz", "signing": {"keyid": "foo"}}`), []string{"service1"}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signing := config.Bundles["authz"].Signing; signing == nil || signing.KeyID != "foo" || signing.PublicKeys["foo"] != keys["foo"] {
+		t.Fatalf("Expected legacy signing configuration but got: %+v", signing)
+	}
+
+	config, err = ParseBundlesConfig([]byte(`{"authz": {}}`), []string{"service1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signing := config.Bundles["authz"].Signing; signing != nil {
+		t.Fatalf("Expected no signing configuration but got: %+v", signing)
+	}
+}
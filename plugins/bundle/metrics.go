@@ -0,0 +1,101 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"time"
+
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results reported in bundle metrics.
+const (
+	resultSuccess     = "success"
+	resultNotModified = "not_modified"
+	resultFailure     = "failure"
+)
+
+// pluginMetrics contains the Prometheus metrics exposed by the plugin. The
+// metrics are labelled with the bundle name.
+type pluginMetrics struct {
+	downloads          *prometheus.CounterVec
+	downloadDuration   *prometheus.HistogramVec
+	activations        *prometheus.CounterVec
+	activationDuration *prometheus.HistogramVec
+}
+
+func newPluginMetrics(manager *plugins.Manager) (*pluginMetrics, error) {
+
+	downloads, err := manager.RegisterCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bundle_downloads_total",
+			Help: "A counter of bundle downloads by result (success, not_modified, or failure).",
+		},
+		[]string{"name", "result"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	downloadDuration, err := manager.RegisterCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "bundle_download_duration_seconds",
+			Help: "A histogram of duration for bundle downloads.",
+		},
+		[]string{"name"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	activations, err := manager.RegisterCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bundle_activations_total",
+			Help: "A counter of bundle activations by result (success or failure).",
+		},
+		[]string{"name", "result"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	activationDuration, err := manager.RegisterCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "bundle_activation_duration_seconds",
+			Help: "A histogram of duration for bundle activations.",
+		},
+		[]string{"name"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pluginMetrics{
+		downloads:          downloads.(*prometheus.CounterVec),
+		downloadDuration:   downloadDuration.(*prometheus.HistogramVec),
+		activations:        activations.(*prometheus.CounterVec),
+		activationDuration: activationDuration.(*prometheus.HistogramVec),
+	}, nil
+}
+
+func (m *pluginMetrics) observeDownload(name, result string, dm metrics.Metrics) {
+	if m == nil {
+		return
+	}
+	m.downloads.WithLabelValues(name, result).Inc()
+	if dm != nil {
+		m.downloadDuration.WithLabelValues(name).Observe(time.Duration(dm.Timer(metrics.BundleRequest).Int64()).Seconds())
+	}
+}
+
+func (m *pluginMetrics) observeActivation(name, result string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.activations.WithLabelValues(name, result).Inc()
+	m.activationDuration.WithLabelValues(name).Observe(d.Seconds())
+}
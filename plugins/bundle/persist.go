@@ -0,0 +1,191 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	persistBundleFile = "bundle.tar.gz"
+	persistDeltaFile  = "delta-%d.tar.gz"
+	persistETagFile   = "etag"
+)
+
+// persistDir returns the directory that the named bundle is persisted in.
+func (p *Plugin) persistDir(name string) string {
+	dir := ""
+	if p.manager.Config != nil && p.manager.Config.PersistenceDirectory != nil {
+		dir = *p.manager.Config.PersistenceDirectory
+	}
+	return filepath.Join(dir, "bundles", url.PathEscape(name))
+}
+
+// saveBundle writes the activated bundle and its etag to disk. The bundle is
+// written as downloaded (raw) so that its signature can be verified when it is
+// loaded. Delta bundles are written next to the snapshot they apply to.
+func (p *Plugin) saveBundle(name string, b *bundle.Bundle, raw []byte, etag string) error {
+
+	if raw == nil {
+		var buf bytes.Buffer
+		if err := bundle.Write(&buf, *b); err != nil {
+			return err
+		}
+		raw = buf.Bytes()
+	}
+
+	dir := p.persistDir(name)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	deltas, err := persistedDeltas(dir)
+	if err != nil {
+		return err
+	}
+
+	if b.IsDelta() {
+		if _, err := os.Stat(filepath.Join(dir, persistBundleFile)); err != nil {
+			return fmt.Errorf("persisted snapshot not found: %v", err)
+		}
+		if err := util.WriteFileAtomic(filepath.Join(dir, fmt.Sprintf(persistDeltaFile, len(deltas))), raw); err != nil {
+			return err
+		}
+	} else {
+		// The deltas are removed in reverse order so that the remaining deltas
+		// are contiguous if the removal is interrupted.
+		for i := len(deltas) - 1; i >= 0; i-- {
+			if err := os.Remove(deltas[i]); err != nil {
+				return err
+			}
+		}
+		if err := util.WriteFileAtomic(filepath.Join(dir, persistBundleFile), raw); err != nil {
+			return err
+		}
+	}
+
+	return util.WriteFileAtomic(filepath.Join(dir, persistETagFile), []byte(etag))
+}
+
+// loadBundle reads the persisted copy of the named bundle and applies the
+// persisted deltas to it. The signatures of the persisted bundles are verified
+// if the bundle is configured with signing. If the bundle has not been
+// persisted, the returned bundle is nil.
+func (p *Plugin) loadBundle(ctx context.Context, name string) (*bundle.Bundle, string, error) {
+
+	dir := p.persistDir(name)
+
+	b, err := p.readPersisted(name, filepath.Join(dir, persistBundleFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	deltas, err := persistedDeltas(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, path := range deltas {
+		delta, err := p.readPersisted(name, path)
+		if err != nil {
+			return nil, "", err
+		}
+		if delta.Manifest.BaseRevision != b.Manifest.Revision {
+			return nil, "", revisionMismatchError{active: b.Manifest.Revision, base: delta.Manifest.BaseRevision}
+		}
+		if err := patchSnapshot(ctx, b, delta); err != nil {
+			return nil, "", err
+		}
+	}
+
+	etag, err := ioutil.ReadFile(filepath.Join(dir, persistETagFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+
+	return b, string(etag), nil
+}
+
+// readPersisted reads the persisted bundle at path and verifies it with the
+// signing configuration of the named bundle.
+func (p *Plugin) readPersisted(name string, path string) (*bundle.Bundle, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var bvc *bundle.VerificationConfig
+
+	if source, ok := p.config.Bundles[name]; ok {
+		bvc = source.Signing
+	}
+
+	b, err := bundle.NewReader(f).WithBundleVerificationConfig(bvc).Read()
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// persistedDeltas returns the paths of the persisted deltas in the order they
+// were activated.
+func persistedDeltas(dir string) ([]string, error) {
+
+	var paths []string
+
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, fmt.Sprintf(persistDeltaFile, i))
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return paths, nil
+			}
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+}
+
+// patchSnapshot applies the patch in the delta bundle to the snapshot.
+func patchSnapshot(ctx context.Context, snapshot *bundle.Bundle, delta *bundle.Bundle) error {
+
+	store := inmem.NewFromObject(snapshot.Data)
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return applyPatch(ctx, store, txn, delta.Patch)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	data, err := storage.ReadOne(ctx, store, storage.Path{})
+	if err != nil {
+		return err
+	}
+
+	snapshot.Data = data.(map[string]interface{})
+	snapshot.Manifest.Revision = delta.Manifest.Revision
+
+	return nil
+}
@@ -7,9 +7,11 @@ package bundle
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
@@ -22,25 +24,35 @@ import (
 
 // Plugin implements bundle activation.
 type Plugin struct {
-	config     Config
-	manager    *plugins.Manager             // plugin manager for storage and service clients
-	status     *Status                      // current plugin status
-	etag       string                       // etag on last successful activation
-	listeners  map[interface{}]func(Status) // listeners to send status updates to
-	downloader *download.Downloader
-	mtx        sync.Mutex
+	config        Config
+	manager       *plugins.Manager                         // plugin manager for storage and service clients
+	status        map[string]*Status                       // current status of each bundle
+	etags         map[string]string                        // etag on last successful activation of each bundle
+	listeners     map[interface{}]func(Status)             // listeners to send status updates to
+	bulkListeners map[interface{}]func(map[string]*Status) // listeners to send the statuses of all bundles to
+	downloaders   map[string]*download.Downloader          // downloader for each bundle
+	metrics       *pluginMetrics                           // prometheus metrics for downloads and activations
+	mtx           sync.Mutex
 }
 
 // New returns a new Plugin with the given config.
 func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 	p := &Plugin{
-		manager: manager,
-		config:  *parsedConfig,
-		status: &Status{
-			Name: parsedConfig.Name,
-		},
+		manager:     manager,
+		config:      *parsedConfig,
+		status:      map[string]*Status{},
+		etags:       map[string]string{},
+		downloaders: map[string]*download.Downloader{},
 	}
-	p.initDownloader()
+	for name := range p.config.Bundles {
+		p.status[name] = &Status{Name: name}
+		p.downloaders[name] = p.newDownloader(name, p.config.Bundles[name])
+	}
+	m, err := newPluginMetrics(manager)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"plugin": Name}).Errorf("Failed to register metrics: %v.", err)
+	}
+	p.metrics = m
 	return p
 }
 
@@ -59,40 +71,107 @@ func Lookup(manager *plugins.Manager) *Plugin {
 // from the configured service. When a new bundle is downloaded, the data and
 // policies are extracted and inserted into storage.
 func (p *Plugin) Start(ctx context.Context) error {
-	p.logInfo("Starting bundle downloader.")
+	p.logInfo("", "Starting bundle downloader.")
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
-	p.downloader.Start(ctx)
+	for name, d := range p.downloaders {
+		if p.config.Bundles[name].Persist {
+			p.activatePersisted(ctx, name)
+		}
+		d.Start(ctx)
+	}
 	return nil
 }
 
+// activatePersisted activates the persisted copy of the named bundle (if any)
+// so that policies and data are available before the first download
+// completes.
+func (p *Plugin) activatePersisted(ctx context.Context, name string) {
+
+	b, etag, err := p.loadBundle(ctx, name)
+	if err != nil {
+		p.logError(name, "Failed to load persisted bundle: %v", err)
+		return
+	} else if b == nil {
+		return
+	}
+
+	if err := p.activate(ctx, name, b); err != nil {
+		p.logError(name, "Persisted bundle activation failed: %v", err)
+		return
+	}
+
+	p.status[name].SetActivateSuccess(b.Manifest.Revision)
+	p.etags[name] = etag
+	p.downloaders[name].SetCache(etag)
+	p.logInfo(name, "Persisted bundle activated successfully.")
+}
+
 // Stop stops the plugin.
 func (p *Plugin) Stop(ctx context.Context) {
-	p.logInfo("Stopping bundle downloader.")
+	p.logInfo("", "Stopping bundle downloader.")
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
-	p.downloader.Stop(ctx)
+	for _, d := range p.downloaders {
+		d.Stop(ctx)
+	}
 }
 
 // Reconfigure notifies the plugin that it's configuration has changed.
+// Downloaders are restarted for bundles whose configuration changed. Bundles
+// that are no longer configured are stopped and their data and policies are
+// removed from storage.
 func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
 	newConfig := config.(*Config)
 	if reflect.DeepEqual(p.config, *newConfig) {
-		p.logDebug("Bundle downloader configuration unchanged.")
+		p.logDebug("", "Bundle downloader configuration unchanged.")
 		return
 	}
 
-	p.logInfo("Bundle downloader configuration changed. Restarting bundle downloader.")
-	p.config = *config.(*Config)
-	p.downloader.Stop(ctx)
-	p.initDownloader()
-	p.downloader.Start(ctx)
+	p.logInfo("", "Bundle downloader configuration changed. Restarting bundle downloaders.")
+
+	var removed []string
+
+	for name, d := range p.downloaders {
+		source, ok := newConfig.Bundles[name]
+		if ok && reflect.DeepEqual(source, p.config.Bundles[name]) {
+			continue
+		}
+		d.Stop(ctx)
+		delete(p.downloaders, name)
+		if !ok {
+			removed = append(removed, name)
+			delete(p.status, name)
+			delete(p.etags, name)
+		}
+	}
+
+	if len(removed) > 0 {
+		if err := p.deactivate(ctx, removed); err != nil {
+			p.logError("", "Bundle deactivation failed: %v", err)
+		}
+		p.notifyBulkListeners()
+	}
+
+	p.config = *newConfig
+
+	for name, source := range p.config.Bundles {
+		if _, ok := p.downloaders[name]; ok {
+			continue
+		}
+		if _, ok := p.status[name]; !ok {
+			p.status[name] = &Status{Name: name}
+		}
+		p.downloaders[name] = p.newDownloader(name, source)
+		p.downloaders[name].Start(ctx)
+	}
 }
 
 // Register a listener to receive status updates. The name must be comparable.
+// The listener is invoked with the status of each bundle when it changes.
 func (p *Plugin) Register(name interface{}, listener func(Status)) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
@@ -112,104 +191,192 @@ func (p *Plugin) Unregister(name interface{}) {
 	delete(p.listeners, name)
 }
 
-func (p *Plugin) initDownloader() {
-	client := p.manager.Client(p.config.Service)
-	path := p.generateDownloadPath(*(p.config.Prefix), p.config.Name)
-	p.downloader = download.New(p.config.Config, client, path).WithCallback(p.oneShot)
-}
+// RegisterBulkListener registers a listener to receive the statuses of all
+// configured bundles keyed by bundle name. The name must be comparable. The
+// listener is invoked when the status of any bundle changes and when bundles
+// are removed from the configuration.
+func (p *Plugin) RegisterBulkListener(name interface{}, listener func(map[string]*Status)) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
 
-func (p *Plugin) generateDownloadPath(prefix string, name string) string {
-	res := ""
-	trimmedPrefix := strings.Trim(prefix, "/")
-	if trimmedPrefix != "" {
-		res += trimmedPrefix + "/"
+	if p.bulkListeners == nil {
+		p.bulkListeners = map[interface{}]func(map[string]*Status){}
 	}
 
-	res += strings.Trim(name, "/")
+	p.bulkListeners[name] = listener
+}
+
+// UnregisterBulkListener unregisters a listener to stop receiving status
+// updates.
+func (p *Plugin) UnregisterBulkListener(name interface{}) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	delete(p.bulkListeners, name)
+}
 
-	return res
+func (p *Plugin) notifyBulkListeners() {
+	for _, listener := range p.bulkListeners {
+		statuses := make(map[string]*Status, len(p.status))
+		for name, s := range p.status {
+			cpy := *s
+			statuses[name] = &cpy
+		}
+		listener(statuses)
+	}
 }
 
-func (p *Plugin) oneShot(ctx context.Context, u download.Update) {
+func (p *Plugin) newDownloader(name string, source *Source) *download.Downloader {
+	client := p.manager.Client(source.Service)
+	d := download.New(source.Config, client, source.Resource).
+		WithCallback(func(ctx context.Context, u download.Update) {
+			p.oneShot(ctx, name, u)
+		}).
+		WithLogAttrs([][2]string{{"name", name}})
+	if source.Signing != nil {
+		d = d.WithBundleVerificationConfig(source.Signing)
+	}
+	return d
+}
+
+func (p *Plugin) oneShot(ctx context.Context, name string, u download.Update) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
-	p.process(ctx, u)
-	status := *p.status
+	if _, ok := p.status[name]; !ok {
+		p.status[name] = &Status{Name: name}
+	}
+
+	p.process(ctx, name, u)
+	status := *p.status[name]
 
 	for _, listener := range p.listeners {
 		listener(status)
 	}
+
+	p.notifyBulkListeners()
 }
 
-func (p *Plugin) process(ctx context.Context, u download.Update) {
+func (p *Plugin) process(ctx context.Context, name string, u download.Update) {
 
 	if u.Error != nil {
-		p.logError("Bundle download failed: %v", u.Error)
-		p.status.SetError(u.Error)
+		p.logError(name, "Bundle download failed: %v", u.Error)
+		p.status[name].SetError(u.Error)
+		p.metrics.observeDownload(name, resultFailure, u.Metrics)
 		return
 	}
 
 	if u.Bundle != nil {
-		p.status.SetDownloadSuccess()
-
-		if err := p.activate(ctx, u.Bundle); err != nil {
-			p.logError("Bundle activation failed: %v", err)
-			p.status.SetError(err)
+		p.status[name].SetDownloadSuccess()
+		p.metrics.observeDownload(name, resultSuccess, u.Metrics)
+
+		t0 := time.Now()
+
+		if err := p.activate(ctx, name, u.Bundle); err != nil {
+			p.metrics.observeActivation(name, resultFailure, time.Since(t0))
+			p.logError(name, "Bundle activation failed: %v", err)
+			p.status[name].SetError(err)
+			if _, ok := err.(revisionMismatchError); ok {
+				// Request a snapshot on the next download. The bundle service
+				// replies with a snapshot if the request does not carry an etag.
+				if d, ok := p.downloaders[name]; ok {
+					d.ClearCache()
+				}
+			}
 			return
 		}
 
-		p.status.SetError(nil)
-		p.status.SetActivateSuccess(u.Bundle.Manifest.Revision)
+		p.metrics.observeActivation(name, resultSuccess, time.Since(t0))
+
+		if source, ok := p.config.Bundles[name]; ok && source.Persist {
+			if err := p.saveBundle(name, u.Bundle, u.Raw, u.ETag); err != nil {
+				p.logError(name, "Failed to persist activated bundle: %v", err)
+			}
+		}
+
+		p.status[name].SetError(nil)
+		p.status[name].SetActivateSuccess(u.Bundle.Manifest.Revision)
 		if u.ETag != "" {
-			p.logInfo("Bundle downloaded and activated successfully. Etag updated to %v.", u.ETag)
+			p.logInfo(name, "Bundle downloaded and activated successfully. Etag updated to %v.", u.ETag)
 		} else {
-			p.logInfo("Bundle downloaded and activated successfully.")
+			p.logInfo(name, "Bundle downloaded and activated successfully.")
 		}
-		p.etag = u.ETag
+		p.etags[name] = u.ETag
 		return
 	}
 
-	if u.ETag == p.etag {
-		p.logDebug("Bundle download skipped, server replied with not modified.")
-		p.status.SetError(nil)
+	p.metrics.observeDownload(name, resultNotModified, u.Metrics)
+
+	if u.ETag == p.etags[name] {
+		p.logDebug(name, "Bundle download skipped, server replied with not modified.")
+		p.status[name].SetError(nil)
 		return
 	}
 }
 
-func (p *Plugin) activate(ctx context.Context, b *bundle.Bundle) error {
-	p.logDebug("Bundle activation in progress. Opening storage transaction.")
+// activate replaces the data and policies owned by the named bundle with the
+// contents of b. Only the subtrees of the data document under the bundle's
+// roots are replaced. The activation fails if the roots overlap with the roots
+// of another active bundle or if the resulting set of policies does not
+// compile.
+func (p *Plugin) activate(ctx context.Context, name string, b *bundle.Bundle) error {
+
+	if b.IsDelta() {
+		return p.activateDelta(ctx, name, b)
+	}
+
+	p.logDebug(name, "Bundle activation in progress. Opening storage transaction.")
+
+	b.Manifest.Init()
+
+	store := p.manager.Store
 
-	return storage.Txn(ctx, p.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
-		p.logDebug("Opened storage transaction (%v).", txn.ID())
-		defer p.logDebug("Closing storage transaction (%v).", txn.ID())
+	return storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		p.logDebug(name, "Opened storage transaction (%v).", txn.ID())
+		defer p.logDebug(name, "Closing storage transaction (%v).", txn.ID())
 
-		// write data from bundle into store, overwritting contents
-		if err := p.manager.Store.Write(ctx, txn, storage.AddOp, storage.Path{}, b.Data); err != nil {
+		manifests, err := p.readManifests(ctx, txn)
+		if err != nil {
 			return err
 		}
 
-		if err := p.writeManifest(ctx, txn, b.Manifest); err != nil {
-			return err
+		for other, m := range manifests {
+			if other == name {
+				continue
+			}
+			for _, r1 := range *m.Roots {
+				for _, r2 := range *b.Manifest.Roots {
+					if bundle.RootPathsOverlap(r1, r2) {
+						return fmt.Errorf("manifest root %q overlaps with root %q of bundle %q", r2, r1, other)
+					}
+				}
+			}
+		}
+
+		roots := append([]string{}, *b.Manifest.Roots...)
+
+		if m, ok := manifests[name]; ok {
+			roots = append(roots, *m.Roots...)
 		}
 
-		// load existing policy ids from store and delete
-		ids, err := p.manager.Store.ListPolicies(ctx, txn)
+		remaining, err := p.erase(ctx, txn, name, roots)
 		if err != nil {
 			return err
 		}
 
-		for _, id := range ids {
-			if err := p.manager.Store.DeletePolicy(ctx, txn, id); err != nil {
-				return err
-			}
+		if err := p.writeData(ctx, txn, *b.Manifest.Roots, b.Data); err != nil {
+			return err
+		}
+
+		if err := p.writeManifest(ctx, txn, name, b.Manifest); err != nil {
+			return err
 		}
 
 		// ensure that policies compile.
-		modules := map[string]*ast.Module{}
+		modules := remaining
 
 		for _, file := range b.Modules {
-			modules[file.Path] = file.Parsed
+			modules[p.policyID(name, file.Path)] = file.Parsed
 		}
 
 		compiler := ast.NewCompiler()
@@ -218,8 +385,161 @@ func (p *Plugin) activate(ctx context.Context, b *bundle.Bundle) error {
 		}
 
 		// write policies from bundle into store.
+		ids := make([]string, 0, len(b.Modules))
+
 		for _, file := range b.Modules {
-			if err := p.manager.Store.UpsertPolicy(ctx, txn, file.Path, file.Raw); err != nil {
+			id := p.policyID(name, file.Path)
+			if err := store.UpsertPolicy(ctx, txn, id, file.Raw); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		if !p.config.IsMultiBundle() {
+			return nil
+		}
+
+		return p.writePolicyIDs(ctx, txn, name, ids)
+	})
+}
+
+// activateDelta applies the patch contained in the delta bundle b to the data
+// owned by the named bundle. The patch is applied in a single transaction. The
+// activation fails if the base revision of the delta bundle does not match the
+// active revision of the named bundle or if the patch modifies data outside of
+// the roots of the active bundle. The active manifest is kept except for the
+// revision.
+func (p *Plugin) activateDelta(ctx context.Context, name string, b *bundle.Bundle) error {
+	p.logDebug(name, "Delta bundle activation in progress. Opening storage transaction.")
+
+	store := p.manager.Store
+
+	return storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		p.logDebug(name, "Opened storage transaction (%v).", txn.ID())
+		defer p.logDebug(name, "Closing storage transaction (%v).", txn.ID())
+
+		manifests, err := p.readManifests(ctx, txn)
+		if err != nil {
+			return err
+		}
+
+		m, ok := manifests[name]
+		if !ok || m.Revision != b.Manifest.BaseRevision {
+			return revisionMismatchError{active: m.Revision, base: b.Manifest.BaseRevision}
+		}
+
+		roots := make([]storage.Path, 0, len(*m.Roots))
+
+		for _, root := range *m.Roots {
+			path, ok := storage.ParsePathEscaped("/" + strings.Trim(root, "/"))
+			if !ok {
+				return fmt.Errorf("manifest root path invalid: %v", root)
+			}
+			roots = append(roots, path)
+		}
+
+		for i, op := range b.Patch.Data {
+			path, ok := storage.ParsePathEscaped(op.Path)
+			if !ok {
+				return fmt.Errorf("patch operation %d: invalid path %v", i, op.Path)
+			}
+			if !hasPrefix(path, roots) {
+				return fmt.Errorf("patch operation %d: path %v is outside of bundle roots", i, op.Path)
+			}
+		}
+
+		if err := applyPatch(ctx, store, txn, b.Patch); err != nil {
+			return err
+		}
+
+		m.Revision = b.Manifest.Revision
+
+		return p.writeManifest(ctx, txn, name, m)
+	})
+}
+
+// applyPatch applies the operations in patch to the data in store.
+func applyPatch(ctx context.Context, store storage.Store, txn storage.Transaction, patch bundle.Patch) error {
+
+	for i, op := range patch.Data {
+
+		path, ok := storage.ParsePathEscaped(op.Path)
+		if !ok {
+			return fmt.Errorf("patch operation %d: invalid path %v", i, op.Path)
+		}
+
+		var err error
+
+		switch op.Op {
+		case bundle.AddOp:
+			// Unlike JSON Patch, missing parent objects are created.
+			if len(path) > 0 {
+				if _, err := store.Read(ctx, txn, path[:len(path)-1]); storage.IsNotFound(err) {
+					if err := storage.MakeDir(ctx, store, txn, path[:len(path)-1]); err != nil {
+						return err
+					}
+				}
+			}
+			err = store.Write(ctx, txn, storage.AddOp, path, op.Value)
+		case bundle.RemoveOp:
+			err = store.Write(ctx, txn, storage.RemoveOp, path, nil)
+		case bundle.ReplaceOp:
+			err = store.Write(ctx, txn, storage.ReplaceOp, path, op.Value)
+		default:
+			err = fmt.Errorf("unsupported op %q", op.Op)
+		}
+
+		if err != nil {
+			return fmt.Errorf("patch operation %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// revisionMismatchError is returned when a delta bundle does not apply to the
+// active revision of the bundle.
+type revisionMismatchError struct {
+	active string
+	base   string
+}
+
+func (e revisionMismatchError) Error() string {
+	return fmt.Sprintf("delta bundle base revision %q does not match active revision %q", e.base, e.active)
+}
+
+func hasPrefix(path storage.Path, prefixes []storage.Path) bool {
+	for _, prefix := range prefixes {
+		if path.HasPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// deactivate removes the data, policies, and manifests of the named bundles
+// from storage.
+func (p *Plugin) deactivate(ctx context.Context, names []string) error {
+
+	store := p.manager.Store
+
+	return storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+
+		manifests, err := p.readManifests(ctx, txn)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			m, ok := manifests[name]
+			if !ok {
+				continue
+			}
+			if _, err := p.erase(ctx, txn, name, *m.Roots); err != nil {
+				return err
+			}
+			path := manifestPath(name)
+			if err := store.Write(ctx, txn, storage.RemoveOp, path[:len(path)-1], nil); err != nil && !storage.IsNotFound(err) {
 				return err
 			}
 		}
@@ -228,7 +548,123 @@ func (p *Plugin) activate(ctx context.Context, b *bundle.Bundle) error {
 	})
 }
 
-func (p *Plugin) writeManifest(ctx context.Context, txn storage.Transaction, m bundle.Manifest) error {
+// erase removes the data under roots and the policies owned by the named
+// bundle. The remaining policies are returned. When a single bundle is
+// configured, it owns all policies. Otherwise, the bundle owns the policies
+// recorded on its last activation.
+func (p *Plugin) erase(ctx context.Context, txn storage.Transaction, name string, roots []string) (map[string]*ast.Module, error) {
+
+	store := p.manager.Store
+
+	for _, root := range roots {
+		path, ok := storage.ParsePathEscaped("/" + strings.Trim(root, "/"))
+		if !ok {
+			return nil, fmt.Errorf("manifest root path invalid: %v", root)
+		}
+		if len(path) == 0 {
+			if err := store.Write(ctx, txn, storage.AddOp, path, map[string]interface{}{}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := store.Write(ctx, txn, storage.RemoveOp, path, nil); err != nil && !storage.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	owned, err := p.readPolicyIDs(ctx, txn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := store.ListPolicies(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := map[string]*ast.Module{}
+
+	for _, id := range ids {
+		if _, ok := owned[id]; ok || !p.config.IsMultiBundle() {
+			if err := store.DeletePolicy(ctx, txn, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		bs, err := store.GetPolicy(ctx, txn, id)
+		if err != nil {
+			return nil, err
+		}
+		module, err := ast.ParseModule(id, string(bs))
+		if err != nil {
+			return nil, err
+		}
+		remaining[id] = module
+	}
+
+	return remaining, nil
+}
+
+func (p *Plugin) writeData(ctx context.Context, txn storage.Transaction, roots []string, data map[string]interface{}) error {
+
+	store := p.manager.Store
+
+	for _, root := range roots {
+		path, ok := storage.ParsePathEscaped("/" + strings.Trim(root, "/"))
+		if !ok {
+			return fmt.Errorf("manifest root path invalid: %v", root)
+		}
+		if value, ok := lookup(path, data); ok {
+			if len(path) > 0 {
+				if err := storage.MakeDir(ctx, store, txn, path[:len(path)-1]); err != nil {
+					return err
+				}
+			}
+			if err := store.Write(ctx, txn, storage.AddOp, path, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readManifests returns the manifests of the active bundles keyed by bundle
+// name.
+func (p *Plugin) readManifests(ctx context.Context, txn storage.Transaction) (map[string]bundle.Manifest, error) {
+
+	result := map[string]bundle.Manifest{}
+
+	value, err := p.manager.Store.Read(ctx, txn, bundlesPath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	bundles, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("corrupt manifest data")
+	}
+
+	for name, value := range bundles {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var m bundle.Manifest
+		if err := util.UnmarshalJSON(util.MustMarshalJSON(obj["manifest"]), &m); err != nil {
+			return nil, fmt.Errorf("corrupt manifest data: %v", err)
+		}
+		m.Init()
+		result[name] = m
+	}
+
+	return result, nil
+}
+
+func (p *Plugin) writeManifest(ctx context.Context, txn storage.Transaction, name string, m bundle.Manifest) error {
 
 	var value interface{} = m
 
@@ -236,33 +672,137 @@ func (p *Plugin) writeManifest(ctx context.Context, txn storage.Transaction, m b
 		return err
 	}
 
-	if err := storage.MakeDir(ctx, p.manager.Store, txn, bundlePath); err != nil {
+	paths := []storage.Path{manifestPath(name)}
+
+	if !p.config.IsMultiBundle() {
+		paths = append(paths, legacyManifestPath)
+	}
+
+	for _, path := range paths {
+		if err := storage.MakeDir(ctx, p.manager.Store, txn, path[:len(path)-1]); err != nil {
+			return err
+		}
+		if err := p.manager.Store.Write(ctx, txn, storage.AddOp, path, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// policyID returns the storage ID of the policy at path in the named bundle.
+// Policies are namespaced by the bundle name so that bundles can contain
+// policies at the same path.
+func (p *Plugin) policyID(name string, path string) string {
+	if !p.config.IsMultiBundle() {
+		return path
+	}
+	return name + "/" + strings.TrimLeft(path, "/")
+}
+
+// readPolicyIDs returns the IDs of the policies written by the last
+// activation of the named bundle.
+func (p *Plugin) readPolicyIDs(ctx context.Context, txn storage.Transaction, name string) (map[string]struct{}, error) {
+
+	result := map[string]struct{}{}
+
+	value, err := p.manager.Store.Read(ctx, txn, policiesPath(name))
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	ids, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("corrupt policy id data")
+	}
+
+	for _, id := range ids {
+		s, ok := id.(string)
+		if !ok {
+			return nil, fmt.Errorf("corrupt policy id data")
+		}
+		result[s] = struct{}{}
+	}
+
+	return result, nil
+}
+
+func (p *Plugin) writePolicyIDs(ctx context.Context, txn storage.Transaction, name string, ids []string) error {
+
+	value := make([]interface{}, len(ids))
+	for i := range ids {
+		value[i] = ids[i]
+	}
+
+	path := policiesPath(name)
+
+	if err := storage.MakeDir(ctx, p.manager.Store, txn, path[:len(path)-1]); err != nil {
 		return err
 	}
 
-	return p.manager.Store.Write(ctx, txn, storage.AddOp, manifestPath, value)
+	return p.manager.Store.Write(ctx, txn, storage.AddOp, path, value)
+}
+
+// manifestPath returns the storage path of the named bundle's manifest.
+func manifestPath(name string) storage.Path {
+	path := make(storage.Path, 0, len(bundlesPath)+2)
+	path = append(path, bundlesPath...)
+	return append(path, name, "manifest")
+}
+
+// policiesPath returns the storage path of the IDs of the policies written by
+// the named bundle.
+func policiesPath(name string) storage.Path {
+	path := make(storage.Path, 0, len(bundlesPath)+2)
+	path = append(path, bundlesPath...)
+	return append(path, name, "policies")
 }
 
-func (p *Plugin) logError(fmt string, a ...interface{}) {
-	logrus.WithFields(p.logrusFields()).Errorf(fmt, a...)
+func lookup(path storage.Path, data map[string]interface{}) (interface{}, bool) {
+	if len(path) == 0 {
+		return data, data != nil
+	}
+	for i := 0; i < len(path)-1; i++ {
+		value, ok := data[path[i]]
+		if !ok {
+			return nil, false
+		}
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data = obj
+	}
+	value, ok := data[path[len(path)-1]]
+	return value, ok
 }
 
-func (p *Plugin) logInfo(fmt string, a ...interface{}) {
-	logrus.WithFields(p.logrusFields()).Infof(fmt, a...)
+func (p *Plugin) logError(name string, fmt string, a ...interface{}) {
+	logrus.WithFields(p.logrusFields(name)).Errorf(fmt, a...)
 }
 
-func (p *Plugin) logDebug(fmt string, a ...interface{}) {
-	logrus.WithFields(p.logrusFields()).Debugf(fmt, a...)
+func (p *Plugin) logInfo(name string, fmt string, a ...interface{}) {
+	logrus.WithFields(p.logrusFields(name)).Infof(fmt, a...)
 }
 
-func (p *Plugin) logrusFields() logrus.Fields {
-	return logrus.Fields{
+func (p *Plugin) logDebug(name string, fmt string, a ...interface{}) {
+	logrus.WithFields(p.logrusFields(name)).Debugf(fmt, a...)
+}
+
+func (p *Plugin) logrusFields(name string) logrus.Fields {
+	fields := logrus.Fields{
 		"plugin": Name,
-		"name":   p.config.Name,
 	}
+	if name != "" {
+		fields["name"] = name
+	}
+	return fields
 }
 
 var (
-	bundlePath   = storage.MustParsePath("/system/bundle")
-	manifestPath = storage.MustParsePath("/system/bundle/manifest")
+	bundlesPath        = storage.MustParsePath("/system/bundles")
+	legacyManifestPath = storage.MustParsePath("/system/bundle/manifest")
 )
@@ -8,23 +8,32 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/download"
+	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestPluginOneShot(t *testing.T) {
 
 	ctx := context.Background()
 	manager := getTestManager()
-	plugin := Plugin{manager: manager, status: &Status{}}
+	plugin := New(&Config{Name: "test"}, manager)
 
 	module := "package foo\n\ncorge=1"
 
@@ -40,7 +49,7 @@ func TestPluginOneShot(t *testing.T) {
 		},
 	}
 
-	plugin.oneShot(ctx, download.Update{Bundle: &b})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: &b})
 
 	txn := storage.NewTransactionOrDie(ctx, manager.Store)
 	defer manager.Store.Abort(ctx, txn)
@@ -61,7 +70,7 @@ func TestPluginOneShot(t *testing.T) {
 	}
 
 	data, err := manager.Store.Read(ctx, txn, storage.Path{})
-	expData := util.MustUnmarshalJSON([]byte(`{"foo": {"bar": 1, "baz": "qux"}, "system": {"bundle": {"manifest": {"revision": "quickbrownfaux"}}}}`))
+	expData := util.MustUnmarshalJSON([]byte(`{"foo": {"bar": 1, "baz": "qux"}, "system": {"bundle": {"manifest": {"revision": "quickbrownfaux", "roots": [""]}}, "bundles": {"test": {"manifest": {"revision": "quickbrownfaux", "roots": [""]}}}}}`))
 	if err != nil {
 		t.Fatal(err)
 	} else if !reflect.DeepEqual(data, expData) {
@@ -74,7 +83,7 @@ func TestPluginOneShotCompileError(t *testing.T) {
 
 	ctx := context.Background()
 	manager := getTestManager()
-	plugin := Plugin{manager: manager, status: &Status{}}
+	plugin := New(&Config{Name: "test"}, manager)
 
 	b1 := &bundle.Bundle{
 		Data: map[string]interface{}{"a": "b"},
@@ -86,7 +95,7 @@ func TestPluginOneShotCompileError(t *testing.T) {
 		},
 	}
 
-	plugin.oneShot(ctx, download.Update{Bundle: b1})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: b1})
 
 	b2 := &bundle.Bundle{
 		Modules: []bundle.ModuleFile{
@@ -97,7 +106,7 @@ func TestPluginOneShotCompileError(t *testing.T) {
 		},
 	}
 
-	plugin.oneShot(ctx, download.Update{Bundle: b2})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: b2})
 
 	txn := storage.NewTransactionOrDie(ctx, manager.Store)
 
@@ -116,7 +125,7 @@ func TestPluginOneShotActivatationRemovesOld(t *testing.T) {
 
 	ctx := context.Background()
 	manager := getTestManager()
-	plugin := Plugin{manager: manager, status: &Status{}}
+	plugin := New(&Config{Name: "test"}, manager)
 
 	module1 := `package example
 
@@ -135,7 +144,7 @@ func TestPluginOneShotActivatationRemovesOld(t *testing.T) {
 		},
 	}
 
-	plugin.oneShot(ctx, download.Update{Bundle: &b1})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: &b1})
 
 	module2 := `package example
 
@@ -154,7 +163,7 @@ func TestPluginOneShotActivatationRemovesOld(t *testing.T) {
 		},
 	}
 
-	plugin.oneShot(ctx, download.Update{Bundle: &b2})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: &b2})
 
 	err := storage.Txn(ctx, manager.Store, storage.TransactionParams{}, func(txn storage.Transaction) error {
 		ids, err := manager.Store.ListPolicies(ctx, txn)
@@ -183,7 +192,7 @@ func TestPluginListener(t *testing.T) {
 
 	ctx := context.Background()
 	manager := getTestManager()
-	plugin := Plugin{manager: manager, status: &Status{}}
+	plugin := New(&Config{Name: "test"}, manager)
 	ch := make(chan Status)
 
 	plugin.Register("test", func(status Status) {
@@ -208,7 +217,7 @@ func TestPluginListener(t *testing.T) {
 
 	// Test that initial bundle is ok. Defer to separate goroutine so we can
 	// check result with channel.
-	go plugin.oneShot(ctx, download.Update{Bundle: &b})
+	go plugin.oneShot(ctx, "test", download.Update{Bundle: &b})
 	s1 := <-ch
 
 	if s1.ActiveRevision != "quickbrownfaux" || s1.Code != "" {
@@ -225,7 +234,7 @@ func TestPluginListener(t *testing.T) {
 	}
 
 	// Test that next update is failed.
-	go plugin.oneShot(ctx, download.Update{Bundle: &b})
+	go plugin.oneShot(ctx, "test", download.Update{Bundle: &b})
 	s2 := <-ch
 
 	if s2.ActiveRevision != "quickbrownfaux" || s2.Code == "" || s2.Message == "" || len(s2.Errors) == 0 {
@@ -241,7 +250,7 @@ func TestPluginListener(t *testing.T) {
 	}
 
 	// Test that new update is successful.
-	go plugin.oneShot(ctx, download.Update{Bundle: &b})
+	go plugin.oneShot(ctx, "test", download.Update{Bundle: &b})
 	s3 := <-ch
 
 	if s3.ActiveRevision != "fancybluederg" || s3.Code != "" || s3.Message != "" || len(s3.Errors) != 0 {
@@ -249,7 +258,7 @@ func TestPluginListener(t *testing.T) {
 	}
 
 	// Test that empty download update results in status update.
-	go plugin.oneShot(ctx, download.Update{})
+	go plugin.oneShot(ctx, "test", download.Update{})
 	s4 := <-ch
 
 	if !reflect.DeepEqual(s3, s4) {
@@ -261,7 +270,7 @@ func TestPluginListener(t *testing.T) {
 func TestPluginListenerErrorClearedOn304(t *testing.T) {
 	ctx := context.Background()
 	manager := getTestManager()
-	plugin := Plugin{manager: manager, status: &Status{}}
+	plugin := New(&Config{Name: "test"}, manager)
 	ch := make(chan Status)
 
 	plugin.Register("test", func(status Status) {
@@ -276,7 +285,7 @@ func TestPluginListenerErrorClearedOn304(t *testing.T) {
 	}
 
 	// Test that initial bundle is ok.
-	go plugin.oneShot(ctx, download.Update{Bundle: &b})
+	go plugin.oneShot(ctx, "test", download.Update{Bundle: &b})
 	s1 := <-ch
 
 	if s1.ActiveRevision != "quickbrownfaux" || s1.Code != "" {
@@ -284,7 +293,7 @@ func TestPluginListenerErrorClearedOn304(t *testing.T) {
 	}
 
 	// Test that service error triggers failure notification.
-	go plugin.oneShot(ctx, download.Update{Error: fmt.Errorf("some error")})
+	go plugin.oneShot(ctx, "test", download.Update{Error: fmt.Errorf("some error")})
 	s2 := <-ch
 
 	if s2.ActiveRevision != "quickbrownfaux" || s2.Code == "" {
@@ -292,7 +301,7 @@ func TestPluginListenerErrorClearedOn304(t *testing.T) {
 	}
 
 	// Test that service recovery triggers healthy notification.
-	go plugin.oneShot(ctx, download.Update{})
+	go plugin.oneShot(ctx, "test", download.Update{})
 	s3 := <-ch
 
 	if s3.ActiveRevision != "quickbrownfaux" || s3.Code != "" {
@@ -300,6 +309,507 @@ func TestPluginListenerErrorClearedOn304(t *testing.T) {
 	}
 }
 
+func TestPluginOneShotMultiBundle(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+	plugin := New(&Config{}, manager)
+
+	if err := storage.WriteOne(ctx, manager.Store, storage.AddOp, storage.MustParsePath("/other"), "unowned"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Policies that were not written by a bundle are kept even if their IDs
+	// are prefixed by a bundle name.
+	if err := storage.Txn(ctx, manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		if err := manager.Store.UpsertPolicy(ctx, txn, "a/pushed.rego", []byte("package pushed.a")); err != nil {
+			return err
+		}
+		return manager.Store.UpsertPolicy(ctx, txn, "authz/v2/policy.rego", []byte("package pushed.authz"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	makeBundle := func(revision string, roots []string, data string, module string) *bundle.Bundle {
+		return &bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: revision, Roots: &roots},
+			Data:     util.MustUnmarshalJSON([]byte(data)).(map[string]interface{}),
+			Modules: []bundle.ModuleFile{
+				{
+					Path:   "/policy.rego",
+					Raw:    []byte(module),
+					Parsed: ast.MustParseModule(module),
+				},
+			},
+		}
+	}
+
+	plugin.oneShot(ctx, "a", download.Update{Bundle: makeBundle("a1", []string{"a", "x/y"}, `{"a": {"p": 1}, "x": {"y": 1}}`, "package a\n\nq = 1")})
+	plugin.oneShot(ctx, "b", download.Update{Bundle: makeBundle("b1", []string{"b"}, `{"b": {"p": 2}}`, "package b\n\nq = 2")})
+	plugin.oneShot(ctx, "authz", download.Update{Bundle: makeBundle("authz1", []string{"authz"}, `{}`, "package authz\n\nq = 4")})
+
+	// Replacing bundle "a" only affects data under its roots.
+	plugin.oneShot(ctx, "a", download.Update{Bundle: makeBundle("a2", []string{"a"}, `{"a": {"p": 3}}`, "package a\n\nq = 3")})
+
+	// Overlapping roots are rejected.
+	plugin.oneShot(ctx, "c", download.Update{Bundle: makeBundle("c1", []string{"b/c"}, `{}`, "package b.c")})
+
+	if plugin.status["a"].ActiveRevision != "a2" || plugin.status["b"].ActiveRevision != "b1" {
+		t.Fatalf("Unexpected status: %v, %v", plugin.status["a"], plugin.status["b"])
+	}
+
+	if plugin.status["c"].Code == "" || plugin.status["c"].ActiveRevision != "" {
+		t.Fatalf("Expected activation error but got: %v", plugin.status["c"])
+	}
+
+	txn := storage.NewTransactionOrDie(ctx, manager.Store)
+	defer manager.Store.Abort(ctx, txn)
+
+	ids, err := manager.Store.ListPolicies(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(ids)
+
+	if !reflect.DeepEqual(ids, []string{"a/policy.rego", "a/pushed.rego", "authz/policy.rego", "authz/v2/policy.rego", "b/policy.rego"}) {
+		t.Fatalf("Unexpected policy ids: %v", ids)
+	}
+
+	data, err := manager.Store.Read(ctx, txn, storage.Path{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// copy data to avoid modifying the store
+	cpy := map[string]interface{}{}
+	for k, v := range data.(map[string]interface{}) {
+		if k != "system" {
+			cpy[k] = v
+		}
+	}
+
+	expData := util.MustUnmarshalJSON([]byte(`{"a": {"p": 3}, "b": {"p": 2}, "x": {}, "other": "unowned"}`))
+	if !reflect.DeepEqual(cpy, expData) {
+		t.Fatalf("Bad data content. Exp:\n%v\n\nGot:\n\n%v", expData, cpy)
+	}
+
+	manifests, err := plugin.readManifests(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(manifests) != 3 || manifests["a"].Revision != "a2" || manifests["b"].Revision != "b1" {
+		t.Fatalf("Unexpected manifests: %v", manifests)
+	}
+}
+
+func TestPluginOneShotDelta(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+	plugin := New(&Config{}, manager)
+
+	roots := []string{"a"}
+
+	snapshot := &bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "r1", Roots: &roots},
+		Data:     util.MustUnmarshalJSON([]byte(`{"a": {"b": 1, "c": [1, 2], "d": "x"}}`)).(map[string]interface{}),
+	}
+
+	makeDelta := func(revision, base string, patch string) *bundle.Bundle {
+		var p bundle.Patch
+		if err := util.UnmarshalJSON([]byte(patch), &p); err != nil {
+			t.Fatal(err)
+		}
+		return &bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: revision, BaseRevision: base, Type: bundle.DeltaBundleType},
+			Patch:    p,
+		}
+	}
+
+	plugin.oneShot(ctx, "test", download.Update{Bundle: snapshot})
+	plugin.oneShot(ctx, "test", download.Update{Bundle: makeDelta("r2", "r1", `{"data": [
+		{"op": "add", "path": "/a/e/f", "value": true},
+		{"op": "add", "path": "/a/c/-", "value": 3},
+		{"op": "remove", "path": "/a/d"},
+		{"op": "replace", "path": "/a/b", "value": 2}
+	]}`)})
+
+	if plugin.status["test"].ActiveRevision != "r2" || plugin.status["test"].Code != "" {
+		t.Fatalf("Unexpected status: %v", plugin.status["test"])
+	}
+
+	exp := util.MustUnmarshalJSON([]byte(`{"b": 2, "c": [1, 2, 3], "e": {"f": true}}`))
+
+	assertData := func() {
+		t.Helper()
+		data, err := storage.ReadOne(ctx, manager.Store, storage.MustParsePath("/a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data, exp) {
+			t.Fatalf("Expected %v but got: %v", exp, data)
+		}
+	}
+
+	assertData()
+
+	// Failed operations leave the data unchanged.
+	plugin.oneShot(ctx, "test", download.Update{Bundle: makeDelta("r3", "r2", `{"data": [
+		{"op": "remove", "path": "/a/b"},
+		{"op": "remove", "path": "/a/missing"}
+	]}`)})
+
+	if plugin.status["test"].ActiveRevision != "r2" || plugin.status["test"].Code == "" {
+		t.Fatalf("Expected activation error but got: %v", plugin.status["test"])
+	}
+
+	assertData()
+
+	// Deltas outside of the active bundle roots are rejected.
+	plugin.oneShot(ctx, "test", download.Update{Bundle: makeDelta("r3", "r2", `{"data": [
+		{"op": "add", "path": "/x", "value": 1}
+	]}`)})
+
+	if plugin.status["test"].ActiveRevision != "r2" || plugin.status["test"].Code == "" {
+		t.Fatalf("Expected activation error but got: %v", plugin.status["test"])
+	}
+
+	// Deltas that do not apply to the active revision are rejected.
+	plugin.oneShot(ctx, "test", download.Update{Bundle: makeDelta("r4", "r3", `{"data": [
+		{"op": "replace", "path": "/a/b", "value": 4}
+	]}`)})
+
+	if plugin.status["test"].ActiveRevision != "r2" || !strings.Contains(plugin.status["test"].Message, "does not match active revision") {
+		t.Fatalf("Expected revision mismatch but got: %v", plugin.status["test"])
+	}
+
+	assertData()
+}
+
+func TestPluginPersistBundle(t *testing.T) {
+
+	ctx := context.Background()
+
+	test.WithTempFS(nil, func(dir string) {
+
+		config := &Config{
+			Bundles: map[string]*Source{
+				"test/a": {Persist: true},
+			},
+		}
+
+		newPlugin := func() *Plugin {
+			manager := getTestManager()
+			manager.Config.PersistenceDirectory = &dir
+			return New(config, manager)
+		}
+
+		module := "package a\n\np = 1"
+		roots := []string{"a"}
+
+		plugin := newPlugin()
+
+		plugin.oneShot(ctx, "test/a", download.Update{ETag: "e1", Bundle: &bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: "r1", Roots: &roots},
+			Data:     util.MustUnmarshalJSON([]byte(`{"a": {"b": 1}}`)).(map[string]interface{}),
+			Modules: []bundle.ModuleFile{
+				{
+					Path:   "/a.rego",
+					Raw:    []byte(module),
+					Parsed: ast.MustParseModule(module),
+				},
+			},
+		}})
+
+		plugin.oneShot(ctx, "test/a", download.Update{ETag: "e2", Bundle: &bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: "r2", BaseRevision: "r1", Type: bundle.DeltaBundleType},
+			Patch: bundle.Patch{Data: []bundle.PatchOperation{
+				{Op: bundle.AddOp, Path: "/a/c", Value: "x"},
+			}},
+		}})
+
+		if plugin.status["test/a"].Code != "" {
+			t.Fatalf("Unexpected status: %v", plugin.status["test/a"])
+		}
+
+		// A new plugin activates the persisted copy of the bundle.
+		plugin = newPlugin()
+		plugin.activatePersisted(ctx, "test/a")
+
+		if plugin.status["test/a"].ActiveRevision != "r2" || plugin.etags["test/a"] != "e2" {
+			t.Fatalf("Unexpected status: %v (etag: %v)", plugin.status["test/a"], plugin.etags["test/a"])
+		}
+
+		data, err := storage.ReadOne(ctx, plugin.manager.Store, storage.MustParsePath("/a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := util.MustUnmarshalJSON([]byte(`{"b": 1, "c": "x"}`))
+		if !reflect.DeepEqual(data, exp) {
+			t.Fatalf("Expected %v but got: %v", exp, data)
+		}
+
+		txn := storage.NewTransactionOrDie(ctx, plugin.manager.Store)
+		defer plugin.manager.Store.Abort(ctx, txn)
+
+		bs, err := plugin.manager.Store.GetPolicy(ctx, txn, "test/a/a.rego")
+		if err != nil || string(bs) != module {
+			t.Fatalf("Expected persisted policy but got: %v (err: %v)", string(bs), err)
+		}
+	})
+}
+
+func TestPluginPersistBundleVerification(t *testing.T) {
+
+	ctx := context.Background()
+
+	test.WithTempFS(nil, func(dir string) {
+
+		keys := map[string]*bundle.KeyConfig{"foo": {Key: "secret", Algorithm: bundle.HS256}}
+
+		config, err := ParseBundlesConfig([]byte(`{"test": {"persist": true, "signing": {"keyid": "foo"}}}`), []string{""}, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newPlugin := func() *Plugin {
+			manager := getTestManager()
+			manager.Config.PersistenceDirectory = &dir
+			return New(config, manager)
+		}
+
+		roots := []string{"a"}
+		b := bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: "r1", Roots: &roots},
+			Data:     util.MustUnmarshalJSON([]byte(`{"a": {"b": 1}}`)).(map[string]interface{}),
+		}
+
+		if err := b.GenerateSignature(bundle.NewSigningConfig("secret", bundle.HS256, ""), "foo"); err != nil {
+			t.Fatal(err)
+		}
+
+		var raw bytes.Buffer
+		if err := bundle.Write(&raw, b); err != nil {
+			t.Fatal(err)
+		}
+
+		plugin := newPlugin()
+		plugin.oneShot(ctx, "test", download.Update{ETag: "e1", Bundle: &b, Raw: raw.Bytes()})
+
+		plugin = newPlugin()
+		plugin.activatePersisted(ctx, "test")
+
+		if plugin.status["test"].ActiveRevision != "r1" {
+			t.Fatalf("Expected persisted bundle to be activated but got: %v", plugin.status["test"])
+		}
+
+		// Persisted bundles that fail verification are not activated.
+		b.Data = util.MustUnmarshalJSON([]byte(`{"a": {"b": 2}}`)).(map[string]interface{})
+		raw.Reset()
+		if err := bundle.Write(&raw, b); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(plugin.persistDir("test"), persistBundleFile), raw.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		plugin = newPlugin()
+		plugin.activatePersisted(ctx, "test")
+
+		if plugin.status["test"].ActiveRevision != "" {
+			t.Fatalf("Expected tampered bundle not to be activated but got: %v", plugin.status["test"])
+		}
+	})
+}
+
+func TestPluginDeactivate(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+	plugin := New(&Config{}, manager)
+
+	roots := []string{"a"}
+	module := "package a\n\nq = 1"
+
+	plugin.oneShot(ctx, "a", download.Update{Bundle: &bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "a1", Roots: &roots},
+		Data:     map[string]interface{}{"a": "x"},
+		Modules: []bundle.ModuleFile{
+			{
+				Path:   "/policy.rego",
+				Raw:    []byte(module),
+				Parsed: ast.MustParseModule(module),
+			},
+		},
+	}})
+
+	if err := plugin.deactivate(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := storage.NewTransactionOrDie(ctx, manager.Store)
+	defer manager.Store.Abort(ctx, txn)
+
+	ids, err := manager.Store.ListPolicies(ctx, txn)
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("Expected policies to be removed but got: %v (err: %v)", ids, err)
+	}
+
+	data, err := manager.Store.Read(ctx, txn, storage.Path{})
+	expData := util.MustUnmarshalJSON([]byte(`{"system": {"bundles": {}}}`))
+	if err != nil || !reflect.DeepEqual(data, expData) {
+		t.Fatalf("Expected data to be removed but got: %v (err: %v)", data, err)
+	}
+}
+
+func TestPluginMetrics(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+	plugin := New(&Config{}, manager)
+
+	m := metrics.New()
+	m.Timer(metrics.BundleRequest).Start()
+	m.Timer(metrics.BundleRequest).Stop()
+
+	roots := []string{"a"}
+
+	makeBundle := func(revision string, data string) *bundle.Bundle {
+		return &bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: revision, Roots: &roots},
+			Data:     util.MustUnmarshalJSON([]byte(data)).(map[string]interface{}),
+		}
+	}
+
+	plugin.oneShot(ctx, "a", download.Update{Bundle: makeBundle("a1", `{"a": 1}`), Metrics: m})
+	plugin.oneShot(ctx, "a", download.Update{Metrics: m})
+	plugin.oneShot(ctx, "a", download.Update{Error: fmt.Errorf("some error"), Metrics: m})
+
+	// The delta does not apply to the active revision so activation fails.
+	delta := makeBundle("a3", `{}`)
+	delta.Manifest.Type = bundle.DeltaBundleType
+	delta.Manifest.BaseRevision = "a2"
+	plugin.oneShot(ctx, "a", download.Update{Bundle: delta})
+
+	tests := []struct {
+		collector prometheus.Collector
+		exp       float64
+	}{
+		{plugin.metrics.downloads.WithLabelValues("a", resultSuccess), 2},
+		{plugin.metrics.downloads.WithLabelValues("a", resultNotModified), 1},
+		{plugin.metrics.downloads.WithLabelValues("a", resultFailure), 1},
+		{plugin.metrics.activations.WithLabelValues("a", resultSuccess), 1},
+		{plugin.metrics.activations.WithLabelValues("a", resultFailure), 1},
+	}
+
+	for i, tc := range tests {
+		if v := testutil.ToFloat64(tc.collector); v != tc.exp {
+			t.Errorf("Expected metric %d to be %v but got %v", i, tc.exp, v)
+		}
+	}
+
+	families, err := manager.PrometheusRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]uint64{}
+	for _, f := range families {
+		if f.GetType() == dto.MetricType_HISTOGRAM {
+			for _, metric := range f.GetMetric() {
+				counts[f.GetName()] += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	// Updates without metrics are not included in the download histogram.
+	if counts["bundle_download_duration_seconds"] != 3 || counts["bundle_activation_duration_seconds"] != 2 {
+		t.Fatalf("Unexpected histogram sample counts: %v", counts)
+	}
+}
+
+func TestPluginReconfigureKeyRotation(t *testing.T) {
+
+	ctx := context.Background()
+
+	manager, err := plugins.New([]byte(`{"services": {"default": {"url": "http://127.0.0.1:1"}}}`), "test-instance-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	makeConfig := func(secret string) *Config {
+		keys := map[string]*bundle.KeyConfig{"foo": {Key: secret, Algorithm: bundle.HS256}}
+		config, err := ParseBundlesConfig([]byte(`{"a": {"signing": {"keyid": "foo"}}}`), manager.Services(), keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	plugin := New(makeConfig("secret1"), manager)
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Stop(ctx)
+
+	d := plugin.downloaders["a"]
+
+	plugin.Reconfigure(ctx, makeConfig("secret1"))
+
+	if plugin.downloaders["a"] != d {
+		t.Fatal("Expected downloader to be kept when keys are unchanged")
+	}
+
+	plugin.Reconfigure(ctx, makeConfig("secret2"))
+
+	if plugin.downloaders["a"] == d {
+		t.Fatal("Expected downloader to be replaced when keys are rotated")
+	}
+
+	if key := plugin.config.Bundles["a"].Signing.PublicKeys["foo"]; key.Key != "secret2" {
+		t.Fatalf("Expected rotated key but got: %v", key)
+	}
+}
+
+func TestPluginBulkListenerReconfigure(t *testing.T) {
+	ctx := context.Background()
+
+	manager, err := plugins.New([]byte(`{"services": {"default": {"url": "http://127.0.0.1:1"}}}`), "test-instance-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	makeConfig := func(raw string) *Config {
+		config, err := ParseBundlesConfig([]byte(raw), manager.Services(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	plugin := New(makeConfig(`{"a": {}, "b": {}}`), manager)
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.Stop(ctx)
+
+	ch := make(chan map[string]*Status, 1)
+
+	plugin.RegisterBulkListener("test", func(statuses map[string]*Status) {
+		ch <- statuses
+	})
+
+	plugin.Reconfigure(ctx, makeConfig(`{"a": {}}`))
+
+	statuses := <-ch
+
+	if len(statuses) != 1 || statuses["a"] == nil {
+		t.Fatalf("Expected status of bundle a only but got: %v", statuses)
+	}
+}
+
 func getTestManager() *plugins.Manager {
 	store := inmem.New()
 	manager, err := plugins.New(nil, "test-instance-id", store)
@@ -309,8 +819,7 @@ func getTestManager() *plugins.Manager {
 	return manager
 }
 
-func TestInitDownloader(t *testing.T) {
-	plugin := Plugin{}
+func TestGenerateDownloadPath(t *testing.T) {
 
 	testCases := []struct {
 		prefix string
@@ -340,7 +849,7 @@ func TestInitDownloader(t *testing.T) {
 	}
 	for i, test := range testCases {
 		t.Run(fmt.Sprintf("case_%d", i), func(t *testing.T) {
-			if out := plugin.generateDownloadPath(test.prefix, test.name); out != test.result {
+			if out := generateDownloadPath(test.prefix, test.name); out != test.result {
 				t.Fatalf("want %v got %v", test.result, out)
 			}
 		})
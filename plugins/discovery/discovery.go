@@ -284,11 +284,34 @@ func getPluginSet(factories map[string]plugins.Factory, manager *plugins.Manager
 	}
 
 	// Parse and validate bundle/logs/status configurations.
-	bundleConfig, err := bundle.ParseConfig(config.Bundle, manager.Services())
+	if config.Bundle != nil && config.Bundles != nil {
+		return nil, fmt.Errorf("invalid configuration: bundle and bundles cannot be specified together")
+	}
+
+	// Keys in the new configuration replace the keys with the same ID so that
+	// rotated keys are used to verify subsequent bundle downloads.
+	keys, err := bundleApi.ParseKeysConfig(config.Keys)
 	if err != nil {
 		return nil, err
 	}
 
+	publicKeys := manager.PublicKeys()
+	for id, key := range keys {
+		publicKeys[id] = key
+	}
+
+	bundleConfig, err := bundle.ParseConfig(config.Bundle, manager.Services(), publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Bundles != nil {
+		bundleConfig, err = bundle.ParseBundlesConfig(config.Bundles, manager.Services(), publicKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	decisionLogsConfig, err := logs.ParseConfig(config.DecisionLogs, manager.Services(), pluginNames)
 	if err != nil {
 		return nil, err
@@ -391,7 +414,7 @@ func registerBundleStatusUpdates(m *plugins.Manager) {
 		return
 	}
 	type pluginlistener string
-	bp.Register(pluginlistener(status.Name), func(s bundle.Status) {
-		sp.UpdateBundleStatus(s)
+	bp.RegisterBulkListener(pluginlistener(status.Name), func(s map[string]*bundle.Status) {
+		sp.BulkUpdateBundleStatus(s)
 	})
 }
@@ -151,6 +151,94 @@ func TestProcessBundle(t *testing.T) {
 		t.Fatal("Expected error but got success")
 	}
 
+	updatedBundle = makeDataBundle(3, `
+		{
+			"config": {
+				"bundles": {"test1": {}, "test2": {"resource": "bundles/test2.tar.gz"}}
+			}
+		}
+	`)
+
+	_, ps, err = processBundle(ctx, manager, nil, updatedBundle, "data.config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ps.Start) != 0 || len(ps.Reconfig) != 1 {
+		t.Fatalf("Expected exactly one reconfigure event but got %v", ps)
+	}
+
+	updatedBundle = makeDataBundle(4, `
+		{
+			"config": {
+				"bundle": {"name": "test1"},
+				"bundles": {"test2": {}}
+			}
+		}
+	`)
+
+	_, _, err = processBundle(ctx, manager, nil, updatedBundle, "data.config")
+	if err == nil {
+		t.Fatal("Expected error but got success")
+	}
+
+}
+
+func TestProcessBundleKeyRotation(t *testing.T) {
+
+	ctx := context.Background()
+
+	manager, err := plugins.New([]byte(`{
+		"services": {
+			"default": {
+				"url": "http://localhost:8181"
+			}
+		},
+		"keys": {"foo": {"key": "secret1", "algorithm": "HS256"}}
+	}`), "test-id", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initialBundle := makeDataBundle(1, `
+		{
+			"config": {
+				"bundles": {"test1": {"signing": {"keyid": "foo"}}}
+			}
+		}
+	`)
+
+	_, ps, err := processBundle(ctx, manager, nil, initialBundle, "data.config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ps.Start) != 1 {
+		t.Fatalf("Expected exactly one start event but got %v", ps)
+	}
+
+	updatedBundle := makeDataBundle(2, `
+		{
+			"config": {
+				"bundles": {"test1": {"signing": {"keyid": "foo"}}},
+				"keys": {"foo": {"key": "secret2", "algorithm": "HS256"}}
+			}
+		}
+	`)
+
+	_, ps, err = processBundle(ctx, manager, nil, updatedBundle, "data.config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ps.Reconfig) != 1 {
+		t.Fatalf("Expected exactly one reconfigure event but got %v", ps)
+	}
+
+	signing := ps.Reconfig[0].Config.(*bundle.Config).Bundles["test1"].Signing
+	if signing == nil || signing.PublicKeys["foo"].Key != "secret2" {
+		t.Fatalf("Expected rotated key but got: %+v", signing)
+	}
 }
 
 type testFactory struct {
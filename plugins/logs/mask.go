@@ -0,0 +1,261 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	defaultMaskDecisionPath = "/system/log/mask"
+
+	maskOpRemove = "remove"
+	maskOpUpsert = "upsert"
+
+	maskRootInput  = "input"
+	maskRootResult = "result"
+)
+
+// maskRule represents a single operation returned by the mask decision. The
+// path is a JSON pointer rooted at the input or result of the event.
+type maskRule struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+	parts []string
+}
+
+// newMaskRule returns a maskRule for the op and path. The path must refer to
+// the input or result of the event.
+func newMaskRule(op, path string, value interface{}) (*maskRule, error) {
+
+	switch op {
+	case maskOpRemove, maskOpUpsert:
+	default:
+		return nil, fmt.Errorf("mask rule: unsupported op %q", op)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("mask rule: path must begin with '/': %q", path)
+	}
+
+	parts := strings.Split(path[1:], "/")
+	for i := range parts {
+		parts[i] = strings.Replace(strings.Replace(parts[i], "~1", "/", -1), "~0", "~", -1)
+	}
+
+	switch parts[0] {
+	case maskRootInput, maskRootResult:
+	default:
+		return nil, fmt.Errorf("mask rule: path must begin with /input or /result: %q", path)
+	}
+
+	return &maskRule{Op: op, Path: path, Value: value, parts: parts}, nil
+}
+
+// newMaskRules returns the rules contained in the value produced by the mask
+// decision. Strings are treated as paths to remove. Objects specify the op,
+// path, and value explicitly.
+func newMaskRules(x interface{}) ([]*maskRule, error) {
+
+	items, ok := x.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mask decision must be a set or array but got %T", x)
+	}
+
+	rules := make([]*maskRule, 0, len(items))
+
+	for _, item := range items {
+		var rule *maskRule
+		var err error
+
+		switch item := item.(type) {
+		case string:
+			rule, err = newMaskRule(maskOpRemove, item, nil)
+		case map[string]interface{}:
+			op, _ := item["op"].(string)
+			path, _ := item["path"].(string)
+			rule, err = newMaskRule(op, path, item["value"])
+		default:
+			err = fmt.Errorf("mask rule: must be a string or object but got %T", item)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Mask applies the rule to the event. Mask returns false if the rule did not
+// modify the event (e.g., because the path does not exist.)
+func (r *maskRule) Mask(event *EventV1) bool {
+
+	var root **interface{}
+
+	switch r.parts[0] {
+	case maskRootInput:
+		root = &event.Input
+	case maskRootResult:
+		root = &event.Result
+	}
+
+	if *root == nil {
+		return false
+	}
+
+	if len(r.parts) == 1 {
+		switch r.Op {
+		case maskOpRemove:
+			*root = nil
+		case maskOpUpsert:
+			var value interface{} = r.Value
+			*root = &value
+		}
+		return true
+	}
+
+	node := **root
+
+	for i := 1; i < len(r.parts)-1; i++ {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		child, ok := obj[r.parts[i]]
+		if !ok {
+			if r.Op == maskOpRemove {
+				return false
+			}
+			child = map[string]interface{}{}
+			obj[r.parts[i]] = child
+		}
+		node = child
+	}
+
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	key := r.parts[len(r.parts)-1]
+
+	switch r.Op {
+	case maskOpRemove:
+		if _, ok := obj[key]; !ok {
+			return false
+		}
+		delete(obj, key)
+	case maskOpUpsert:
+		obj[key] = r.Value
+	}
+
+	return true
+}
+
+// preparedMask is the mask decision query prepared for evaluation with a
+// specific compiler.
+type preparedMask struct {
+	compiler *ast.Compiler
+	query    rego.PreparedEvalQuery
+}
+
+// prepareMask returns the mask decision query prepared for evaluation with
+// compiler. The query is prepared again when the compiler or configuration
+// changes.
+func (p *Plugin) prepareMask(ctx context.Context, compiler *ast.Compiler) (rego.PreparedEvalQuery, error) {
+
+	p.maskMtx.Lock()
+	defer p.maskMtx.Unlock()
+
+	if p.mask != nil && p.mask.compiler == compiler {
+		return p.mask.query, nil
+	}
+
+	pq, err := rego.New(
+		rego.Query(p.config.maskDecisionRef.String()),
+		rego.Compiler(compiler),
+		rego.Store(p.manager.Store),
+	).PrepareForEval(ctx)
+
+	if err != nil {
+		return pq, err
+	}
+
+	p.mask = &preparedMask{compiler: compiler, query: pq}
+
+	return pq, nil
+}
+
+// maskEvent evaluates the mask decision against the event and applies the
+// resulting rules. The input and result are copied before they are modified
+// because they may be shared with the caller.
+func (p *Plugin) maskEvent(ctx context.Context, event *EventV1) error {
+
+	compiler := p.manager.GetCompiler()
+	if compiler == nil {
+		return nil
+	}
+
+	var input interface{} = event
+	if err := util.RoundTrip(&input); err != nil {
+		return err
+	}
+
+	pq, err := p.prepareMask(ctx, compiler)
+	if err != nil {
+		return err
+	}
+
+	rs, err := pq.Eval(ctx, rego.EvalInput(input))
+
+	if err != nil {
+		return err
+	} else if len(rs) == 0 {
+		return nil
+	}
+
+	rules, err := newMaskRules(rs[0].Expressions[0].Value)
+	if err != nil {
+		return err
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	for _, doc := range []**interface{}{&event.Input, &event.Result} {
+		if *doc != nil {
+			var cpy interface{} = **doc
+			if err := util.RoundTrip(&cpy); err != nil {
+				return err
+			}
+			*doc = &cpy
+		}
+	}
+
+	for _, rule := range rules {
+		if !rule.Mask(event) {
+			continue
+		}
+		switch rule.Op {
+		case maskOpRemove:
+			event.Erased = append(event.Erased, rule.Path)
+		case maskOpUpsert:
+			event.Masked = append(event.Masked, rule.Path)
+		}
+	}
+
+	return nil
+}
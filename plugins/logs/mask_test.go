@@ -0,0 +1,290 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/server"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestMaskRules(t *testing.T) {
+
+	tests := []struct {
+		note      string
+		rules     string
+		input     string
+		result    string
+		expInput  string
+		expResult string
+		expErased []string
+		expMasked []string
+		wantErr   bool
+	}{
+		{
+			note:      "erase input field",
+			rules:     `["/input/password"]`,
+			input:     `{"user": "bob", "password": "secret"}`,
+			expInput:  `{"user": "bob"}`,
+			expErased: []string{"/input/password"},
+		},
+		{
+			note:      "erase nested field",
+			rules:     `["/input/a/b", "/input/a/missing", "/input/x/y"]`,
+			input:     `{"a": {"b": 1, "c": 2}, "x": 1}`,
+			expInput:  `{"a": {"c": 2}, "x": 1}`,
+			expErased: []string{"/input/a/b"},
+		},
+		{
+			note:      "erase whole result",
+			rules:     `["/result"]`,
+			input:     `{}`,
+			result:    `{"allow": true}`,
+			expInput:  `{}`,
+			expErased: []string{"/result"},
+		},
+		{
+			note:      "escaped path",
+			rules:     `["/input/a~1b", "/input/c~0d"]`,
+			input:     `{"a/b": 1, "c~d": 2, "e": 3}`,
+			expInput:  `{"e": 3}`,
+			expErased: []string{"/input/a~1b", "/input/c~0d"},
+		},
+		{
+			note:      "upsert",
+			rules:     `[{"op": "upsert", "path": "/input/password", "value": "**REDACTED**"}, {"op": "upsert", "path": "/result/a/b", "value": 1}]`,
+			input:     `{"password": "secret"}`,
+			result:    `{}`,
+			expInput:  `{"password": "**REDACTED**"}`,
+			expResult: `{"a": {"b": 1}}`,
+			expMasked: []string{"/input/password", "/result/a/b"},
+		},
+		{
+			note:      "explicit remove",
+			rules:     `[{"op": "remove", "path": "/input/password"}]`,
+			input:     `{"password": "secret"}`,
+			expInput:  `{}`,
+			expErased: []string{"/input/password"},
+		},
+		{
+			note:    "bad root",
+			rules:   `["/labels/id"]`,
+			wantErr: true,
+		},
+		{
+			note:    "bad op",
+			rules:   `[{"op": "add", "path": "/input/a"}]`,
+			wantErr: true,
+		},
+		{
+			note:    "bad path",
+			rules:   `["input/a"]`,
+			wantErr: true,
+		},
+		{
+			note:    "bad rule type",
+			rules:   `[1]`,
+			wantErr: true,
+		},
+		{
+			note:    "bad decision type",
+			rules:   `{"a": 1}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			rules, err := newMaskRules(util.MustUnmarshalJSON([]byte(tc.rules)))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var event EventV1
+
+			if tc.input != "" {
+				input := util.MustUnmarshalJSON([]byte(tc.input))
+				event.Input = &input
+			}
+
+			if tc.result != "" {
+				result := util.MustUnmarshalJSON([]byte(tc.result))
+				event.Result = &result
+			}
+
+			for _, rule := range rules {
+				if rule.Mask(&event) {
+					switch rule.Op {
+					case maskOpRemove:
+						event.Erased = append(event.Erased, rule.Path)
+					case maskOpUpsert:
+						event.Masked = append(event.Masked, rule.Path)
+					}
+				}
+			}
+
+			assertDoc(t, "input", event.Input, tc.expInput)
+			assertDoc(t, "result", event.Result, tc.expResult)
+
+			if !reflect.DeepEqual(event.Erased, tc.expErased) {
+				t.Fatalf("Expected erased %v but got %v", tc.expErased, event.Erased)
+			}
+
+			if !reflect.DeepEqual(event.Masked, tc.expMasked) {
+				t.Fatalf("Expected masked %v but got %v", tc.expMasked, event.Masked)
+			}
+		})
+	}
+}
+
+func TestPluginMaskEvent(t *testing.T) {
+
+	ctx := context.Background()
+	store := inmem.New()
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "mask.rego", []byte(`
+			package system.log
+
+			mask["/input/password"]
+
+			mask[{"op": "upsert", "path": "/input/ssn", "value": "**REDACTED**"}] {
+				input.input.ssn
+			}
+		`))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := plugins.New(nil, "test-instance-id", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	if err := manager.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	var input interface{} = map[string]interface{}{
+		"user":     "bob",
+		"password": "secret",
+		"ssn":      "123-45-6789",
+	}
+
+	plugin.Log(ctx, &server.Info{Input: &input})
+
+	if len(backend.events) != 1 {
+		t.Fatalf("Expected one event but got: %v", backend.events)
+	}
+
+	event := backend.events[0]
+
+	assertDoc(t, "input", event.Input, `{"user": "bob", "ssn": "**REDACTED**"}`)
+
+	if !reflect.DeepEqual(event.Erased, []string{"/input/password"}) || !reflect.DeepEqual(event.Masked, []string{"/input/ssn"}) {
+		t.Fatalf("Unexpected erased or masked paths: %v %v", event.Erased, event.Masked)
+	}
+
+	// The caller's input must not be modified.
+	if input.(map[string]interface{})["password"] != "secret" {
+		t.Fatalf("Expected original input to be unchanged but got: %v", input)
+	}
+
+	// The mask decision is prepared once and reused while the compiler is
+	// unchanged.
+	mask := plugin.mask
+
+	plugin.Log(ctx, &server.Info{Input: &input})
+
+	if plugin.mask != mask || mask.compiler != manager.GetCompiler() {
+		t.Fatal("Expected prepared mask decision to be reused")
+	}
+
+	// Policy changes cause the mask decision to be prepared again.
+	err = storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "mask.rego", []byte(`
+			package system.log
+
+			mask["/input/user"]
+		`))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin.Log(ctx, &server.Info{Input: &input})
+
+	if plugin.mask == mask {
+		t.Fatal("Expected mask decision to be prepared again")
+	}
+
+	assertDoc(t, "input", backend.events[2].Input, `{"password": "secret", "ssn": "123-45-6789"}`)
+}
+
+func TestPluginMaskDecisionConfig(t *testing.T) {
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *config.MaskDecision != "/system/log/mask" || config.maskDecisionRef.String() != "data.system.log.mask" {
+		t.Fatalf("Unexpected mask decision: %v %v", *config.MaskDecision, config.maskDecisionRef)
+	}
+
+	config, err = ParseConfig([]byte(`{"plugin": "test_plugin", "mask_decision": "/foo/bar"}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.maskDecisionRef.String() != "data.foo.bar" {
+		t.Fatalf("Unexpected mask decision: %v", config.maskDecisionRef)
+	}
+
+	if _, err := ParseConfig([]byte(`{"plugin": "test_plugin", "mask_decision": "foo"}`), nil, []string{"test_plugin"}); err == nil {
+		t.Fatal("Expected error for invalid mask decision")
+	}
+}
+
+func assertDoc(t *testing.T, name string, doc *interface{}, exp string) {
+	t.Helper()
+	if exp == "" {
+		if doc != nil {
+			t.Fatalf("Expected %v to be erased but got: %v", name, *doc)
+		}
+		return
+	}
+	if doc == nil {
+		t.Fatalf("Expected %v %v but got nil", name, exp)
+	}
+	if !reflect.DeepEqual(*doc, util.MustUnmarshalJSON([]byte(exp))) {
+		t.Fatalf("Expected %v %v but got: %v", name, exp, *doc)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons reported for dropped events.
+const (
+	droppedSampled     = "sampled"
+	droppedRateLimited = "rate_limited"
+)
+
+// pluginMetrics contains the Prometheus metrics exposed by the plugin.
+type pluginMetrics struct {
+	droppedEvents *prometheus.CounterVec
+	droppedChunks prometheus.Counter
+	bufferSize    prometheus.Gauge
+	uploadErrors  prometheus.Counter
+}
+
+func newPluginMetrics(manager *plugins.Manager) (*pluginMetrics, error) {
+
+	droppedEvents, err := manager.RegisterCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "decision_logs_dropped_events_total",
+			Help: "A counter of decision log events dropped by rate limiting or sampling.",
+		},
+		[]string{"reason"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	droppedChunks, err := manager.RegisterCollector(prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "decision_logs_dropped_chunks_total",
+			Help: "A counter of decision log chunks dropped because the buffer size limit was exceeded.",
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize, err := manager.RegisterCollector(prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "decision_logs_buffer_size_bytes",
+			Help: "A gauge of the size of compressed decision log chunks waiting to be uploaded.",
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	uploadErrors, err := manager.RegisterCollector(prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "decision_logs_upload_errors_total",
+			Help: "A counter of failed decision log uploads.",
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pluginMetrics{
+		droppedEvents: droppedEvents.(*prometheus.CounterVec),
+		droppedChunks: droppedChunks.(prometheus.Counter),
+		bufferSize:    bufferSize.(prometheus.Gauge),
+		uploadErrors:  uploadErrors.(prometheus.Counter),
+	}, nil
+}
+
+func (m *pluginMetrics) incrDroppedEvents(reason string) {
+	if m != nil {
+		m.droppedEvents.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *pluginMetrics) addDroppedChunks(n int) {
+	if m != nil {
+		m.droppedChunks.Add(float64(n))
+	}
+}
+
+func (m *pluginMetrics) setBufferSize(n int64) {
+	if m != nil {
+		m.bufferSize.Set(float64(n))
+	}
+}
+
+func (m *pluginMetrics) incrUploadErrors() {
+	if m != nil {
+		m.uploadErrors.Inc()
+	}
+}
@@ -8,16 +8,20 @@ package logs
 import (
 	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
+	"os"
 	"reflect"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/plugins/rest"
 	"github.com/open-policy-agent/opa/server"
+	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/version"
 	"github.com/pkg/errors"
@@ -39,6 +43,8 @@ type EventV1 struct {
 	Query       string                 `json:"query,omitempty"`
 	Input       *interface{}           `json:"input,omitempty"`
 	Result      *interface{}           `json:"result,omitempty"`
+	Erased      []string               `json:"erased,omitempty"`
+	Masked      []string               `json:"masked,omitempty"`
 	Error       error                  `json:"error,omitempty"`
 	RequestedBy string                 `json:"requested_by"`
 	Timestamp   time.Time              `json:"timestamp"`
@@ -61,6 +67,9 @@ type ReportingConfig struct {
 	UploadSizeLimitBytes *int64 `json:"upload_size_limit_bytes,omitempty"` // max size of upload payload
 	MinDelaySeconds      *int64 `json:"min_delay_seconds,omitempty"`       // min amount of time to wait between successful poll attempts
 	MaxDelaySeconds      *int64 `json:"max_delay_seconds,omitempty"`       // max amount of time to wait between poll attempts
+
+	MaxDecisionsPerSecond *float64 `json:"max_decisions_per_second,omitempty"` // max number of events logged per second
+	SampleRate            *float64 `json:"sample_rate,omitempty"`              // probability that an event is logged
 }
 
 // Config represents the plugin configuration.
@@ -69,6 +78,11 @@ type Config struct {
 	Service       string          `json:"service"`
 	PartitionName string          `json:"partition_name,omitempty"`
 	Reporting     ReportingConfig `json:"reporting"`
+	MaskDecision  *string         `json:"mask_decision"`
+	Console       bool            `json:"console"`
+	File          *FileConfig     `json:"file,omitempty"`
+
+	maskDecisionRef ast.Ref
 }
 
 func (c *Config) validateAndInjectDefaults(services []string, plugins []string) error {
@@ -84,9 +98,11 @@ func (c *Config) validateAndInjectDefaults(services []string, plugins []string)
 		if !found {
 			return fmt.Errorf("invalid plugin name %q in decision_logs", *c.Plugin)
 		}
-	} else if c.Service == "" && len(services) != 0 {
+	} else if c.Service == "" && len(services) != 0 && !c.localOutputEnabled() {
+		// Decisions are only uploaded to the default service if they are not
+		// written to the console or a file.
 		c.Service = services[0]
-	} else {
+	} else if c.Service != "" || !c.localOutputEnabled() {
 		found := false
 
 		for _, svc := range services {
@@ -140,9 +156,46 @@ func (c *Config) validateAndInjectDefaults(services []string, plugins []string)
 
 	c.Reporting.BufferSizeLimitBytes = &bufferLimit
 
+	if c.Reporting.MaxDecisionsPerSecond != nil && *c.Reporting.MaxDecisionsPerSecond <= 0 {
+		return fmt.Errorf("reporting 'max_decisions_per_second' must be > 0 in decision_logs")
+	}
+
+	if c.Reporting.SampleRate != nil && (*c.Reporting.SampleRate <= 0 || *c.Reporting.SampleRate > 1) {
+		return fmt.Errorf("reporting 'sample_rate' must be > 0 and <= 1 in decision_logs")
+	}
+
+	if c.File != nil {
+		if err := c.File.validateAndInjectDefaults(); err != nil {
+			return err
+		}
+	}
+
+	if c.MaskDecision == nil {
+		maskDecision := defaultMaskDecisionPath
+		c.MaskDecision = &maskDecision
+	}
+
+	path, ok := storage.ParsePathEscaped(*c.MaskDecision)
+	if !ok {
+		return fmt.Errorf("invalid mask_decision %q in decision_logs", *c.MaskDecision)
+	}
+
+	c.maskDecisionRef = path.Ref(ast.DefaultRootDocument)
+
 	return nil
 }
 
+// localOutputEnabled returns true if events are written to the console or to a
+// file.
+func (c *Config) localOutputEnabled() bool {
+	return c.Console || c.File != nil
+}
+
+// uploadEnabled returns true if events are uploaded to a remote service.
+func (c *Config) uploadEnabled() bool {
+	return c.Plugin == nil && c.Service != ""
+}
+
 // Plugin implements decision log buffering and uploading.
 type Plugin struct {
 	manager  *plugins.Manager
@@ -152,6 +205,12 @@ type Plugin struct {
 	mtx      sync.Mutex
 	stop     chan chan struct{}
 	reconfig chan interface{}
+	sinks    []sink
+	console  io.Writer
+	limiter  *rateLimiter
+	metrics  *pluginMetrics
+	mask     *preparedMask
+	maskMtx  sync.Mutex
 }
 
 // ParseConfig validates the config and injects default values.
@@ -183,8 +242,19 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 		buffer:   newLogBuffer(*parsedConfig.Reporting.BufferSizeLimitBytes),
 		enc:      newChunkEncoder(*parsedConfig.Reporting.UploadSizeLimitBytes),
 		reconfig: make(chan interface{}),
+		console:  os.Stdout,
 	}
 
+	plugin.sinks = plugin.newSinks(parsedConfig)
+	plugin.limiter = newLimiter(parsedConfig)
+
+	m, err := newPluginMetrics(manager)
+	if err != nil {
+		plugin.logError("Failed to register metrics: %v.", err)
+	}
+
+	plugin.metrics = m
+
 	return plugin
 }
 
@@ -212,11 +282,18 @@ func (p *Plugin) Stop(ctx context.Context) {
 	done := make(chan struct{})
 	p.stop <- done
 	_ = <-done
+	p.mtx.Lock()
+	p.closeSinks()
+	p.mtx.Unlock()
 }
 
 // Log appends a decision log event to the buffer for uploading.
 func (p *Plugin) Log(ctx context.Context, decision *server.Info) {
 
+	if !p.sample() {
+		return
+	}
+
 	path := strings.Replace(strings.TrimPrefix(decision.Path, "data."), ".", "/", -1)
 
 	event := EventV1{
@@ -240,6 +317,15 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) {
 		event.Error = decision.Error
 	}
 
+	if err := p.maskEvent(ctx, &event); err != nil {
+		// Events are dropped rather than logged unmasked so that sensitive
+		// values are not leaked when the mask decision fails.
+		p.logError("Log event masking failed: %v. Dropping event.", err)
+		return
+	}
+
+	p.writeSinks(event)
+
 	if p.config.Plugin != nil {
 		proxy, ok := p.manager.Plugin(*p.config.Plugin).(Logger)
 		if !ok {
@@ -250,6 +336,10 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) {
 		return
 	}
 
+	if !p.config.uploadEnabled() {
+		return
+	}
+
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
@@ -261,6 +351,7 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) {
 
 	if result != nil {
 		p.bufferChunk(p.buffer, result)
+		p.metrics.setBufferSize(p.buffer.usage)
 	}
 }
 
@@ -278,7 +369,7 @@ func (p *Plugin) loop() {
 	for {
 		var err error
 
-		if p.config.Plugin == nil {
+		if p.config.uploadEnabled() {
 			var uploaded bool
 			uploaded, err = p.oneShot(ctx)
 
@@ -301,7 +392,7 @@ func (p *Plugin) loop() {
 			delay = util.DefaultBackoff(float64(minRetryDelay), float64(*p.config.Reporting.MaxDelaySeconds), retry)
 		}
 
-		if p.config.Plugin == nil {
+		if p.config.uploadEnabled() {
 			p.logDebug("Waiting %v before next upload/retry.", delay)
 		}
 
@@ -334,6 +425,7 @@ func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
 	oldBuffer := p.buffer
 	p.buffer = newLogBuffer(*p.config.Reporting.BufferSizeLimitBytes)
 	p.enc = newChunkEncoder(*p.config.Reporting.UploadSizeLimitBytes)
+	p.metrics.setBufferSize(0)
 	p.mtx.Unlock()
 
 	// Along with uploading the compressed events in the buffer
@@ -353,9 +445,11 @@ func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
 	for bs := oldBuffer.Pop(); bs != nil; bs = oldBuffer.Pop() {
 		err := uploadChunk(ctx, p.manager.Client(p.config.Service), p.config.PartitionName, bs)
 		if err != nil {
+			p.metrics.incrUploadErrors()
 			// requeue the chunk
 			p.mtx.Lock()
 			p.bufferChunk(p.buffer, bs)
+			p.metrics.setBufferSize(p.buffer.usage)
 			p.mtx.Unlock()
 			return false, err
 		}
@@ -374,12 +468,95 @@ func (p *Plugin) reconfigure(config interface{}) {
 	}
 
 	p.logInfo("Decision log uploader configuration changed.")
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
 	p.config = *newConfig
+	p.closeSinks()
+	p.sinks = p.newSinks(newConfig)
+	p.limiter = newLimiter(newConfig)
+
+	p.maskMtx.Lock()
+	p.mask = nil
+	p.maskMtx.Unlock()
+}
+
+func newLimiter(config *Config) *rateLimiter {
+	if config.Reporting.MaxDecisionsPerSecond == nil {
+		return nil
+	}
+	return newRateLimiter(*config.Reporting.MaxDecisionsPerSecond)
+}
+
+// sample returns false if the event should be dropped because of the sample
+// rate or rate limit.
+func (p *Plugin) sample() bool {
+
+	p.mtx.Lock()
+	rate := p.config.Reporting.SampleRate
+	limiter := p.limiter
+	p.mtx.Unlock()
+
+	if rate != nil && rand.Float64() >= *rate {
+		p.metrics.incrDroppedEvents(droppedSampled)
+		return false
+	}
+
+	if limiter != nil && !limiter.Allow() {
+		p.metrics.incrDroppedEvents(droppedRateLimited)
+		return false
+	}
+
+	return true
+}
+
+func (p *Plugin) newSinks(config *Config) []sink {
+	var sinks []sink
+	if config.Console {
+		sinks = append(sinks, newConsoleSink(p.console))
+	}
+	if config.File != nil {
+		sinks = append(sinks, newFileSink(config.File))
+	}
+	return sinks
+}
+
+func (p *Plugin) closeSinks() {
+	for _, s := range p.sinks {
+		if err := s.Close(); err != nil {
+			p.logError("Failed to close decision log output: %v.", err)
+		}
+	}
+	p.sinks = nil
+}
+
+func (p *Plugin) writeSinks(event EventV1) {
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if len(p.sinks) == 0 {
+		return
+	}
+
+	bs, err := encodeEvent(event)
+	if err != nil {
+		p.logError("Log encoding failed: %v.", err)
+		return
+	}
+
+	for _, s := range p.sinks {
+		if err := s.Write(bs); err != nil {
+			p.logError("Failed to write decision log event: %v.", err)
+		}
+	}
 }
 
 func (p *Plugin) bufferChunk(buffer *logBuffer, bs []byte) {
 	dropped := buffer.Push(bs)
 	if dropped > 0 {
+		p.metrics.addDroppedChunks(dropped)
 		p.logError("Dropped %v chunks from buffer. Reduce reporting interval or increase buffer size.", dropped)
 	}
 }
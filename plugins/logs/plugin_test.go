@@ -22,6 +22,7 @@ import (
 	"github.com/open-policy-agent/opa/server"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/version"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestMain(m *testing.M) {
@@ -392,6 +393,45 @@ func TestPluginRequeue(t *testing.T) {
 	}
 }
 
+func TestPluginMetrics(t *testing.T) {
+
+	ctx := context.Background()
+
+	fixture := newTestFixture(t)
+	defer fixture.server.stop()
+
+	fixture.server.ch = make(chan []EventV1, 1)
+
+	fixture.plugin.Log(ctx, &server.Info{DecisionID: "abc"})
+
+	fixture.server.expCode = 500
+	if _, err := fixture.plugin.oneShot(ctx); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	<-fixture.server.ch
+
+	if v := testutil.ToFloat64(fixture.plugin.metrics.uploadErrors); v != 1 {
+		t.Fatalf("Expected one upload error but got %v", v)
+	}
+
+	// The failed chunk is requeued.
+	if v := testutil.ToFloat64(fixture.plugin.metrics.bufferSize); v == 0 {
+		t.Fatal("Expected non-zero buffer size")
+	}
+
+	fixture.server.expCode = 200
+	if _, err := fixture.plugin.oneShot(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	<-fixture.server.ch
+
+	if v := testutil.ToFloat64(fixture.plugin.metrics.bufferSize); v != 0 {
+		t.Fatalf("Expected empty buffer but got %v", v)
+	}
+}
+
 func TestPluginReconfigure(t *testing.T) {
 
 	ctx := context.Background()
@@ -0,0 +1,190 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/server"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	now := time.Unix(0, 0)
+
+	l := newRateLimiter(2)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	allowed := func() (n int) {
+		for i := 0; i < 10; i++ {
+			if l.Allow() {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := allowed(); n != 2 {
+		t.Fatalf("Expected initial burst of 2 but got %v", n)
+	}
+
+	now = now.Add(time.Millisecond * 500)
+
+	if n := allowed(); n != 1 {
+		t.Fatalf("Expected 1 event after half a second but got %v", n)
+	}
+
+	// The bucket does not fill beyond the burst size.
+	now = now.Add(time.Second * 10)
+
+	if n := allowed(); n != 2 {
+		t.Fatalf("Expected 2 events after idle period but got %v", n)
+	}
+}
+
+func TestRateLimiterFractional(t *testing.T) {
+
+	now := time.Unix(0, 0)
+
+	l := newRateLimiter(0.5)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	if !l.Allow() || l.Allow() {
+		t.Fatal("Expected exactly one event to be allowed")
+	}
+
+	now = now.Add(time.Second)
+
+	if l.Allow() {
+		t.Fatal("Expected event to be dropped after one second")
+	}
+
+	now = now.Add(time.Second)
+
+	if !l.Allow() {
+		t.Fatal("Expected event to be allowed after two seconds")
+	}
+}
+
+func TestPluginRateLimitAndSampling(t *testing.T) {
+
+	tests := []struct {
+		note       string
+		config     string
+		expEvents  int
+		expSampled float64
+		expLimited float64
+	}{
+		{
+			note:      "no limits",
+			config:    `{"plugin": "test_plugin"}`,
+			expEvents: 10,
+		},
+		{
+			note:       "rate limit",
+			config:     `{"plugin": "test_plugin", "reporting": {"max_decisions_per_second": 3}}`,
+			expEvents:  3,
+			expLimited: 7,
+		},
+		{
+			note:      "sample all",
+			config:    `{"plugin": "test_plugin", "reporting": {"sample_rate": 1}}`,
+			expEvents: 10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			ctx := context.Background()
+			manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+			backend := &testPlugin{}
+			manager.Register("test_plugin", backend)
+
+			config, err := ParseConfig([]byte(tc.config), nil, []string{"test_plugin"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plugin := New(config, manager)
+
+			if plugin.limiter != nil {
+				now := time.Now()
+				plugin.limiter.now = func() time.Time { return now }
+				plugin.limiter.last = now
+			}
+
+			for i := 0; i < 10; i++ {
+				plugin.Log(ctx, &server.Info{})
+			}
+
+			if len(backend.events) != tc.expEvents {
+				t.Fatalf("Expected %v events but got %v", tc.expEvents, len(backend.events))
+			}
+
+			if v := testutil.ToFloat64(plugin.metrics.droppedEvents.WithLabelValues(droppedSampled)); v != tc.expSampled {
+				t.Fatalf("Expected %v sampled events but got %v", tc.expSampled, v)
+			}
+
+			if v := testutil.ToFloat64(plugin.metrics.droppedEvents.WithLabelValues(droppedRateLimited)); v != tc.expLimited {
+				t.Fatalf("Expected %v rate limited events but got %v", tc.expLimited, v)
+			}
+		})
+	}
+}
+
+func TestPluginSampling(t *testing.T) {
+
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	backend := &testPlugin{}
+	manager.Register("test_plugin", backend)
+
+	config, err := ParseConfig([]byte(`{"plugin": "test_plugin", "reporting": {"sample_rate": 0.5}}`), nil, []string{"test_plugin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	const n = 1000
+
+	for i := 0; i < n; i++ {
+		plugin.Log(ctx, &server.Info{})
+	}
+
+	sampled := testutil.ToFloat64(plugin.metrics.droppedEvents.WithLabelValues(droppedSampled))
+
+	if len(backend.events)+int(sampled) != n {
+		t.Fatalf("Expected logged and sampled events to add up to %v but got %v and %v", n, len(backend.events), sampled)
+	}
+
+	// The probability of falling outside of this range is negligible.
+	if len(backend.events) < 350 || len(backend.events) > 650 {
+		t.Fatalf("Expected roughly half of the events to be logged but got %v", len(backend.events))
+	}
+}
+
+func TestConfigRateLimitAndSampling(t *testing.T) {
+
+	for _, config := range []string{
+		`{"plugin": "test_plugin", "reporting": {"max_decisions_per_second": 0}}`,
+		`{"plugin": "test_plugin", "reporting": {"sample_rate": 0}}`,
+		`{"plugin": "test_plugin", "reporting": {"sample_rate": 1.5}}`,
+	} {
+		if _, err := ParseConfig([]byte(config), nil, []string{"test_plugin"}); err == nil {
+			t.Fatalf("Expected error for %v", config)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	defaultFileMaxSizeBytes = int64(100 * 1024 * 1024) // 100MB limit
+	defaultFileMaxBackups   = 3
+)
+
+// FileConfig represents the configuration for writing decision log events to
+// a local file.
+type FileConfig struct {
+	Path         string `json:"path"`                     // path of file to write events to
+	MaxSizeBytes *int64 `json:"max_size_bytes,omitempty"` // max size of file before it is rotated
+	MaxBackups   *int   `json:"max_backups,omitempty"`    // max number of rotated files to keep
+}
+
+func (c *FileConfig) validateAndInjectDefaults() error {
+
+	if c.Path == "" {
+		return fmt.Errorf("file configuration missing 'path' in decision_logs")
+	}
+
+	maxSize := defaultFileMaxSizeBytes
+	if c.MaxSizeBytes != nil {
+		if *c.MaxSizeBytes <= 0 {
+			return fmt.Errorf("file 'max_size_bytes' must be > 0 in decision_logs")
+		}
+		maxSize = *c.MaxSizeBytes
+	}
+
+	c.MaxSizeBytes = &maxSize
+
+	maxBackups := defaultFileMaxBackups
+	if c.MaxBackups != nil {
+		if *c.MaxBackups < 0 {
+			return fmt.Errorf("file 'max_backups' must be >= 0 in decision_logs")
+		}
+		maxBackups = *c.MaxBackups
+	}
+
+	c.MaxBackups = &maxBackups
+
+	return nil
+}
+
+// sink defines the interface for local decision log outputs. Events are
+// written to sinks as newline delimited JSON.
+type sink interface {
+	Write(bs []byte) error
+	Close() error
+}
+
+// encodeEvent returns the JSON encoding of the event followed by a newline.
+// This is the same encoding used in uploaded chunks.
+func encodeEvent(event EventV1) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// consoleSink writes events to the console (stdout by default.)
+type consoleSink struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+func newConsoleSink(w io.Writer) *consoleSink {
+	return &consoleSink{w: w}
+}
+
+func (s *consoleSink) Write(bs []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err := s.w.Write(bs)
+	return err
+}
+
+func (s *consoleSink) Close() error {
+	return nil
+}
+
+// fileSink writes events to a file. When the file exceeds the size limit, it
+// is rotated: path is renamed to path.1, path.1 to path.2, and so on. Files
+// beyond the backup limit are removed.
+type fileSink struct {
+	mtx        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func newFileSink(config *FileConfig) *fileSink {
+	return &fileSink{
+		path:       config.Path,
+		maxSize:    *config.MaxSizeBytes,
+		maxBackups: *config.MaxBackups,
+	}
+}
+
+func (s *fileSink) Write(bs []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(len(bs)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(bs)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *fileSink) open() error {
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	s.f = nil
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	if err := os.Remove(s.backupPath(s.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) backupPath(i int) string {
+	return fmt.Sprintf("%v.%d", s.path, i)
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/server"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestConfigLocalOutputs(t *testing.T) {
+
+	tests := []struct {
+		note       string
+		config     string
+		services   []string
+		wantErr    bool
+		expService string
+		expUpload  bool
+	}{
+		{
+			note:    "no service or output",
+			config:  `{}`,
+			wantErr: true,
+		},
+		{
+			note:   "console only",
+			config: `{"console": true}`,
+		},
+		{
+			note:   "file only",
+			config: `{"file": {"path": "decisions.log"}}`,
+		},
+		{
+			note:     "console with services",
+			config:   `{"console": true}`,
+			services: []string{"example"},
+		},
+		{
+			note:       "console and upload",
+			config:     `{"console": true, "service": "example"}`,
+			services:   []string{"example"},
+			expService: "example",
+			expUpload:  true,
+		},
+		{
+			note:     "console and bad service",
+			config:   `{"console": true, "service": "missing"}`,
+			services: []string{"example"},
+			wantErr:  true,
+		},
+		{
+			note:    "file missing path",
+			config:  `{"file": {}}`,
+			wantErr: true,
+		},
+		{
+			note:    "file bad size",
+			config:  `{"file": {"path": "decisions.log", "max_size_bytes": 0}}`,
+			wantErr: true,
+		},
+		{
+			note:    "file bad backups",
+			config:  `{"file": {"path": "decisions.log", "max_backups": -1}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tc.config), tc.services, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if config.Service != tc.expService || config.uploadEnabled() != tc.expUpload {
+				t.Fatalf("Expected service %q (upload: %v) but got %q (upload: %v)", tc.expService, tc.expUpload, config.Service, config.uploadEnabled())
+			}
+			if config.File != nil && (*config.File.MaxSizeBytes != defaultFileMaxSizeBytes || *config.File.MaxBackups != defaultFileMaxBackups) {
+				t.Fatalf("Expected file defaults to be injected but got: %+v", config.File)
+			}
+		})
+	}
+}
+
+func TestPluginConsoleOutput(t *testing.T) {
+
+	ctx := context.Background()
+	manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+
+	config, err := ParseConfig([]byte(`{"console": true}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	plugin := New(config, manager)
+	plugin.console = &buf
+	plugin.sinks = plugin.newSinks(config)
+
+	plugin.Log(ctx, &server.Info{DecisionID: "1", Path: "data.foo"})
+	plugin.Log(ctx, &server.Info{DecisionID: "2", Path: "data.bar"})
+
+	events := decodeEvents(t, buf.String())
+
+	if len(events) != 2 || events[0].DecisionID != "1" || events[0].Path != "foo" || events[1].DecisionID != "2" {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+
+	if plugin.enc.bytesWritten != 0 || plugin.buffer.Len() != 0 {
+		t.Fatal("Expected events not to be buffered for upload")
+	}
+}
+
+func TestPluginFileOutputRotation(t *testing.T) {
+
+	test.WithTempFS(nil, func(rootDir string) {
+
+		ctx := context.Background()
+		manager, _ := plugins.New(nil, "test-instance-id", inmem.New())
+		path := filepath.Join(rootDir, "decisions.log")
+
+		config, err := ParseConfig([]byte(`{"file": {"path": "`+filepath.ToSlash(path)+`", "max_size_bytes": 1, "max_backups": 2}}`), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plugin := New(config, manager)
+
+		for _, id := range []string{"1", "2", "3", "4"} {
+			plugin.Log(ctx, &server.Info{DecisionID: id})
+		}
+
+		plugin.mtx.Lock()
+		plugin.closeSinks()
+		plugin.mtx.Unlock()
+
+		// Each event exceeds the size limit so every write rotates the file.
+		exp := map[string]string{
+			path:        "4",
+			path + ".1": "3",
+			path + ".2": "2",
+		}
+
+		for name, id := range exp {
+			bs, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := decodeEvents(t, string(bs))
+			if len(events) != 1 || events[0].DecisionID != id {
+				t.Fatalf("Expected event %v in %v but got: %v", id, name, events)
+			}
+		}
+
+		if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+			t.Fatalf("Expected oldest backup to be removed but got: %v", err)
+		}
+	})
+}
+
+func decodeEvents(t *testing.T, s string) []EventV1 {
+	t.Helper()
+	var events []EventV1
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		var event EventV1
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
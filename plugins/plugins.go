@@ -11,10 +11,13 @@ import (
 	"sync"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/config"
 	"github.com/open-policy-agent/opa/plugins/rest"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/util"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Factory defines the interface OPA uses to instantiate your plugin.
@@ -91,12 +94,15 @@ type Manager struct {
 	Info   *ast.Term
 	ID     string
 
-	compiler           *ast.Compiler
-	compilerMux        sync.RWMutex
-	services           map[string]rest.Client
-	plugins            []namedplugin
-	registeredTriggers []func(txn storage.Transaction)
-	mtx                sync.Mutex
+	compiler                *ast.Compiler
+	compilerMux             sync.RWMutex
+	services                map[string]rest.Client
+	keys                    map[string]*bundle.KeyConfig
+	plugins                 []namedplugin
+	registeredTriggers      []func(txn storage.Transaction)
+	registeredCacheTriggers []func(*cache.Config)
+	registry                *prometheus.Registry
+	mtx                     sync.Mutex
 }
 
 type namedplugin struct {
@@ -125,11 +131,18 @@ func New(raw []byte, id string, store storage.Store, opts ...func(*Manager)) (*M
 		return nil, err
 	}
 
+	keys, err := bundle.ParseKeysConfig(parsedConfig.Keys)
+	if err != nil {
+		return nil, err
+	}
+
 	m := &Manager{
 		Store:    store,
 		Config:   parsedConfig,
 		ID:       id,
 		services: services,
+		keys:     keys,
+		registry: prometheus.NewRegistry(),
 	}
 
 	for _, f := range opts {
@@ -201,6 +214,14 @@ func (m *Manager) RegisterCompilerTrigger(f func(txn storage.Transaction)) {
 	m.registeredTriggers = append(m.registeredTriggers, f)
 }
 
+// RegisterCacheTrigger registers for change notifications when the caching
+// configuration is changed.
+func (m *Manager) RegisterCacheTrigger(f func(*cache.Config)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.registeredCacheTriggers = append(m.registeredCacheTriggers, f)
+}
+
 // Start starts the manager.
 func (m *Manager) Start(ctx context.Context) error {
 	if m == nil {
@@ -220,27 +241,29 @@ func (m *Manager) Start(ctx context.Context) error {
 		return err
 	}
 
-	if err := func() error {
-		m.mtx.Lock()
-		defer m.mtx.Unlock()
+	// The trigger is registered before plugins are started so that policies
+	// activated by plugins on start (e.g., persisted bundles) are compiled.
+	config := storage.TriggerConfig{OnCommit: m.onCommit}
 
-		for _, p := range m.plugins {
-			if err := p.plugin.Start(ctx); err != nil {
-				return err
-			}
-		}
+	err = storage.Txn(ctx, m.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		_, err := m.Store.Register(ctx, txn, config)
+		return err
+	})
 
-		return nil
-	}(); err != nil {
+	if err != nil {
 		return err
 	}
 
-	config := storage.TriggerConfig{OnCommit: m.onCommit}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
 
-	return storage.Txn(ctx, m.Store, storage.WriteParams, func(txn storage.Transaction) error {
-		_, err := m.Store.Register(ctx, txn, config)
-		return err
-	})
+	for _, p := range m.plugins {
+		if err := p.plugin.Start(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Stop stops the manager, stopping all the plugins registered with it
@@ -258,6 +281,14 @@ func (m *Manager) Reconfigure(config *config.Config) error {
 	if err != nil {
 		return err
 	}
+	keys, err := bundle.ParseKeysConfig(config.Keys)
+	if err != nil {
+		return err
+	}
+	cacheConfig, err := cache.ParseCachingConfig(config.Caching)
+	if err != nil {
+		return err
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 	config.Labels = m.Config.Labels // don't overwrite labels
@@ -265,6 +296,12 @@ func (m *Manager) Reconfigure(config *config.Config) error {
 	for name, client := range services {
 		m.services[name] = client
 	}
+	for id, key := range keys {
+		m.keys[id] = key
+	}
+	for _, f := range m.registeredCacheTriggers {
+		f(cacheConfig)
+	}
 	return nil
 }
 
@@ -307,6 +344,37 @@ func (m *Manager) Client(name string) rest.Client {
 	return m.services[name]
 }
 
+// PublicKeys returns the set of keys that bundle signatures can be verified
+// with, keyed by key ID.
+func (m *Manager) PublicKeys() map[string]*bundle.KeyConfig {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	keys := make(map[string]*bundle.KeyConfig, len(m.keys))
+	for id, key := range m.keys {
+		keys[id] = key
+	}
+	return keys
+}
+
+// PrometheusRegistry returns the registry that Prometheus metrics exposed by
+// the server and plugins are registered with.
+func (m *Manager) PrometheusRegistry() *prometheus.Registry {
+	return m.registry
+}
+
+// RegisterCollector registers the Prometheus collector with the manager's
+// registry. If an equivalent collector has already been registered (e.g.,
+// because a plugin was re-created), the existing collector is returned.
+func (m *Manager) RegisterCollector(c prometheus.Collector) (prometheus.Collector, error) {
+	if err := m.registry.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
 // Services returns a list of services that m can provide clients for.
 func (m *Manager) Services() []string {
 	s := make([]string, 0, len(m.services))
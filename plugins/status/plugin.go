@@ -15,27 +15,33 @@ import (
 	"github.com/open-policy-agent/opa/plugins/bundle"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus"
 )
 
 // UpdateRequestV1 represents the status update message that OPA sends to
 // remote HTTP endpoints.
 type UpdateRequestV1 struct {
-	Labels    map[string]string `json:"labels"`
-	Bundle    *bundle.Status    `json:"bundle,omitempty"`
-	Discovery *bundle.Status    `json:"discovery,omitempty"`
+	Labels    map[string]string         `json:"labels"`
+	Bundle    *bundle.Status            `json:"bundle,omitempty"` // Deprecated: Use Bundles instead.
+	Bundles   map[string]*bundle.Status `json:"bundles,omitempty"`
+	Discovery *bundle.Status            `json:"discovery,omitempty"`
+	Metrics   map[string]interface{}    `json:"metrics,omitempty"`
 }
 
 // Plugin implements status reporting. Updates can be triggered by the caller.
 type Plugin struct {
-	manager          *plugins.Manager
-	config           Config
-	bundleCh         chan bundle.Status
-	lastBundleStatus *bundle.Status
-	discoCh          chan bundle.Status
-	lastDiscoStatus  *bundle.Status
-	stop             chan chan struct{}
-	reconfig         chan interface{}
+	manager            *plugins.Manager
+	config             Config
+	bundleCh           chan bundle.Status
+	bulkBundleCh       chan map[string]*bundle.Status
+	lastBundleStatuses map[string]*bundle.Status
+	discoCh            chan bundle.Status
+	lastDiscoStatus    *bundle.Status
+	stop               chan chan struct{}
+	reconfig           chan interface{}
+	failures           prometheus.Counter
 }
 
 // Config contains configuration for the plugin.
@@ -90,12 +96,27 @@ func ParseConfig(config []byte, services []string) (*Config, error) {
 func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 
 	plugin := &Plugin{
-		manager:  manager,
-		config:   *parsedConfig,
-		bundleCh: make(chan bundle.Status),
-		discoCh:  make(chan bundle.Status),
-		stop:     make(chan chan struct{}),
-		reconfig: make(chan interface{}),
+		manager:            manager,
+		config:             *parsedConfig,
+		bundleCh:           make(chan bundle.Status),
+		bulkBundleCh:       make(chan map[string]*bundle.Status),
+		lastBundleStatuses: map[string]*bundle.Status{},
+		discoCh:            make(chan bundle.Status),
+		stop:               make(chan chan struct{}),
+		reconfig:           make(chan interface{}),
+	}
+
+	failures, err := manager.RegisterCollector(prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "status_update_failures_total",
+			Help: "A counter of failed status updates.",
+		},
+	))
+
+	if err != nil {
+		plugin.logError("Failed to register metrics: %v.", err)
+	} else {
+		plugin.failures = failures.(prometheus.Counter)
 	}
 
 	return plugin
@@ -127,11 +148,19 @@ func (p *Plugin) Stop(ctx context.Context) {
 	_ = <-done
 }
 
-// UpdateBundleStatus notifies the plugin that the policy bundle was updated.
+// UpdateBundleStatus notifies the plugin that a policy bundle was updated.
+// Statuses are tracked per bundle name.
 func (p *Plugin) UpdateBundleStatus(status bundle.Status) {
 	p.bundleCh <- status
 }
 
+// BulkUpdateBundleStatus notifies the plugin that the status of one or more
+// policy bundles changed. The statuses replace the statuses of all bundles so
+// that bundles which are no longer configured are not reported.
+func (p *Plugin) BulkUpdateBundleStatus(status map[string]*bundle.Status) {
+	p.bulkBundleCh <- status
+}
+
 // UpdateDiscoveryStatus notifies the plugin that the discovery bundle was updated.
 func (p *Plugin) UpdateDiscoveryStatus(status bundle.Status) {
 	p.discoCh <- status
@@ -151,6 +180,16 @@ func (p *Plugin) loop() {
 		case status := <-p.bundleCh:
 			err := p.oneShot(ctx, false, status)
 			if err != nil {
+				p.incrFailures()
+				p.logError("%v.", err)
+			} else {
+				p.logInfo("Status update sent successfully in response to bundle update.")
+			}
+		case statuses := <-p.bulkBundleCh:
+			p.lastBundleStatuses = statuses
+			err := p.sendUpdate(ctx)
+			if err != nil {
+				p.incrFailures()
 				p.logError("%v.", err)
 			} else {
 				p.logInfo("Status update sent successfully in response to bundle update.")
@@ -158,6 +197,7 @@ func (p *Plugin) loop() {
 		case status := <-p.discoCh:
 			err := p.oneShot(ctx, true, status)
 			if err != nil {
+				p.incrFailures()
 				p.logError("%v.", err)
 			} else {
 				p.logInfo("Status update sent successfully in response to discovery update.")
@@ -179,13 +219,35 @@ func (p *Plugin) oneShot(ctx context.Context, disco bool, status bundle.Status)
 	if disco {
 		p.lastDiscoStatus = &status
 	} else {
-		p.lastBundleStatus = &status
+		p.lastBundleStatuses[status.Name] = &status
 	}
 
+	return p.sendUpdate(ctx)
+}
+
+func (p *Plugin) sendUpdate(ctx context.Context) error {
+
 	req := UpdateRequestV1{
 		Labels:    p.manager.Labels(),
 		Discovery: p.lastDiscoStatus,
-		Bundle:    p.lastBundleStatus,
+	}
+
+	if len(p.lastBundleStatuses) > 0 {
+		req.Bundles = p.lastBundleStatuses
+	}
+
+	// The deprecated bundle field is only set if a single bundle is reported
+	// so that existing consumers continue to work.
+	if len(p.lastBundleStatuses) == 1 {
+		for _, s := range p.lastBundleStatuses {
+			req.Bundle = s
+		}
+	}
+
+	if metrics, err := p.gatherMetrics(); err != nil {
+		p.logError("Failed to gather metrics: %v.", err)
+	} else if len(metrics) > 0 {
+		req.Metrics = map[string]interface{}{"prometheus": metrics}
 	}
 
 	resp, err := p.manager.Client(p.config.Service).
@@ -210,6 +272,41 @@ func (p *Plugin) oneShot(ctx context.Context, disco bool, status bundle.Status)
 	}
 }
 
+func (p *Plugin) incrFailures() {
+	if p.failures != nil {
+		p.failures.Inc()
+	}
+}
+
+// reportedMetrics is the set of Prometheus metrics included in status
+// updates. Only the counters of dropped decision log events and chunks are
+// reported so that the size of status updates does not grow with the number
+// of metrics registered by the server and plugins.
+var reportedMetrics = map[string]struct{}{
+	"decision_logs_dropped_events_total": {},
+	"decision_logs_dropped_chunks_total": {},
+}
+
+// gatherMetrics returns the reported metrics registered with the manager's
+// Prometheus registry keyed by metric name.
+func (p *Plugin) gatherMetrics() (map[string]*dto.MetricFamily, error) {
+
+	families, err := p.manager.PrometheusRegistry().Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]*dto.MetricFamily{}
+
+	for _, f := range families {
+		if _, ok := reportedMetrics[f.GetName()]; ok {
+			result[f.GetName()] = f
+		}
+	}
+
+	return result, nil
+}
+
 func (p *Plugin) reconfigure(config interface{}) {
 	newConfig := config.(*Config)
 
@@ -17,6 +17,7 @@ import (
 	"github.com/open-policy-agent/opa/plugins/bundle"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/util"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestPluginStart(t *testing.T) {
@@ -34,6 +35,7 @@ func TestPluginStart(t *testing.T) {
 
 	fixture.plugin.UpdateBundleStatus(*status)
 	result := <-fixture.server.ch
+	result.Metrics = nil // see TestPluginStartMetrics
 
 	exp := UpdateRequestV1{
 		Labels: map[string]string{
@@ -41,6 +43,9 @@ func TestPluginStart(t *testing.T) {
 			"app": "example-app",
 		},
 		Bundle: status,
+		Bundles: map[string]*bundle.Status{
+			status.Name: status,
+		},
 	}
 
 	if !reflect.DeepEqual(result, exp) {
@@ -63,6 +68,7 @@ func TestPluginStartDiscovery(t *testing.T) {
 
 	fixture.plugin.UpdateDiscoveryStatus(*status)
 	result := <-fixture.server.ch
+	result.Metrics = nil // see TestPluginStartMetrics
 
 	exp := UpdateRequestV1{
 		Labels: map[string]string{
@@ -77,6 +83,129 @@ func TestPluginStartDiscovery(t *testing.T) {
 	}
 }
 
+func TestPluginStartMultiBundle(t *testing.T) {
+
+	fixture := newTestFixture(t)
+	fixture.server.ch = make(chan UpdateRequestV1)
+	defer fixture.server.stop()
+
+	ctx := context.Background()
+
+	fixture.plugin.Start(ctx)
+	defer fixture.plugin.Stop(ctx)
+
+	status1 := testStatus()
+	status2 := testStatus()
+	status2.Name = "example/other"
+
+	fixture.plugin.UpdateBundleStatus(*status1)
+	<-fixture.server.ch
+
+	fixture.plugin.UpdateBundleStatus(*status2)
+	result := <-fixture.server.ch
+	result.Metrics = nil // see TestPluginStartMetrics
+
+	exp := UpdateRequestV1{
+		Labels: map[string]string{
+			"id":  "test-instance-id",
+			"app": "example-app",
+		},
+		Bundles: map[string]*bundle.Status{
+			status1.Name: status1,
+			status2.Name: status2,
+		},
+	}
+
+	if !reflect.DeepEqual(result, exp) {
+		t.Fatalf("Expected: %+v but got: %+v", exp, result)
+	}
+}
+
+func TestPluginBulkUpdateBundleStatus(t *testing.T) {
+
+	fixture := newTestFixture(t)
+	fixture.server.ch = make(chan UpdateRequestV1)
+	defer fixture.server.stop()
+
+	ctx := context.Background()
+
+	fixture.plugin.Start(ctx)
+	defer fixture.plugin.Stop(ctx)
+
+	status1 := testStatus()
+	status2 := testStatus()
+	status2.Name = "example/other"
+
+	fixture.plugin.BulkUpdateBundleStatus(map[string]*bundle.Status{status1.Name: status1, status2.Name: status2})
+	<-fixture.server.ch
+
+	// Bundles that are no longer reported are dropped.
+	fixture.plugin.BulkUpdateBundleStatus(map[string]*bundle.Status{status2.Name: status2})
+	result := <-fixture.server.ch
+	result.Metrics = nil // see TestPluginStartMetrics
+
+	exp := UpdateRequestV1{
+		Labels: map[string]string{
+			"id":  "test-instance-id",
+			"app": "example-app",
+		},
+		Bundle: status2,
+		Bundles: map[string]*bundle.Status{
+			status2.Name: status2,
+		},
+	}
+
+	if !reflect.DeepEqual(result, exp) {
+		t.Fatalf("Expected: %+v but got: %+v", exp, result)
+	}
+}
+
+func TestPluginStartMetrics(t *testing.T) {
+
+	fixture := newTestFixture(t)
+	fixture.server.ch = make(chan UpdateRequestV1)
+	defer fixture.server.stop()
+
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{Name: "decision_logs_dropped_chunks_total", Help: "A test counter."})
+	if _, err := fixture.manager.RegisterCollector(dropped); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped.Add(3)
+
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_counter_total", Help: "A test counter."})
+	if _, err := fixture.manager.RegisterCollector(other); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	fixture.plugin.Start(ctx)
+	defer fixture.plugin.Stop(ctx)
+
+	fixture.plugin.UpdateBundleStatus(*testStatus())
+	result := <-fixture.server.ch
+
+	exp := util.MustUnmarshalJSON([]byte(`{
+		"decision_logs_dropped_chunks_total": {
+			"name": "decision_logs_dropped_chunks_total",
+			"help": "A test counter.",
+			"type": 0,
+			"metric": [{"counter": {"value": 3}}]
+		}
+	}`))
+
+	prom, ok := result.Metrics["prometheus"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected prometheus metrics but got: %v", result.Metrics)
+	}
+
+	// Metrics other than the dropped decision log counters are not reported.
+	if !reflect.DeepEqual(prom, exp) {
+		t.Fatalf("Expected: %v but got: %v", exp, prom)
+	}
+}
+
 func TestPluginBadAuth(t *testing.T) {
 	fixture := newTestFixture(t)
 	ctx := context.Background()
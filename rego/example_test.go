@@ -16,6 +16,7 @@ import (
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -585,3 +586,73 @@ func ExampleRego_Eval_tracer() {
 	// Redo x = 1
 	// | Redo x = 1
 }
+
+func ExampleRego_PrepareForEval() {
+
+	ctx := context.Background()
+
+	// Define a simple policy for example purposes.
+	module := `package example
+
+	default allow = false
+
+	allow {
+		input.user = "alice"
+	}
+	`
+
+	// Parse and compile the query and module once.
+	r := rego.New(rego.Query("data.example.allow"), rego.Module("example.rego", module))
+	pq, err := r.PrepareForEval(ctx)
+	if err != nil {
+		// Handle error.
+	}
+
+	// Evaluate the prepared query with different inputs.
+	for _, user := range []string{"alice", "bob"} {
+		rs, err := pq.Eval(ctx, rego.EvalInput(map[string]interface{}{"user": user}))
+		if err != nil {
+			// Handle error.
+		}
+		fmt.Printf("%v: %v\n", user, rs[0].Expressions[0].Value)
+	}
+
+	// Output:
+	//
+	// alice: true
+	// bob: false
+}
+
+func ExampleRego_Eval_customBuiltin() {
+
+	ctx := context.Background()
+
+	// Declare and implement a built-in function that is only visible to this
+	// Rego object.
+	r := rego.New(
+		rego.Query(`x = hello("bob")`),
+		rego.Function1(
+			&rego.Function{
+				Name: "hello",
+				Decl: types.NewFunction(types.Args(types.S), types.S),
+			},
+			func(_ rego.BuiltinContext, a *ast.Term) (*ast.Term, error) {
+				if s, ok := a.Value.(ast.String); ok {
+					return ast.StringTerm("hello, " + string(s)), nil
+				}
+				return nil, nil
+			}),
+	)
+
+	rs, err := r.Eval(ctx)
+	if err != nil {
+		// Handle error.
+	}
+
+	// Inspect result.
+	fmt.Println("x:", rs[0].Bindings["x"])
+
+	// Output:
+	//
+	// x: hello, bob
+}
@@ -21,6 +21,8 @@ import (
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/cache"
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -42,17 +44,78 @@ type PartialQueries struct {
 // PartialResult represents the result of partial evaluation. The result can be
 // used to generate a new query that can be run when inputs are known.
 type PartialResult struct {
-	compiler *ast.Compiler
-	store    storage.Store
-	body     ast.Body
+	compiler     *ast.Compiler
+	store        storage.Store
+	body         ast.Body
+	builtinDecls map[string]*ast.Builtin
+	builtinFuncs map[string]*topdown.Builtin
 }
 
-// Rego returns an object that can be evaluated to produce a query result.
+// Rego returns an object that can be evaluated to produce a query result. The
+// custom built-in functions used to produce the partial result are carried
+// over to the new object.
 func (pr PartialResult) Rego(options ...func(*Rego)) *Rego {
 	options = append(options, Compiler(pr.compiler), Store(pr.store), ParsedQuery(pr.body))
+	options = append([]func(*Rego){pr.builtins}, options...)
 	return New(options...)
 }
 
+func (pr PartialResult) builtins(r *Rego) {
+	for name, decl := range pr.builtinDecls {
+		r.builtinDecls[name] = decl
+	}
+	for name, f := range pr.builtinFuncs {
+		r.builtinFuncs[name] = f
+	}
+}
+
+// PreparedEvalQuery holds a query that has been parsed and compiled for
+// evaluation. The query can be evaluated any number of times with different
+// inputs and is safe for concurrent use.
+type PreparedEvalQuery struct {
+	r        *Rego
+	qc       ast.QueryCompiler
+	compiled ast.Body
+}
+
+// Eval evaluates the prepared query and returns a ResultSet. The options
+// override the input, transaction, metrics, and tracers set on the Rego object
+// that prepared the query.
+func (pq PreparedEvalQuery) Eval(ctx context.Context, options ...EvalOption) (ResultSet, error) {
+
+	ectx, finish, err := pq.r.newEvalContext(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	defer finish(ctx)
+
+	return pq.r.eval(ctx, ectx, pq.qc, pq.compiled)
+}
+
+// PreparedPartialQuery holds a query that has been parsed and compiled for
+// partial evaluation. The query can be partially evaluated any number of times
+// and is safe for concurrent use.
+type PreparedPartialQuery struct {
+	r        *Rego
+	compiled ast.Body
+}
+
+// Partial runs partial evaluation on the prepared query and returns the
+// result. The options override the input, unknowns, transaction, metrics, and
+// tracers set on the Rego object that prepared the query.
+func (pq PreparedPartialQuery) Partial(ctx context.Context, options ...EvalOption) (*PartialQueries, error) {
+
+	ectx, finish, err := pq.r.newEvalContext(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	defer finish(ctx)
+
+	return pq.r.partial(ctx, ectx, pq.compiled)
+}
+
 // Result defines the output of Rego evaluation.
 type Result struct {
 	Expressions []*ExpressionValue `json:"expressions"`
@@ -151,14 +214,47 @@ type Rego struct {
 	tracers          []topdown.Tracer
 	tracebuf         *topdown.BufferTracer
 	trace            bool
-	instrumentation  *topdown.Instrumentation
 	instrument       bool
 	capture          map[*ast.Expr]ast.Var // map exprs to generated capture vars
 	termVarID        int
 	dump             io.Writer
 	runtime          *ast.Term
+	builtinDecls     map[string]*ast.Builtin
+	builtinFuncs     map[string]*topdown.Builtin
+	limits           topdown.Limits
+	interQueryCache  cache.InterQueryCache
+}
+
+// Function represents the declaration of a custom built-in function that is
+// callable in Rego.
+type Function struct {
+	Name string
+	Decl *types.Function
 }
 
+// BuiltinContext contains context from the evaluator that may be used by
+// custom built-in functions.
+type BuiltinContext = topdown.BuiltinContext
+
+type (
+	// Builtin1 defines the implementation of a custom built-in function that
+	// takes one operand. If the function returns a nil term and no error, the
+	// result is undefined.
+	Builtin1 func(bctx BuiltinContext, op1 *ast.Term) (*ast.Term, error)
+
+	// Builtin2 defines the implementation of a custom built-in function that
+	// takes two operands.
+	Builtin2 func(bctx BuiltinContext, op1, op2 *ast.Term) (*ast.Term, error)
+
+	// Builtin3 defines the implementation of a custom built-in function that
+	// takes three operands.
+	Builtin3 func(bctx BuiltinContext, op1, op2, op3 *ast.Term) (*ast.Term, error)
+
+	// BuiltinDyn defines the implementation of a custom built-in function that
+	// takes any number of operands.
+	BuiltinDyn func(bctx BuiltinContext, terms []*ast.Term) (*ast.Term, error)
+)
+
 // Dump returns an argument that sets the writer to dump debugging information to.
 func Dump(w io.Writer) func(r *Rego) {
 	return func(r *Rego) {
@@ -314,6 +410,22 @@ func Tracer(t topdown.Tracer) func(r *Rego) {
 	}
 }
 
+// Limits returns an argument that sets the resource limits to enforce during
+// evaluation.
+func Limits(limits topdown.Limits) func(r *Rego) {
+	return func(r *Rego) {
+		r.limits = limits
+	}
+}
+
+// InterQueryBuiltinCache returns an argument that sets the inter-query cache
+// that built-in functions can use to share values across evaluations.
+func InterQueryBuiltinCache(c cache.InterQueryCache) func(r *Rego) {
+	return func(r *Rego) {
+		r.interQueryCache = c
+	}
+}
+
 // Runtime returns an argument that sets the runtime data to provide to the
 // evaluation engine.
 func Runtime(term *ast.Term) func(r *Rego) {
@@ -322,6 +434,76 @@ func Runtime(term *ast.Term) func(r *Rego) {
 	}
 }
 
+// Function1 returns an argument that adds a custom built-in function with one
+// operand to r. The built-in is only visible to r. If a compiler is provided
+// with the Compiler option, the built-in declaration must also be added to it
+// with ast.Compiler.WithBuiltins.
+func Function1(decl *Function, f Builtin1) func(r *Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term, iter func(*ast.Term) error) error {
+		result, err := f(bctx, terms[0])
+		return finishFunction(decl.Name, bctx, result, err, iter)
+	})
+}
+
+// Function2 returns an argument that adds a custom built-in function with two
+// operands to r. See Function1 for details.
+func Function2(decl *Function, f Builtin2) func(r *Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term, iter func(*ast.Term) error) error {
+		result, err := f(bctx, terms[0], terms[1])
+		return finishFunction(decl.Name, bctx, result, err, iter)
+	})
+}
+
+// Function3 returns an argument that adds a custom built-in function with
+// three operands to r. See Function1 for details.
+func Function3(decl *Function, f Builtin3) func(r *Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term, iter func(*ast.Term) error) error {
+		result, err := f(bctx, terms[0], terms[1], terms[2])
+		return finishFunction(decl.Name, bctx, result, err, iter)
+	})
+}
+
+// FunctionDyn returns an argument that adds a custom built-in function with
+// any number of operands to r. The operands are passed to f in the order
+// declared. See Function1 for details.
+func FunctionDyn(decl *Function, f BuiltinDyn) func(r *Rego) {
+	return newFunction(decl, func(bctx BuiltinContext, terms []*ast.Term, iter func(*ast.Term) error) error {
+		result, err := f(bctx, terms[:len(decl.Decl.Args())])
+		return finishFunction(decl.Name, bctx, result, err, iter)
+	})
+}
+
+func newFunction(decl *Function, f topdown.BuiltinFunc) func(r *Rego) {
+	return func(r *Rego) {
+		bi := &ast.Builtin{
+			Name: decl.Name,
+			Decl: decl.Decl,
+		}
+		r.builtinDecls[decl.Name] = bi
+		r.builtinFuncs[decl.Name] = &topdown.Builtin{
+			Decl: bi,
+			Func: f,
+		}
+	}
+}
+
+func finishFunction(name string, bctx BuiltinContext, result *ast.Term, err error, iter func(*ast.Term) error) error {
+	if err != nil {
+		if _, ok := err.(*topdown.Error); ok {
+			return err
+		}
+		return &topdown.Error{
+			Code:     topdown.InternalErr,
+			Message:  fmt.Sprintf("%v: %v", name, err.Error()),
+			Location: bctx.Location,
+		}
+	}
+	if result == nil {
+		return nil
+	}
+	return iter(result)
+}
+
 // PrintTrace is a helper fnuction to write a human-readable version of the
 // trace to the writer w.
 func PrintTrace(w io.Writer, r *Rego) {
@@ -331,11 +513,127 @@ func PrintTrace(w io.Writer, r *Rego) {
 	topdown.PrettyTrace(w, *r.tracebuf)
 }
 
+// EvalContext contains the options that can be set each time a prepared query
+// is evaluated. All other options are fixed when the query is prepared.
+type EvalContext struct {
+	hasInput         bool
+	rawInput         *interface{}
+	parsedInput      ast.Value
+	metrics          metrics.Metrics
+	txn              storage.Transaction
+	instrument       bool
+	instrumentation  *topdown.Instrumentation
+	partialNamespace string
+	tracers          []topdown.Tracer
+	unknowns         []string
+	parsedUnknowns   []*ast.Term
+	limits           topdown.Limits
+	interQueryCache  cache.InterQueryCache
+}
+
+// EvalOption sets an option on the EvalContext of a prepared query.
+type EvalOption func(*EvalContext)
+
+// EvalInput returns an argument that sets the input document for evaluation.
+// Input should be a native Go value representing the input document.
+func EvalInput(x interface{}) EvalOption {
+	return func(e *EvalContext) {
+		e.hasInput = true
+		e.rawInput = &x
+		e.parsedInput = nil
+	}
+}
+
+// EvalParsedInput returns an argument that sets the input document for
+// evaluation.
+func EvalParsedInput(x ast.Value) EvalOption {
+	return func(e *EvalContext) {
+		e.hasInput = true
+		e.rawInput = nil
+		e.parsedInput = x
+	}
+}
+
+// EvalMetrics returns an argument that sets the metrics collection for
+// evaluation.
+func EvalMetrics(m metrics.Metrics) EvalOption {
+	return func(e *EvalContext) {
+		e.metrics = m
+	}
+}
+
+// EvalTransaction returns an argument that sets the transaction to use for
+// storage layer operations during evaluation.
+func EvalTransaction(txn storage.Transaction) EvalOption {
+	return func(e *EvalContext) {
+		e.txn = txn
+	}
+}
+
+// EvalInstrument returns an argument that enables instrumentation for
+// evaluation.
+func EvalInstrument(yes bool) EvalOption {
+	return func(e *EvalContext) {
+		e.instrument = yes
+	}
+}
+
+// EvalTracer returns an argument that adds a query tracer for evaluation.
+func EvalTracer(t topdown.Tracer) EvalOption {
+	return func(e *EvalContext) {
+		if t != nil {
+			e.tracers = append(e.tracers, t)
+		}
+	}
+}
+
+// EvalLimits returns an argument that sets the resource limits to enforce
+// during evaluation.
+func EvalLimits(limits topdown.Limits) EvalOption {
+	return func(e *EvalContext) {
+		e.limits = limits
+	}
+}
+
+// EvalInterQueryBuiltinCache returns an argument that sets the inter-query
+// cache that built-in functions can use to share values across evaluations.
+func EvalInterQueryBuiltinCache(c cache.InterQueryCache) EvalOption {
+	return func(e *EvalContext) {
+		e.interQueryCache = c
+	}
+}
+
+// EvalPartialNamespace returns an argument that sets the namespace to use for
+// partial evaluation results.
+func EvalPartialNamespace(ns string) EvalOption {
+	return func(e *EvalContext) {
+		e.partialNamespace = ns
+	}
+}
+
+// EvalUnknowns returns an argument that sets the values to treat as unknown
+// during partial evaluation.
+func EvalUnknowns(unknowns []string) EvalOption {
+	return func(e *EvalContext) {
+		e.unknowns = unknowns
+	}
+}
+
+// EvalParsedUnknowns returns an argument that sets the values to treat as
+// unknown during partial evaluation.
+func EvalParsedUnknowns(unknowns []*ast.Term) EvalOption {
+	return func(e *EvalContext) {
+		e.parsedUnknowns = unknowns
+	}
+}
+
 // New returns a new Rego object.
 func New(options ...func(*Rego)) *Rego {
 
 	r := &Rego{
-		capture: map[*ast.Expr]ast.Var{},
+		capture:      map[*ast.Expr]ast.Var{},
+		builtinDecls: map[string]*ast.Builtin{},
+		builtinFuncs: map[string]*topdown.Builtin{},
 	}
 
 	for _, option := range options {
@@ -343,7 +641,7 @@ func New(options ...func(*Rego)) *Rego {
 	}
 
 	if r.compiler == nil {
-		r.compiler = ast.NewCompiler()
+		r.compiler = ast.NewCompiler().WithBuiltins(r.builtinDecls)
 	}
 
 	if r.store == nil {
@@ -354,10 +652,6 @@ func New(options ...func(*Rego)) *Rego {
 		r.metrics = metrics.New()
 	}
 
-	if r.instrument {
-		r.instrumentation = topdown.NewInstrumentation(r.metrics)
-	}
-
 	if r.trace {
 		r.tracebuf = topdown.NewBufferTracer()
 		r.tracers = append(r.tracers, r.tracebuf)
@@ -369,18 +663,30 @@ func New(options ...func(*Rego)) *Rego {
 // Eval evaluates this Rego object and returns a ResultSet.
 func (r *Rego) Eval(ctx context.Context) (ResultSet, error) {
 
+	pq, err := r.PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.Eval(ctx, r.evalOptions()...)
+}
+
+// PrepareForEval parses and compiles the modules and query on r and returns a
+// PreparedEvalQuery that can be evaluated repeatedly with different inputs.
+func (r *Rego) PrepareForEval(ctx context.Context) (PreparedEvalQuery, error) {
+
 	if len(r.query) == 0 && len(r.parsedQuery) == 0 {
-		return nil, fmt.Errorf("cannot evaluate empty query")
+		return PreparedEvalQuery{}, fmt.Errorf("cannot evaluate empty query")
 	}
 
 	parsed, query, err := r.parse()
 	if err != nil {
-		return nil, err
+		return PreparedEvalQuery{}, err
 	}
 
 	err = r.compileModules(parsed)
 	if err != nil {
-		return nil, err
+		return PreparedEvalQuery{}, err
 	}
 
 	qc, compiled, err := r.compileQuery([]extraStage{
@@ -391,20 +697,10 @@ func (r *Rego) Eval(ctx context.Context) (ResultSet, error) {
 	}, query)
 
 	if err != nil {
-		return nil, err
+		return PreparedEvalQuery{}, err
 	}
 
-	txn := r.txn
-
-	if txn == nil {
-		txn, err = r.store.NewTransaction(ctx)
-		if err != nil {
-			return nil, err
-		}
-		defer r.store.Abort(ctx, txn)
-	}
-
-	return r.eval(ctx, qc, compiled, txn)
+	return PreparedEvalQuery{r: r, qc: qc, compiled: compiled}, nil
 }
 
 // PartialEval has been deprecated and renamed to PartialResult.
@@ -440,62 +736,51 @@ func (r *Rego) PartialResult(ctx context.Context) (PartialResult, error) {
 		return PartialResult{}, err
 	}
 
-	txn := r.txn
-
-	if txn == nil {
-		txn, err = r.store.NewTransaction(ctx)
-		if err != nil {
-			return PartialResult{}, err
-		}
-		defer r.store.Abort(ctx, txn)
+	ectx, finish, err := r.newEvalContext(ctx, r.evalOptions())
+	if err != nil {
+		return PartialResult{}, err
 	}
 
-	partialNamespace := r.partialNamespace
-	if partialNamespace == "" {
-		partialNamespace = defaultPartialNamespace
-	}
+	defer finish(ctx)
 
-	return r.partialResult(ctx, compiled, txn, partialNamespace, ast.Wildcard)
+	return r.partialResult(ctx, ectx, compiled, ast.Wildcard)
 }
 
 // Partial runs partial evaluation on r and returns the result.
 func (r *Rego) Partial(ctx context.Context) (*PartialQueries, error) {
 
+	pq, err := r.PrepareForPartial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.Partial(ctx, r.evalOptions()...)
+}
+
+// PrepareForPartial parses and compiles the modules and query on r and returns
+// a PreparedPartialQuery that can be partially evaluated repeatedly.
+func (r *Rego) PrepareForPartial(ctx context.Context) (PreparedPartialQuery, error) {
+
 	if len(r.query) == 0 && len(r.parsedQuery) == 0 {
-		return nil, fmt.Errorf("cannot evaluate empty query")
+		return PreparedPartialQuery{}, fmt.Errorf("cannot evaluate empty query")
 	}
 
 	parsed, query, err := r.parse()
 	if err != nil {
-		return nil, err
+		return PreparedPartialQuery{}, err
 	}
 
 	err = r.compileModules(parsed)
 	if err != nil {
-		return nil, err
+		return PreparedPartialQuery{}, err
 	}
 
 	_, compiled, err := r.compileQuery(nil, query)
 	if err != nil {
-		return nil, err
-	}
-
-	txn := r.txn
-
-	if txn == nil {
-		txn, err = r.store.NewTransaction(ctx)
-		if err != nil {
-			return nil, err
-		}
-		defer r.store.Abort(ctx, txn)
-	}
-
-	partialNamespace := r.partialNamespace
-	if partialNamespace == "" {
-		partialNamespace = defaultPartialNamespace
+		return PreparedPartialQuery{}, err
 	}
 
-	return r.partial(ctx, compiled, txn, partialNamespace)
+	return PreparedPartialQuery{r: r, compiled: compiled}, nil
 }
 
 // Compile returnss a compiled policy query.
@@ -627,29 +912,9 @@ func (r *Rego) compileQuery(extras []extraStage, query ast.Body) (ast.QueryCompi
 		imports = append(imports, parsed...)
 	}
 
-	var input ast.Value
-
-	if r.rawInput != nil {
-		rawPtr := util.Reference(r.rawInput)
-		// roundtrip through json: this turns slices (e.g. []string, []bool) into
-		// []interface{}, the only array type ast.InterfaceToValue can work with
-		if err := util.RoundTrip(rawPtr); err != nil {
-			return nil, nil, err
-		}
-		val, err := ast.InterfaceToValue(*rawPtr)
-		if err != nil {
-			return nil, nil, err
-		}
-		input = val
-		r.input = val
-	} else {
-		input = r.input
-	}
-
 	qctx := ast.NewQueryContext().
 		WithPackage(pkg).
-		WithImports(imports).
-		WithInput(input)
+		WithImports(imports)
 
 	qc := r.compiler.QueryCompiler().WithContext(qctx)
 
@@ -662,22 +927,107 @@ func (r *Rego) compileQuery(extras []extraStage, query ast.Body) (ast.QueryCompi
 
 }
 
-func (r *Rego) eval(ctx context.Context, qc ast.QueryCompiler, compiled ast.Body, txn storage.Transaction) (rs ResultSet, err error) {
+// evalOptions returns the evaluation options set on r. The options are used
+// when r is evaluated directly rather than through a prepared query.
+func (r *Rego) evalOptions() []EvalOption {
+	options := []EvalOption{
+		EvalTransaction(r.txn),
+		EvalMetrics(r.metrics),
+		EvalInstrument(r.instrument),
+		EvalLimits(r.limits),
+		EvalInterQueryBuiltinCache(r.interQueryCache),
+	}
+	for i := range r.tracers {
+		options = append(options, EvalTracer(r.tracers[i]))
+	}
+	return options
+}
+
+// newEvalContext returns the context for a single evaluation. Options that are
+// not set fall back to the values on r. If the caller does not provide a
+// transaction, a new one is opened and closed by the returned function.
+func (r *Rego) newEvalContext(ctx context.Context, options []EvalOption) (*EvalContext, func(context.Context), error) {
+
+	ectx := &EvalContext{
+		partialNamespace: r.partialNamespace,
+		unknowns:         r.unknowns,
+		parsedUnknowns:   r.parsedUnknowns,
+	}
+
+	for _, option := range options {
+		option(ectx)
+	}
+
+	if ectx.partialNamespace == "" {
+		ectx.partialNamespace = defaultPartialNamespace
+	}
+
+	if ectx.metrics == nil {
+		ectx.metrics = metrics.New()
+	}
+
+	if ectx.instrument {
+		ectx.instrumentation = topdown.NewInstrumentation(ectx.metrics)
+	}
+
+	if !ectx.hasInput {
+		ectx.rawInput = r.rawInput
+		ectx.parsedInput = r.input
+	}
+
+	if ectx.rawInput != nil {
+		input, err := parseRawInput(ectx.rawInput)
+		if err != nil {
+			return nil, nil, err
+		}
+		ectx.parsedInput = input
+	}
+
+	finish := func(context.Context) {}
+
+	if ectx.txn == nil {
+		txn, err := r.store.NewTransaction(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		ectx.txn = txn
+		finish = func(ctx context.Context) {
+			r.store.Abort(ctx, txn)
+		}
+	}
+
+	return ectx, finish, nil
+}
+
+func parseRawInput(rawInput *interface{}) (ast.Value, error) {
+	rawPtr := util.Reference(rawInput)
+	// roundtrip through json: this turns slices (e.g. []string, []bool) into
+	// []interface{}, the only array type ast.InterfaceToValue can work with
+	if err := util.RoundTrip(rawPtr); err != nil {
+		return nil, err
+	}
+	return ast.InterfaceToValue(*rawPtr)
+}
+
+func (r *Rego) eval(ctx context.Context, ectx *EvalContext, qc ast.QueryCompiler, compiled ast.Body) (rs ResultSet, err error) {
 
 	q := topdown.NewQuery(compiled).
 		WithCompiler(r.compiler).
 		WithStore(r.store).
-		WithTransaction(txn).
-		WithMetrics(r.metrics).
-		WithInstrumentation(r.instrumentation).
-		WithRuntime(r.runtime)
+		WithTransaction(ectx.txn).
+		WithMetrics(ectx.metrics).
+		WithInstrumentation(ectx.instrumentation).
+		WithRuntime(r.runtime).
+		WithBuiltins(r.builtinFuncs).
+		WithLimits(ectx.limits).
+		WithInterQueryBuiltinCache(ectx.interQueryCache)
 
-	for i := range r.tracers {
-		q = q.WithTracer(r.tracers[i])
+	for i := range ectx.tracers {
+		q = q.WithTracer(ectx.tracers[i])
 	}
 
-	if r.input != nil {
-		q = q.WithInput(ast.NewTerm(r.input))
+	if ectx.parsedInput != nil {
+		q = q.WithInput(ast.NewTerm(ectx.parsedInput))
 	}
 
 	// Cancel query if context is cancelled or deadline is reached.
@@ -735,13 +1085,15 @@ func (r *Rego) eval(ctx context.Context, qc ast.QueryCompiler, compiled ast.Body
 	return rs, nil
 }
 
-func (r *Rego) partialResult(ctx context.Context, compiled ast.Body, txn storage.Transaction, partialNamespace string, output *ast.Term) (PartialResult, error) {
+func (r *Rego) partialResult(ctx context.Context, ectx *EvalContext, compiled ast.Body, output *ast.Term) (PartialResult, error) {
 
-	pq, err := r.partial(ctx, compiled, txn, partialNamespace)
+	pq, err := r.partial(ctx, ectx, compiled)
 	if err != nil {
 		return PartialResult{}, err
 	}
 
+	partialNamespace := ectx.partialNamespace
+
 	// Construct module for queries.
 	module := ast.MustParseModule("package " + partialNamespace)
 	module.Rules = make([]*ast.Rule, len(pq.Queries))
@@ -765,25 +1117,27 @@ func (r *Rego) partialResult(ctx context.Context, compiled ast.Body, txn storage
 	}
 
 	result := PartialResult{
-		compiler: r.compiler,
-		store:    r.store,
-		body:     ast.MustParseBody(fmt.Sprintf("data.%v.__result__", partialNamespace)),
+		compiler:     r.compiler,
+		store:        r.store,
+		body:         ast.MustParseBody(fmt.Sprintf("data.%v.__result__", partialNamespace)),
+		builtinDecls: r.builtinDecls,
+		builtinFuncs: r.builtinFuncs,
 	}
 
 	return result, nil
 }
 
-func (r *Rego) partial(ctx context.Context, compiled ast.Body, txn storage.Transaction, partialNamespace string) (*PartialQueries, error) {
+func (r *Rego) partial(ctx context.Context, ectx *EvalContext, compiled ast.Body) (*PartialQueries, error) {
 
 	var unknowns []*ast.Term
 
-	if r.parsedUnknowns != nil {
-		unknowns = r.parsedUnknowns
-	} else if r.unknowns != nil {
-		unknowns = make([]*ast.Term, len(r.unknowns))
-		for i := range r.unknowns {
+	if ectx.parsedUnknowns != nil {
+		unknowns = ectx.parsedUnknowns
+	} else if ectx.unknowns != nil {
+		unknowns = make([]*ast.Term, len(ectx.unknowns))
+		for i := range ectx.unknowns {
 			var err error
-			unknowns[i], err = ast.ParseTerm(r.unknowns[i])
+			unknowns[i], err = ast.ParseTerm(ectx.unknowns[i])
 			if err != nil {
 				return nil, err
 			}
@@ -794,7 +1148,7 @@ func (r *Rego) partial(ctx context.Context, compiled ast.Body, txn storage.Trans
 	}
 
 	// Check partial namespace to ensure it's valid.
-	if term, err := ast.ParseTerm(partialNamespace); err != nil {
+	if term, err := ast.ParseTerm(ectx.partialNamespace); err != nil {
 		return nil, err
 	} else if _, ok := term.Value.(ast.Var); !ok {
 		return nil, fmt.Errorf("bad partial namespace")
@@ -803,18 +1157,21 @@ func (r *Rego) partial(ctx context.Context, compiled ast.Body, txn storage.Trans
 	q := topdown.NewQuery(compiled).
 		WithCompiler(r.compiler).
 		WithStore(r.store).
-		WithTransaction(txn).
-		WithMetrics(r.metrics).
-		WithInstrumentation(r.instrumentation).
+		WithTransaction(ectx.txn).
+		WithMetrics(ectx.metrics).
+		WithInstrumentation(ectx.instrumentation).
 		WithUnknowns(unknowns).
-		WithRuntime(r.runtime)
+		WithRuntime(r.runtime).
+		WithBuiltins(r.builtinFuncs).
+		WithLimits(ectx.limits).
+		WithInterQueryBuiltinCache(ectx.interQueryCache)
 
-	for i := range r.tracers {
-		q = q.WithTracer(r.tracers[i])
+	for i := range ectx.tracers {
+		q = q.WithTracer(ectx.tracers[i])
 	}
 
-	if r.input != nil {
-		q = q.WithInput(ast.NewTerm(r.input))
+	if ectx.parsedInput != nil {
+		q = q.WithInput(ast.NewTerm(ectx.parsedInput))
 	}
 
 	// Cancel query if context is cancelled or deadline is reached.
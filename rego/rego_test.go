@@ -7,7 +7,9 @@ package rego
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -255,3 +257,432 @@ func TestRegoMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestPrepareForEval(t *testing.T) {
+
+	ctx := context.Background()
+
+	r := New(
+		Query("data.test.x = y"),
+		Module("test.rego", `package test
+
+		x = input.a + 1`),
+		Input(map[string]interface{}{"a": 1}),
+	)
+
+	pq, err := r.PrepareForEval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		note     string
+		options  []EvalOption
+		expected interface{}
+	}{
+		{
+			note:     "fallback to rego input",
+			expected: json.Number("2"),
+		},
+		{
+			note:     "raw input",
+			options:  []EvalOption{EvalInput(map[string]interface{}{"a": 10})},
+			expected: json.Number("11"),
+		},
+		{
+			note:     "parsed input",
+			options:  []EvalOption{EvalParsedInput(ast.MustParseTerm(`{"a": 20}`).Value)},
+			expected: json.Number("21"),
+		},
+		{
+			note:    "undefined input",
+			options: []EvalOption{EvalParsedInput(ast.MustParseTerm(`{"b": 20}`).Value)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			rs, err := pq.Eval(ctx, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected == nil {
+				if len(rs) != 0 {
+					t.Fatalf("Expected undefined result but got: %v", rs)
+				}
+				return
+			}
+			if len(rs) != 1 || !reflect.DeepEqual(rs[0].Bindings["y"], tc.expected) {
+				t.Fatalf("Expected y to be %v but got: %v", tc.expected, rs)
+			}
+		})
+	}
+}
+
+func TestPrepareForEvalMetrics(t *testing.T) {
+
+	ctx := context.Background()
+
+	pq, err := New(Query("data.x = 1"), Module("test.rego", "package x")).PrepareForEval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+
+	if _, err := pq.Eval(ctx, EvalMetrics(m)); err != nil {
+		t.Fatal(err)
+	}
+
+	all := m.All()
+
+	if _, ok := all["timer_rego_query_eval_ns"]; !ok {
+		t.Fatal("Expected eval timer to be recorded")
+	}
+
+	for _, name := range []string{"timer_rego_query_parse_ns", "timer_rego_query_compile_ns", "timer_rego_module_compile_ns"} {
+		if _, ok := all[name]; ok {
+			t.Errorf("Expected %v not to be recorded during evaluation", name)
+		}
+	}
+}
+
+func TestPrepareForEvalConcurrent(t *testing.T) {
+
+	ctx := context.Background()
+
+	pq, err := New(Query("x = input.a * 2")).PrepareForEval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 50
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			rs, err := pq.Eval(ctx, EvalInput(map[string]interface{}{"a": i}))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if exp := json.Number(fmt.Sprint(i * 2)); len(rs) != 1 || rs[0].Bindings["x"] != exp {
+				errs <- fmt.Errorf("expected x to be %v but got: %v", exp, rs)
+				return
+			}
+			errs <- nil
+		}(i)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrepareForPartial(t *testing.T) {
+
+	ctx := context.Background()
+
+	r := New(
+		Query("data.test.p = true"),
+		Module("test.rego", `package test
+
+		p { input.x = data.test.y }
+		y = 1`),
+	)
+
+	pq, err := r.PrepareForPartial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := pq.Partial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := ast.MustParseBody("1 = input.x")
+
+	if len(result.Queries) != 1 || !result.Queries[0].Equal(exp) {
+		t.Fatalf("Expected %v but got: %v", exp, result.Queries)
+	}
+
+	// With the input known, the query is fully evaluated.
+	result, err = pq.Partial(ctx, EvalInput(map[string]interface{}{"x": 1}), EvalParsedUnknowns([]*ast.Term{ast.MustParseTerm("input.y")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Queries) != 1 || len(result.Queries[0]) != 0 {
+		t.Fatalf("Expected empty query but got: %v", result.Queries)
+	}
+}
+
+func TestRegoCustomBuiltins(t *testing.T) {
+
+	ctx := context.Background()
+
+	options := []func(*Rego){
+		Function1(&Function{
+			Name: "test.double",
+			Decl: types.NewFunction(types.Args(types.N), types.N),
+		}, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			n, ok := a.Value.(ast.Number)
+			if !ok {
+				return nil, fmt.Errorf("expected number")
+			}
+			i, _ := n.Int()
+			return ast.IntNumberTerm(i * 2), nil
+		}),
+		Function2(&Function{
+			Name: "test.concat",
+			Decl: types.NewFunction(types.Args(types.S, types.S), types.S),
+		}, func(_ BuiltinContext, a, b *ast.Term) (*ast.Term, error) {
+			return ast.StringTerm(string(a.Value.(ast.String)) + string(b.Value.(ast.String))), nil
+		}),
+		Function3(&Function{
+			Name: "test.between",
+			Decl: types.NewFunction(types.Args(types.N, types.N, types.N), types.B),
+		}, func(_ BuiltinContext, a, b, c *ast.Term) (*ast.Term, error) {
+			return ast.BooleanTerm(a.Value.Compare(b.Value) <= 0 && b.Value.Compare(c.Value) <= 0), nil
+		}),
+		FunctionDyn(&Function{
+			Name: "test.count_args",
+			Decl: types.NewFunction(types.Args(types.A, types.A, types.A, types.A), types.N),
+		}, func(_ BuiltinContext, terms []*ast.Term) (*ast.Term, error) {
+			return ast.IntNumberTerm(len(terms)), nil
+		}),
+		Function1(&Function{
+			Name: "test.undefined",
+			Decl: types.NewFunction(types.Args(types.A), types.A),
+		}, func(BuiltinContext, *ast.Term) (*ast.Term, error) {
+			return nil, nil
+		}),
+		Function1(&Function{
+			Name: "test.location",
+			Decl: types.NewFunction(types.Args(types.A), types.N),
+		}, func(bctx BuiltinContext, _ *ast.Term) (*ast.Term, error) {
+			return ast.IntNumberTerm(bctx.Location.Row), nil
+		}),
+	}
+
+	tests := []struct {
+		note     string
+		query    string
+		module   string
+		expected interface{}
+		wantErr  string
+	}{
+		{
+			note:     "one operand",
+			query:    "x = test.double(21)",
+			expected: json.Number("42"),
+		},
+		{
+			note:     "two operands",
+			query:    `x = test.concat("foo", "bar")`,
+			expected: "foobar",
+		},
+		{
+			note:     "three operands",
+			query:    "x = test.between(1, 2, 3)",
+			expected: true,
+		},
+		{
+			note:     "dynamic operands",
+			query:    "x = test.count_args(1, 2, 3, 4)",
+			expected: json.Number("4"),
+		},
+		{
+			note:  "undefined",
+			query: "x = test.undefined(1)",
+		},
+		{
+			note:     "builtin context",
+			query:    "x = test.location(1)",
+			expected: json.Number("1"),
+		},
+		{
+			note:     "called from module",
+			query:    "x = data.test.p",
+			module:   "package test\n\np = test.double(x) { x = 2 }",
+			expected: json.Number("4"),
+		},
+		{
+			note:    "type error",
+			query:   `x = test.double("a")`,
+			wantErr: "rego_type_error: test.double: invalid argument(s)",
+		},
+		{
+			note:    "error",
+			query:   "x = test.double(input)",
+			wantErr: "eval_internal_error: test.double: expected number",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			opts := append([]func(*Rego){Query(tc.query), Input("a")}, options...)
+			if tc.module != "" {
+				opts = append(opts, Module("test.rego", tc.module))
+			}
+			rs, err := New(opts...).Eval(ctx)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error %q but got: %v", tc.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected == nil {
+				if len(rs) != 0 {
+					t.Fatalf("Expected undefined result but got: %v", rs)
+				}
+				return
+			}
+			if len(rs) != 1 || !reflect.DeepEqual(rs[0].Bindings["x"], tc.expected) {
+				t.Fatalf("Expected x to be %v but got: %v", tc.expected, rs)
+			}
+		})
+	}
+}
+
+func TestRegoCustomBuiltinsIsolated(t *testing.T) {
+
+	ctx := context.Background()
+
+	decl := &Function{
+		Name: "test.isolated",
+		Decl: types.NewFunction(nil, types.B),
+	}
+
+	r := New(Query("test.isolated()"), Function1(decl, nil))
+	if _, err := r.PrepareForEval(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Query("test.isolated()")).Eval(ctx); err == nil || !strings.Contains(err.Error(), "undefined function test.isolated") {
+		t.Fatalf("Expected undefined function error but got: %v", err)
+	}
+
+	if _, ok := ast.BuiltinMap[decl.Name]; ok {
+		t.Fatal("Expected custom built-in not to be registered globally")
+	}
+}
+
+func TestRegoCustomBuiltinsPartial(t *testing.T) {
+
+	ctx := context.Background()
+
+	r := New(
+		Query("data.test.p = true"),
+		Module("test.rego", `package test
+
+		p { test.upper("a") = input.x }`),
+		Function1(&Function{
+			Name: "test.upper",
+			Decl: types.NewFunction(types.Args(types.S), types.S),
+		}, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			return ast.StringTerm(strings.ToUpper(string(a.Value.(ast.String)))), nil
+		}),
+	)
+
+	pq, err := r.Partial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := ast.MustParseBody(`"A" = input.x`)
+
+	if len(pq.Queries) != 1 || !pq.Queries[0].Equal(exp) {
+		t.Fatalf("Expected %v but got: %v", exp, pq.Queries)
+	}
+}
+
+func TestRegoCustomBuiltinsPartialResult(t *testing.T) {
+
+	ctx := context.Background()
+
+	r := New(
+		Query("data.test.p"),
+		Module("test.rego", `package test
+
+		p { test.upper(input.y) = input.x }`),
+		Function1(&Function{
+			Name: "test.upper",
+			Decl: types.NewFunction(types.Args(types.S), types.S),
+		}, func(_ BuiltinContext, a *ast.Term) (*ast.Term, error) {
+			return ast.StringTerm(strings.ToUpper(string(a.Value.(ast.String)))), nil
+		}),
+	)
+
+	pr, err := r.PartialResult(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := pr.Rego(Input(map[string]interface{}{"x": "A", "y": "a"})).Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != 1 || rs[0].Expressions[0].Value != true {
+		t.Fatalf("Expected true but got: %v", rs)
+	}
+}
+
+func TestRegoCustomBuiltinsContext(t *testing.T) {
+
+	type contextKey string
+
+	ctx := context.WithValue(context.Background(), contextKey("tenant"), "acmecorp")
+
+	r := New(
+		Query("x = test.tenant()"),
+		FunctionDyn(&Function{
+			Name: "test.tenant",
+			Decl: types.NewFunction(nil, types.S),
+		}, func(bctx BuiltinContext, _ []*ast.Term) (*ast.Term, error) {
+			return ast.StringTerm(bctx.Context.Value(contextKey("tenant")).(string)), nil
+		}),
+	)
+
+	rs, err := r.Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != 1 || rs[0].Bindings["x"] != "acmecorp" {
+		t.Fatalf("Expected context value to be passed to built-in but got: %v", rs)
+	}
+}
+
+func TestRegoLimits(t *testing.T) {
+
+	ctx := context.Background()
+	query := "x = [[i, j] | input[i]; input[j]]"
+	input := make([]interface{}, 20)
+
+	_, err := New(Query(query), Input(input), Limits(topdown.Limits{MaxSteps: 100})).Eval(ctx)
+	if !topdown.IsLimitExceeded(err) {
+		t.Fatalf("Expected limit error but got: %v", err)
+	}
+
+	pq, err := New(Query(query), Input(input)).PrepareForEval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pq.Eval(ctx, EvalLimits(topdown.Limits{MaxCollectionSize: 10}))
+	if !topdown.IsLimitExceeded(err) {
+		t.Fatalf("Expected limit error but got: %v", err)
+	}
+
+	rs, err := pq.Eval(ctx)
+	if err != nil || len(rs) != 1 {
+		t.Fatalf("Expected result without limits but got: %v (err: %v)", rs, err)
+	}
+}
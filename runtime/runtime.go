@@ -18,6 +18,8 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/config"
 	"github.com/open-policy-agent/opa/internal/runtime"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/plugins"
@@ -26,6 +28,7 @@ import (
 	"github.com/open-policy-agent/opa/repl"
 	"github.com/open-policy-agent/opa/server"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/disk"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/version"
 	"github.com/pkg/errors"
@@ -91,6 +94,11 @@ type Params struct {
 	// Optional filter that will be passed to the file loader.
 	Filter loader.Filter
 
+	// BundleVerificationConfig sets the key configuration used to verify the
+	// signature of bundles loaded from Paths. If nil, signatures are not
+	// verified.
+	BundleVerificationConfig *bundle.VerificationConfig
+
 	// Watch flag controls whether OPA will watch the Paths files for changes.
 	// If this flag is true, OPA will watch the Paths files for changes and
 	// reload the storage layer each time they change. This is useful for
@@ -154,21 +162,37 @@ func NewRuntime(ctx context.Context, params Params) (*Runtime, error) {
 		}
 	}
 
-	loaded, err := loader.Filtered(params.Paths, params.Filter)
+	loaded, err := loader.FilteredWithBundleVerification(params.Paths, params.Filter, params.BundleVerificationConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	store := inmem.New()
+	var bs []byte
+
+	if params.ConfigFile != "" {
+		bs, err = ioutil.ReadFile(params.ConfigFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "config error")
+		}
+	}
+
+	store, err := newStore(ctx, bs, params.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	txn, err := store.NewTransaction(ctx, storage.WriteParams)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := store.Write(ctx, txn, storage.AddOp, storage.Path{}, loaded.Documents); err != nil {
-		store.Abort(ctx, txn)
-		return nil, errors.Wrapf(err, "storage error")
+	// Documents are written key-by-key so that data persisted by the store
+	// under other keys is not discarded.
+	for key, value := range loaded.Documents {
+		if err := store.Write(ctx, txn, storage.AddOp, storage.Path{key}, value); err != nil {
+			store.Abort(ctx, txn)
+			return nil, errors.Wrapf(err, "storage error")
+		}
 	}
 
 	if err := compileAndStoreInputs(ctx, store, txn, loaded.Modules, params.ErrorLimit); err != nil {
@@ -180,15 +204,6 @@ func NewRuntime(ctx context.Context, params Params) (*Runtime, error) {
 		return nil, errors.Wrapf(err, "storage error")
 	}
 
-	var bs []byte
-
-	if params.ConfigFile != "" {
-		bs, err = ioutil.ReadFile(params.ConfigFile)
-		if err != nil {
-			return nil, errors.Wrapf(err, "config error")
-		}
-	}
-
 	info, err := runtime.Term(runtime.Params{Config: bs})
 	if err != nil {
 		return nil, err
@@ -350,7 +365,7 @@ func (rt *Runtime) readWatcher(ctx context.Context, watcher *fsnotify.Watcher, p
 
 func (rt *Runtime) processWatcherUpdate(ctx context.Context, paths []string, removed string) error {
 
-	loaded, err := loader.Filtered(paths, rt.Params.Filter)
+	loaded, err := loader.FilteredWithBundleVerification(paths, rt.Params.Filter, rt.Params.BundleVerificationConfig)
 	if err != nil {
 		return err
 	}
@@ -430,6 +445,36 @@ func compileAndStoreInputs(ctx context.Context, store storage.Store, txn storage
 	return nil
 }
 
+// newStore returns the store configured in the raw config. If no storage is
+// configured, the in-memory store is used.
+func newStore(ctx context.Context, raw []byte, id string) (storage.Store, error) {
+
+	if raw == nil {
+		return inmem.New(), nil
+	}
+
+	parsed, err := config.ParseConfig(raw, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "config error")
+	}
+
+	if parsed.Storage == nil || parsed.Storage.Disk == nil {
+		return inmem.New(), nil
+	}
+
+	opts, err := disk.ParseConfig(parsed.Storage.Disk)
+	if err != nil {
+		return nil, errors.Wrapf(err, "config error")
+	}
+
+	store, err := disk.New(ctx, *opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "storage error")
+	}
+
+	return store, nil
+}
+
 func warnDiagnosticPolicyDeprecated(c *ast.Compiler) {
 	rules := c.GetRules(ast.MustParseRef("data.system.diagnostics"))
 	if len(rules) > 0 {
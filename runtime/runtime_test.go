@@ -83,6 +83,62 @@ p = true { 1 = 2 }`
 	}
 }
 
+func TestInitDiskStorage(t *testing.T) {
+
+	fs := map[string]string{
+		"/data/x.json": `{"foo": "bar"}`,
+		"/config.yaml": `
+storage:
+  disk:
+    directory: store
+    partitions:
+      - /users
+`,
+	}
+
+	test.WithTempFS(fs, func(rootDir string) {
+		ctx := context.Background()
+
+		// Directory is relative to the working directory.
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(rootDir); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+
+		params := NewParams()
+		params.ConfigFile = path.Join(rootDir, "config.yaml")
+		params.Paths = []string{path.Join(rootDir, "data")}
+
+		rt, err := NewRuntime(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = storage.WriteOne(ctx, rt.Store, storage.AddOp, storage.MustParsePath("/users"), map[string]interface{}{"alice": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Restart without loading any files. The data should survive.
+		params.Paths = nil
+
+		rt, err = NewRuntime(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range []string{"/foo", "/users/alice"} {
+			if _, err := storage.ReadOne(ctx, rt.Store, storage.MustParsePath(p)); err != nil {
+				t.Fatalf("Expected %v to be persisted but got: %v", p, err)
+			}
+		}
+	})
+}
+
 func TestWatchPaths(t *testing.T) {
 
 	fs := map[string]string{
@@ -35,6 +35,7 @@ import (
 	"github.com/open-policy-agent/opa/server/writer"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/version"
 	"github.com/open-policy-agent/opa/watch"
@@ -101,6 +102,9 @@ type Server struct {
 	logger            func(context.Context, *Info)
 	errLimit          int
 	runtime           *ast.Term
+	timers            *prometheus.HistogramVec
+	counters          *prometheus.CounterVec
+	interQueryCache   cache.InterQueryCache
 }
 
 // Loop will contain all the calls from the server that we'll be listening on.
@@ -115,6 +119,13 @@ func New() *Server {
 // Init initializes the server. This function MUST be called before Loop.
 func (s *Server) Init(ctx context.Context) (*Server, error) {
 
+	cacheConfig, err := cache.ParseCachingConfig(s.manager.Config.Caching)
+	if err != nil {
+		return nil, err
+	}
+
+	s.interQueryCache = cache.NewInterQueryCache(cacheConfig)
+
 	s.initRouter()
 
 	// Add authorization handler. This must come BEFORE authentication handler
@@ -152,6 +163,7 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 	}
 
 	s.manager.RegisterCompilerTrigger(s.migrateWatcher)
+	s.manager.RegisterCacheTrigger(s.updateCacheConfig)
 
 	s.watcher, err = watch.New(ctx, s.store, s.getCompiler(), txn)
 	if err != nil {
@@ -339,14 +351,20 @@ func (s *Server) getListenerForUNIXSocket(u *url.URL) (Loop, error) {
 
 func (s *Server) initRouter() {
 
-	promRegistry := prometheus.NewRegistry()
-	duration := prometheus.NewHistogramVec(
+	// The registry is shared with the plugins so that their metrics are exposed
+	// on the same endpoint.
+	promRegistry := s.manager.PrometheusRegistry()
+	collector, err := s.manager.RegisterCollector(prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name: "http_request_duration_seconds",
 			Help: "A histogram of duration for requests.",
 		},
 		[]string{"code", "handler", "method"},
-	)
+	))
+	if err != nil {
+		panic(err)
+	}
+	duration := collector.(*prometheus.HistogramVec)
 	v0DataDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV0Data})
 	v1DataDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Data})
 	v1PoliciesDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerV1Policies})
@@ -355,7 +373,30 @@ func (s *Server) initRouter() {
 	indexDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerIndex})
 	catchAllDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerCatch})
 	GetHealthDur := duration.MustCurryWith(prometheus.Labels{"handler": PromHandlerHealth})
-	promRegistry.MustRegister(duration)
+
+	collector, err = s.manager.RegisterCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "rego_timer_duration_seconds",
+			Help: "A histogram of duration for policy engine timers, e.g., query parsing, compilation, and evaluation.",
+		},
+		[]string{"timer"},
+	))
+	if err != nil {
+		panic(err)
+	}
+	s.timers = collector.(*prometheus.HistogramVec)
+
+	collector, err = s.manager.RegisterCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rego_counter_total",
+			Help: "A counter for policy engine events, e.g., inter-query cache hits and misses of built-in functions.",
+		},
+		[]string{"counter"},
+	))
+	if err != nil {
+		panic(err)
+	}
+	s.counters = collector.(*prometheus.CounterVec)
 
 	router := s.router
 
@@ -439,6 +480,11 @@ func (s *Server) execQuery(ctx context.Context, r *http.Request, decisionID stri
 		rawInput = &x
 	}
 
+	limits, err := s.evalLimits(r)
+	if err != nil {
+		return results, err
+	}
+
 	compiler := s.getCompiler()
 
 	rego := rego.New(
@@ -450,6 +496,8 @@ func (s *Server) execQuery(ctx context.Context, r *http.Request, decisionID stri
 		rego.Instrument(instrument),
 		rego.Tracer(buf),
 		rego.Runtime(s.runtime),
+		rego.Limits(limits),
+		rego.InterQueryBuiltinCache(s.interQueryCache),
 	)
 
 	output, err := rego.Eval(ctx)
@@ -557,6 +605,10 @@ func (s *Server) migrateWatcher(txn storage.Transaction) {
 	}
 }
 
+func (s *Server) updateCacheConfig(cacheConfig *cache.Config) {
+	s.interQueryCache.UpdateConfig(cacheConfig)
+}
+
 func (s *Server) unversionedPost(w http.ResponseWriter, r *http.Request) {
 	s.v0QueryPath(w, r, s.manager.Config.DefaultDecisionRef())
 }
@@ -590,6 +642,12 @@ func (s *Server) v0QueryPath(w http.ResponseWriter, r *http.Request, path ast.Re
 		goInput = &x
 	}
 
+	limits, err := s.evalLimits(r)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
 	// Prepare for query.
 	txn, err := s.store.NewTransaction(ctx)
 	if err != nil {
@@ -615,6 +673,8 @@ func (s *Server) v0QueryPath(w http.ResponseWriter, r *http.Request, path ast.Re
 		rego.Instrument(diagLogger.Instrument()),
 		rego.Tracer(buf),
 		rego.Runtime(s.runtime),
+		rego.Limits(limits),
+		rego.InterQueryBuiltinCache(s.interQueryCache),
 	)
 
 	rs, err := rego.Eval(ctx)
@@ -762,6 +822,12 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.RegoQueryParse).Stop()
 
+	limits, err := s.evalLimits(r)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
 	txn, err := s.store.NewTransaction(ctx)
 	if err != nil {
 		writer.ErrorAuto(w, err)
@@ -791,6 +857,8 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		rego.Instrument(instrument),
 		rego.Metrics(m),
 		rego.Runtime(s.runtime),
+		rego.Limits(limits),
+		rego.InterQueryBuiltinCache(s.interQueryCache),
 	)
 
 	pq, err := eval.Partial(ctx)
@@ -799,6 +867,8 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.observeMetrics(m)
+
 	result := types.CompileResponseV1{}
 
 	if includeMetrics || includeInstrumentation {
@@ -869,6 +939,12 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 		goInput = &x
 	}
 
+	limits, err := s.evalLimits(r)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
 	// Prepare for query.
 	txn, err := s.store.NewTransaction(ctx)
 	if err != nil {
@@ -900,6 +976,8 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 		rego.Tracer(buf),
 		rego.Instrument(instrument),
 		rego.Runtime(s.runtime),
+		rego.Limits(limits),
+		rego.InterQueryBuiltinCache(s.interQueryCache),
 	)
 
 	rs, err := rego.Eval(ctx)
@@ -1023,6 +1101,12 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.RegoQueryParse).Stop()
 
+	limits, err := s.evalLimits(r)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
 	txn, err := s.store.NewTransaction(ctx)
 	if err != nil {
 		writer.ErrorAuto(w, err)
@@ -1048,7 +1132,7 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 		instrument = true
 	}
 
-	rego, err := s.makeRego(ctx, partial, txn, input, path.String(), m, instrument, buf, opts)
+	rego, err := s.makeRego(ctx, partial, txn, input, path.String(), m, instrument, buf, limits, opts)
 
 	if err != nil {
 		diagLogger.Log(ctx, decisionID, r.RemoteAddr, path.String(), "", goInput, nil, err, m, nil)
@@ -1586,6 +1670,7 @@ func (s *Server) evalDiagnosticPolicy(r *http.Request) (logger diagnosticsLogger
 	defer func() {
 		logger.revision = s.revision
 		logger.logger = s.logger
+		logger.observe = s.observeMetrics
 	}()
 
 	if s.diagnostics == nil {
@@ -1683,14 +1768,14 @@ func (s *Server) getCompiler() *ast.Compiler {
 	return s.manager.GetCompiler()
 }
 
-func (s *Server) makeRego(ctx context.Context, partial bool, txn storage.Transaction, input ast.Value, path string, m metrics.Metrics, instrument bool, tracer topdown.Tracer, opts []func(*rego.Rego)) (*rego.Rego, error) {
+func (s *Server) makeRego(ctx context.Context, partial bool, txn storage.Transaction, input ast.Value, path string, m metrics.Metrics, instrument bool, tracer topdown.Tracer, limits topdown.Limits, opts []func(*rego.Rego)) (*rego.Rego, error) {
 
 	if partial {
 		s.mtx.Lock()
 		defer s.mtx.Unlock()
 		pr, ok := s.partials[path]
 		if !ok {
-			opts = append(opts, rego.Transaction(txn), rego.Query(path), rego.Metrics(m), rego.Instrument(instrument), rego.Runtime(s.runtime))
+			opts = append(opts, rego.Transaction(txn), rego.Query(path), rego.Metrics(m), rego.Instrument(instrument), rego.Runtime(s.runtime), rego.Limits(limits), rego.InterQueryBuiltinCache(s.interQueryCache))
 			r := rego.New(opts...)
 			var err error
 			pr, err = r.PartialResult(ctx)
@@ -1705,14 +1790,42 @@ func (s *Server) makeRego(ctx context.Context, partial bool, txn storage.Transac
 			rego.Metrics(m),
 			rego.Instrument(instrument),
 			rego.Tracer(tracer),
+			rego.Limits(limits),
+			rego.InterQueryBuiltinCache(s.interQueryCache),
 		}
 		return pr.Rego(opts...), nil
 	}
 
-	opts = append(opts, rego.Transaction(txn), rego.Query(path), rego.ParsedInput(input), rego.Metrics(m), rego.Tracer(tracer), rego.Instrument(instrument), rego.Runtime(s.runtime))
+	opts = append(opts, rego.Transaction(txn), rego.Query(path), rego.ParsedInput(input), rego.Metrics(m), rego.Tracer(tracer), rego.Instrument(instrument), rego.Runtime(s.runtime), rego.Limits(limits), rego.InterQueryBuiltinCache(s.interQueryCache))
 	return rego.New(opts...), nil
 }
 
+// evalLimits returns the resource limits to enforce when evaluating policies
+// for r. The limits are read from the configuration. The timeout parameter may
+// lower, but not raise, the configured timeout.
+func (s *Server) evalLimits(r *http.Request) (topdown.Limits, error) {
+
+	var limits topdown.Limits
+
+	if c := s.manager.Config.EvalLimits; c != nil {
+		limits.MaxSteps = c.MaxSteps
+		limits.MaxCollectionSize = c.MaxCollectionSize
+		limits.Timeout = time.Duration(c.TimeoutSeconds * float64(time.Second))
+	}
+
+	if values := r.URL.Query()[types.ParamTimeoutV1]; len(values) > 0 {
+		timeout, err := time.ParseDuration(values[len(values)-1])
+		if err != nil || timeout <= 0 {
+			return limits, types.BadRequestErr(fmt.Sprintf("invalid %v parameter: %v", types.ParamTimeoutV1, values[len(values)-1]))
+		}
+		if limits.Timeout == 0 || timeout < limits.Timeout {
+			limits.Timeout = timeout
+		}
+	}
+
+	return limits, nil
+}
+
 func (s *Server) prepareV1PatchSlice(root string, ops []types.PatchV1) (result []patchImpl, err error) {
 
 	root = "/" + strings.Trim(root, "/")
@@ -2099,8 +2212,35 @@ func renderVersion(w http.ResponseWriter) {
 	fmt.Fprintln(w, "<br>")
 }
 
+// observeMetrics records the timers and counters in m in the Prometheus
+// registry so that parse, compile, and evaluation latencies and events are
+// aggregated across requests.
+func (s *Server) observeMetrics(m metrics.Metrics) {
+	if s.timers == nil {
+		return
+	}
+	for key, value := range m.All() {
+		if strings.HasPrefix(key, "counter_") {
+			if n, ok := value.(uint64); ok && n > 0 && s.counters != nil {
+				s.counters.WithLabelValues(strings.TrimPrefix(key, "counter_")).Add(float64(n))
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, "timer_") || !strings.HasSuffix(key, "_ns") {
+			continue
+		}
+		ns, ok := value.(int64)
+		if !ok || ns <= 0 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "timer_"), "_ns")
+		s.timers.WithLabelValues(name).Observe(time.Duration(ns).Seconds())
+	}
+}
+
 type diagnosticsLogger struct {
 	logger     func(context.Context, *Info)
+	observe    func(metrics.Metrics)
 	revision   string
 	explain    bool
 	instrument bool
@@ -2134,6 +2274,10 @@ func (l diagnosticsLogger) Log(ctx context.Context, decisionID, remoteAddr, path
 		info.Trace = *tracer
 	}
 
+	if l.observe != nil && m != nil {
+		l.observe(m)
+	}
+
 	if l.logger != nil {
 		l.logger(ctx, info)
 	}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/config"
 	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/server/identifier"
@@ -1068,6 +1069,76 @@ func TestDataWatchDocsExample(t *testing.T) {
 	}
 }
 
+func TestDataEvalLimits(t *testing.T) {
+	f := newFixture(t)
+
+	f.server.manager.Config.EvalLimits = &config.EvalLimits{MaxSteps: 100}
+
+	if err := f.v1TestRequests([]tr{
+		{http.MethodPut, "/data/x", `[1,2,3,4,5,6,7,8,9,10]`, 204, ""},
+		{http.MethodPut, "/policies/test", "package test\n\nsmall = [x | x = data.x[_]; x < 3]\n\nlarge = [[x, y] | data.x[x]; data.x[y]]", 200, ""},
+		{http.MethodGet, "/data/test/small", "", 200, `{"result": [1, 2]}`},
+		{http.MethodGet, "/data/test/small?timeout=1s", "", 200, `{"result": [1, 2]}`},
+		{http.MethodGet, "/data/test/small?timeout=bad", "", 400, `{"code": "invalid_parameter", "message": "invalid timeout parameter: bad"}`},
+		{http.MethodPost, "/data/test/small?timeout=-1s", "", 400, `{"code": "invalid_parameter", "message": "invalid timeout parameter: -1s"}`},
+		{http.MethodGet, "/query?q=data.test.small=x&timeout=bad", "", 400, `{"code": "invalid_parameter", "message": "invalid timeout parameter: bad"}`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []*http.Request{
+		newReqV1(http.MethodGet, "/data/test/large", ""),
+		newReqV1(http.MethodPost, "/data/test/large", ""),
+		newReqV1(http.MethodGet, "/query?q=data.test.large=x", ""),
+		newReqV0(http.MethodPost, "/data/test/large", ""),
+	} {
+		f.reset()
+		f.server.Handler.ServeHTTP(f.recorder, req)
+
+		if f.recorder.Code != 500 || !strings.Contains(f.recorder.Body.String(), "evaluation exceeded maximum number of steps (100)") {
+			t.Fatalf("Expected limit error for %v %v but got %v: %v", req.Method, req.URL, f.recorder.Code, f.recorder.Body.String())
+		}
+	}
+}
+
+type testCacheValue int64
+
+func (v testCacheValue) SizeInBytes() int64 {
+	return int64(v)
+}
+
+func TestCacheReconfigure(t *testing.T) {
+	f := newFixture(t)
+
+	f.server.interQueryCache.Insert(ast.String("foo"), testCacheValue(100))
+
+	if _, found := f.server.interQueryCache.Get(ast.String("foo")); !found {
+		t.Fatal("Expected cache entry")
+	}
+
+	c, err := config.ParseConfig([]byte(`{"caching": {"inter_query_builtin_cache": {"max_size_bytes": 10}}}`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.server.manager.Reconfigure(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := f.server.interQueryCache.Get(ast.String("foo")); found {
+		t.Fatal("Expected cache entry to be dropped after reconfiguration")
+	}
+
+	c, err = config.ParseConfig([]byte(`{"caching": {"inter_query_builtin_cache": {"max_size_bytes": -1}}}`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.server.manager.Reconfigure(c); err == nil {
+		t.Fatal("Expected error for invalid caching config")
+	}
+}
+
 func TestDataGetExplainFull(t *testing.T) {
 	f := newFixture(t)
 
@@ -2052,6 +2123,7 @@ func TestMetricsEndpoint(t *testing.T) {
 	expected := []string{
 		`http_request_duration_seconds_count{code="200",handler="v1/policies",method="put"} 1`,
 		`http_request_duration_seconds_count{code="200",handler="v1/data",method="post"} 1`,
+		`rego_timer_duration_seconds_count{timer="rego_query_eval"} 1`,
 	}
 
 	for _, exp := range expected {
@@ -2062,6 +2134,53 @@ func TestMetricsEndpoint(t *testing.T) {
 
 }
 
+func TestHTTPSendInterQueryCache(t *testing.T) {
+
+	var requests int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=300")
+		fmt.Fprint(w, `{"user": "bob"}`)
+	}))
+
+	defer ts.Close()
+
+	f := newFixture(t)
+
+	module := fmt.Sprintf(`package test
+
+	p = x { http.send({"method": "get", "url": "%v", "cache": true}, resp); x = resp.body.user }`, ts.URL)
+
+	err := f.v1TestRequests([]tr{
+		{"PUT", "/policies/test", module, http.StatusOK, "{}"},
+		{"POST", "/data/test/p", "", http.StatusOK, `{"result": "bob"}`},
+		{"POST", "/data/test/p", "", http.StatusOK, `{"result": "bob"}`},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected response to be cached across queries but got %d requests", requests)
+	}
+
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, newReqUnversioned(http.MethodGet, "/metrics", ""))
+
+	resp := f.recorder.Body.String()
+
+	for _, exp := range []string{
+		`rego_counter_total{counter="rego_builtin_http_send_interquery_cache_hits"} 1`,
+		`rego_counter_total{counter="rego_builtin_http_send_interquery_cache_misses"} 1`,
+	} {
+		if !strings.Contains(resp, exp) {
+			t.Fatalf("Expected to find %q but got:\n\n%v", exp, resp)
+		}
+	}
+}
+
 func TestDecisionIDs(t *testing.T) {
 	f := newFixture(t)
 	f.server = f.server.WithDiagnosticsBuffer(NewBoundedBuffer(4))
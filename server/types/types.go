@@ -418,6 +418,10 @@ const (
 	// ParamWatchV1 defines the name of the HTTP URL parameter that indicates
 	// the client wants to set a watch on the current query or data reference.
 	ParamWatchV1 = "watch"
+
+	// ParamTimeoutV1 defines the name of the HTTP URL parameter that specifies
+	// the maximum amount of time to spend evaluating the query, e.g., "500ms".
+	ParamTimeoutV1 = "timeout"
 )
 
 // BadRequestErr represents an error condition raised if the caller passes
@@ -0,0 +1,80 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package disk
+
+import (
+	"container/list"
+	"sync"
+)
+
+// unitCache is a least recently used cache of decoded units keyed by unit
+// path. The cache is safe for concurrent use.
+type unitCache struct {
+	mtx   sync.Mutex
+	size  int
+	l     *list.List
+	items map[string]*list.Element
+}
+
+type unitCacheEntry struct {
+	key   string
+	value interface{}
+}
+
+func newUnitCache(size int) *unitCache {
+	return &unitCache{
+		size:  size,
+		l:     list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Get returns the cached value of the unit.
+func (c *unitCache) Get(key string) (interface{}, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.l.MoveToFront(elem)
+	return elem.Value.(*unitCacheEntry).value, true
+}
+
+// Put inserts or updates the value of the unit. If the cache is full, the
+// least recently used unit is evicted.
+func (c *unitCache) Put(key string, value interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*unitCacheEntry).value = value
+		c.l.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.l.PushFront(&unitCacheEntry{key: key, value: value})
+	for c.l.Len() > c.size {
+		elem := c.l.Back()
+		c.l.Remove(elem)
+		delete(c.items, elem.Value.(*unitCacheEntry).key)
+	}
+}
+
+// Delete removes the unit from the cache.
+func (c *unitCache) Delete(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.l.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Purge removes all units from the cache.
+func (c *unitCache) Purge() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.l.Init()
+	c.items = map[string]*list.Element{}
+}
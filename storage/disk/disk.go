@@ -0,0 +1,631 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package disk implements a persistent, disk-backed version of the policy
+// engine's storage layer.
+//
+// The disk store splits the data document into units that are stored in
+// separate files. By default, each key directly under the root of the data
+// document is a unit. Callers can declare additional partitions (e.g.,
+// /users) so that each key under the partition (e.g., /users/alice) is
+// stored separately. Units are only loaded into memory when they are read,
+// so the data document does not have to fit into memory at once. Recently
+// read units are cached.
+//
+// Values stored at or above a partition must be objects.
+//
+// Like the in-memory store, the disk store supports multi-reader/single-writer
+// concurrency with rollback. Writes are staged in memory and flushed to disk
+// when the transaction is committed. Before any files are modified, the
+// previous state of the affected files is written to a journal. If the commit
+// fails (or the process exits during the commit), the previous state is
+// restored from the journal.
+package disk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/internal/index"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	metadataFile = "metadata.json"
+	journalFile  = "journal.json"
+	dataDir      = "data"
+	policiesDir  = "policies"
+	unitExt      = ".json"
+
+	defaultCacheSize = 1000
+)
+
+// Options contains parameters that configure the disk-based store.
+type Options struct {
+	Dir        string         // directory to store data in
+	Partitions []storage.Path // data prefixes whose children are stored separately
+	CacheSize  int            // maximum number of units cached in memory (default: 1000)
+}
+
+// Config represents the configuration of the disk-based store.
+type Config struct {
+	Directory  string   `json:"directory"`
+	Partitions []string `json:"partitions"`
+	CacheSize  int      `json:"cache_size"`
+}
+
+// ParseConfig validates the raw disk store configuration and returns the
+// options to open the store with.
+func ParseConfig(raw []byte) (*Options, error) {
+
+	var config Config
+
+	if err := util.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Directory == "" {
+		return nil, fmt.Errorf("disk storage directory must be set")
+	}
+
+	if config.CacheSize < 0 {
+		return nil, fmt.Errorf("disk storage cache size must be positive")
+	}
+
+	opts := &Options{
+		Dir:       config.Directory,
+		CacheSize: config.CacheSize,
+	}
+
+	for _, s := range config.Partitions {
+		path, ok := storage.ParsePathEscaped(s)
+		if !ok || len(path) == 0 {
+			return nil, fmt.Errorf("invalid disk storage partition: %q", s)
+		}
+		opts.Partitions = append(opts.Partitions, path)
+	}
+
+	return opts, nil
+}
+
+// metadata is persisted alongside the data and records information required
+// to interpret the data files. Files are named after the hash of the unit path
+// or policy ID so the metadata records the units and policies that exist.
+type metadata struct {
+	Partitions []string `json:"partitions"`
+	Dirs       []string `json:"dirs"`
+	Units      []string `json:"units"`
+	Policies   []string `json:"policies"`
+}
+
+// journal records the state of the units and policies modified by a commit
+// along with the metadata before the commit.
+type journal struct {
+	Metadata metadata        `json:"metadata"`
+	Units    []journalUnit   `json:"units"`
+	Policies []journalPolicy `json:"policies"`
+}
+
+type journalUnit struct {
+	Path   string      `json:"path"`
+	Exists bool        `json:"exists"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+type journalPolicy struct {
+	ID     string `json:"id"`
+	Exists bool   `json:"exists"`
+	Value  []byte `json:"value,omitempty"`
+}
+
+// Store provides a disk-based implementation of the storage.Store interface.
+type Store struct {
+	rmu        sync.RWMutex                      // reader-writer lock
+	wmu        sync.Mutex                        // writer lock
+	xid        uint64                            // last generated transaction id
+	dir        string                            // root directory of the store
+	partitions map[string]struct{}               // partition paths (including prefixes)
+	configured []string                          // partitions as configured by caller
+	units      map[string]storage.Path           // units that exist on disk
+	dirs       map[string]storage.Path           // partitions that exist (excluding root)
+	policies   map[string]struct{}               // policy ids that exist on disk
+	triggers   map[*handle]storage.TriggerConfig // registered triggers
+	indices    *index.Indices                    // data ref indices
+	cache      *unitCache                        // recently read units
+}
+
+type handle struct {
+	db *Store
+}
+
+// New returns a disk-based store rooted at opts.Dir. If the directory already
+// contains a store, the existing data and policies are made available. The
+// partitions of an existing store cannot be changed.
+func New(ctx context.Context, opts Options) (*Store, error) {
+
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("disk storage directory must be set")
+	}
+
+	db := &Store{
+		dir:        opts.Dir,
+		partitions: map[string]struct{}{storage.Path{}.String(): {}},
+		units:      map[string]storage.Path{},
+		dirs:       map[string]storage.Path{},
+		policies:   map[string]struct{}{},
+		triggers:   map[*handle]storage.TriggerConfig{},
+		indices:    index.NewIndices(),
+	}
+
+	cacheSize := opts.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultCacheSize
+	}
+
+	db.cache = newUnitCache(cacheSize)
+
+	for _, p := range opts.Partitions {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("root cannot be used as partition")
+		}
+		db.configured = append(db.configured, p.String())
+		for i := 1; i <= len(p); i++ {
+			db.partitions[p[:i].String()] = struct{}{}
+		}
+	}
+
+	sort.Strings(db.configured)
+
+	for _, d := range []string{dataDir, policiesDir} {
+		if err := os.MkdirAll(filepath.Join(db.dir, d), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewTransaction is called create a new transaction in the store.
+func (db *Store) NewTransaction(ctx context.Context, params ...storage.TransactionParams) (storage.Transaction, error) {
+	var write bool
+	if len(params) > 0 {
+		write = params[0].Write
+	}
+	xid := atomic.AddUint64(&db.xid, uint64(1))
+	if write {
+		db.wmu.Lock()
+	} else {
+		db.rmu.RLock()
+	}
+	return newTransaction(xid, write, db), nil
+}
+
+// Commit is called to finish the transaction. Staged writes are flushed to
+// disk before triggers are invoked.
+func (db *Store) Commit(ctx context.Context, txn storage.Transaction) error {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return err
+	}
+	if !underlying.write {
+		db.rmu.RUnlock()
+		return nil
+	}
+	defer db.wmu.Unlock()
+	db.rmu.Lock()
+	defer db.rmu.Unlock()
+	event, err := underlying.Commit()
+	if err != nil {
+		return err
+	}
+	db.indices = index.NewIndices()
+	db.runOnCommitTriggers(ctx, txn, event)
+	return nil
+}
+
+// Abort is called to cancel the transaction.
+func (db *Store) Abort(ctx context.Context, txn storage.Transaction) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		panic(err)
+	}
+	if underlying.write {
+		db.wmu.Unlock()
+	} else {
+		db.rmu.RUnlock()
+	}
+}
+
+// ListPolicies returns the IDs of all policies in the store.
+func (db *Store) ListPolicies(_ context.Context, txn storage.Transaction) ([]string, error) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return nil, err
+	}
+	return underlying.ListPolicies(), nil
+}
+
+// GetPolicy returns the raw policy identified by id.
+func (db *Store) GetPolicy(_ context.Context, txn storage.Transaction, id string) ([]byte, error) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return nil, err
+	}
+	return underlying.GetPolicy(id)
+}
+
+// UpsertPolicy inserts or updates the raw policy identified by id.
+func (db *Store) UpsertPolicy(_ context.Context, txn storage.Transaction, id string, bs []byte) error {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return err
+	}
+	return underlying.UpsertPolicy(id, bs)
+}
+
+// DeletePolicy removes the policy identified by id.
+func (db *Store) DeletePolicy(_ context.Context, txn storage.Transaction, id string) error {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return err
+	}
+	if _, err := underlying.GetPolicy(id); err != nil {
+		return err
+	}
+	return underlying.DeletePolicy(id)
+}
+
+// Register is called to register a trigger that is invoked when write
+// transactions are committed.
+func (db *Store) Register(ctx context.Context, txn storage.Transaction, config storage.TriggerConfig) (storage.TriggerHandle, error) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return nil, err
+	}
+	if !underlying.write {
+		return nil, &storage.Error{
+			Code:    storage.InvalidTransactionErr,
+			Message: "triggers must be registered with a write transaction",
+		}
+	}
+	h := &handle{db}
+	db.triggers[h] = config
+	return h, nil
+}
+
+// Read is called to fetch a document referred to by path.
+func (db *Store) Read(ctx context.Context, txn storage.Transaction, path storage.Path) (interface{}, error) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return nil, err
+	}
+	return underlying.Read(path)
+}
+
+// Write is called to modify a document referred to by path.
+func (db *Store) Write(ctx context.Context, txn storage.Transaction, op storage.PatchOp, path storage.Path, value interface{}) error {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return err
+	}
+	val := util.Reference(value)
+	if err := util.RoundTrip(val); err != nil {
+		return err
+	}
+	return underlying.Write(op, path, *val)
+}
+
+// Build is called to build an index over the data referred to by ref.
+func (db *Store) Build(ctx context.Context, txn storage.Transaction, ref ast.Ref) (storage.Index, error) {
+	underlying, err := db.underlying(txn)
+	if err != nil {
+		return nil, err
+	}
+	if underlying.write {
+		return nil, &storage.Error{
+			Code:    storage.IndexingNotSupportedErr,
+			Message: "disk store does not support indexing on write transactions",
+		}
+	}
+	return db.indices.Build(ctx, db, txn, ref)
+}
+
+// Unregister removes the trigger from the store.
+func (h *handle) Unregister(ctx context.Context, txn storage.Transaction) {
+	underlying, err := h.db.underlying(txn)
+	if err != nil || !underlying.write {
+		return
+	}
+	delete(h.db.triggers, h)
+}
+
+func (db *Store) runOnCommitTriggers(ctx context.Context, txn storage.Transaction, event storage.TriggerEvent) {
+	for _, t := range db.triggers {
+		t.OnCommit(ctx, txn, event)
+	}
+}
+
+func (db *Store) underlying(txn storage.Transaction) (*transaction, error) {
+	underlying, ok := txn.(*transaction)
+	if !ok || underlying.db != db {
+		return nil, &storage.Error{
+			Code:    storage.InvalidTransactionErr,
+			Message: "unknown transaction",
+		}
+	}
+	return underlying, nil
+}
+
+// isPartition returns true if path refers to a partition (or a prefix of a
+// partition.) The root of the data document is always a partition.
+func (db *Store) isPartition(path storage.Path) bool {
+	_, ok := db.partitions[path.String()]
+	return ok
+}
+
+// unitFor returns the path of the unit that contains the document referred to
+// by path. The path must not refer to a partition.
+func (db *Store) unitFor(path storage.Path) storage.Path {
+	for i := len(path) - 1; i >= 0; i-- {
+		if db.isPartition(path[:i]) {
+			return path[:i+1]
+		}
+	}
+	return path[:1]
+}
+
+// load reads the metadata from disk. If a commit was interrupted, the state
+// before the commit is restored first.
+func (db *Store) load() error {
+
+	bs, err := ioutil.ReadFile(filepath.Join(db.dir, journalFile))
+	if err == nil {
+		var j journal
+		if err := util.UnmarshalJSON(bs, &j); err != nil {
+			return fmt.Errorf("corrupt disk storage journal: %v", err)
+		}
+		if err := db.rollback(&j); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	bs, err = ioutil.ReadFile(filepath.Join(db.dir, metadataFile))
+	if err == nil {
+		var meta metadata
+		if err := util.UnmarshalJSON(bs, &meta); err != nil {
+			return fmt.Errorf("corrupt disk storage metadata: %v", err)
+		}
+		sort.Strings(meta.Partitions)
+		if strings.Join(meta.Partitions, ",") != strings.Join(db.configured, ",") {
+			return fmt.Errorf("disk storage partitions cannot be changed (existing partitions: %v)", meta.Partitions)
+		}
+		if err := db.setMetadata(meta); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return db.writeMetadata()
+}
+
+// setMetadata replaces the units, partitions, and policies that exist with
+// the ones recorded in meta.
+func (db *Store) setMetadata(meta metadata) error {
+
+	db.dirs = make(map[string]storage.Path, len(meta.Dirs))
+	db.units = make(map[string]storage.Path, len(meta.Units))
+	db.policies = make(map[string]struct{}, len(meta.Policies))
+
+	for _, s := range meta.Dirs {
+		path, ok := storage.ParsePathEscaped(s)
+		if !ok {
+			return fmt.Errorf("corrupt disk storage metadata: invalid path %q", s)
+		}
+		db.dirs[path.String()] = path
+	}
+
+	for _, s := range meta.Units {
+		path, ok := storage.ParsePathEscaped(s)
+		if !ok || len(path) == 0 {
+			return fmt.Errorf("corrupt disk storage metadata: invalid path %q", s)
+		}
+		db.units[path.String()] = path
+	}
+
+	for _, id := range meta.Policies {
+		db.policies[id] = struct{}{}
+	}
+
+	return nil
+}
+
+func (db *Store) metadata() metadata {
+	meta := metadata{
+		Partitions: db.configured,
+		Dirs:       make([]string, 0, len(db.dirs)),
+		Units:      make([]string, 0, len(db.units)),
+		Policies:   make([]string, 0, len(db.policies)),
+	}
+	for s := range db.dirs {
+		meta.Dirs = append(meta.Dirs, s)
+	}
+	for s := range db.units {
+		meta.Units = append(meta.Units, s)
+	}
+	for id := range db.policies {
+		meta.Policies = append(meta.Policies, id)
+	}
+	sort.Strings(meta.Dirs)
+	sort.Strings(meta.Units)
+	sort.Strings(meta.Policies)
+	if meta.Partitions == nil {
+		meta.Partitions = []string{}
+	}
+	return meta
+}
+
+func (db *Store) writeMetadata() error {
+	bs, err := json.Marshal(db.metadata())
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(db.dir, metadataFile), bs)
+}
+
+func (db *Store) writeJournal(j *journal) error {
+	bs, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(db.dir, journalFile), bs)
+}
+
+// rollback resets the in-memory state to the metadata recorded in the journal,
+// restores the recorded units and policies, and then removes the journal. If
+// the rollback fails, the journal is kept so that it is retried on startup.
+func (db *Store) rollback(j *journal) error {
+
+	db.cache.Purge()
+
+	if err := db.setMetadata(j.Metadata); err != nil {
+		return err
+	}
+
+	for _, u := range j.Units {
+		path, ok := storage.ParsePathEscaped(u.Path)
+		if !ok || len(path) == 0 {
+			return fmt.Errorf("corrupt disk storage journal: invalid path %q", u.Path)
+		}
+		if !u.Exists {
+			if err := os.Remove(db.unitFile(path)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		bs, err := json.Marshal(u.Value)
+		if err != nil {
+			return err
+		}
+		if err := util.WriteFileAtomic(db.unitFile(path), bs); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range j.Policies {
+		if !p.Exists {
+			if err := os.Remove(db.policyFile(p.ID)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := util.WriteFileAtomic(db.policyFile(p.ID), p.Value); err != nil {
+			return err
+		}
+	}
+
+	if err := db.writeMetadata(); err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(db.dir, journalFile))
+}
+
+func (db *Store) unitFile(path storage.Path) string {
+	return filepath.Join(db.dir, dataDir, hashName(path.String())+unitExt)
+}
+
+func (db *Store) policyFile(id string) string {
+	return filepath.Join(db.dir, policiesDir, hashName(id))
+}
+
+// readUnit returns the value of the unit. The value is shared with other
+// readers and must not be modified.
+func (db *Store) readUnit(path storage.Path) (interface{}, error) {
+	key := path.String()
+	if value, ok := db.cache.Get(key); ok {
+		return value, nil
+	}
+	f, err := os.Open(db.unitFile(path))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer f.Close()
+	var value interface{}
+	if err := util.NewJSONDecoder(f).Decode(&value); err != nil {
+		return nil, wrapError(err)
+	}
+	db.cache.Put(key, value)
+	return value, nil
+}
+
+func (db *Store) readPolicy(id string) ([]byte, error) {
+	bs, err := ioutil.ReadFile(db.policyFile(id))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return bs, nil
+}
+
+// hashName returns the file name for s. File names are hashed so that their
+// length does not depend on the length of the unit path or policy ID.
+func hashName(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+var doesNotExistMsg = "document does not exist"
+var rootMustBeObjectMsg = "root must be object"
+var rootCannotBeRemovedMsg = "root cannot be removed"
+var partitionMustBeObjectMsg = "value stored at partition must be object"
+var outOfRangeMsg = "array index out of range"
+var arrayIndexTypeMsg = "array index must be integer"
+
+func wrapError(err error) *storage.Error {
+	return &storage.Error{
+		Code:    storage.InternalErr,
+		Message: err.Error(),
+	}
+}
+
+func invalidPatchError(f string, a ...interface{}) *storage.Error {
+	return &storage.Error{
+		Code:    storage.InvalidPatchErr,
+		Message: fmt.Sprintf(f, a...),
+	}
+}
+
+func notFoundError(path storage.Path) *storage.Error {
+	return notFoundErrorHint(path, doesNotExistMsg)
+}
+
+func notFoundErrorHint(path storage.Path, hint string) *storage.Error {
+	return notFoundErrorf("%v: %v", path.String(), hint)
+}
+
+func notFoundErrorf(f string, a ...interface{}) *storage.Error {
+	msg := fmt.Sprintf(f, a...)
+	return &storage.Error{
+		Code:    storage.NotFoundErr,
+		Message: msg,
+	}
+}
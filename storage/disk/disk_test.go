@@ -0,0 +1,495 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package disk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestDiskReadWrite(t *testing.T) {
+
+	tests := []struct {
+		note        string
+		op          string
+		path        string
+		value       string
+		expected    error
+		getPath     string
+		getExpected interface{}
+	}{
+		{"read root", "", "", "", nil, "/", `{"a": [1,2,3], "b": {"v1": "hello"}, "users": {"alice": {"roles": ["admin"]}, "bob": {"roles": []}}, "x": {"y": {"z": {"q": 1}}, "w": true}}`},
+		{"read partition", "", "", "", nil, "/users", `{"alice": {"roles": ["admin"]}, "bob": {"roles": []}}`},
+		{"read partition prefix", "", "", "", nil, "/x", `{"y": {"z": {"q": 1}}, "w": true}`},
+		{"read unit", "", "", "", nil, "/users/alice/roles/0", `"admin"`},
+		{"read missing", "", "", "", nil, "/users/carol", notFoundError(storage.MustParsePath("/users/carol"))},
+		{"read missing partition", "", "", "", nil, "/deadbeef/0", notFoundError(storage.MustParsePath("/deadbeef/0"))},
+
+		{"add root", "add", "/", `{"a": [1], "users": {"carol": {}}}`, nil, "/", `{"a": [1], "users": {"carol": {}}}`},
+		{"add unit", "add", "/users/carol", `{"roles": []}`, nil, "/users/carol", `{"roles": []}`},
+		{"add arr", "add", "/a/1", `"x"`, nil, "/a", `[1,"x",2,3]`},
+		{"add in unit", "add", "/users/bob/roles/-", `"dev"`, nil, "/users/bob", `{"roles": ["dev"]}`},
+		{"add partition", "add", "/users", `{"carol": {}}`, nil, "/users", `{"carol": {}}`},
+		{"add partition prefix", "add", "/x", `{"y": {"z": {"r": 2}}}`, nil, "/x", `{"y": {"z": {"r": 2}}}`},
+		{"remove unit", "remove", "/users/alice", "", nil, "/users", `{"bob": {"roles": []}}`},
+		{"remove partition", "remove", "/users", "", nil, "/users", notFoundError(storage.MustParsePath("/users"))},
+		{"remove partition prefix", "remove", "/x", "", nil, "/x/y/z", notFoundError(storage.MustParsePath("/x/y/z"))},
+		{"replace unit", "replace", "/b", `"x"`, nil, "/b", `"x"`},
+		{"replace in unit", "replace", "/b/v1", `"x"`, nil, "/b", `{"v1": "x"}`},
+
+		{"err: bad root type", "add", "/", "[1,2,3]", invalidPatchError("%v", rootMustBeObjectMsg), "", nil},
+		{"err: remove root", "remove", "/", "", invalidPatchError("%v", rootCannotBeRemovedMsg), "", nil},
+		{"err: partition type", "add", "/users", "[1,2,3]", invalidPatchError("%v: %v", storage.MustParsePath("/users"), partitionMustBeObjectMsg), "", nil},
+		{"err: nested partition type", "add", "/x", `{"y": 1}`, invalidPatchError("%v: %v", storage.MustParsePath("/x/y"), partitionMustBeObjectMsg), "", nil},
+		{"err: add arr (out of range)", "add", "/a/5", "1", notFoundErrorHint(storage.MustParsePath("/a/5"), outOfRangeMsg), "", nil},
+		{"err: append (invalid op)", "remove", "/a/-", "", invalidPatchError("%v: invalid patch path", storage.MustParsePath("/a/-")), "", nil},
+		{"err: add (missing parent)", "add", "/dead/beef", "1", notFoundError(storage.MustParsePath("/dead/beef")), "", nil},
+		{"err: replace unit (missing)", "replace", "/users/carol", "1", notFoundError(storage.MustParsePath("/users/carol")), "", nil},
+		{"remove nested partition", "remove", "/x/y/z", "", nil, "/x/y", `{}`},
+	}
+
+	ctx := context.Background()
+
+	for _, tc := range tests {
+		test.Subtest(t, tc.note, func(t *testing.T) {
+			test.WithTempFS(nil, func(dir string) {
+
+				store := newTestStore(t, dir)
+
+				if tc.op != "" {
+					var op storage.PatchOp
+					switch tc.op {
+					case "add":
+						op = storage.AddOp
+					case "remove":
+						op = storage.RemoveOp
+					case "replace":
+						op = storage.ReplaceOp
+					default:
+						panic(fmt.Sprintf("illegal value: %v", tc.op))
+					}
+
+					var value interface{}
+					if tc.value != "" {
+						value = util.MustUnmarshalJSON([]byte(tc.value))
+					}
+
+					err := storage.WriteOne(ctx, store, op, storage.MustParsePath(tc.path), value)
+					if tc.expected == nil && err != nil {
+						t.Fatalf("Unexpected write error: %v", err)
+					} else if tc.expected != nil && !reflect.DeepEqual(err, tc.expected) {
+						t.Fatalf("Expected write error %v but got: %v", tc.expected, err)
+					}
+				}
+
+				if tc.getPath == "" {
+					return
+				}
+
+				// Reopen the store to verify the result was persisted.
+				store = newTestStore(t, dir)
+
+				result, err := storage.ReadOne(ctx, store, storage.MustParsePath(tc.getPath))
+				switch expected := tc.getExpected.(type) {
+				case error:
+					if !reflect.DeepEqual(err, expected) {
+						t.Fatalf("Expected read error %v but got: %v (result: %v)", expected, err, result)
+					}
+				case string:
+					if err != nil {
+						t.Fatalf("Unexpected read error: %v", err)
+					}
+					if e := util.MustUnmarshalJSON([]byte(expected)); !reflect.DeepEqual(result, e) {
+						t.Fatalf("Expected %v but got: %v", e, result)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestDiskTxnIsolation(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+
+		txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+		path := storage.MustParsePath("/users/alice/roles")
+
+		if err := store.Write(ctx, txn, storage.AddOp, path, []interface{}{"dev"}); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := store.Read(ctx, txn, storage.MustParsePath("/users/alice"))
+		if err != nil || !reflect.DeepEqual(result, util.MustUnmarshalJSON([]byte(`{"roles": ["dev"]}`))) {
+			t.Fatalf("Expected write to be visible inside transaction but got: %v (err: %v)", result, err)
+		}
+
+		store.Abort(ctx, txn)
+
+		result, err = storage.ReadOne(ctx, store, path)
+		if err != nil || !reflect.DeepEqual(result, util.MustUnmarshalJSON([]byte(`["admin"]`))) {
+			t.Fatalf("Expected aborted write to be discarded but got: %v (err: %v)", result, err)
+		}
+	})
+}
+
+func TestDiskPolicies(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+
+		err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			if err := store.UpsertPolicy(ctx, txn, "a/b.rego", []byte("package a.b")); err != nil {
+				return err
+			}
+			return store.UpsertPolicy(ctx, txn, "c.rego", []byte("package c"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store = newTestStore(t, dir)
+		txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+
+		bs, err := store.GetPolicy(ctx, txn, "a/b.rego")
+		if err != nil || string(bs) != "package a.b" {
+			t.Fatalf("Expected policy to be persisted but got: %q (err: %v)", bs, err)
+		}
+
+		if err := store.DeletePolicy(ctx, txn, "c.rego"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeletePolicy(ctx, txn, "deadbeef"); !storage.IsNotFound(err) {
+			t.Fatalf("Expected not found error but got: %v", err)
+		}
+
+		if err := store.Commit(ctx, txn); err != nil {
+			t.Fatal(err)
+		}
+
+		store = newTestStore(t, dir)
+		txn = storage.NewTransactionOrDie(ctx, store)
+		defer store.Abort(ctx, txn)
+
+		ids, err := store.ListPolicies(ctx, txn)
+		if err != nil || !reflect.DeepEqual(ids, []string{"a/b.rego"}) {
+			t.Fatalf("Expected [a/b.rego] but got: %v (err: %v)", ids, err)
+		}
+	})
+}
+
+func TestDiskTriggers(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+		writeTxn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+
+		var event storage.TriggerEvent
+		modifiedPath := storage.MustParsePath("/users/carol")
+		expectedValue := map[string]interface{}{}
+
+		_, err := store.Register(ctx, writeTxn, storage.TriggerConfig{
+			OnCommit: func(ctx context.Context, txn storage.Transaction, evt storage.TriggerEvent) {
+				result, err := store.Read(ctx, txn, modifiedPath)
+				if err != nil || !reflect.DeepEqual(result, expectedValue) {
+					t.Fatalf("Expected trigger read to return %v but got: %v (err: %v)", expectedValue, result, err)
+				}
+				event = evt
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Write(ctx, writeTxn, storage.AddOp, modifiedPath, expectedValue); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Commit(ctx, writeTxn); err != nil {
+			t.Fatal(err)
+		}
+
+		exp := storage.DataEvent{Path: modifiedPath, Data: expectedValue}
+		if len(event.Data) != 1 || !reflect.DeepEqual(event.Data[0], exp) {
+			t.Fatalf("Expected data event %v but got: %v", exp, event.Data)
+		}
+	})
+}
+
+func TestDiskIndexing(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+		txn := storage.NewTransactionOrDie(ctx, store)
+		defer store.Abort(ctx, txn)
+
+		index, err := store.Build(ctx, txn, ast.MustParseRef("data.users[x].roles[y]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []*ast.ValueMap
+		err = index.Lookup(ctx, txn, "admin", func(bindings *ast.ValueMap) error {
+			found = append(found, bindings)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(found) != 1 || ast.Compare(found[0].Get(ast.Var("x")), ast.String("alice")) != 0 {
+			t.Fatalf("Expected single binding for alice but got: %v", found)
+		}
+	})
+}
+
+func TestDiskPartitionsChanged(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		newTestStore(t, dir)
+		_, err := New(context.Background(), Options{Dir: dir, Partitions: []storage.Path{storage.MustParsePath("/users")}})
+		if err == nil {
+			t.Fatal("Expected error when partitions change")
+		}
+	})
+}
+
+func TestDiskLongPaths(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+
+		path := storage.Path{"users", strings.Repeat("x", 1000)}
+		if err := storage.WriteOne(ctx, store, storage.AddOp, path, "hello"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			return store.UpsertPolicy(ctx, txn, strings.Repeat("y", 1000), []byte("package y"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		store = newTestStore(t, dir)
+
+		result, err := storage.ReadOne(ctx, store, path)
+		if err != nil || result != "hello" {
+			t.Fatalf("Expected hello but got: %v (err: %v)", result, err)
+		}
+
+		txn := storage.NewTransactionOrDie(ctx, store)
+		defer store.Abort(ctx, txn)
+
+		bs, err := store.GetPolicy(ctx, txn, strings.Repeat("y", 1000))
+		if err != nil || string(bs) != "package y" {
+			t.Fatalf("Expected policy but got: %q (err: %v)", bs, err)
+		}
+	})
+}
+
+func TestDiskCommitRollback(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+
+		// Make the unit file for /b a non-empty directory so that the commit
+		// (and the rollback) fails after other units may have been written.
+		txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+		if err := store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/a"), "x"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/c"), "y"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Write(ctx, txn, storage.RemoveOp, storage.MustParsePath("/b"), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		unit := store.unitFile(storage.MustParsePath("/b"))
+		if err := os.Remove(unit); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(unit, "blocker"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Commit(ctx, txn); err == nil {
+			t.Fatal("Expected commit error")
+		}
+
+		if _, err := storage.ReadOne(ctx, store, storage.MustParsePath("/c")); !storage.IsNotFound(err) {
+			t.Fatalf("Expected not found error but got: %v", err)
+		}
+
+		// The journal is rolled back when the store is reopened.
+		if err := os.RemoveAll(unit); err != nil {
+			t.Fatal(err)
+		}
+
+		store = newTestStore(t, dir)
+
+		result, err := storage.ReadOne(ctx, store, storage.MustParsePath("/a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := util.MustUnmarshalJSON([]byte(`[1,2,3]`)); !reflect.DeepEqual(result, exp) {
+			t.Fatalf("Expected %v but got: %v", exp, result)
+		}
+		if _, err := storage.ReadOne(ctx, store, storage.MustParsePath("/c")); !storage.IsNotFound(err) {
+			t.Fatalf("Expected not found error but got: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, journalFile)); !os.IsNotExist(err) {
+			t.Fatalf("Expected journal to be removed but got: %v", err)
+		}
+	})
+}
+
+func TestDiskJournalRecovery(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		store := newTestStore(t, dir)
+
+		// Simulate a commit that was interrupted after the journal was written
+		// and some of the files were modified.
+		j, err := (&transaction{db: store, units: map[string]*unitUpdate{
+			"/a": {path: storage.MustParsePath("/a")},
+		}}).journal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.writeJournal(j); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := util.WriteFileAtomic(store.unitFile(storage.MustParsePath("/a")), []byte(`"corrupt"`)); err != nil {
+			t.Fatal(err)
+		}
+
+		store = newTestStore(t, dir)
+
+		result, err := storage.ReadOne(ctx, store, storage.MustParsePath("/a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := util.MustUnmarshalJSON([]byte(`[1,2,3]`)); !reflect.DeepEqual(result, exp) {
+			t.Fatalf("Expected %v but got: %v", exp, result)
+		}
+	})
+}
+
+func TestDiskCache(t *testing.T) {
+	test.WithTempFS(nil, func(dir string) {
+		ctx := context.Background()
+		newTestStore(t, dir)
+
+		store, err := New(ctx, Options{
+			Dir: dir,
+			Partitions: []storage.Path{
+				storage.MustParsePath("/users"),
+				storage.MustParsePath("/x/y/z"),
+			},
+			CacheSize: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read := func(path string) {
+			t.Helper()
+			if _, err := storage.ReadOne(ctx, store, storage.MustParsePath(path)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		read("/a")
+
+		// Cached units are not read from disk again.
+		if err := os.Remove(store.unitFile(storage.MustParsePath("/a"))); err != nil {
+			t.Fatal(err)
+		}
+
+		read("/a")
+
+		// Reading another unit evicts /a.
+		read("/b")
+
+		if _, err := storage.ReadOne(ctx, store, storage.MustParsePath("/a")); err == nil {
+			t.Fatal("Expected error after eviction")
+		}
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+
+	opts, err := ParseConfig([]byte(`{"directory": "/tmp/opa", "partitions": ["/users", "/a/b%2Fc"], "cache_size": 10}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &Options{
+		Dir:        "/tmp/opa",
+		Partitions: []storage.Path{{"users"}, {"a", "b/c"}},
+		CacheSize:  10,
+	}
+
+	if !reflect.DeepEqual(opts, exp) {
+		t.Fatalf("Expected %v but got %v", exp, opts)
+	}
+
+	for _, raw := range []string{`{}`, `{"directory": "x", "partitions": ["/"]}`, `{"directory": "x", "partitions": ["users"]}`, `{"directory": "x", "cache_size": -1}`} {
+		if _, err := ParseConfig([]byte(raw)); err == nil {
+			t.Fatalf("Expected error for %v", raw)
+		}
+	}
+}
+
+// newTestStore opens the store in dir and populates it with test data if the
+// directory is empty.
+func newTestStore(t *testing.T, dir string) *Store {
+	ctx := context.Background()
+	store, err := New(ctx, Options{
+		Dir: dir,
+		Partitions: []storage.Path{
+			storage.MustParsePath("/users"),
+			storage.MustParsePath("/x/y/z"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := storage.NewTransactionOrDie(ctx, store)
+	_, err = store.Read(ctx, txn, storage.Path{"a"})
+	store.Abort(ctx, txn)
+
+	if storage.IsNotFound(err) && len(store.units) == 0 && len(store.dirs) == 0 {
+		data := util.MustUnmarshalJSON([]byte(`{
+			"a": [1,2,3],
+			"b": {"v1": "hello"},
+			"users": {"alice": {"roles": ["admin"]}, "bob": {"roles": []}},
+			"x": {"y": {"z": {"q": 1}}, "w": true}
+		}`))
+		if err := storage.WriteOne(ctx, store, storage.AddOp, storage.Path{}, data); err != nil {
+			t.Fatal(err)
+		}
+	} else if err != nil && !storage.IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	return store
+}
@@ -0,0 +1,646 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// transaction implements the low-level read/write operations on the disk store
+// and contains the state required for pending transactions.
+//
+// For write transactions, the struct contains the set of units and partitions
+// that were modified by write operations in the transaction. Units are staged
+// in their entirety: a write to a path inside a unit loads the unit, applies
+// the patch to a copy, and stages the copy. Writes to partitions are split
+// into the units contained in the written value.
+//
+// Read transactions do not require any special handling and simply passthrough
+// to the underlying store. Read transactions do not support upgrade.
+type transaction struct {
+	xid      uint64
+	write    bool
+	db       *Store
+	units    map[string]*unitUpdate
+	dirs     map[string]*unitUpdate
+	policies map[string]policyUpdate
+	events   []storage.DataEvent
+}
+
+// unitUpdate records a pending change to a unit or partition.
+type unitUpdate struct {
+	path   storage.Path
+	remove bool
+	value  interface{} // ignored for partitions
+}
+
+type policyUpdate struct {
+	value  []byte
+	remove bool
+}
+
+func newTransaction(xid uint64, write bool, db *Store) *transaction {
+	return &transaction{
+		xid:      xid,
+		write:    write,
+		db:       db,
+		units:    map[string]*unitUpdate{},
+		dirs:     map[string]*unitUpdate{},
+		policies: map[string]policyUpdate{},
+	}
+}
+
+func (txn *transaction) ID() uint64 {
+	return txn.xid
+}
+
+func (txn *transaction) Read(path storage.Path) (interface{}, error) {
+
+	if txn.db.isPartition(path) {
+		if !txn.dirExists(path) {
+			return nil, notFoundError(path)
+		}
+		return txn.readPartition(path)
+	}
+
+	unit := txn.db.unitFor(path)
+
+	value, ok, err := txn.readUnit(unit)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, notFoundError(path)
+	}
+
+	return ptr(value, path, len(unit))
+}
+
+func (txn *transaction) Write(op storage.PatchOp, path storage.Path, value interface{}) error {
+
+	if !txn.write {
+		return &storage.Error{
+			Code:    storage.InvalidTransactionErr,
+			Message: "data write during read transaction",
+		}
+	}
+
+	var err error
+
+	if txn.db.isPartition(path) {
+		err = txn.writePartition(op, path, value)
+	} else {
+		err = txn.writeUnit(op, path, value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	txn.events = append(txn.events, storage.DataEvent{
+		Path:    path,
+		Data:    value,
+		Removed: op == storage.RemoveOp,
+	})
+
+	return nil
+}
+
+func (txn *transaction) writePartition(op storage.PatchOp, path storage.Path, value interface{}) error {
+
+	if len(path) == 0 {
+		if op == storage.RemoveOp {
+			return invalidPatchError("%v", rootCannotBeRemovedMsg)
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return invalidPatchError("%v", rootMustBeObjectMsg)
+		}
+	} else {
+		if !txn.dirExists(path[:len(path)-1]) {
+			return notFoundError(path)
+		}
+		if op != storage.AddOp && !txn.dirExists(path) {
+			return notFoundError(path)
+		}
+	}
+
+	var units []*unitUpdate
+	var dirs []storage.Path
+
+	if op != storage.RemoveOp {
+		var err error
+		units, dirs, err = txn.split(path, value, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range txn.listUnits(path) {
+		txn.units[p.String()] = &unitUpdate{path: p, remove: true}
+	}
+
+	for _, p := range txn.listDirs(path) {
+		txn.dirs[p.String()] = &unitUpdate{path: p, remove: true}
+	}
+
+	for _, u := range units {
+		txn.units[u.path.String()] = u
+	}
+
+	for _, p := range dirs {
+		txn.dirs[p.String()] = &unitUpdate{path: p}
+	}
+
+	return nil
+}
+
+// split returns the units and partitions contained in value which is to be
+// stored at path.
+func (txn *transaction) split(path storage.Path, value interface{}, units []*unitUpdate, dirs []storage.Path) ([]*unitUpdate, []storage.Path, error) {
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, invalidPatchError("%v: %v", path, partitionMustBeObjectMsg)
+	}
+
+	if len(path) > 0 {
+		dirs = append(dirs, path)
+	}
+
+	for key, child := range obj {
+		childPath := make(storage.Path, len(path), len(path)+1)
+		copy(childPath, path)
+		childPath = append(childPath, key)
+		if txn.db.isPartition(childPath) {
+			var err error
+			units, dirs, err = txn.split(childPath, child, units, dirs)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			units = append(units, &unitUpdate{path: childPath, value: child})
+		}
+	}
+
+	return units, dirs, nil
+}
+
+func (txn *transaction) writeUnit(op storage.PatchOp, path storage.Path, value interface{}) error {
+
+	unit := txn.db.unitFor(path)
+
+	if !txn.dirExists(unit[:len(unit)-1]) {
+		return notFoundError(path)
+	}
+
+	curr, ok, err := txn.readUnit(unit)
+	if err != nil {
+		return err
+	}
+
+	if len(path) == len(unit) {
+		if !ok && op != storage.AddOp {
+			return notFoundError(path)
+		}
+		txn.units[unit.String()] = &unitUpdate{path: unit, remove: op == storage.RemoveOp, value: value}
+		return nil
+	}
+
+	if !ok {
+		return notFoundError(path)
+	}
+
+	updated, err := patch(deepCopy(curr), op, path, len(unit), value)
+	if err != nil {
+		return err
+	}
+
+	txn.units[unit.String()] = &unitUpdate{path: unit, value: updated}
+	return nil
+}
+
+// Commit flushes the staged changes to disk and returns the event to pass to
+// triggers. The previous state of the modified units and policies is written
+// to the journal first so that it can be restored if the commit fails.
+func (txn *transaction) Commit() (result storage.TriggerEvent, err error) {
+
+	db := txn.db
+
+	j, err := txn.journal()
+	if err != nil {
+		return result, err
+	}
+
+	if err := db.writeJournal(j); err != nil {
+		return result, wrapError(err)
+	}
+
+	if err := txn.apply(); err != nil {
+		if rerr := db.rollback(j); rerr != nil {
+			return result, wrapError(fmt.Errorf("%v (rollback failed: %v)", err, rerr))
+		}
+		return result, wrapError(err)
+	}
+
+	// The commit is complete once the journal has been removed.
+	if err := os.Remove(filepath.Join(db.dir, journalFile)); err != nil {
+		if rerr := db.rollback(j); rerr != nil {
+			return result, wrapError(fmt.Errorf("%v (rollback failed: %v)", err, rerr))
+		}
+		return result, wrapError(err)
+	}
+
+	for id, update := range txn.policies {
+		result.Policy = append(result.Policy, storage.PolicyEvent{
+			ID:      id,
+			Data:    update.value,
+			Removed: update.remove,
+		})
+	}
+
+	result.Data = txn.events
+
+	return result, nil
+}
+
+// journal returns the journal that records the current state of the units and
+// policies modified by the transaction.
+func (txn *transaction) journal() (*journal, error) {
+
+	db := txn.db
+
+	j := &journal{
+		Metadata: db.metadata(),
+	}
+
+	for key, u := range txn.units {
+		ju := journalUnit{Path: key}
+		if _, ok := db.units[key]; ok {
+			value, err := db.readUnit(u.path)
+			if err != nil {
+				return nil, err
+			}
+			ju.Exists = true
+			ju.Value = value
+		}
+		j.Units = append(j.Units, ju)
+	}
+
+	for id := range txn.policies {
+		jp := journalPolicy{ID: id}
+		if _, ok := db.policies[id]; ok {
+			bs, err := db.readPolicy(id)
+			if err != nil {
+				return nil, err
+			}
+			jp.Exists = true
+			jp.Value = bs
+		}
+		j.Policies = append(j.Policies, jp)
+	}
+
+	return j, nil
+}
+
+// apply writes the staged changes to disk and updates the set of units,
+// partitions, and policies that exist.
+func (txn *transaction) apply() error {
+
+	db := txn.db
+	changed := len(txn.dirs) > 0
+
+	for key, u := range txn.units {
+		if u.remove {
+			if _, ok := db.units[key]; ok {
+				if err := os.Remove(db.unitFile(u.path)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				delete(db.units, key)
+				db.cache.Delete(key)
+				changed = true
+			}
+			continue
+		}
+		bs, err := json.Marshal(u.value)
+		if err != nil {
+			return err
+		}
+		if err := util.WriteFileAtomic(db.unitFile(u.path), bs); err != nil {
+			return err
+		}
+		if _, ok := db.units[key]; !ok {
+			db.units[key] = u.path
+			changed = true
+		}
+		db.cache.Put(key, u.value)
+	}
+
+	for key, u := range txn.dirs {
+		if u.remove {
+			delete(db.dirs, key)
+		} else {
+			db.dirs[key] = u.path
+		}
+	}
+
+	for id, update := range txn.policies {
+		if update.remove {
+			if err := os.Remove(db.policyFile(id)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(db.policies, id)
+			changed = true
+		} else {
+			if err := util.WriteFileAtomic(db.policyFile(id), update.value); err != nil {
+				return err
+			}
+			if _, ok := db.policies[id]; !ok {
+				db.policies[id] = struct{}{}
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		return db.writeMetadata()
+	}
+
+	return nil
+}
+
+func (txn *transaction) ListPolicies() []string {
+	var ids []string
+	for id := range txn.db.policies {
+		if _, ok := txn.policies[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	for id, update := range txn.policies {
+		if !update.remove {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (txn *transaction) GetPolicy(id string) ([]byte, error) {
+	if update, ok := txn.policies[id]; ok {
+		if !update.remove {
+			return update.value, nil
+		}
+		return nil, notFoundErrorf("policy id %q", id)
+	}
+	if _, ok := txn.db.policies[id]; ok {
+		return txn.db.readPolicy(id)
+	}
+	return nil, notFoundErrorf("policy id %q", id)
+}
+
+func (txn *transaction) UpsertPolicy(id string, bs []byte) error {
+	if !txn.write {
+		return &storage.Error{
+			Code:    storage.InvalidTransactionErr,
+			Message: "policy write during read transaction",
+		}
+	}
+	txn.policies[id] = policyUpdate{bs, false}
+	return nil
+}
+
+func (txn *transaction) DeletePolicy(id string) error {
+	if !txn.write {
+		return &storage.Error{
+			Code:    storage.InvalidTransactionErr,
+			Message: "policy write during read transaction",
+		}
+	}
+	txn.policies[id] = policyUpdate{nil, true}
+	return nil
+}
+
+// readPartition assembles the object stored at the partition path from the
+// units and partitions underneath it.
+func (txn *transaction) readPartition(path storage.Path) (interface{}, error) {
+
+	result := map[string]interface{}{}
+
+	for _, unit := range txn.listUnits(path) {
+		if len(unit) != len(path)+1 {
+			continue
+		}
+		value, ok, err := txn.readUnit(unit)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			result[unit[len(path)]] = value
+		}
+	}
+
+	for _, dir := range txn.listDirs(path) {
+		if len(dir) != len(path)+1 {
+			continue
+		}
+		value, err := txn.readPartition(dir)
+		if err != nil {
+			return nil, err
+		}
+		result[dir[len(path)]] = value
+	}
+
+	return result, nil
+}
+
+func (txn *transaction) readUnit(unit storage.Path) (interface{}, bool, error) {
+	key := unit.String()
+	if u, ok := txn.units[key]; ok {
+		if u.remove {
+			return nil, false, nil
+		}
+		return u.value, true, nil
+	}
+	if _, ok := txn.db.units[key]; !ok {
+		return nil, false, nil
+	}
+	value, err := txn.db.readUnit(unit)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (txn *transaction) dirExists(path storage.Path) bool {
+	if len(path) == 0 {
+		return true
+	}
+	key := path.String()
+	if u, ok := txn.dirs[key]; ok {
+		return !u.remove
+	}
+	_, ok := txn.db.dirs[key]
+	return ok
+}
+
+// listUnits returns the existing units under prefix in sorted order.
+func (txn *transaction) listUnits(prefix storage.Path) []storage.Path {
+	return txn.list(prefix, txn.db.units, txn.units)
+}
+
+// listDirs returns the existing partitions under (and including) prefix in
+// sorted order. The root is never included.
+func (txn *transaction) listDirs(prefix storage.Path) []storage.Path {
+	return txn.list(prefix, txn.db.dirs, txn.dirs)
+}
+
+func (txn *transaction) list(prefix storage.Path, committed map[string]storage.Path, staged map[string]*unitUpdate) []storage.Path {
+	var result []storage.Path
+	for key, path := range committed {
+		if _, ok := staged[key]; !ok && path.HasPrefix(prefix) {
+			result = append(result, path)
+		}
+	}
+	for _, u := range staged {
+		if !u.remove && u.path.HasPrefix(prefix) {
+			result = append(result, u.path)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Compare(result[j]) < 0
+	})
+	return result
+}
+
+// patch applies the operation to the document referred to by path[idx:]
+// relative to data. The data is modified in place and must not be shared.
+func patch(data interface{}, op storage.PatchOp, path storage.Path, idx int, value interface{}) (interface{}, error) {
+
+	key := path[idx]
+	last := idx == len(path)-1
+
+	switch node := data.(type) {
+	case map[string]interface{}:
+		if !last {
+			child, ok := node[key]
+			if !ok {
+				return nil, notFoundError(path)
+			}
+			updated, err := patch(child, op, path, idx+1, value)
+			if err != nil {
+				return nil, err
+			}
+			node[key] = updated
+			return node, nil
+		}
+		switch op {
+		case storage.ReplaceOp, storage.RemoveOp:
+			if _, ok := node[key]; !ok {
+				return nil, notFoundError(path)
+			}
+		}
+		if op == storage.RemoveOp {
+			delete(node, key)
+		} else {
+			node[key] = value
+		}
+		return node, nil
+
+	case []interface{}:
+		if last && key == "-" {
+			if op != storage.AddOp {
+				return nil, invalidPatchError("%v: invalid patch path", path)
+			}
+			return append(node, value), nil
+		}
+		pos, err := validateArrayIndex(node, key, path)
+		if err != nil {
+			return nil, err
+		}
+		if !last {
+			updated, err := patch(node[pos], op, path, idx+1, value)
+			if err != nil {
+				return nil, err
+			}
+			node[pos] = updated
+			return node, nil
+		}
+		switch op {
+		case storage.AddOp:
+			cpy := make([]interface{}, len(node)+1)
+			copy(cpy[:pos], node[:pos])
+			copy(cpy[pos+1:], node[pos:])
+			cpy[pos] = value
+			return cpy, nil
+		case storage.RemoveOp:
+			return append(node[:pos], node[pos+1:]...), nil
+		default:
+			node[pos] = value
+			return node, nil
+		}
+	}
+
+	return nil, notFoundError(path)
+}
+
+func deepCopy(val interface{}) interface{} {
+	switch val := val.(type) {
+	case []interface{}:
+		cpy := make([]interface{}, len(val))
+		for i := range cpy {
+			cpy[i] = deepCopy(val[i])
+		}
+		return cpy
+	case map[string]interface{}:
+		cpy := make(map[string]interface{}, len(val))
+		for k := range val {
+			cpy[k] = deepCopy(val[k])
+		}
+		return cpy
+	default:
+		return val
+	}
+}
+
+// ptr returns the document referred to by path[idx:] relative to data.
+func ptr(data interface{}, path storage.Path, idx int) (interface{}, error) {
+
+	node := data
+	for i := idx; i < len(path); i++ {
+		key := path[i]
+		switch curr := node.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if node, ok = curr[key]; !ok {
+				return nil, notFoundError(path)
+			}
+		case []interface{}:
+			pos, err := validateArrayIndex(curr, key, path)
+			if err != nil {
+				return nil, err
+			}
+			node = curr[pos]
+		default:
+			return nil, notFoundError(path)
+		}
+	}
+
+	return node, nil
+}
+
+func validateArrayIndex(arr []interface{}, s string, path storage.Path) (int, error) {
+	idx, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, notFoundErrorHint(path, arrayIndexTypeMsg)
+	}
+	if idx < 0 || idx >= len(arr) {
+		return 0, notFoundErrorHint(path, outOfRangeMsg)
+	}
+	return idx, nil
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/internal/index"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -33,7 +34,7 @@ func New() storage.Store {
 		data:     map[string]interface{}{},
 		triggers: map[*handle]storage.TriggerConfig{},
 		policies: map[string][]byte{},
-		indices:  newIndices(),
+		indices:  index.NewIndices(),
 	}
 }
 
@@ -72,7 +73,7 @@ type store struct {
 	data     map[string]interface{}            // raw data
 	policies map[string][]byte                 // raw policies
 	triggers map[*handle]storage.TriggerConfig // registered triggers
-	indices  *indices                          // data ref indices
+	indices  *index.Indices                    // data ref indices
 }
 
 type handle struct {
@@ -98,7 +99,7 @@ func (db *store) Commit(ctx context.Context, txn storage.Transaction) error {
 	if underlying.write {
 		db.rmu.Lock()
 		event := underlying.Commit()
-		db.indices = newIndices()
+		db.indices = index.NewIndices()
 		db.runOnCommitTriggers(ctx, txn, event)
 		db.rmu.Unlock()
 		db.wmu.Unlock()
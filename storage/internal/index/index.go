@@ -2,7 +2,8 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
-package inmem
+// Package index implements data ref indices shared by storage implementations.
+package index
 
 import (
 	"context"
@@ -17,7 +18,7 @@ import (
 	"github.com/open-policy-agent/opa/util"
 )
 
-// indices contains a mapping of non-ground references to values to sets of bindings.
+// Indices contains a mapping of non-ground references to values to sets of bindings.
 //
 //  +------+------------------------------------+
 //  | ref1 | val1 | bindings-1, bindings-2, ... |
@@ -35,29 +36,32 @@ import (
 // reference obtained by plugging bindings into the non-ground reference that is the
 // index key.
 //
-type indices struct {
+type Indices struct {
 	mu    sync.Mutex
 	table map[int]*indicesNode
 }
 
 type indicesNode struct {
 	key  ast.Ref
-	val  *bindingIndex
+	val  *BindingIndex
 	next *indicesNode
 }
 
-func newIndices() *indices {
-	return &indices{
+// NewIndices returns an empty set of indices.
+func NewIndices() *Indices {
+	return &Indices{
 		table: map[int]*indicesNode{},
 	}
 }
 
-func (ind *indices) Build(ctx context.Context, store storage.Store, txn storage.Transaction, ref ast.Ref) (*bindingIndex, error) {
+// Build returns the index for ref, building it from the store if it does not
+// exist yet.
+func (ind *Indices) Build(ctx context.Context, store storage.Store, txn storage.Transaction, ref ast.Ref) (*BindingIndex, error) {
 
 	ind.mu.Lock()
 	defer ind.mu.Unlock()
 
-	if exist := ind.get(ref); exist != nil {
+	if exist := ind.Get(ref); exist != nil {
 		return exist, nil
 	}
 
@@ -80,7 +84,8 @@ func (ind *indices) Build(ctx context.Context, store storage.Store, txn storage.
 	return index, nil
 }
 
-func (ind *indices) get(ref ast.Ref) *bindingIndex {
+// Get returns the index for ref or nil if the index has not been built.
+func (ind *Indices) Get(ref ast.Ref) *BindingIndex {
 	node := ind.getNode(ref)
 	if node != nil {
 		return node.val
@@ -88,7 +93,7 @@ func (ind *indices) get(ref ast.Ref) *bindingIndex {
 	return nil
 }
 
-func (ind *indices) iter(iter func(ast.Ref, *bindingIndex) error) error {
+func (ind *Indices) iter(iter func(ast.Ref, *BindingIndex) error) error {
 	for _, head := range ind.table {
 		for entry := head; entry != nil; entry = entry.next {
 			if err := iter(entry.key, entry.val); err != nil {
@@ -99,7 +104,7 @@ func (ind *indices) iter(iter func(ast.Ref, *bindingIndex) error) error {
 	return nil
 }
 
-func (ind *indices) getNode(ref ast.Ref) *indicesNode {
+func (ind *Indices) getNode(ref ast.Ref) *indicesNode {
 	hashCode := ref.Hash()
 	for entry := ind.table[hashCode]; entry != nil; entry = entry.next {
 		if entry.key.Equal(ref) {
@@ -109,7 +114,7 @@ func (ind *indices) getNode(ref ast.Ref) *indicesNode {
 	return nil
 }
 
-func (ind *indices) String() string {
+func (ind *Indices) String() string {
 	buf := []string{}
 	for _, head := range ind.table {
 		for entry := head; entry != nil; entry = entry.next {
@@ -120,8 +125,8 @@ func (ind *indices) String() string {
 	return "{" + strings.Join(buf, ", ") + "}"
 }
 
-// bindingIndex contains a mapping of values to bindings.
-type bindingIndex struct {
+// BindingIndex contains a mapping of values to bindings.
+type BindingIndex struct {
 	table map[int]*indexNode
 }
 
@@ -131,13 +136,14 @@ type indexNode struct {
 	next *indexNode
 }
 
-func newBindingIndex() *bindingIndex {
-	return &bindingIndex{
+func newBindingIndex() *BindingIndex {
+	return &BindingIndex{
 		table: map[int]*indexNode{},
 	}
 }
 
-func (ind *bindingIndex) Add(val interface{}, bindings *ast.ValueMap) {
+// Add inserts bindings for val into the index.
+func (ind *BindingIndex) Add(val interface{}, bindings *ast.ValueMap) {
 
 	node := ind.getNode(val)
 	if node != nil {
@@ -158,7 +164,8 @@ func (ind *bindingIndex) Add(val interface{}, bindings *ast.ValueMap) {
 	ind.table[hashCode] = entry
 }
 
-func (ind *bindingIndex) Lookup(_ context.Context, _ storage.Transaction, val interface{}, iter storage.IndexIterator) error {
+// Lookup invokes iter for each set of bindings associated with val.
+func (ind *BindingIndex) Lookup(_ context.Context, _ storage.Transaction, val interface{}, iter storage.IndexIterator) error {
 	node := ind.getNode(val)
 	if node == nil {
 		return nil
@@ -166,7 +173,7 @@ func (ind *bindingIndex) Lookup(_ context.Context, _ storage.Transaction, val in
 	return node.val.Iter(iter)
 }
 
-func (ind *bindingIndex) getNode(val interface{}) *indexNode {
+func (ind *BindingIndex) getNode(val interface{}) *indexNode {
 	hashCode := hash(val)
 	head := ind.table[hashCode]
 	for entry := head; entry != nil; entry = entry.next {
@@ -177,7 +184,7 @@ func (ind *bindingIndex) getNode(val interface{}) *indexNode {
 	return nil
 }
 
-func (ind *bindingIndex) String() string {
+func (ind *BindingIndex) String() string {
 
 	buf := []string{}
 
@@ -1,7 +1,7 @@
 // Copyright 2016 The OPA Authors.  All rights reserved.
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
-package inmem
+package index_test
 
 import (
 	"context"
@@ -11,6 +11,8 @@ import (
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/storage/internal/index"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -48,13 +50,13 @@ func TestIndicesAdd(t *testing.T) {
 
 	data := loadSmallTestData()
 	ctx := context.Background()
-	store := NewFromObject(data)
+	store := inmem.NewFromObject(data)
 	txn := storage.NewTransactionOrDie(ctx, store)
 
-	indices := newIndices()
+	indices := index.NewIndices()
 	ref := ast.MustParseRef("data.d[x][y]")
 
-	index, err := indices.Build(ctx, store, txn, ref)
+	idx, err := indices.Build(ctx, store, txn, ref)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,47 +68,47 @@ func TestIndicesAdd(t *testing.T) {
 		panic(err)
 	}
 	bindings1 := loadExpectedBindings(`[{"x": "e", "y": 2}]`)[0]
-	index.Add(val1, bindings1)
-	assertBindingsEqual(t, "new value", index, val1, `[{"x": "e", "y": 2}]`)
+	idx.Add(val1, bindings1)
+	assertBindingsEqual(t, "new value", idx, val1, `[{"x": "e", "y": 2}]`)
 
 	// existing value
 	val2 := "baz"
 	bindings2 := loadExpectedBindings(`[{"x": "e", "y": 3}]`)[0]
-	index.Add(val2, bindings2)
-	assertBindingsEqual(t, "existing value", index, val2, `[{"x": "e", "y": 1}, {"x": "e", "y": 3}]`)
-	index.Add(val2, bindings2)
-	assertBindingsEqual(t, "same value (no change)", index, val2, `[{"x": "e", "y": 1}, {"x": "e", "y": 3}]`)
+	idx.Add(val2, bindings2)
+	assertBindingsEqual(t, "existing value", idx, val2, `[{"x": "e", "y": 1}, {"x": "e", "y": 3}]`)
+	idx.Add(val2, bindings2)
+	assertBindingsEqual(t, "same value (no change)", idx, val2, `[{"x": "e", "y": 1}, {"x": "e", "y": 3}]`)
 }
 
 func runIndexBuildTestCase(t *testing.T, i int, note string, refStr string, expectedStr string, value interface{}) {
 
 	ctx := context.Background()
 	data := loadSmallTestData()
-	store := NewFromObject(data)
+	store := inmem.NewFromObject(data)
 	txn := storage.NewTransactionOrDie(ctx, store)
-	indices := newIndices()
+	indices := index.NewIndices()
 
 	ref := ast.MustParseRef(refStr)
 
-	if indices.get(ref) != nil {
+	if indices.Get(ref) != nil {
 		t.Errorf("Test case %d (%v): Did not expect indices to contain %v yet", i, note, ref)
 		return
 	}
 
-	index, err := indices.Build(ctx, store, txn, ref)
+	idx, err := indices.Build(ctx, store, txn, ref)
 	if err != nil {
 		t.Errorf("Test case %d (%v): Did not expect error from build: %v", i, note, err)
 		return
 	}
 
-	assertBindingsEqual(t, fmt.Sprintf("Test case %d (%v)", i, note), index, value, expectedStr)
+	assertBindingsEqual(t, fmt.Sprintf("Test case %d (%v)", i, note), idx, value, expectedStr)
 }
 
-func assertBindingsEqual(t *testing.T, note string, index *bindingIndex, value interface{}, expectedStr string) {
+func assertBindingsEqual(t *testing.T, note string, idx *index.BindingIndex, value interface{}, expectedStr string) {
 
 	expected := loadExpectedBindings(expectedStr)
 
-	err := index.Lookup(context.Background(), nil, value, func(bindings *ast.ValueMap) error {
+	err := idx.Lookup(context.Background(), nil, value, func(bindings *ast.ValueMap) error {
 		for j := range expected {
 			if expected[j].Equal(bindings) {
 				tmp := expected[:j]
@@ -150,3 +152,27 @@ func loadExpectedBindings(input string) []*ast.ValueMap {
 	}
 	return expected
 }
+
+func loadSmallTestData() map[string]interface{} {
+	var data map[string]interface{}
+	err := util.UnmarshalJSON([]byte(`{
+		"a": [1,2,3,4],
+		"c": [{
+			"x": [true, false, "foo"],
+			"y": [null, 3.14159],
+			"z": {"p": true, "q": false}
+		}],
+		"d": {
+			"e": ["bar", "baz"]
+		},
+		"g": {
+			"a": [1, 0, 0, 0],
+			"b": [0, 2, 0, 0],
+			"c": [0, 0, 0, 4]
+		}
+	}`), &data)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -5,10 +5,13 @@
 package topdown
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/topdown/cache"
 )
 
 type (
@@ -55,12 +58,16 @@ type (
 	// BuiltinContext contains context from the evaluator that may be used by
 	// built-in functions.
 	BuiltinContext struct {
-		Runtime  *ast.Term      // runtime information on the OPA instance
-		Cache    builtins.Cache // built-in function state cache
-		Location *ast.Location  // location of built-in call
-		Tracers  []Tracer       // tracer objects for trace() built-in function
-		QueryID  uint64         // identifies query being evaluated
-		ParentID uint64         // identifies parent of query being evaluated
+		Context                context.Context       // request context that was passed when query started
+		Metrics                metrics.Metrics       // metrics collection for the query (may be nil)
+		Runtime                *ast.Term             // runtime information on the OPA instance
+		Cache                  builtins.Cache        // built-in function state cache
+		InterQueryBuiltinCache cache.InterQueryCache // cross-query built-in function state cache (may be nil)
+		Location               *ast.Location         // location of built-in call
+		Tracers                []Tracer              // tracer objects for trace() built-in function
+		QueryID                uint64                // identifies query being evaluated
+		ParentID               uint64                // identifies parent of query being evaluated
+		limiter                *limiter              // resource limits of query being evaluated (may be nil)
 	}
 
 	// BuiltinFunc defines an interface for implementing built-in functions.
@@ -69,6 +76,14 @@ type (
 	// operands and invoke the iteraror for each successful/defined output
 	// value.
 	BuiltinFunc func(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error
+
+	// Builtin combines the declaration and implementation of a built-in
+	// function. Builtins are provided to individual queries rather than
+	// registered globally.
+	Builtin struct {
+		Decl *ast.Builtin
+		Func BuiltinFunc
+	}
 )
 
 // RegisterBuiltinFunc adds a new built-in function to the evaluation engine.
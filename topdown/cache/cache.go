@@ -0,0 +1,174 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package cache defines the inter-query cache that built-in functions can use
+// to share values across queries.
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const defaultMaxSizeBytes = int64(10 * 1024 * 1024)
+
+// Config represents the configuration of the inter-query cache.
+type Config struct {
+	InterQueryBuiltinCache InterQueryBuiltinCacheConfig `json:"inter_query_builtin_cache"`
+}
+
+// InterQueryBuiltinCacheConfig represents the configuration of the inter-query
+// cache that built-in functions can utilize.
+type InterQueryBuiltinCacheConfig struct {
+	MaxSizeBytes *int64 `json:"max_size_bytes,omitempty"`
+}
+
+// ParseCachingConfig returns the config for the inter-query cache. If raw is
+// nil, the default configuration is returned.
+func ParseCachingConfig(raw []byte) (*Config, error) {
+
+	var config Config
+
+	if raw != nil {
+		if err := util.Unmarshal(raw, &config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, config.validateAndInjectDefaults()
+}
+
+func (c *Config) validateAndInjectDefaults() error {
+	if c.InterQueryBuiltinCache.MaxSizeBytes == nil {
+		maxSize := defaultMaxSizeBytes
+		c.InterQueryBuiltinCache.MaxSizeBytes = &maxSize
+	} else if *c.InterQueryBuiltinCache.MaxSizeBytes < 0 {
+		return fmt.Errorf("invalid max_size_bytes: %v", *c.InterQueryBuiltinCache.MaxSizeBytes)
+	}
+	return nil
+}
+
+// InterQueryCacheValue defines the interface for the data that the inter-query
+// cache holds.
+type InterQueryCacheValue interface {
+	SizeInBytes() int64
+}
+
+// InterQueryCache defines the interface for the inter-query cache. Caches
+// must be safe for concurrent use.
+type InterQueryCache interface {
+	Get(key ast.Value) (value InterQueryCacheValue, found bool)
+	Insert(key ast.Value, value InterQueryCacheValue) (dropped int)
+	Delete(key ast.Value)
+	UpdateConfig(config *Config)
+}
+
+// NewInterQueryCache returns a new inter-query cache. When the cache exceeds
+// the configured size, the least recently used entries are dropped. If config
+// is nil, the default configuration is used.
+func NewInterQueryCache(config *Config) InterQueryCache {
+	c := &cache{
+		items:   map[string]*list.Element{},
+		l:       list.New(),
+		maxSize: defaultMaxSizeBytes,
+	}
+	c.UpdateConfig(config)
+	return c
+}
+
+type cache struct {
+	items   map[string]*list.Element
+	l       *list.List
+	usage   int64
+	maxSize int64
+	mtx     sync.Mutex
+}
+
+type cacheItem struct {
+	key   string
+	value InterQueryCacheValue
+}
+
+// Get returns the value in the cache for key.
+func (c *cache) Get(key ast.Value) (InterQueryCacheValue, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.items[key.String()]
+	if !ok {
+		return nil, false
+	}
+
+	c.l.MoveToFront(elem)
+	return elem.Value.(*cacheItem).value, true
+}
+
+// Insert inserts the key-value pair into the cache. If the cache is full,
+// entries are dropped to make room and the number of dropped entries is
+// returned. Values larger than the cache are not inserted.
+func (c *cache) Insert(key ast.Value, value InterQueryCacheValue) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	k := key.String()
+	c.delete(k)
+
+	size := value.SizeInBytes()
+	if size > c.maxSize {
+		return 0
+	}
+
+	dropped := 0
+
+	for c.usage+size > c.maxSize {
+		c.delete(c.l.Back().Value.(*cacheItem).key)
+		dropped++
+	}
+
+	c.items[k] = c.l.PushFront(&cacheItem{key: k, value: value})
+	c.usage += size
+
+	return dropped
+}
+
+// Delete deletes the value in the cache for key.
+func (c *cache) Delete(key ast.Value) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.delete(key.String())
+}
+
+// UpdateConfig updates the cache configuration. If the cache exceeds the new
+// maximum size, entries are dropped.
+func (c *cache) UpdateConfig(config *Config) {
+	if config == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.maxSize = defaultMaxSizeBytes
+	if config.InterQueryBuiltinCache.MaxSizeBytes != nil {
+		c.maxSize = *config.InterQueryBuiltinCache.MaxSizeBytes
+	}
+
+	for c.usage > c.maxSize {
+		c.delete(c.l.Back().Value.(*cacheItem).key)
+	}
+}
+
+func (c *cache) delete(k string) {
+	elem, ok := c.items[k]
+	if !ok {
+		return
+	}
+	c.usage -= elem.Value.(*cacheItem).value.SizeInBytes()
+	c.l.Remove(elem)
+	delete(c.items, k)
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+type testValue int64
+
+func (v testValue) SizeInBytes() int64 {
+	return int64(v)
+}
+
+func TestParseCachingConfig(t *testing.T) {
+
+	config, err := ParseCachingConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *config.InterQueryBuiltinCache.MaxSizeBytes != defaultMaxSizeBytes {
+		t.Fatalf("Expected default max size but got %v", *config.InterQueryBuiltinCache.MaxSizeBytes)
+	}
+
+	config, err = ParseCachingConfig([]byte(`{"inter_query_builtin_cache": {"max_size_bytes": 100}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *config.InterQueryBuiltinCache.MaxSizeBytes != 100 {
+		t.Fatalf("Expected max size of 100 but got %v", *config.InterQueryBuiltinCache.MaxSizeBytes)
+	}
+
+	if _, err := ParseCachingConfig([]byte(`{"inter_query_builtin_cache": {"max_size_bytes": -1}}`)); err == nil {
+		t.Fatal("Expected error for negative max size")
+	}
+}
+
+func TestInterQueryCache(t *testing.T) {
+
+	config, err := ParseCachingConfig([]byte(`{"inter_query_builtin_cache": {"max_size_bytes": 20}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewInterQueryCache(config)
+	a, b, d := ast.String("a"), ast.String("b"), ast.String("d")
+
+	if dropped := c.Insert(a, testValue(10)); dropped != 0 {
+		t.Fatalf("Expected no entries to be dropped but got %v", dropped)
+	}
+
+	if dropped := c.Insert(b, testValue(10)); dropped != 0 {
+		t.Fatalf("Expected no entries to be dropped but got %v", dropped)
+	}
+
+	// Access a so that b becomes the least recently used entry.
+	if v, ok := c.Get(a); !ok || v != testValue(10) {
+		t.Fatalf("Expected value for a but got %v", v)
+	}
+
+	if dropped := c.Insert(d, testValue(5)); dropped != 1 {
+		t.Fatalf("Expected one entry to be dropped but got %v", dropped)
+	}
+
+	if _, ok := c.Get(b); ok {
+		t.Fatal("Expected b to be dropped")
+	}
+
+	if _, ok := c.Get(a); !ok {
+		t.Fatal("Expected a to be kept")
+	}
+
+	c.Delete(a)
+
+	if _, ok := c.Get(a); ok {
+		t.Fatal("Expected a to be deleted")
+	}
+
+	// Values larger than the cache are not inserted.
+	c.Insert(b, testValue(21))
+
+	if _, ok := c.Get(b); ok {
+		t.Fatal("Expected large value to be rejected")
+	}
+
+	var maxSize int64
+	c.UpdateConfig(&Config{InterQueryBuiltinCache: InterQueryBuiltinCacheConfig{MaxSizeBytes: &maxSize}})
+
+	if _, ok := c.Get(d); ok {
+		t.Fatal("Expected entries to be dropped after shrinking cache")
+	}
+}
@@ -1,8 +1,12 @@
 package topdown
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
 	"net"
+	"sort"
+	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/topdown/builtins"
@@ -32,6 +36,350 @@ func builtinNetCIDROverlap(a, b ast.Value) (ast.Value, error) {
 	return ast.Boolean(cidrnet.Contains(ip)), nil
 }
 
+func builtinNetCIDRContains(a, b ast.Value) (ast.Value, error) {
+	cidr, err := cidrOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	other, err := ipOrCIDROperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Boolean(cidrContains(cidr, other)), nil
+}
+
+func builtinNetCIDRIntersects(a, b ast.Value) (ast.Value, error) {
+	cidrA, err := cidrOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	cidrB, err := cidrOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Boolean(cidrIntersects(cidrA, cidrB)), nil
+}
+
+// maxCIDRExpandHostBits is the maximum number of host bits in CIDRs that can be
+// expanded, i.e., a CIDR can be expanded to at most 65536 addresses.
+const maxCIDRExpandHostBits = 16
+
+func builtinNetCIDRExpand(bctx BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+	cidr, err := cidrOperand(operands[0].Value, 1)
+	if err != nil {
+		return handleBuiltinErr(ast.NetCIDRExpand.Name, bctx.Location, err)
+	}
+
+	ones, bits := cidr.Mask.Size()
+	if bits-ones > maxCIDRExpandHostBits {
+		return handleBuiltinErr(ast.NetCIDRExpand.Name, bctx.Location, builtins.NewOperandErr(1, "CIDR %v is too large to expand (more than %d host bits)", cidr, maxCIDRExpandHostBits))
+	}
+
+	if err := bctx.limiter.checkSize(1<<uint(bits-ones), bctx.Location); err != nil {
+		return err
+	}
+
+	result := ast.NewSet()
+
+	for ip := copyIP(cidr.IP); cidr.Contains(ip); ip = nextIP(ip) {
+		if bctx.Context != nil && bctx.Context.Err() != nil {
+			return handleBuiltinErr(ast.NetCIDRExpand.Name, bctx.Location, bctx.Context.Err())
+		}
+		result.Add(ast.StringTerm(ip.String()))
+		if isLastIP(ip) {
+			break
+		}
+	}
+
+	return iter(ast.NewTerm(result))
+}
+
+func builtinNetCIDRMerge(a ast.Value) (ast.Value, error) {
+	var terms []*ast.Term
+
+	switch a := a.(type) {
+	case ast.Array:
+		terms = a
+	case ast.Set:
+		terms = a.Sorted()
+	default:
+		return nil, builtins.NewOperandTypeErr(1, a, "array", "set")
+	}
+
+	var v4, v6 []*net.IPNet
+
+	for _, t := range terms {
+		cidr, err := ipOrCIDROperand(t.Value, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(cidr.IP) == net.IPv4len {
+			v4 = append(v4, cidr)
+		} else {
+			v6 = append(v6, cidr)
+		}
+	}
+
+	result := ast.NewSet()
+
+	for _, cidr := range mergeCIDRs(v4) {
+		result.Add(ast.StringTerm(cidr.String()))
+	}
+
+	for _, cidr := range mergeCIDRs(v6) {
+		result.Add(ast.StringTerm(cidr.String()))
+	}
+
+	return result, nil
+}
+
+func builtinNetCIDRContainsMatches(a, b ast.Value) (ast.Value, error) {
+	cidrs, err := cidrMatchOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	others, err := cidrMatchOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ast.NewSet()
+
+	for _, cidr := range cidrs {
+		for _, other := range others {
+			if cidrContains(cidr.cidr, other.cidr) {
+				result.Add(ast.ArrayTerm(cidr.key, other.key))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// privateCIDRs are the private address ranges defined by RFC 1918 and RFC 4193.
+var privateCIDRs = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+func builtinNetIPIsPrivate(a ast.Value) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(string(s))
+	if ip == nil {
+		return nil, builtins.NewOperandErr(1, "not a valid textual representation of an IP address: %s", string(s))
+	}
+
+	for _, cidr := range privateCIDRs {
+		if cidr.Contains(ip) {
+			return ast.Boolean(true), nil
+		}
+	}
+
+	return ast.Boolean(false), nil
+}
+
+func cidrOperand(x ast.Value, pos int) (*net.IPNet, error) {
+	s, err := builtins.StringOperand(x, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	_, cidr, err := net.ParseCIDR(string(s))
+	if err != nil {
+		return nil, builtins.NewOperandErr(pos, "%v", err)
+	}
+
+	return cidr, nil
+}
+
+// ipOrCIDROperand returns the CIDR specified by x. IPs are treated as CIDRs
+// that contain a single address.
+func ipOrCIDROperand(x ast.Value, pos int) (*net.IPNet, error) {
+	s, err := builtins.StringOperand(x, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(string(s), "/") {
+		return cidrOperand(x, pos)
+	}
+
+	ip := net.ParseIP(string(s))
+	if ip == nil {
+		return nil, builtins.NewOperandErr(pos, "not a valid textual representation of an IP address: %s", string(s))
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+}
+
+type cidrMatch struct {
+	key  *ast.Term
+	cidr *net.IPNet
+}
+
+// cidrMatchOperand returns the CIDRs specified by x along with the keys used to
+// identify them in the output of net.cidr_contains_matches. Collection elements
+// may be strings or arrays whose first element is a string.
+func cidrMatchOperand(x ast.Value, pos int) ([]cidrMatch, error) {
+	var result []cidrMatch
+
+	add := func(key, elem *ast.Term) error {
+		if arr, ok := elem.Value.(ast.Array); ok && len(arr) > 0 {
+			elem = arr[0]
+		}
+		cidr, err := ipOrCIDROperand(elem.Value, pos)
+		if err != nil {
+			return err
+		}
+		result = append(result, cidrMatch{key: key, cidr: cidr})
+		return nil
+	}
+
+	var err error
+
+	switch x := x.(type) {
+	case ast.String:
+		err = add(ast.NewTerm(x), ast.NewTerm(x))
+	case ast.Array:
+		for i := range x {
+			if err = add(ast.IntNumberTerm(i), x[i]); err != nil {
+				break
+			}
+		}
+	case ast.Set:
+		err = x.Iter(func(elem *ast.Term) error {
+			return add(elem, elem)
+		})
+	case ast.Object:
+		err = x.Iter(func(k, v *ast.Term) error {
+			return add(k, v)
+		})
+	default:
+		err = builtins.NewOperandTypeErr(pos, x, "string", "array", "set", "object")
+	}
+
+	return result, err
+}
+
+func cidrContains(a, b *net.IPNet) bool {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	return bitsA == bitsB && onesA <= onesB && a.Contains(b.IP)
+}
+
+func cidrIntersects(a, b *net.IPNet) bool {
+	_, bitsA := a.Mask.Size()
+	_, bitsB := b.Mask.Size()
+	return bitsA == bitsB && (a.Contains(b.IP) || b.Contains(a.IP))
+}
+
+// mergeCIDRs returns the smallest set of CIDRs that covers the same addresses
+// as cidrs. All of the CIDRs must belong to the same address family.
+func mergeCIDRs(cidrs []*net.IPNet) []*net.IPNet {
+
+	for i := range cidrs {
+		cidrs[i] = &net.IPNet{IP: cidrs[i].IP.Mask(cidrs[i].Mask), Mask: cidrs[i].Mask}
+	}
+
+	sort.Slice(cidrs, func(i, j int) bool {
+		if cmp := bytes.Compare(cidrs[i].IP, cidrs[j].IP); cmp != 0 {
+			return cmp < 0
+		}
+		onesI, _ := cidrs[i].Mask.Size()
+		onesJ, _ := cidrs[j].Mask.Size()
+		return onesI < onesJ
+	})
+
+	var result []*net.IPNet
+
+	for _, cidr := range cidrs {
+		if len(result) > 0 && cidrContains(result[len(result)-1], cidr) {
+			continue
+		}
+		result = append(result, cidr)
+		for len(result) > 1 {
+			parent, ok := mergeSiblingCIDRs(result[len(result)-2], result[len(result)-1])
+			if !ok {
+				break
+			}
+			result = append(result[:len(result)-2], parent)
+		}
+	}
+
+	return result
+}
+
+// mergeSiblingCIDRs returns the CIDR that consists of exactly a and b if they
+// are adjacent halves of the same network.
+func mergeSiblingCIDRs(a, b *net.IPNet) (*net.IPNet, bool) {
+	onesA, bits := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+
+	if onesA != onesB || onesA == 0 {
+		return nil, false
+	}
+
+	mask := net.CIDRMask(onesA-1, bits)
+
+	if !a.IP.Mask(mask).Equal(a.IP) || !b.IP.Mask(mask).Equal(a.IP) {
+		return nil, false
+	}
+
+	return &net.IPNet{IP: a.IP, Mask: mask}, true
+}
+
+func copyIP(ip net.IP) net.IP {
+	cpy := make(net.IP, len(ip))
+	copy(cpy, ip)
+	return cpy
+}
+
+func nextIP(ip net.IP) net.IP {
+	i := new(big.Int).SetBytes(ip)
+	i.Add(i, big.NewInt(1))
+	next := make(net.IP, len(ip))
+	b := i.Bytes()
+	copy(next[len(next)-len(b):], b)
+	return next
+}
+
+func isLastIP(ip net.IP) bool {
+	for i := range ip {
+		if ip[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	result := make([]*net.IPNet, len(cidrs))
+	for i := range cidrs {
+		_, cidr, err := net.ParseCIDR(cidrs[i])
+		if err != nil {
+			panic(err)
+		}
+		result[i] = cidr
+	}
+	return result
+}
+
 func init() {
 	RegisterFunctionalBuiltin2(ast.NetCIDROverlap.Name, builtinNetCIDROverlap)
+	RegisterFunctionalBuiltin2(ast.NetCIDRContains.Name, builtinNetCIDRContains)
+	RegisterFunctionalBuiltin2(ast.NetCIDRIntersects.Name, builtinNetCIDRIntersects)
+	RegisterBuiltinFunc(ast.NetCIDRExpand.Name, builtinNetCIDRExpand)
+	RegisterFunctionalBuiltin1(ast.NetCIDRMerge.Name, builtinNetCIDRMerge)
+	RegisterFunctionalBuiltin2(ast.NetCIDRContainsMatches.Name, builtinNetCIDRContainsMatches)
+	RegisterFunctionalBuiltin1(ast.NetIPIsPrivate.Name, builtinNetIPIsPrivate)
 }
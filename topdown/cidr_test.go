@@ -1,6 +1,9 @@
 package topdown
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestNetCIDROverlap(t *testing.T) {
 	tests := []struct {
@@ -18,3 +21,136 @@ func TestNetCIDROverlap(t *testing.T) {
 		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
 	}
 }
+
+func TestNetCIDRContains(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"ip", []string{`p = x { x = net.cidr_contains("10.0.0.0/8", "10.1.2.3") }`}, "true"},
+		{"ip outside", []string{`p = x { x = net.cidr_contains("10.0.0.0/8", "11.1.2.3") }`}, "false"},
+		{"cidr", []string{`p = x { x = net.cidr_contains("10.0.0.0/8", "10.1.0.0/16") }`}, "true"},
+		{"cidr larger", []string{`p = x { x = net.cidr_contains("10.1.0.0/16", "10.0.0.0/8") }`}, "false"},
+		{"ipv6 ip", []string{`p = x { x = net.cidr_contains("2001:db8::/32", "2001:db8:1::1") }`}, "true"},
+		{"ipv6 cidr", []string{`p = x { x = net.cidr_contains("2001:db8::/32", "2001:db8:1::/48") }`}, "true"},
+		{"mixed families", []string{`p = x { x = net.cidr_contains("::/0", "10.0.0.0/8") }`}, "false"},
+		{"bad cidr", []string{`p = x { x = net.cidr_contains("10.0.0.0", "10.0.0.1") }`}, fmt.Errorf("operand 1 invalid CIDR address: 10.0.0.0")},
+		{"bad ip", []string{`p = x { x = net.cidr_contains("10.0.0.0/8", "10.0.0") }`}, fmt.Errorf("operand 2 not a valid textual representation of an IP address: 10.0.0")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestNetCIDRIntersects(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"overlap", []string{`p = x { x = net.cidr_intersects("10.0.0.0/8", "10.1.0.0/16") }`}, "true"},
+		{"overlap reversed", []string{`p = x { x = net.cidr_intersects("10.1.0.0/16", "10.0.0.0/8") }`}, "true"},
+		{"disjoint", []string{`p = x { x = net.cidr_intersects("10.0.0.0/16", "10.1.0.0/16") }`}, "false"},
+		{"ipv6", []string{`p = x { x = net.cidr_intersects("fd00::/8", "fd12::/16") }`}, "true"},
+		{"mixed families", []string{`p = x { x = net.cidr_intersects("::/0", "0.0.0.0/0") }`}, "false"},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestNetCIDRExpand(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"ipv4", []string{`p = x { x = net.cidr_expand("192.168.1.254/30") }`}, `["192.168.1.252", "192.168.1.253", "192.168.1.254", "192.168.1.255"]`},
+		{"single", []string{`p = x { x = net.cidr_expand("10.0.0.1/32") }`}, `["10.0.0.1"]`},
+		{"end of range", []string{`p = x { x = net.cidr_expand("255.255.255.254/31") }`}, `["255.255.255.254", "255.255.255.255"]`},
+		{"ipv6", []string{`p = x { x = net.cidr_expand("2001:db8::/127") }`}, `["2001:db8::", "2001:db8::1"]`},
+		{"bad cidr", []string{`p = x { x = net.cidr_expand("10.0.0.0/33") }`}, fmt.Errorf("operand 1 invalid CIDR address: 10.0.0.0/33")},
+		{"too large", []string{`p = x { x = net.cidr_expand("10.0.0.0/15") }`}, fmt.Errorf("operand 1 CIDR 10.0.0.0/15 is too large to expand (more than 16 host bits)")},
+		{"too large ipv6", []string{`p = x { x = net.cidr_expand("2001:db8::/64") }`}, fmt.Errorf("operand 1 CIDR 2001:db8::/64 is too large to expand (more than 16 host bits)")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestNetCIDRMerge(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"adjacent", []string{`p = x { x = net.cidr_merge(["10.0.0.0/25", "10.0.0.128/25"]) }`}, `["10.0.0.0/24"]`},
+		{"recursive", []string{`p = x { x = net.cidr_merge(["10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/25"]) }`}, `["10.0.0.0/24"]`},
+		{"contained", []string{`p = x { x = net.cidr_merge({"10.0.0.0/8", "10.1.0.0/16", "10.2.3.4"}) }`}, `["10.0.0.0/8"]`},
+		{"ips", []string{`p = x { x = net.cidr_merge(["192.168.0.0", "192.168.0.1", "192.168.0.3"]) }`}, `["192.168.0.0/31", "192.168.0.3/32"]`},
+		{"not aligned", []string{`p = x { x = net.cidr_merge(["10.0.1.0/24", "10.0.2.0/24"]) }`}, `["10.0.1.0/24", "10.0.2.0/24"]`},
+		{"host bits", []string{`p = x { x = net.cidr_merge(["10.0.0.1/24"]) }`}, `["10.0.0.0/24"]`},
+		{"ipv6", []string{`p = x { x = net.cidr_merge(["2001:db8::/33", "2001:db8:8000::/33", "10.0.0.0/8"]) }`}, `["10.0.0.0/8", "2001:db8::/32"]`},
+		{"bad", []string{`p = x { x = net.cidr_merge(["10.0.0.0/8", "bad"]) }`}, fmt.Errorf("operand 1 not a valid textual representation of an IP address: bad")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestNetCIDRContainsMatches(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"strings", []string{`p = x { x = net.cidr_contains_matches("10.0.0.0/8", "10.1.2.3") }`}, `[["10.0.0.0/8", "10.1.2.3"]]`},
+		{"arrays", []string{`p = x { x = net.cidr_contains_matches(["10.0.0.0/8", "192.168.0.0/16"], ["192.168.1.1", "10.0.0.1", "8.8.8.8"]) }`}, `[[0, 1], [1, 0]]`},
+		{"sets", []string{`p = x { x = net.cidr_contains_matches({"10.0.0.0/8", "10.1.0.0/16"}, {"10.1.2.3"}) }`}, `[["10.0.0.0/8", "10.1.2.3"], ["10.1.0.0/16", "10.1.2.3"]]`},
+		{"objects", []string{`p = x { x = net.cidr_contains_matches({"private": "10.0.0.0/8", "v6": ["fd00::/8", "extra"]}, {"host": ["fd00::1", 1]}) }`}, `[["v6", "host"]]`},
+		{"no matches", []string{`p = x { x = net.cidr_contains_matches(["10.0.0.0/8"], ["11.0.0.1"]) }`}, `[]`},
+		{"bad", []string{`p = x { x = net.cidr_contains_matches(["10.0.0.0/8"], ["bad"]) }`}, fmt.Errorf("operand 2 not a valid textual representation of an IP address: bad")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestNetIPIsPrivate(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"10/8", []string{`p = x { x = net.ip_is_private("10.20.30.40") }`}, "true"},
+		{"172.16/12", []string{`p = x { x = net.ip_is_private("172.31.255.255") }`}, "true"},
+		{"172.32", []string{`p = x { x = net.ip_is_private("172.32.0.1") }`}, "false"},
+		{"192.168/16", []string{`p = x { x = net.ip_is_private("192.168.0.1") }`}, "true"},
+		{"public", []string{`p = x { x = net.ip_is_private("8.8.8.8") }`}, "false"},
+		{"ipv6 unique local", []string{`p = x { x = net.ip_is_private("fd12:3456::1") }`}, "true"},
+		{"ipv6 public", []string{`p = x { x = net.ip_is_private("2001:db8::1") }`}, "false"},
+		{"bad", []string{`p = x { x = net.ip_is_private("10.0.0.0/8") }`}, fmt.Errorf("operand 1 not a valid textual representation of an IP address: 10.0.0.0/8")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
@@ -5,10 +5,28 @@
 package topdown
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -24,7 +42,152 @@ func builtinCryptoX509ParseCertificates(a ast.Value) (ast.Value, error) {
 		return nil, err
 	}
 
-	bs, err := json.Marshal(certs)
+	return x509ToValue(certs)
+}
+
+func builtinCryptoX509ParseAndVerifyCertificates(a, b ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	rootsStr, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := getX509CertsFromString(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	trusted, err := getX509CertsFromString(string(rootsStr))
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := ast.Array{ast.BooleanTerm(false), ast.ObjectTerm()}
+
+	if len(certs) == 0 || len(trusted) == 0 {
+		return invalid, nil
+	}
+
+	roots := x509.NewCertPool()
+	for _, cert := range trusted {
+		roots.AddCert(cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return invalid, nil
+	}
+
+	leaf, err := x509ToValue(certs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Array{ast.BooleanTerm(true), ast.NewTerm(leaf)}, nil
+}
+
+func builtinCryptoX509ParseCertificateRequest(a ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, isPEM, err := decodePEMOrBase64(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	if isPEM {
+		block, _ := pem.Decode(bs)
+		if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+			return nil, fmt.Errorf("no PEM encoded certificate request found")
+		}
+		bs = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	return x509ToValue(csr)
+}
+
+func builtinCryptoX509ParseRSAPrivateKey(a ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := getPrivateKeysFromString(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("expected exactly one PEM encoded private key but got %d", len(keys))
+	}
+
+	key, ok := keys[0].(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+
+	return privateKeyToJWK(key)
+}
+
+func builtinCryptoParsePrivateKeys(a ast.Value) (ast.Value, error) {
+
+	str, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(str)) == "" {
+		return ast.Array{}, nil
+	}
+
+	keys, err := getPrivateKeysFromString(string(str))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(ast.Array, 0, len(keys))
+
+	for _, key := range keys {
+		jwk, err := privateKeyToJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ast.NewTerm(jwk))
+	}
+
+	return result, nil
+}
+
+// x509ToValue converts the parsed X.509 structure to its JSON representation.
+func x509ToValue(v interface{}) (ast.Value, error) {
+
+	bs, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +201,224 @@ func builtinCryptoX509ParseCertificates(a ast.Value) (ast.Value, error) {
 	return ast.InterfaceToValue(x)
 }
 
+// decodePEMOrBase64 returns the bytes represented by s and whether they are PEM
+// encoded. The input may be PEM encoded or base64 encoded PEM or DER.
+func decodePEMOrBase64(s string) ([]byte, bool, error) {
+
+	if strings.HasPrefix(strings.TrimSpace(s), "-----BEGIN") {
+		return []byte(s), true, nil
+	}
+
+	bs, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return bs, bytes.HasPrefix(bytes.TrimSpace(bs), []byte("-----BEGIN")), nil
+}
+
+func getX509CertsFromString(s string) ([]*x509.Certificate, error) {
+
+	bs, isPEM, err := decodePEMOrBase64(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPEM {
+		return x509.ParseCertificates(bs)
+	}
+
+	var der []byte
+
+	for block, rest := pem.Decode(bs); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			der = append(der, block.Bytes...)
+		}
+	}
+
+	if len(der) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificates found")
+	}
+
+	return x509.ParseCertificates(der)
+}
+
+// getPrivateKeysFromString returns the RSA, ECDSA, and Ed25519 private keys in the PEM
+// encoded string s. Blocks that do not contain private keys are ignored.
+func getPrivateKeysFromString(s string) ([]interface{}, error) {
+
+	bs, isPEM, err := decodePEMOrBase64(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPEM {
+		return nil, fmt.Errorf("private keys must be PEM encoded")
+	}
+
+	var keys []interface{}
+
+	for block, rest := pem.Decode(bs); block != nil; block, rest = pem.Decode(rest) {
+		var key interface{}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, convertEd25519Key(key))
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM encoded private keys found")
+	}
+
+	return keys, nil
+}
+
+// privateKeyToJWK returns the JSON Web Key representation of the private key.
+func privateKeyToJWK(key interface{}) (ast.Value, error) {
+
+	enc := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	var jwk map[string]interface{}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		key.Precompute()
+		jwk = map[string]interface{}{
+			"kty": "RSA",
+			"n":   enc(key.N),
+			"e":   enc(big.NewInt(int64(key.E))),
+			"d":   enc(key.D),
+		}
+		if len(key.Primes) == 2 {
+			jwk["p"] = enc(key.Primes[0])
+			jwk["q"] = enc(key.Primes[1])
+			jwk["dp"] = enc(key.Precomputed.Dp)
+			jwk["dq"] = enc(key.Precomputed.Dq)
+			jwk["qi"] = enc(key.Precomputed.Qinv)
+		}
+	case *ecdsa.PrivateKey:
+		params := key.Curve.Params()
+		size := (params.BitSize + 7) / 8
+		pad := func(i *big.Int) string {
+			bs := make([]byte, size)
+			b := i.Bytes()
+			copy(bs[size-len(b):], b)
+			return base64.RawURLEncoding.EncodeToString(bs)
+		}
+		jwk = map[string]interface{}{
+			"kty": "EC",
+			"crv": params.Name,
+			"x":   pad(key.X),
+			"y":   pad(key.Y),
+			"d":   pad(key.D),
+		}
+	case ed25519.PrivateKey:
+		jwk = map[string]interface{}{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			"d":   base64.RawURLEncoding.EncodeToString(key.Seed()),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	return ast.InterfaceToValue(jwk)
+}
+
+func builtinCryptoMd5(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, md5.New)
+}
+
+func builtinCryptoSha1(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, sha1.New)
+}
+
+func builtinCryptoSha256(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, sha256.New)
+}
+
+func builtinCryptoSha512(a ast.Value) (ast.Value, error) {
+	return hashHelper(a, sha512.New)
+}
+
+func builtinCryptoHmacSha256(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, sha256.New)
+}
+
+func builtinCryptoHmacSha512(a, b ast.Value) (ast.Value, error) {
+	return hmacHelper(a, b, sha512.New)
+}
+
+func builtinCryptoHmacEqual(a, b ast.Value) (ast.Value, error) {
+	mac1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mac2, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Boolean(hmac.Equal([]byte(mac1), []byte(mac2))), nil
+}
+
+// hashHelper returns the hex encoded digest of the string operand.
+func hashHelper(a ast.Value, h func() hash.Hash) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	d := h()
+	d.Write([]byte(s))
+
+	return ast.String(hex.EncodeToString(d.Sum(nil))), nil
+}
+
+// hmacHelper returns the hex encoded HMAC of the string operand a computed with
+// the key b.
+func hmacHelper(a, b ast.Value, h func() hash.Hash) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(s))
+
+	return ast.String(hex.EncodeToString(mac.Sum(nil))), nil
+}
+
 func init() {
 	RegisterFunctionalBuiltin1(ast.CryptoX509ParseCertificates.Name, builtinCryptoX509ParseCertificates)
+	RegisterFunctionalBuiltin2(ast.CryptoX509ParseAndVerifyCertificates.Name, builtinCryptoX509ParseAndVerifyCertificates)
+	RegisterFunctionalBuiltin1(ast.CryptoX509ParseCertificateRequest.Name, builtinCryptoX509ParseCertificateRequest)
+	RegisterFunctionalBuiltin1(ast.CryptoX509ParseRSAPrivateKey.Name, builtinCryptoX509ParseRSAPrivateKey)
+	RegisterFunctionalBuiltin1(ast.CryptoParsePrivateKeys.Name, builtinCryptoParsePrivateKeys)
+	RegisterFunctionalBuiltin1(ast.CryptoMd5.Name, builtinCryptoMd5)
+	RegisterFunctionalBuiltin1(ast.CryptoSha1.Name, builtinCryptoSha1)
+	RegisterFunctionalBuiltin1(ast.CryptoSha256.Name, builtinCryptoSha256)
+	RegisterFunctionalBuiltin1(ast.CryptoSha512.Name, builtinCryptoSha512)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacSha256.Name, builtinCryptoHmacSha256)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacSha512.Name, builtinCryptoHmacSha512)
+	RegisterFunctionalBuiltin2(ast.CryptoHmacEqual.Name, builtinCryptoHmacEqual)
 }
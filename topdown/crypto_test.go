@@ -5,8 +5,20 @@
 package topdown
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
 )
 
 func TestCryptoX509ParseCertificates(t *testing.T) {
@@ -58,3 +70,259 @@ func TestCryptoX509ParseCertificates(t *testing.T) {
 	}
 
 }
+
+func TestCryptoHashes(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"md5", []string{`p = x { x = crypto.md5("lorem ipsum") }`}, `"80a751fde577028640c419000e33eba6"`},
+		{"sha1", []string{`p = x { x = crypto.sha1("lorem ipsum") }`}, `"bfb7759a67daeb65410490b4d98bb9da7d1ea2ce"`},
+		{"sha256", []string{`p = x { x = crypto.sha256("lorem ipsum") }`}, `"5e2bf57d3f40c4b6df69daf1936cb766f832374b4fc0259a7cbff06e2f70f269"`},
+		{"sha512", []string{`p = x { x = crypto.sha512("lorem ipsum") }`}, `"f80eebd9aabb1a15fb869ed568d858a5c0dca3d5da07a410e1bd988763918d973e344814625f7c844695b2de36ffd27af290d0e34362c51dee5947d58d40527a"`},
+		{"sha256 empty", []string{`p = x { x = crypto.sha256("") }`}, `"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestCryptoHmac(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"sha256", []string{`p = x { x = crypto.hmac.sha256("what do ya want for nothing?", "Jefe") }`}, `"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"`},
+		{"sha512", []string{`p = x { x = crypto.hmac.sha512("what do ya want for nothing?", "Jefe") }`}, `"164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea2505549758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"`},
+		{"equal", []string{`p = x { x = crypto.hmac.equal(crypto.hmac.sha256("msg", "key"), "2d93cbc1be167bcb1637a4a23cbff01a7878f0c50ee833954ea5221bb1b8c628") }`}, "true"},
+		{"not equal", []string{`p = x { x = crypto.hmac.equal("abc", "abd") }`}, "false"},
+		{"not equal length", []string{`p = x { x = crypto.hmac.equal("abc", "abcd") }`}, "false"},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestCryptoX509ParseAndVerifyCertificates(t *testing.T) {
+
+	rootKey, rootCert := generateTestCert(t, "root", nil, nil, true)
+	interKey, interCert := generateTestCert(t, "intermediate", rootCert, rootKey, true)
+	_, leafCert := generateTestCert(t, "leaf", interCert, interKey, false)
+	_, otherRootCert := generateTestCert(t, "other", nil, nil, true)
+
+	chain := string(encodeTestCerts(leafCert, interCert))
+	roots := string(encodeTestCerts(rootCert))
+
+	rule := `p = [valid, name] {
+		[valid, leaf] := crypto.x509.parse_and_verify_certificates(chain, roots)
+		name := object.get(object.get(leaf, "Subject", {}), "CommonName", "")
+	}`
+
+	tests := []struct {
+		note     string
+		chain    string
+		roots    string
+		expected interface{}
+	}{
+		{"pem", chain, roots, `[true, "leaf"]`},
+		{"base64 pem", base64.StdEncoding.EncodeToString([]byte(chain)), base64.StdEncoding.EncodeToString([]byte(roots)), `[true, "leaf"]`},
+		{"base64 der", base64.StdEncoding.EncodeToString(append(leafCert.Raw, interCert.Raw...)), base64.StdEncoding.EncodeToString(rootCert.Raw), `[true, "leaf"]`},
+		{"multiple roots", chain, string(encodeTestCerts(otherRootCert, rootCert)), `[true, "leaf"]`},
+		{"wrong root", chain, string(encodeTestCerts(otherRootCert)), `[false, ""]`},
+		{"untrusted root in chain", string(encodeTestCerts(leafCert, interCert, otherRootCert)), string(encodeTestCerts(otherRootCert)), `[false, ""]`},
+		{"self-signed leaf", string(encodeTestCerts(otherRootCert)), roots, `[false, ""]`},
+		{"missing intermediate", string(encodeTestCerts(leafCert)), roots, `[false, ""]`},
+		{"empty chain", "", roots, `[false, ""]`},
+		{"empty roots", chain, "", `[false, ""]`},
+		{"empty chain and roots", "", "", `[false, ""]`},
+		{"no certificates", "-----BEGIN FOO-----\n-----END FOO-----\n", roots, fmt.Errorf("no PEM encoded certificates found")},
+		{"no roots", chain, "-----BEGIN FOO-----\n-----END FOO-----\n", fmt.Errorf("no PEM encoded certificates found")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		rules := []string{
+			fmt.Sprintf("chain = %q { true }", tc.chain),
+			fmt.Sprintf("roots = %q { true }", tc.roots),
+			rule,
+		}
+		runTopDownTestCase(t, data, tc.note, rules, tc.expected)
+	}
+}
+
+func TestCryptoX509ParseCertificateRequest(t *testing.T) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "www.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+
+	rule := `p = [cn, sans] {
+		parsed := crypto.x509.parse_certificate_request(csr)
+		cn := parsed.Subject.CommonName
+		sans := parsed.DNSNames
+	}`
+
+	tests := []struct {
+		note     string
+		csr      string
+		expected interface{}
+	}{
+		{"pem", csr, `["example.com", ["example.com", "www.example.com"]]`},
+		{"base64 der", base64.StdEncoding.EncodeToString(der), `["example.com", ["example.com", "www.example.com"]]`},
+		{"wrong block", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), fmt.Errorf("no PEM encoded certificate request found")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		rules := []string{
+			fmt.Sprintf("csr = %q { true }", tc.csr),
+			rule,
+		}
+		runTopDownTestCase(t, data, tc.note, rules, tc.expected)
+	}
+}
+
+func TestCryptoParsePrivateKeys(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	pkcs8PEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER}))
+	ecPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+
+	n := base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes())
+	x := base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes())
+
+	tests := []struct {
+		note     string
+		rule     string
+		keys     string
+		expected interface{}
+	}{
+		{"rsa", `p = [k.kty, k.n, k.e] { k := crypto.x509.parse_rsa_private_key(keys) }`, rsaPEM, fmt.Sprintf(`["RSA", %q, "AQAB"]`, n)},
+		{"rsa pkcs8", `p = [k.kty, k.n] { k := crypto.x509.parse_rsa_private_key(keys) }`, pkcs8PEM, fmt.Sprintf(`["RSA", %q]`, n)},
+		{"rsa base64", `p = k.n { k := crypto.x509.parse_rsa_private_key(keys) }`, base64.StdEncoding.EncodeToString([]byte(rsaPEM)), fmt.Sprintf(`%q`, n)},
+		{"rsa signs jwt", `p = true { k := crypto.x509.parse_rsa_private_key(keys); io.jwt.encode_sign({"alg": "RS256"}, {"sub": "x"}, k) }`, rsaPEM, `true`},
+		{"rsa wrong type", `p = k { k := crypto.x509.parse_rsa_private_key(keys) }`, ecPEM, fmt.Errorf("not an RSA private key")},
+		{"rsa multiple", `p = k { k := crypto.x509.parse_rsa_private_key(keys) }`, rsaPEM + rsaPEM, fmt.Errorf("expected exactly one PEM encoded private key but got 2")},
+		{"multiple", `p = [[k.kty, object.get(k, "crv", "")] | k := parsed[_]] { parsed := crypto.parse_private_keys(keys) }`, rsaPEM + ecPEM, `[["RSA", ""], ["EC", "P-256"]]`},
+		{"ec", `p = parsed[0].x { parsed := crypto.parse_private_keys(keys) }`, ecPEM, fmt.Sprintf(`%q`, x)},
+		{"empty", `p = k { k := crypto.parse_private_keys(keys) }`, "", `[]`},
+		{"no keys", `p = k { k := crypto.parse_private_keys(keys) }`, "-----BEGIN FOO-----\n-----END FOO-----\n", fmt.Errorf("no PEM encoded private keys found")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		rules := []string{
+			fmt.Sprintf("keys = %q { true }", tc.keys),
+			tc.rule,
+		}
+		runTopDownTestCase(t, data, tc.note, rules, tc.expected)
+	}
+
+	if stdlibEd25519 {
+		edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The DER encoding of an Ed25519 PKCS #8 private key is a fixed prefix
+		// followed by the seed.
+		edDER := append([]byte{0x30, 0x2e, 0x02, 0x01, 0x00, 0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70, 0x04, 0x22, 0x04, 0x20}, edPrivate.Seed()...)
+		edPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))
+
+		rules := []string{
+			fmt.Sprintf("keys = %q { true }", rsaPEM+edPEM),
+			`p = [[k.kty, object.get(k, "crv", ""), object.get(k, "x", "")] | k := parsed[_]] { parsed := crypto.parse_private_keys(keys); io.jwt.encode_sign({"alg": "EdDSA"}, {"sub": "x"}, parsed[1]) }`,
+		}
+
+		runTopDownTestCase(t, data, "ed25519", rules, fmt.Sprintf(`[["RSA", "", ""], ["OKP", "Ed25519", %q]]`, base64.RawURLEncoding.EncodeToString(edPublic)))
+	}
+}
+
+// generateTestCert returns a new key and certificate for cn signed by the
+// parent. If parent is nil, the certificate is self-signed.
+func generateTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, cert
+}
+
+func encodeTestCerts(certs ...*x509.Certificate) []byte {
+	var bs []byte
+	for _, cert := range certs {
+		bs = append(bs, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return bs
+}
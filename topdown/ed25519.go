@@ -0,0 +1,16 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// +build !go1.13
+
+package topdown
+
+// stdlibEd25519 is true if crypto/x509 parses Ed25519 keys.
+const stdlibEd25519 = false
+
+// convertEd25519Key returns the key as-is because crypto/x509 does not parse
+// Ed25519 keys before Go 1.13.
+func convertEd25519Key(key interface{}) interface{} {
+	return key
+}
@@ -0,0 +1,28 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// +build go1.13
+
+package topdown
+
+import (
+	stded25519 "crypto/ed25519"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// stdlibEd25519 is true if crypto/x509 parses Ed25519 keys.
+const stdlibEd25519 = true
+
+// convertEd25519Key converts the Ed25519 keys returned by crypto/x509 to the
+// key types used for signing and verification. Other keys are returned as-is.
+func convertEd25519Key(key interface{}) interface{} {
+	switch key := key.(type) {
+	case stded25519.PublicKey:
+		return ed25519.PublicKey(key)
+	case stded25519.PrivateKey:
+		return ed25519.PrivateKey(key)
+	}
+	return key
+}
@@ -38,6 +38,10 @@ const (
 
 	// WithMergeErr indicates that the real and replacement data could not be merged.
 	WithMergeErr string = "eval_with_merge_error"
+
+	// LimitErr indicates evaluation stopped because one of the limits set on
+	// the query was exceeded.
+	LimitErr string = "eval_limit_error"
 )
 
 // IsError returns true if the err is an Error.
@@ -54,6 +58,15 @@ func IsCancel(err error) bool {
 	return false
 }
 
+// IsLimitExceeded returns true if err was caused by exceeding an evaluation
+// limit.
+func IsLimitExceeded(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Code == LimitErr
+	}
+	return false
+}
+
 func (e *Error) Error() string {
 
 	msg := fmt.Sprintf("%v: %v", e.Code, e.Message)
@@ -6,8 +6,10 @@ import (
 	"sort"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/topdown/copypropagation"
 )
 
@@ -26,30 +28,34 @@ func (f *queryIDFactory) Next() uint64 {
 }
 
 type eval struct {
-	ctx           context.Context
-	queryID       uint64
-	queryIDFact   *queryIDFactory
-	parent        *eval
-	cancel        Cancel
-	query         ast.Body
-	index         int
-	bindings      *bindings
-	store         storage.Store
-	baseCache     *baseCache
-	withCache     *baseCache
-	txn           storage.Transaction
-	compiler      *ast.Compiler
-	input         *ast.Term
-	tracers       []Tracer
-	instr         *Instrumentation
-	builtinCache  builtins.Cache
-	virtualCache  *virtualCache
-	saveSet       *saveSet
-	saveStack     *saveStack
-	saveSupport   *saveSupport
-	saveNamespace *ast.Term
-	genvarprefix  string
-	runtime       *ast.Term
+	ctx                    context.Context
+	queryID                uint64
+	queryIDFact            *queryIDFactory
+	parent                 *eval
+	cancel                 Cancel
+	query                  ast.Body
+	index                  int
+	bindings               *bindings
+	store                  storage.Store
+	baseCache              *baseCache
+	withCache              *baseCache
+	txn                    storage.Transaction
+	compiler               *ast.Compiler
+	input                  *ast.Term
+	tracers                []Tracer
+	instr                  *Instrumentation
+	builtinCache           builtins.Cache
+	virtualCache           *virtualCache
+	saveSet                *saveSet
+	saveStack              *saveStack
+	saveSupport            *saveSupport
+	saveNamespace          *ast.Term
+	genvarprefix           string
+	runtime                *ast.Term
+	builtins               map[string]*Builtin
+	limiter                *limiter
+	metrics                metrics.Metrics
+	interQueryBuiltinCache cache.InterQueryCache
 }
 
 func (e *eval) Run(iter evalIterator) error {
@@ -88,6 +94,18 @@ func (e *eval) next(iter evalIterator) error {
 	return err
 }
 
+// location returns the location of the expression being evaluated or the last
+// expression in the query if evaluation has reached the end.
+func (e *eval) location() *ast.Location {
+	if len(e.query) == 0 {
+		return nil
+	}
+	if e.index >= len(e.query) {
+		return e.query[len(e.query)-1].Location
+	}
+	return e.query[e.index].Location
+}
+
 func (e *eval) partial() bool {
 	return e.saveSet != nil
 }
@@ -166,6 +184,10 @@ func (e *eval) evalExpr(iter evalIterator) error {
 		}
 	}
 
+	if err := e.limiter.step(e.location()); err != nil {
+		return err
+	}
+
 	if e.index >= len(e.query) {
 		return iter(e)
 	}
@@ -468,8 +490,14 @@ func (e *eval) evalCall(terms []*ast.Term, iter unifyIterator) error {
 		return eval.eval(iter)
 	}
 
-	bi := ast.BuiltinMap[ref.String()]
-	if bi == nil {
+	var bi *ast.Builtin
+	var f BuiltinFunc
+
+	if b, ok := e.builtins[ref.String()]; ok {
+		bi, f = b.Decl, b.Func
+	} else if bi = ast.BuiltinMap[ref.String()]; bi != nil {
+		f = builtinFunctions[bi.Name]
+	} else {
 		return unsupportedBuiltinErr(e.query[e.index].Location)
 	}
 
@@ -497,7 +525,6 @@ func (e *eval) evalCall(terms []*ast.Term, iter unifyIterator) error {
 		}
 	}
 
-	f := builtinFunctions[bi.Name]
 	if f == nil {
 		return unsupportedBuiltinErr(e.query[e.index].Location)
 	}
@@ -508,12 +535,16 @@ func (e *eval) evalCall(terms []*ast.Term, iter unifyIterator) error {
 	}
 
 	bctx := BuiltinContext{
-		Runtime:  e.runtime,
-		Cache:    e.builtinCache,
-		Location: e.query[e.index].Location,
-		Tracers:  e.tracers,
-		QueryID:  e.queryID,
-		ParentID: parentID,
+		Context:                e.ctx,
+		Metrics:                e.metrics,
+		Runtime:                e.runtime,
+		Cache:                  e.builtinCache,
+		InterQueryBuiltinCache: e.interQueryBuiltinCache,
+		Location:               e.query[e.index].Location,
+		Tracers:                e.tracers,
+		QueryID:                e.queryID,
+		ParentID:               parentID,
+		limiter:                e.limiter,
 	}
 
 	eval := evalBuiltin{
@@ -818,7 +849,7 @@ func (e *eval) biunifyComprehensionArray(x *ast.ArrayComprehension, b *ast.Term,
 	child := e.closure(x.Body)
 	err := child.Run(func(child *eval) error {
 		result = append(result, child.bindings.Plug(x.Term))
-		return nil
+		return e.limiter.checkSize(len(result), x.Term.Location)
 	})
 	if err != nil {
 		return err
@@ -831,7 +862,7 @@ func (e *eval) biunifyComprehensionSet(x *ast.SetComprehension, b *ast.Term, b1,
 	child := e.closure(x.Body)
 	err := child.Run(func(child *eval) error {
 		result.Add(child.bindings.Plug(x.Term))
-		return nil
+		return e.limiter.checkSize(result.Len(), x.Term.Location)
 	})
 	if err != nil {
 		return err
@@ -850,7 +881,7 @@ func (e *eval) biunifyComprehensionObject(x *ast.ObjectComprehension, b *ast.Ter
 			return objectDocKeyConflictErr(x.Key.Location)
 		}
 		result.Insert(key, value)
-		return nil
+		return e.limiter.checkSize(result.Len(), x.Key.Location)
 	})
 	if err != nil {
 		return err
@@ -1134,7 +1165,7 @@ func (e evalBuiltin) eval(iter unifyIterator) error {
 	e.e.instr.startTimer(evalOpBuiltinCall)
 	defer e.e.instr.stopTimer(evalOpBuiltinCall)
 
-	return e.f(e.bctx, operands, func(output *ast.Term) error {
+	err := e.f(e.bctx, operands, func(output *ast.Term) error {
 
 		e.e.instr.stopTimer(evalOpBuiltinCall)
 		defer e.e.instr.startTimer(evalOpBuiltinCall)
@@ -1147,6 +1178,21 @@ func (e evalBuiltin) eval(iter unifyIterator) error {
 		}
 		return e.e.unify(e.terms[len(e.terms)-1], output, iter)
 	})
+
+	// Built-ins that observe the context fail when the caller cancels the
+	// query or the timeout expires. Report these failures accordingly.
+	if err != nil && !IsCancel(err) && !IsLimitExceeded(err) && e.bctx.Context != nil && e.bctx.Context.Err() != nil {
+		if e.e.limiter.timedOut() {
+			return e.e.limiter.timeoutErr(e.bctx.Location)
+		}
+		return &Error{
+			Code:     CancelErr,
+			Message:  "caller cancelled query execution",
+			Location: e.bctx.Location,
+		}
+	}
+
+	return err
 }
 
 type evalFunc struct {
@@ -1658,6 +1704,9 @@ func (e evalVirtualPartial) reduce(head *ast.Head, b *bindings, result *ast.Term
 	switch v := result.Value.(type) {
 	case ast.Set:
 		v.Add(b.Plug(head.Key))
+		if err := e.e.limiter.checkSize(v.Len(), head.Location); err != nil {
+			return nil, err
+		}
 	case ast.Object:
 		key := b.Plug(head.Key)
 		value := b.Plug(head.Value)
@@ -1667,6 +1716,9 @@ func (e evalVirtualPartial) reduce(head *ast.Head, b *bindings, result *ast.Term
 		}
 		v.Insert(key, value)
 		result.Value = v
+		if err := e.e.limiter.checkSize(v.Len(), head.Location); err != nil {
+			return nil, err
+		}
 	}
 
 	return result, nil
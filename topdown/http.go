@@ -6,8 +6,13 @@ package topdown
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"mime"
 	"strconv"
 
 	"net/http"
@@ -21,45 +26,153 @@ import (
 
 const defaultHTTPRequestTimeout = time.Second * 5
 
-var allowedKeys = ast.NewSet(ast.StringTerm("method"), ast.StringTerm("url"), ast.StringTerm("body"), ast.StringTerm("enable_redirect"), ast.StringTerm("headers"))
+var allowedKeys = ast.NewSet(
+	ast.StringTerm("method"),
+	ast.StringTerm("url"),
+	ast.StringTerm("body"),
+	ast.StringTerm("raw_body"),
+	ast.StringTerm("enable_redirect"),
+	ast.StringTerm("force_json_decode"),
+	ast.StringTerm("headers"),
+	ast.StringTerm("timeout"),
+	ast.StringTerm("tls_ca_cert"),
+	ast.StringTerm("tls_client_cert"),
+	ast.StringTerm("tls_client_key"),
+	ast.StringTerm("tls_insecure_skip_verify"),
+	ast.StringTerm("raise_error"),
+	ast.StringTerm("cache"),
+	ast.StringTerm("force_cache"),
+	ast.StringTerm("force_cache_duration_seconds"),
+)
+
 var requiredKeys = ast.NewSet(ast.StringTerm("method"), ast.StringTerm("url"))
 
-var client *http.Client
+// Names of the metrics that report inter-query cache usage.
+const (
+	httpSendInterQueryCacheHits   = "rego_builtin_http_send_interquery_cache_hits"
+	httpSendInterQueryCacheMisses = "rego_builtin_http_send_interquery_cache_misses"
+)
+
+// httpRequestTimeout is applied to requests if neither the request nor the
+// query context set a deadline.
+var httpRequestTimeout time.Duration
+
+// httpSendCacheKey is the key for responses in the built-in cache.
+type httpSendCacheKey string
+
+// httpSendRequest contains the options of an http.send request.
+type httpSendRequest struct {
+	method                string
+	url                   string
+	body                  *bytes.Buffer
+	headers               map[string]interface{}
+	enableRedirect        bool
+	forceJSONDecode       bool
+	raiseError            bool
+	timeout               time.Duration
+	tlsCACert             string
+	tlsClientCert         string
+	tlsClientKey          string
+	tlsInsecureSkipVerify bool
+	cache                 bool
+	forceCache            bool
+	forceCacheDuration    time.Duration
+}
 
 func builtinHTTPSend(bctx BuiltinContext, args []*ast.Term, iter func(*ast.Term) error) error {
 
-	req, err := validateHTTPRequestOperand(args[0], 1)
+	obj, err := validateHTTPRequestOperand(args[0], 1)
 	if err != nil {
 		return handleBuiltinErr(ast.HTTPSend.Name, bctx.Location, err)
 	}
 
-	resp, err := executeHTTPRequest(bctx, req)
+	req, err := parseHTTPRequest(obj)
 	if err != nil {
 		return handleBuiltinErr(ast.HTTPSend.Name, bctx.Location, err)
 	}
 
+	client, err := createHTTPClient(req)
+	if err != nil {
+		return handleBuiltinErr(ast.HTTPSend.Name, bctx.Location, err)
+	}
+
+	resp, err := executeHTTPRequest(bctx, client, obj, req)
+	if err != nil {
+		// Errors are returned as part of the response if the caller asked for
+		// that, unless the query itself was cancelled.
+		if req.raiseError || (bctx.Context != nil && bctx.Context.Err() != nil) {
+			return handleBuiltinErr(ast.HTTPSend.Name, bctx.Location, err)
+		}
+		resp = ast.NewObject(
+			[2]*ast.Term{ast.StringTerm("status_code"), ast.IntNumberTerm(0)},
+			[2]*ast.Term{ast.StringTerm("error"), ast.ObjectTerm(
+				[2]*ast.Term{ast.StringTerm("message"), ast.StringTerm(err.Error())},
+			)},
+		)
+	}
+
 	return iter(ast.NewTerm(resp))
 }
 
 func init() {
-	createHTTPClient()
-	RegisterBuiltinFunc(ast.HTTPSend.Name, builtinHTTPSend)
-}
-
-func createHTTPClient() {
-	timeout := defaultHTTPRequestTimeout
+	httpRequestTimeout = defaultHTTPRequestTimeout
 	timeoutDuration := os.Getenv("HTTP_SEND_TIMEOUT")
 	if timeoutDuration != "" {
-		timeout, _ = time.ParseDuration(timeoutDuration)
+		httpRequestTimeout, _ = time.ParseDuration(timeoutDuration)
 	}
+	RegisterBuiltinFunc(ast.HTTPSend.Name, builtinHTTPSend)
+}
+
+// createHTTPClient returns a client for the request. Redirects are disabled
+// unless the request enables them. Requests are bounded by the query context
+// instead of a client timeout.
+func createHTTPClient(req httpSendRequest) (*http.Client, error) {
 
-	// create a http client with redirects disabled
-	client = &http.Client{
-		Timeout: timeout,
-		CheckRedirect: func(*http.Request, []*http.Request) error {
+	client := &http.Client{}
+
+	if !req.enableRedirect {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
 			return http.ErrUseLastResponse
-		},
+		}
+	}
+
+	if req.tlsCACert == "" && req.tlsClientCert == "" && req.tlsClientKey == "" && !req.tlsInsecureSkipVerify {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: req.tlsInsecureSkipVerify,
+	}
+
+	if req.tlsCACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(req.tlsCACert)) {
+			return nil, fmt.Errorf("tls_ca_cert does not contain any PEM encoded certificates")
+		}
+		tlsConfig.RootCAs = pool
 	}
+
+	if req.tlsClientCert != "" || req.tlsClientKey != "" {
+		if req.tlsClientCert == "" || req.tlsClientKey == "" {
+			return nil, fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+		}
+		cert, err := tls.X509KeyPair([]byte(req.tlsClientCert), []byte(req.tlsClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// The TLS options are supplied by the policy so the transport is not
+	// shared with other requests. Keep-alives are disabled so that idle
+	// connections are not left behind once the request completes.
+	client.Transport = &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: true,
+	}
+
+	return client, nil
 }
 
 func validateHTTPRequestOperand(term *ast.Term, pos int) (ast.Object, error) {
@@ -99,104 +212,256 @@ func addHeaders(req *http.Request, headers map[string]interface{}) (bool, error)
 	return true, nil
 }
 
-func executeHTTPRequest(bctx BuiltinContext, obj ast.Object) (ast.Value, error) {
-	var url string
-	var method string
-	var body *bytes.Buffer
-	var enableRedirect bool
-	var customHeaders map[string]interface{}
+func parseHTTPRequest(obj ast.Object) (httpSendRequest, error) {
+
+	req := httpSendRequest{
+		forceJSONDecode: true,
+		raiseError:      true,
+	}
+
 	for _, val := range obj.Keys() {
 		key, err := ast.JSON(val.Value)
 		if err != nil {
-			return nil, err
+			return req, err
 		}
 		key = key.(string)
 
 		switch key {
 		case "method":
-			method = obj.Get(val).String()
-			method = strings.Trim(method, "\"")
+			req.method = obj.Get(val).String()
+			req.method = strings.Trim(req.method, "\"")
 		case "url":
-			url = obj.Get(val).String()
-			url = strings.Trim(url, "\"")
+			req.url = obj.Get(val).String()
+			req.url = strings.Trim(req.url, "\"")
 		case "enable_redirect":
-			enableRedirect, err = strconv.ParseBool(obj.Get(val).String())
+			req.enableRedirect, err = strconv.ParseBool(obj.Get(val).String())
+			if err != nil {
+				return req, err
+			}
+		case "force_json_decode":
+			req.forceJSONDecode, err = strconv.ParseBool(obj.Get(val).String())
+			if err != nil {
+				return req, err
+			}
+		case "raise_error":
+			req.raiseError, err = strconv.ParseBool(obj.Get(val).String())
+			if err != nil {
+				return req, err
+			}
+		case "tls_insecure_skip_verify":
+			req.tlsInsecureSkipVerify, err = strconv.ParseBool(obj.Get(val).String())
 			if err != nil {
-				return nil, err
+				return req, err
+			}
+		case "cache":
+			req.cache, err = strconv.ParseBool(obj.Get(val).String())
+			if err != nil {
+				return req, err
+			}
+		case "force_cache":
+			req.forceCache, err = strconv.ParseBool(obj.Get(val).String())
+			if err != nil {
+				return req, err
+			}
+		case "force_cache_duration_seconds":
+			seconds, err := strconv.ParseInt(obj.Get(val).String(), 10, 64)
+			if err != nil {
+				return req, err
+			}
+			req.forceCacheDuration = time.Duration(seconds) * time.Second
+		case "timeout":
+			req.timeout, err = parseHTTPTimeout(obj.Get(val).Value)
+			if err != nil {
+				return req, err
+			}
+		case "tls_ca_cert", "tls_client_cert", "tls_client_key", "raw_body":
+			s, ok := obj.Get(val).Value.(ast.String)
+			if !ok {
+				return req, fmt.Errorf("%v must be a string", key)
+			}
+			switch key {
+			case "tls_ca_cert":
+				req.tlsCACert = string(s)
+			case "tls_client_cert":
+				req.tlsClientCert = string(s)
+			case "tls_client_key":
+				req.tlsClientKey = string(s)
+			case "raw_body":
+				req.body = bytes.NewBufferString(string(s))
 			}
 		case "body":
 			bodyVal := obj.Get(val).Value
 			bodyValInterface, err := ast.JSON(bodyVal)
 			if err != nil {
-				return nil, err
+				return req, err
 			}
 
 			bodyValBytes, err := json.Marshal(bodyValInterface)
 			if err != nil {
-				return nil, err
+				return req, err
 			}
-			body = bytes.NewBuffer(bodyValBytes)
+			req.body = bytes.NewBuffer(bodyValBytes)
 		case "headers":
 			headersVal := obj.Get(val).Value
 			headersValInterface, err := ast.JSON(headersVal)
 			if err != nil {
-				return nil, err
+				return req, err
 			}
 			var ok bool
-			customHeaders, ok = headersValInterface.(map[string]interface{})
+			req.headers, ok = headersValInterface.(map[string]interface{})
 			if !ok {
-				return nil, fmt.Errorf("invalid type for headers key")
+				return req, fmt.Errorf("invalid type for headers key")
 			}
 		default:
-			return nil, fmt.Errorf("Invalid Key %v", key)
+			return req, fmt.Errorf("Invalid Key %v", key)
 		}
 	}
 
-	// check if redirects are enabled
-	if enableRedirect {
-		client.CheckRedirect = nil
+	if obj.Get(ast.StringTerm("body")) != nil && obj.Get(ast.StringTerm("raw_body")) != nil {
+		return req, fmt.Errorf("body and raw_body must not be set together")
 	}
 
-	if body == nil {
-		body = bytes.NewBufferString("")
+	if req.forceCache && req.forceCacheDuration <= 0 {
+		return req, fmt.Errorf("force_cache_duration_seconds must be set to a positive value when force_cache is enabled")
+	}
+
+	if req.body == nil {
+		req.body = bytes.NewBufferString("")
+	}
+
+	return req, nil
+}
+
+// parseHTTPTimeout parses the timeout option. The timeout is either a duration
+// string (e.g., "5s") or a number of nanoseconds.
+func parseHTTPTimeout(v ast.Value) (time.Duration, error) {
+	switch v := v.(type) {
+	case ast.String:
+		d, err := time.ParseDuration(string(v))
+		if err != nil {
+			return 0, err
+		}
+		if d <= 0 {
+			return 0, fmt.Errorf("timeout must be positive")
+		}
+		return d, nil
+	case ast.Number:
+		n, ok := v.Int()
+		if !ok || n <= 0 {
+			return 0, fmt.Errorf("timeout must be a positive integer number of nanoseconds")
+		}
+		return time.Duration(n), nil
 	}
+	return 0, fmt.Errorf("timeout must be a string or number")
+}
+
+func executeHTTPRequest(bctx BuiltinContext, client *http.Client, obj ast.Object, req httpSendRequest) (ast.Value, error) {
 
 	// check if cache already has a response for this query
-	cachedResponse := checkCache(method, url, bctx)
+	cacheKey := httpSendCacheKey(obj.String())
+	cachedResponse := checkCache(cacheKey, bctx)
 	if cachedResponse != nil {
 		return cachedResponse, nil
 	}
 
-	// create the http request
-	req, err := http.NewRequest(strings.ToUpper(method), url, body)
+	// check if the inter-query cache has a fresh response for this request.
+	// Stale responses are revalidated with the server if possible.
+	interQueryCache := bctx.InterQueryBuiltinCache
+	if !req.cache && !req.forceCache {
+		interQueryCache = nil
+	}
+
+	var cachedEntry *httpSendCacheEntry
+
+	if interQueryCache != nil {
+		if v, ok := interQueryCache.Get(obj); ok {
+			cachedEntry = v.(*httpSendCacheEntry)
+			if time.Now().Before(cachedEntry.expiresAt) {
+				incrCounter(bctx, httpSendInterQueryCacheHits)
+				bctx.Cache.Put(cacheKey, cachedEntry.value)
+				return cachedEntry.value, nil
+			}
+		}
+		incrCounter(bctx, httpSendInterQueryCacheMisses)
+	}
+
+	// create the http request bound to the query context so that cancelling
+	// the query aborts the request
+	ctx := bctx.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if req.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.timeout)
+		defer cancel()
+	} else if _, ok := ctx.Deadline(); !ok && httpRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, httpRequestTimeout)
+		defer cancel()
+	}
+
+	httpReq, err := http.NewRequest(strings.ToUpper(req.method), req.url, req.body)
 	if err != nil {
 		return nil, err
 	}
 
+	httpReq = httpReq.WithContext(ctx)
+
 	// Add custom headers passed from CLI
 
-	if len(customHeaders) != 0 {
-		if ok, err := addHeaders(req, customHeaders); !ok {
+	if len(req.headers) != 0 {
+		if ok, err := addHeaders(httpReq, req.headers); !ok {
 			return nil, err
 		}
 	}
 
+	if cachedEntry != nil {
+		if cachedEntry.etag != "" {
+			httpReq.Header.Set("If-None-Match", cachedEntry.etag)
+		}
+		if cachedEntry.lastModified != "" {
+			httpReq.Header.Set("If-Modified-Since", cachedEntry.lastModified)
+		}
+	}
+
 	// execute the http request
-	resp, err := client.Do(req)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	// format the http result
+	// the cached response is still valid so refresh its expiry
+	if cachedEntry != nil && resp.StatusCode == http.StatusNotModified {
+		if entry := newHTTPSendCacheEntry(req.method, cachedEntry.value, resp.Header, req.forceCache, req.forceCacheDuration); entry != nil {
+			interQueryCache.Insert(obj, entry)
+		} else {
+			interQueryCache.Delete(obj)
+		}
+		bctx.Cache.Put(cacheKey, cachedEntry.value)
+		return cachedEntry.value, nil
+	}
+
+	rawBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// format the http result. Unless the request disables force_json_decode,
+	// the body is decoded regardless of the response Content-Type.
 	var resultBody interface{}
-	json.NewDecoder(resp.Body).Decode(&resultBody)
+	if req.forceJSONDecode || isJSONContentType(resp.Header.Get("Content-Type")) {
+		json.Unmarshal(rawBody, &resultBody)
+	}
 
 	result := make(map[string]interface{})
 	result["status"] = resp.Status
 	result["status_code"] = resp.StatusCode
 	result["body"] = resultBody
+	result["raw_body"] = string(rawBody)
 
 	resultObj, err := ast.InterfaceToValue(result)
 	if err != nil {
@@ -204,26 +469,154 @@ func executeHTTPRequest(bctx BuiltinContext, obj ast.Object) (ast.Value, error)
 	}
 
 	// add result to cache
-	key := getCtxKey(method, url)
-	bctx.Cache.Put(key, resultObj)
+	bctx.Cache.Put(cacheKey, resultObj)
+
+	if interQueryCache != nil {
+		if entry := newHTTPSendCacheEntry(req.method, resultObj, resp.Header, req.forceCache, req.forceCacheDuration); entry != nil {
+			interQueryCache.Insert(obj, entry)
+		} else {
+			interQueryCache.Delete(obj)
+		}
+	}
 
 	return resultObj, nil
 }
 
-// getCtxKey returns the cache key.
-// Key format: <METHOD>_<url>
-func getCtxKey(method string, url string) string {
-	keyTerms := []string{strings.ToUpper(method), url}
-	return strings.Join(keyTerms, "_")
+// isJSONContentType returns true if the media type is application/json or
+// uses the +json suffix.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
 }
 
 // checkCache checks for the given key's value in the cache
-func checkCache(method string, url string, bctx BuiltinContext) ast.Value {
-	key := getCtxKey(method, url)
-
+func checkCache(key httpSendCacheKey, bctx BuiltinContext) ast.Value {
 	val, ok := bctx.Cache.Get(key)
 	if ok {
 		return val.(ast.Value)
 	}
 	return nil
 }
+
+func incrCounter(bctx BuiltinContext, name string) {
+	if bctx.Metrics != nil {
+		bctx.Metrics.Counter(name).Incr()
+	}
+}
+
+// httpSendCacheEntry is the value stored in the inter-query cache for an
+// http.send request.
+type httpSendCacheEntry struct {
+	value        ast.Value
+	expiresAt    time.Time
+	etag         string
+	lastModified string
+	size         int64
+}
+
+func (e *httpSendCacheEntry) SizeInBytes() int64 {
+	return e.size
+}
+
+// newHTTPSendCacheEntry returns a cache entry for the response. If the
+// response must not be cached, nil is returned. If force is true, the
+// response is cached for the given duration regardless of the response
+// headers.
+func newHTTPSendCacheEntry(method string, value ast.Value, header http.Header, force bool, duration time.Duration) *httpSendCacheEntry {
+
+	now := time.Now()
+
+	entry := &httpSendCacheEntry{
+		value:        value,
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+	}
+
+	if force {
+		entry.expiresAt = now.Add(duration)
+	} else {
+		switch strings.ToUpper(method) {
+		case http.MethodGet, http.MethodHead:
+		default:
+			return nil
+		}
+
+		var ok bool
+		entry.expiresAt, ok = responseExpiry(header, now)
+		if !ok {
+			return nil
+		}
+
+		// responses that are already stale are only useful if they can be
+		// revalidated
+		if !entry.expiresAt.After(now) && entry.etag == "" && entry.lastModified == "" {
+			return nil
+		}
+	}
+
+	entry.size = int64(len(value.String()) + len(entry.etag) + len(entry.lastModified))
+
+	return entry
+}
+
+// responseExpiry returns the time at which a response with the given headers
+// becomes stale. If the response must not be stored, ok is false.
+func responseExpiry(header http.Header, now time.Time) (expiresAt time.Time, ok bool) {
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+
+	if _, found := directives["no-store"]; found {
+		return now, false
+	}
+
+	if _, found := directives["no-cache"]; found {
+		return now, true
+	}
+
+	if maxAge, found := directives["max-age"]; found {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil {
+			return now, true
+		}
+		if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil {
+			seconds -= age
+		}
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return now, true
+		}
+		// account for clock skew between the server and OPA
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return now.Add(t.Sub(date)), true
+		}
+		return t, true
+	}
+
+	return now, true
+}
+
+// parseCacheControl returns the directives in a Cache-Control header value.
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			directives[key] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		} else {
+			directives[key] = ""
+		}
+	}
+	return directives
+}
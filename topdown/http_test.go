@@ -6,14 +6,31 @@ package topdown
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/topdown/cache"
 )
 
 // The person Type
@@ -47,6 +64,7 @@ func TestHTTPGetRequest(t *testing.T) {
 	bodyMap := map[string]string{"id": "1", "firstname": "John"}
 	body = append(body, bodyMap)
 	expectedResult["body"] = body
+	expectedResult["raw_body"] = "[{\"id\":\"1\",\"firstname\":\"John\"}]\n"
 
 	resultObj, err := ast.InterfaceToValue(expectedResult)
 	if err != nil {
@@ -97,6 +115,7 @@ func TestHTTPCustomHeaders(t *testing.T) {
 
 	bodyMap := map[string][]string{"X-Foo": {"ISO-8859-1,utf-8;q=0.7,*;q=0.7"}, "X-Opa": {"server"}}
 	expectedResult["body"] = bodyMap
+	expectedResult["raw_body"] = "{\"X-Foo\":[\"ISO-8859-1,utf-8;q=0.7,*;q=0.7\"],\"X-Opa\":[\"server\"]}\n"
 
 	jsonString, err := json.Marshal(expectedResult)
 	if err != nil {
@@ -149,6 +168,7 @@ func TestHTTPostRequest(t *testing.T) {
 		"status":      "200 OK",
 		"status_code": http.StatusOK,
 		"body":        map[string]string{"id": "2", "firstname": "Joe"},
+		"raw_body":    "{\"id\":\"2\",\"firstname\":\"Joe\"}\n",
 	}
 
 	resultObj, err := ast.InterfaceToValue(expectedResult)
@@ -224,6 +244,7 @@ func TestHTTDeleteRequest(t *testing.T) {
 	bodyMap := map[string]string{"id": "1", "firstname": "John"}
 	body = append(body, bodyMap)
 	expectedResult["body"] = body
+	expectedResult["raw_body"] = "[{\"id\":\"1\",\"firstname\":\"John\"}]\n"
 
 	resultObj, err := ast.InterfaceToValue(expectedResult)
 	if err != nil {
@@ -285,6 +306,7 @@ func TestHTTPRedirectDisable(t *testing.T) {
 	expectedResult["status"] = "301 Moved Permanently"
 	expectedResult["status_code"] = http.StatusMovedPermanently
 	expectedResult["body"] = nil
+	expectedResult["raw_body"] = "<a href=\"/test\">Moved Permanently</a>.\n\n"
 
 	resultObj, err := ast.InterfaceToValue(expectedResult)
 	if err != nil {
@@ -312,6 +334,7 @@ func TestHTTPRedirectEnable(t *testing.T) {
 	expectedResult["status"] = "200 OK"
 	expectedResult["status_code"] = http.StatusOK
 	expectedResult["body"] = nil
+	expectedResult["raw_body"] = ""
 
 	resultObj, err := ast.InterfaceToValue(expectedResult)
 	if err != nil {
@@ -340,3 +363,474 @@ func getTestServer() (baseURL string, teardownFn func()) {
 
 	return ts.URL, ts.Close
 }
+
+func TestHTTPSendContextCancellation(t *testing.T) {
+
+	done := make(chan struct{})
+	defer close(done)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+
+	defer ts.Close()
+
+	compiler := compileModules([]string{fmt.Sprintf(`
+		package test
+
+		p = x { http.send({"method": "get", "url": "%s"}, x) }`, ts.URL)})
+
+	store := inmem.New()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	txn := storage.NewTransactionOrDie(ctx, store)
+	q := NewQuery(ast.MustParseBody("data.test.p")).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn)
+
+	start := time.Now()
+
+	_, err := q.Run(ctx)
+	if err == nil || !IsCancel(err) {
+		t.Fatalf("Expected cancel error but got: %v", err)
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Expected request to be aborted when the context expired but took %v", d)
+	}
+}
+
+func TestHTTPSendInterQueryCache(t *testing.T) {
+
+	tests := []struct {
+		note        string
+		headers     map[string]string
+		options     string
+		expRequests int
+		expHits     uint64
+	}{
+		{
+			note:        "cache disabled",
+			headers:     map[string]string{"Cache-Control": "max-age=300"},
+			expRequests: 3,
+		},
+		{
+			note:        "max-age",
+			headers:     map[string]string{"Cache-Control": "max-age=300"},
+			options:     `"cache": true`,
+			expRequests: 1,
+			expHits:     2,
+		},
+		{
+			note:        "expires",
+			headers:     map[string]string{"Expires": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)},
+			options:     `"cache": true`,
+			expRequests: 1,
+			expHits:     2,
+		},
+		{
+			note:        "no-store",
+			headers:     map[string]string{"Cache-Control": "no-store, max-age=300"},
+			options:     `"cache": true`,
+			expRequests: 3,
+		},
+		{
+			note:        "no freshness information",
+			options:     `"cache": true`,
+			expRequests: 3,
+		},
+		{
+			note:        "force cache",
+			headers:     map[string]string{"Cache-Control": "no-store"},
+			options:     `"force_cache": true, "force_cache_duration_seconds": 300`,
+			expRequests: 1,
+			expHits:     2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			var requests int
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				fmt.Fprintf(w, `{"n": %d}`, requests)
+			}))
+
+			defer ts.Close()
+
+			options := tc.options
+			if options != "" {
+				options = ", " + options
+			}
+
+			query := fmt.Sprintf(`http.send({"method": "get", "url": "%s"%s}, x)`, ts.URL, options)
+			c := cache.NewInterQueryCache(nil)
+			m := metrics.New()
+
+			for i := 0; i < 3; i++ {
+				qrs := runHTTPSendQuery(t, query, c, m)
+				n := i + 1
+				if n > tc.expRequests {
+					n = tc.expRequests
+				}
+				if exp := fmt.Sprintf(`{"n": %d}`, n); qrs[0]["x"].Value.(ast.Object).Get(ast.StringTerm("body")).String() != exp {
+					t.Fatalf("Expected body %v but got %v", exp, qrs[0]["x"])
+				}
+			}
+
+			if requests != tc.expRequests {
+				t.Fatalf("Expected %d requests but got %d", tc.expRequests, requests)
+			}
+
+			if hits := m.Counter(httpSendInterQueryCacheHits).Value(); hits != tc.expHits {
+				t.Fatalf("Expected %d cache hits but got %v", tc.expHits, hits)
+			}
+		})
+	}
+}
+
+func TestHTTPSendInterQueryCacheRevalidation(t *testing.T) {
+
+	var requests, notModified int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, `{"version": 1}`)
+	}))
+
+	defer ts.Close()
+
+	query := fmt.Sprintf(`http.send({"method": "get", "url": "%s", "cache": true}, x)`, ts.URL)
+	c := cache.NewInterQueryCache(nil)
+
+	for i := 0; i < 3; i++ {
+		qrs := runHTTPSendQuery(t, query, c, metrics.New())
+		if body := qrs[0]["x"].Value.(ast.Object).Get(ast.StringTerm("body")).String(); body != `{"version": 1}` {
+			t.Fatalf("Expected cached body but got %v", body)
+		}
+	}
+
+	if requests != 3 || notModified != 2 {
+		t.Fatalf("Expected 3 requests with 2 revalidations but got %d and %d", requests, notModified)
+	}
+}
+
+func TestHTTPSendInterQueryCacheForceDuration(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	query := fmt.Sprintf(`http.send({"method": "get", "url": "%s", "force_cache": true}, x)`, ts.URL)
+	compiler := compileModules([]string{})
+	store := inmem.New()
+	ctx := context.Background()
+	txn := storage.NewTransactionOrDie(ctx, store)
+
+	_, err := NewQuery(ast.MustParseBody(query)).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithInterQueryBuiltinCache(cache.NewInterQueryCache(nil)).
+		Run(ctx)
+
+	if err == nil || !strings.Contains(err.Error(), "force_cache_duration_seconds must be set") {
+		t.Fatalf("Expected error for missing duration but got: %v", err)
+	}
+}
+
+func runHTTPSendQuery(t *testing.T, query string, c cache.InterQueryCache, m metrics.Metrics) QueryResultSet {
+	t.Helper()
+
+	compiler := compileModules([]string{})
+	store := inmem.New()
+	ctx := context.Background()
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+
+	qrs, err := NewQuery(ast.MustParseBody(query)).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithMetrics(m).
+		WithInterQueryBuiltinCache(c).
+		Run(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(qrs) != 1 {
+		t.Fatalf("Expected one result but got: %v", qrs)
+	}
+
+	return qrs
+}
+
+func TestHTTPSendTLS(t *testing.T) {
+
+	clientCert, clientKey := generateTestClientCert(t)
+
+	block, _ := pem.Decode(clientCert)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"client": %q}`, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	tests := []struct {
+		note    string
+		options map[string]interface{}
+		exp     string
+	}{
+		{
+			note: "client cert",
+			options: map[string]interface{}{
+				"tls_ca_cert":     string(caCert),
+				"tls_client_cert": string(clientCert),
+				"tls_client_key":  string(clientKey),
+			},
+			exp: `{"client": "opa-client"}`,
+		},
+		{
+			note: "insecure skip verify",
+			options: map[string]interface{}{
+				"tls_insecure_skip_verify": true,
+				"tls_client_cert":          string(clientCert),
+				"tls_client_key":           string(clientKey),
+			},
+			exp: `{"client": "opa-client"}`,
+		},
+		{
+			note: "missing client cert",
+			options: map[string]interface{}{
+				"tls_ca_cert": string(caCert),
+				"raise_error": false,
+			},
+		},
+		{
+			note: "unknown server ca",
+			options: map[string]interface{}{
+				"tls_client_cert": string(clientCert),
+				"tls_client_key":  string(clientKey),
+				"raise_error":     false,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			tc.options["method"] = "get"
+			tc.options["url"] = ts.URL
+
+			bs, err := json.Marshal(tc.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query := fmt.Sprintf(`http.send(%s, x)`, bs)
+			qrs := runHTTPSendQuery(t, query, cache.NewInterQueryCache(nil), metrics.New())
+			resp := qrs[0]["x"].Value.(ast.Object)
+
+			if tc.exp == "" {
+				if resp.Get(ast.StringTerm("error")) == nil {
+					t.Fatalf("Expected error in response but got %v", resp)
+				}
+			} else if body := resp.Get(ast.StringTerm("body")); body == nil || body.String() != tc.exp {
+				t.Fatalf("Expected body %v but got %v", tc.exp, resp)
+			}
+		})
+	}
+}
+
+func TestHTTPSendTimeout(t *testing.T) {
+
+	done := make(chan struct{})
+	defer close(done)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+
+	defer ts.Close()
+
+	query := fmt.Sprintf(`http.send({"method": "get", "url": "%s", "timeout": "50ms", "raise_error": false}, x)`, ts.URL)
+
+	start := time.Now()
+	qrs := runHTTPSendQuery(t, query, cache.NewInterQueryCache(nil), metrics.New())
+
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Expected request to time out but took %v", d)
+	}
+
+	resp := qrs[0]["x"].Value.(ast.Object)
+
+	if code := resp.Get(ast.StringTerm("status_code")).String(); code != "0" {
+		t.Fatalf("Expected status code 0 but got %v", resp)
+	}
+
+	msg, ok := resp.Get(ast.StringTerm("error")).Value.(ast.Object).Get(ast.StringTerm("message")).Value.(ast.String)
+	if !ok || !strings.Contains(string(msg), "deadline exceeded") {
+		t.Fatalf("Expected deadline exceeded error but got %v", resp)
+	}
+
+	compiler := compileModules([]string{})
+	store := inmem.New()
+	ctx := context.Background()
+	txn := storage.NewTransactionOrDie(ctx, store)
+
+	query = fmt.Sprintf(`http.send({"method": "get", "url": "%s", "timeout": 50000000}, x)`, ts.URL)
+
+	_, err := NewQuery(ast.MustParseBody(query)).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		Run(ctx)
+
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("Expected deadline exceeded error but got: %v", err)
+	}
+}
+
+func TestHTTPSendRawBody(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	}))
+
+	defer ts.Close()
+
+	tests := []struct {
+		note    string
+		options string
+		exp     string
+	}{
+		{
+			note:    "decoded by default",
+			options: `"raw_body": "{\"a\": 1}", "headers": {"Content-Type": "text/plain"}`,
+			exp:     `{"body": {"a": 1}, "raw_body": "{\"a\": 1}"}`,
+		},
+		{
+			note:    "content type not json",
+			options: `"raw_body": "{\"a\": 1}", "headers": {"Content-Type": "text/plain"}, "force_json_decode": false`,
+			exp:     `{"body": null, "raw_body": "{\"a\": 1}"}`,
+		},
+		{
+			note:    "content type json",
+			options: `"raw_body": "{\"a\": 1}", "headers": {"Content-Type": "application/vnd.api+json"}, "force_json_decode": false`,
+			exp:     `{"body": {"a": 1}, "raw_body": "{\"a\": 1}"}`,
+		},
+		{
+			note:    "plain text",
+			options: `"raw_body": "hello", "headers": {"Content-Type": "text/plain"}`,
+			exp:     `{"body": null, "raw_body": "hello"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			query := fmt.Sprintf(`http.send({"method": "post", "url": "%s", %s}, x)`, ts.URL, tc.options)
+			qrs := runHTTPSendQuery(t, query, cache.NewInterQueryCache(nil), metrics.New())
+			resp := qrs[0]["x"].Value.(ast.Object)
+			result := ast.NewObject(
+				[2]*ast.Term{ast.StringTerm("body"), resp.Get(ast.StringTerm("body"))},
+				[2]*ast.Term{ast.StringTerm("raw_body"), resp.Get(ast.StringTerm("raw_body"))},
+			)
+			if exp := ast.MustParseTerm(tc.exp); exp.Value.Compare(result) != 0 {
+				t.Fatalf("Expected %v but got %v", exp, result)
+			}
+		})
+	}
+}
+
+func TestHTTPSendInvalidOptions(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"body and raw_body", []string{`p = x { http.send({"method": "post", "url": "http://127.0.0.1:51113", "body": {}, "raw_body": ""}, x) }`}, fmt.Errorf(`body and raw_body must not be set together`)},
+		{"client cert without key", []string{`p = x { http.send({"method": "get", "url": "http://127.0.0.1:51113", "tls_client_cert": "x", "raise_error": false}, x) }`}, fmt.Errorf(`tls_client_cert and tls_client_key must be set together`)},
+		{"invalid ca cert", []string{`p = x { http.send({"method": "get", "url": "http://127.0.0.1:51113", "tls_ca_cert": "x"}, x) }`}, fmt.Errorf(`tls_ca_cert does not contain any PEM encoded certificates`)},
+		{"invalid timeout", []string{`p = x { http.send({"method": "get", "url": "http://127.0.0.1:51113", "timeout": "x"}, x) }`}, fmt.Errorf(`invalid duration`)},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func generateTestClientCert(t *testing.T) (certPEM []byte, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "opa-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
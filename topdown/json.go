@@ -0,0 +1,463 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+func builtinJSONFilter(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := jsonPathTreeOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := tree.filter(obj)
+	if !ok {
+		return ast.NewObject(), nil
+	}
+
+	return result, nil
+}
+
+func builtinJSONRemove(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := jsonPathTreeOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.remove(obj), nil
+}
+
+func builtinJSONPatch(a, b ast.Value) (ast.Value, error) {
+	ops, err := builtins.ArrayOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := a
+
+	for _, op := range ops {
+		patch, err := parseJSONPatchOp(op.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if doc, ok = patch.apply(doc); !ok {
+			return nil, BuiltinEmpty{}
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonPathNode is a node in the tree of paths given to json.filter and
+// json.remove. Leaf nodes select the entire value at the path.
+type jsonPathNode struct {
+	leaf     bool
+	children map[string]*jsonPathNode
+}
+
+func jsonPathTreeOperand(x ast.Value, pos int) (*jsonPathNode, error) {
+	var paths []ast.Value
+
+	switch x := x.(type) {
+	case ast.Array:
+		for _, p := range x {
+			paths = append(paths, p.Value)
+		}
+	case ast.Set:
+		x.Foreach(func(p *ast.Term) {
+			paths = append(paths, p.Value)
+		})
+	default:
+		return nil, builtins.NewOperandTypeErr(pos, x, "array", "set")
+	}
+
+	root := &jsonPathNode{}
+
+	for _, p := range paths {
+		path, err := jsonPathOperand(p, pos)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return nil, builtins.NewOperandErr(pos, "paths must not be empty")
+		}
+		node := root
+		for _, seg := range path {
+			key := seg.Value.String()
+			child, ok := node.children[key]
+			if !ok {
+				if node.children == nil {
+					node.children = map[string]*jsonPathNode{}
+				}
+				child = &jsonPathNode{}
+				node.children[key] = child
+			}
+			node = child
+		}
+		node.leaf = true
+	}
+
+	return root, nil
+}
+
+// jsonPathOperand returns the segments of the path specified by x. Paths may be
+// given as strings separated by "/" (with "~1" and "~0" escaping "/" and "~")
+// or as arrays of segments. Only the empty string refers to the root; as in
+// JSON Pointer, "/" refers to the key "".
+func jsonPathOperand(x ast.Value, pos int) (ast.Array, error) {
+	switch x := x.(type) {
+	case ast.String:
+		if x == "" {
+			return ast.Array{}, nil
+		}
+		parts := strings.Split(strings.TrimPrefix(string(x), "/"), "/")
+		path := make(ast.Array, len(parts))
+		for i := range parts {
+			part := strings.Replace(parts[i], "~1", "/", -1)
+			part = strings.Replace(part, "~0", "~", -1)
+			path[i] = ast.StringTerm(part)
+		}
+		return path, nil
+	case ast.Array:
+		return x, nil
+	}
+	return nil, builtins.NewOperandErr(pos, "paths must be strings or arrays")
+}
+
+func (n *jsonPathNode) child(key *ast.Term) *jsonPathNode {
+	return n.children[key.Value.String()]
+}
+
+// index returns the child for the array index i. Array elements can be
+// referred to by number or by string.
+func (n *jsonPathNode) index(i int) *jsonPathNode {
+	if child := n.child(ast.IntNumberTerm(i)); child != nil {
+		return child
+	}
+	return n.child(ast.StringTerm(strconv.Itoa(i)))
+}
+
+func (n *jsonPathNode) filter(x ast.Value) (ast.Value, bool) {
+
+	if n.leaf {
+		return x, true
+	}
+
+	switch x := x.(type) {
+	case ast.Object:
+		result := ast.NewObject()
+		x.Foreach(func(k, v *ast.Term) {
+			if child := n.child(k); child != nil {
+				if fv, ok := child.filter(v.Value); ok {
+					result.Insert(k, ast.NewTerm(fv))
+				}
+			}
+		})
+		return result, true
+	case ast.Array:
+		result := ast.Array{}
+		for i := range x {
+			if child := n.index(i); child != nil {
+				if fv, ok := child.filter(x[i].Value); ok {
+					result = append(result, ast.NewTerm(fv))
+				}
+			}
+		}
+		return result, true
+	case ast.Set:
+		result := ast.NewSet()
+		x.Foreach(func(elem *ast.Term) {
+			if child := n.child(elem); child != nil {
+				if fv, ok := child.filter(elem.Value); ok {
+					result.Add(ast.NewTerm(fv))
+				}
+			}
+		})
+		return result, true
+	}
+
+	return nil, false
+}
+
+func (n *jsonPathNode) remove(x ast.Value) ast.Value {
+	switch x := x.(type) {
+	case ast.Object:
+		result := ast.NewObject()
+		x.Foreach(func(k, v *ast.Term) {
+			child := n.child(k)
+			if child == nil {
+				result.Insert(k, v)
+			} else if !child.leaf {
+				result.Insert(k, ast.NewTerm(child.remove(v.Value)))
+			}
+		})
+		return result
+	case ast.Array:
+		result := ast.Array{}
+		for i := range x {
+			child := n.index(i)
+			if child == nil {
+				result = append(result, x[i])
+			} else if !child.leaf {
+				result = append(result, ast.NewTerm(child.remove(x[i].Value)))
+			}
+		}
+		return result
+	case ast.Set:
+		result := ast.NewSet()
+		x.Foreach(func(elem *ast.Term) {
+			child := n.child(elem)
+			if child == nil {
+				result.Add(elem)
+			} else if !child.leaf {
+				result.Add(ast.NewTerm(child.remove(elem.Value)))
+			}
+		})
+		return result
+	}
+	return x
+}
+
+// jsonPatchOp is a single operation of a JSON Patch (RFC 6902).
+type jsonPatchOp struct {
+	op    string
+	path  ast.Array
+	from  ast.Array
+	value *ast.Term
+}
+
+func parseJSONPatchOp(x ast.Value) (jsonPatchOp, error) {
+	var patch jsonPatchOp
+
+	obj, ok := x.(ast.Object)
+	if !ok {
+		return patch, builtins.NewOperandErr(2, "patch operations must be objects")
+	}
+
+	op := obj.Get(ast.StringTerm("op"))
+	if op == nil {
+		return patch, builtins.NewOperandErr(2, "patch operation must have a string op")
+	}
+
+	s, ok := op.Value.(ast.String)
+	if !ok {
+		return patch, builtins.NewOperandErr(2, "patch operation must have a string op")
+	}
+	patch.op = string(s)
+
+	path := obj.Get(ast.StringTerm("path"))
+	if path == nil {
+		return patch, builtins.NewOperandErr(2, "patch operation %v must have a path", patch.op)
+	}
+
+	var err error
+	if patch.path, err = jsonPathOperand(path.Value, 2); err != nil {
+		return patch, err
+	}
+
+	switch patch.op {
+	case "add", "replace", "test":
+		if patch.value = obj.Get(ast.StringTerm("value")); patch.value == nil {
+			return patch, builtins.NewOperandErr(2, "patch operation %v must have a value", patch.op)
+		}
+	case "move", "copy":
+		from := obj.Get(ast.StringTerm("from"))
+		if from == nil {
+			return patch, builtins.NewOperandErr(2, "patch operation %v must have a from path", patch.op)
+		}
+		if patch.from, err = jsonPathOperand(from.Value, 2); err != nil {
+			return patch, err
+		}
+	case "remove":
+	default:
+		return patch, builtins.NewOperandErr(2, "invalid patch operation %v", patch.op)
+	}
+
+	return patch, nil
+}
+
+// apply returns the result of applying the operation to doc. If the operation
+// cannot be applied, false is returned.
+func (p jsonPatchOp) apply(doc ast.Value) (ast.Value, bool) {
+	switch p.op {
+	case "add":
+		return jsonPatchUpdate(doc, p.path, "add", p.value)
+	case "remove":
+		return jsonPatchUpdate(doc, p.path, "remove", nil)
+	case "replace":
+		return jsonPatchUpdate(doc, p.path, "replace", p.value)
+	case "move":
+		if len(p.from) < len(p.path) && p.from.Equal(p.path[:len(p.from)]) {
+			return nil, false
+		}
+		value, ok := jsonPatchGet(doc, p.from)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = jsonPatchUpdate(doc, p.from, "remove", nil); !ok {
+			return nil, false
+		}
+		return jsonPatchUpdate(doc, p.path, "add", value)
+	case "copy":
+		value, ok := jsonPatchGet(doc, p.from)
+		if !ok {
+			return nil, false
+		}
+		return jsonPatchUpdate(doc, p.path, "add", value)
+	case "test":
+		value, ok := jsonPatchGet(doc, p.path)
+		if !ok || value.Value.Compare(p.value.Value) != 0 {
+			return nil, false
+		}
+		return doc, true
+	}
+	return nil, false
+}
+
+func jsonPatchGet(doc ast.Value, path ast.Array) (*ast.Term, bool) {
+	curr := ast.NewTerm(doc)
+	for _, seg := range path {
+		switch x := curr.Value.(type) {
+		case ast.Object:
+			if curr = x.Get(seg); curr == nil {
+				return nil, false
+			}
+		case ast.Array:
+			i, ok := jsonPatchIndex(seg, len(x)-1)
+			if !ok {
+				return nil, false
+			}
+			curr = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return curr, true
+}
+
+// jsonPatchUpdate returns a copy of doc with the add, remove or replace
+// operation applied at path. The original document is not modified.
+func jsonPatchUpdate(doc ast.Value, path ast.Array, op string, value *ast.Term) (ast.Value, bool) {
+
+	if len(path) == 0 {
+		if op == "remove" {
+			return nil, false
+		}
+		return value.Value, true
+	}
+
+	seg, last := path[0], len(path) == 1
+
+	switch x := doc.(type) {
+	case ast.Object:
+		curr := x.Get(seg)
+		if curr == nil && (!last || op != "add") {
+			return nil, false
+		}
+		result := ast.NewObject()
+		x.Foreach(func(k, v *ast.Term) {
+			if k.Equal(seg) {
+				if !last {
+					result.Insert(k, v)
+				} else if op != "remove" {
+					result.Insert(k, value)
+				}
+			} else {
+				result.Insert(k, v)
+			}
+		})
+		if last {
+			if op == "add" && curr == nil {
+				result.Insert(seg, value)
+			}
+			return result, true
+		}
+		child, ok := jsonPatchUpdate(curr.Value, path[1:], op, value)
+		if !ok {
+			return nil, false
+		}
+		result.Insert(seg, ast.NewTerm(child))
+		return result, true
+	case ast.Array:
+		if last && op == "add" {
+			i, ok := len(x), seg.Equal(ast.StringTerm("-"))
+			if !ok {
+				if i, ok = jsonPatchIndex(seg, len(x)); !ok {
+					return nil, false
+				}
+			}
+			result := make(ast.Array, 0, len(x)+1)
+			result = append(result, x[:i]...)
+			result = append(result, value)
+			return append(result, x[i:]...), true
+		}
+		i, ok := jsonPatchIndex(seg, len(x)-1)
+		if !ok {
+			return nil, false
+		}
+		result := make(ast.Array, 0, len(x))
+		result = append(result, x[:i]...)
+		if !last {
+			child, ok := jsonPatchUpdate(x[i].Value, path[1:], op, value)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, ast.NewTerm(child))
+		} else if op == "replace" {
+			result = append(result, value)
+		}
+		return append(result, x[i+1:]...), true
+	}
+
+	return nil, false
+}
+
+// jsonPatchIndex returns the array index referred to by seg if it is between
+// zero and max (inclusive).
+func jsonPatchIndex(seg *ast.Term, max int) (int, bool) {
+	var i int
+	switch x := seg.Value.(type) {
+	case ast.Number:
+		var ok bool
+		if i, ok = x.Int(); !ok {
+			return 0, false
+		}
+	case ast.String:
+		var err error
+		if i, err = strconv.Atoi(string(x)); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if i < 0 || i > max {
+		return 0, false
+	}
+	return i, true
+}
+
+func init() {
+	RegisterFunctionalBuiltin2(ast.JSONFilter.Name, builtinJSONFilter)
+	RegisterFunctionalBuiltin2(ast.JSONRemove.Name, builtinJSONRemove)
+	RegisterFunctionalBuiltin2(ast.JSONPatch.Name, builtinJSONPatch)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopDownJSONFilter(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"string paths", []string{`p = x { x = json.filter({"a": {"b": 1, "c": 2}, "d": 3}, ["a/b", "d"]) }`}, `{"a": {"b": 1}, "d": 3}`},
+		{"leading slash", []string{`p = x { x = json.filter({"a": {"b": 1, "c": 2}}, ["/a/c"]) }`}, `{"a": {"c": 2}}`},
+		{"array paths", []string{`p = x { x = json.filter({"a": {"b": 1, "c": 2}}, [["a", "c"]]) }`}, `{"a": {"c": 2}}`},
+		{"set of paths", []string{`p = x { x = json.filter({"a": 1, "b": 2, "c": 3}, {"a", "c"}) }`}, `{"a": 1, "c": 3}`},
+		{"overlapping paths", []string{`p = x { x = json.filter({"a": {"b": 1, "c": 2}}, ["a/b", "a"]) }`}, `{"a": {"b": 1, "c": 2}}`},
+		{"array index", []string{`p = x { x = json.filter({"a": [{"b": 1, "c": 2}, {"b": 3}, 4]}, ["a/0/b", ["a", 2]]) }`}, `{"a": [{"b": 1}, 4]}`},
+		{"escaped", []string{`p = x { x = json.filter({"a/b": 1, "c~d": 2, "e": 3}, ["a~1b", "c~0d"]) }`}, `{"a/b": 1, "c~d": 2}`},
+		{"missing path", []string{`p = x { x = json.filter({"a": 1}, ["b/c"]) }`}, `{}`},
+		{"scalar", []string{`p = x { x = json.filter({"a": 1}, ["a/b"]) }`}, `{}`},
+		{"empty key", []string{`p = x { x = json.filter({"": 1, "a": 2}, ["/"]) }`}, `{"": 1}`},
+		{"err: empty path", []string{`p = x { x = json.filter({"a": 1}, [""]) }`}, fmt.Errorf("operand 2 paths must not be empty")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownJSONRemove(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"string paths", []string{`p = x { x = json.remove({"a": {"b": 1, "c": 2}, "d": 3}, ["a/b", "d"]) }`}, `{"a": {"c": 2}}`},
+		{"array paths", []string{`p = x { x = json.remove({"a": {"b": 1, "c": 2}}, [["a", "c"]]) }`}, `{"a": {"b": 1}}`},
+		{"set of paths", []string{`p = x { x = json.remove({"a": 1, "b": 2, "c": 3}, {"a", "c"}) }`}, `{"b": 2}`},
+		{"array index", []string{`p = x { x = json.remove({"a": [{"b": 1, "c": 2}, {"b": 3}, 4]}, ["a/0/b", ["a", 1]]) }`}, `{"a": [{"c": 2}, 4]}`},
+		{"set element", []string{`p = x { x = json.remove({"a": {"x", "y"}}, [["a", "x"]]) }`}, `{"a": ["y"]}`},
+		{"missing path", []string{`p = x { x = json.remove({"a": 1}, ["b/c", "a/b"]) }`}, `{"a": 1}`},
+		{"empty key", []string{`p = x { x = json.remove({"": 1, "a": {"": 2, "b": 3}}, ["/", "/a/"]) }`}, `{"a": {"b": 3}}`},
+		{"err: paths", []string{`p = x { x = json.remove({"a": 1}, [data.a[0]]) }`}, fmt.Errorf("operand 2 paths must be strings or arrays")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownJSONPatch(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"add", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/b", "value": 2}]) }`}, `{"a": 1, "b": 2}`},
+		{"add: replaces member", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/a", "value": 2}]) }`}, `{"a": 2}`},
+		{"add: array insert", []string{`p = x { x = json.patch({"a": [1, 3]}, [{"op": "add", "path": "/a/1", "value": 2}]) }`}, `{"a": [1, 2, 3]}`},
+		{"add: array append", []string{`p = x { x = json.patch({"a": [1]}, [{"op": "add", "path": "/a/-", "value": 2}]) }`}, `{"a": [1, 2]}`},
+		{"add: root", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "", "value": [1]}]) }`}, `[1]`},
+		{"add: array path", []string{`p = x { x = json.patch({"a": {"b": 1}}, [{"op": "add", "path": ["a", "c"], "value": 2}]) }`}, `{"a": {"b": 1, "c": 2}}`},
+		{"add: missing parent", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/b/c", "value": 2}]) }`}, ""},
+		{"add: index out of range", []string{`p = x { x = json.patch([1], [{"op": "add", "path": "/2", "value": 2}]) }`}, ""},
+		{"remove", []string{`p = x { x = json.patch({"a": {"b": 1, "c": 2}}, [{"op": "remove", "path": "/a/b"}]) }`}, `{"a": {"c": 2}}`},
+		{"remove: array", []string{`p = x { x = json.patch([1, 2, 3], [{"op": "remove", "path": "/1"}]) }`}, `[1, 3]`},
+		{"remove: empty key", []string{`p = x { x = json.patch({"": 1}, [{"op": "remove", "path": "/"}]) }`}, `{}`},
+		{"add: empty key", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/", "value": 2}]) }`}, `{"a": 1, "": 2}`},
+		{"remove: missing", []string{`p = x { x = json.patch({"a": 1}, [{"op": "remove", "path": "/b"}]) }`}, ""},
+		{"replace", []string{`p = x { x = json.patch({"a": {"b": 1}}, [{"op": "replace", "path": "/a/b", "value": [2]}]) }`}, `{"a": {"b": [2]}}`},
+		{"replace: array", []string{`p = x { x = json.patch([1, 2], [{"op": "replace", "path": "/0", "value": 3}]) }`}, `[3, 2]`},
+		{"replace: missing", []string{`p = x { x = json.patch({"a": 1}, [{"op": "replace", "path": "/b", "value": 2}]) }`}, ""},
+		{"move", []string{`p = x { x = json.patch({"a": {"b": 1}, "c": {}}, [{"op": "move", "from": "/a/b", "path": "/c/d"}]) }`}, `{"a": {}, "c": {"d": 1}}`},
+		{"move: array", []string{`p = x { x = json.patch([1, 2, 3], [{"op": "move", "from": "/0", "path": "/-"}]) }`}, `[2, 3, 1]`},
+		{"move: into child", []string{`p = x { x = json.patch({"a": {"b": 1}}, [{"op": "move", "from": "/a", "path": "/a/b/c"}]) }`}, ""},
+		{"copy", []string{`p = x { x = json.patch({"a": {"b": 1}}, [{"op": "copy", "from": "/a", "path": "/c"}]) }`}, `{"a": {"b": 1}, "c": {"b": 1}}`},
+		{"test", []string{`p = x { x = json.patch({"a": [1, 2]}, [{"op": "test", "path": "/a", "value": [1, 2]}, {"op": "add", "path": "/b", "value": 3}]) }`}, `{"a": [1, 2], "b": 3}`},
+		{"test: fails", []string{`p = x { x = json.patch({"a": 1}, [{"op": "test", "path": "/a", "value": 2}, {"op": "add", "path": "/b", "value": 3}]) }`}, ""},
+		{"sequence", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/b", "value": {}}, {"op": "add", "path": "/b/c", "value": 2}, {"op": "remove", "path": "/a"}]) }`}, `{"b": {"c": 2}}`},
+		{"escaped", []string{`p = x { x = json.patch({"a/b": 1}, [{"op": "replace", "path": "/a~1b", "value": 2}]) }`}, `{"a/b": 2}`},
+		{"err: op", []string{`p = x { x = json.patch({"a": 1}, [{"op": "merge", "path": "/a"}]) }`}, fmt.Errorf("operand 2 invalid patch operation merge")},
+		{"err: value", []string{`p = x { x = json.patch({"a": 1}, [{"op": "add", "path": "/a"}]) }`}, fmt.Errorf("operand 2 patch operation add must have a value")},
+		{"err: from", []string{`p = x { x = json.patch({"a": 1}, [{"op": "copy", "path": "/a"}]) }`}, fmt.Errorf("operand 2 patch operation copy must have a from path")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
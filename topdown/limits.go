@@ -0,0 +1,114 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// Limits defines resource limits that are enforced during query evaluation.
+// Zero values indicate the corresponding limit is not enforced.
+type Limits struct {
+	// MaxSteps is the maximum number of expressions that may be evaluated.
+	MaxSteps int64
+
+	// MaxCollectionSize is the maximum number of elements in arrays, sets and
+	// objects produced by comprehensions and partial rules.
+	MaxCollectionSize int
+
+	// Timeout is the maximum amount of time the evaluation may take.
+	Timeout time.Duration
+}
+
+// limiter tracks resource usage for a single query evaluation. The limiter is
+// shared by all of the eval instances created for the query.
+type limiter struct {
+	limits  Limits
+	steps   int64
+	expired int32
+}
+
+func newLimiter(limits Limits) *limiter {
+	if limits == (Limits{}) {
+		return nil
+	}
+	return &limiter{limits: limits}
+}
+
+// start begins tracking the timeout. The returned context is cancelled when
+// the timeout expires so that built-in functions observing it are aborted.
+// The caller must invoke the returned function when evaluation finishes.
+func (l *limiter) start(ctx context.Context) (context.Context, func()) {
+
+	if l == nil || l.limits.Timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	timer := time.AfterFunc(l.limits.Timeout, func() {
+		atomic.StoreInt32(&l.expired, 1)
+		cancel()
+	})
+
+	return ctx, func() {
+		timer.Stop()
+		cancel()
+	}
+}
+
+// step records the evaluation of an expression and returns an error if any of
+// the evaluation limits have been exceeded.
+func (l *limiter) step(loc *ast.Location) error {
+
+	if l == nil {
+		return nil
+	}
+
+	if l.timedOut() {
+		return l.timeoutErr(loc)
+	}
+
+	l.steps++
+
+	if l.limits.MaxSteps > 0 && l.steps > l.limits.MaxSteps {
+		return &Error{
+			Code:     LimitErr,
+			Message:  fmt.Sprintf("evaluation exceeded maximum number of steps (%d)", l.limits.MaxSteps),
+			Location: loc,
+		}
+	}
+
+	return nil
+}
+
+// checkSize returns an error if a collection of size n exceeds the limit.
+func (l *limiter) checkSize(n int, loc *ast.Location) error {
+	if l == nil || l.limits.MaxCollectionSize <= 0 || n <= l.limits.MaxCollectionSize {
+		return nil
+	}
+	return &Error{
+		Code:     LimitErr,
+		Message:  fmt.Sprintf("collection exceeded maximum size (%d)", l.limits.MaxCollectionSize),
+		Location: loc,
+	}
+}
+
+func (l *limiter) timedOut() bool {
+	return l != nil && atomic.LoadInt32(&l.expired) != 0
+}
+
+func (l *limiter) timeoutErr(loc *ast.Location) error {
+	return &Error{
+		Code:     LimitErr,
+		Message:  fmt.Sprintf("evaluation exceeded timeout (%v)", l.limits.Timeout),
+		Location: loc,
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+func builtinObjectGet(a, b, c ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := obj.Get(ast.NewTerm(b)); v != nil {
+		return v.Value, nil
+	}
+
+	return c, nil
+}
+
+func builtinObjectRemove(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := objectKeysOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ast.NewObject()
+
+	obj.Foreach(func(k, v *ast.Term) {
+		if !keys.Contains(k) {
+			result.Insert(k, v)
+		}
+	})
+
+	return result, nil
+}
+
+func builtinObjectFilter(a, b ast.Value) (ast.Value, error) {
+	obj, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := objectKeysOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ast.NewObject()
+
+	obj.Foreach(func(k, v *ast.Term) {
+		if keys.Contains(k) {
+			result.Insert(k, v)
+		}
+	})
+
+	return result, nil
+}
+
+func builtinObjectUnion(a, b ast.Value) (ast.Value, error) {
+	objA, err := builtins.ObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	objB, err := builtins.ObjectOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return unionObjects(objA, objB), nil
+}
+
+// unionObjects recursively merges a and b. When a key exists in both objects
+// and the values are not both objects, the value from b is used.
+func unionObjects(a, b ast.Object) ast.Object {
+	result := ast.NewObject()
+
+	a.Foreach(func(k, v *ast.Term) {
+		v2 := b.Get(k)
+		if v2 == nil {
+			result.Insert(k, v)
+			return
+		}
+		obj1, ok1 := v.Value.(ast.Object)
+		obj2, ok2 := v2.Value.(ast.Object)
+		if ok1 && ok2 {
+			result.Insert(k, ast.NewTerm(unionObjects(obj1, obj2)))
+		} else {
+			result.Insert(k, v2)
+		}
+	})
+
+	b.Foreach(func(k, v *ast.Term) {
+		if a.Get(k) == nil {
+			result.Insert(k, v)
+		}
+	})
+
+	return result
+}
+
+// objectKeysOperand returns the set of keys specified by x. The keys may be
+// given as an array, a set, or the keys of an object.
+func objectKeysOperand(x ast.Value, pos int) (ast.Set, error) {
+	switch x := x.(type) {
+	case ast.Array:
+		return ast.NewSet(x...), nil
+	case ast.Set:
+		return x, nil
+	case ast.Object:
+		return ast.NewSet(x.Keys()...), nil
+	}
+	return nil, builtins.NewOperandTypeErr(pos, x, "array", "set", "object")
+}
+
+func init() {
+	RegisterFunctionalBuiltin3(ast.ObjectGet.Name, builtinObjectGet)
+	RegisterFunctionalBuiltin2(ast.ObjectRemove.Name, builtinObjectRemove)
+	RegisterFunctionalBuiltin2(ast.ObjectFilter.Name, builtinObjectFilter)
+	RegisterFunctionalBuiltin2(ast.ObjectUnion.Name, builtinObjectUnion)
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopDownObject(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"get", []string{`p = x { x = object.get({"a": 1}, "a", 0) }`}, "1"},
+		{"get: default", []string{`p = x { x = object.get({"a": 1}, "b", 0) }`}, "0"},
+		{"get: false value", []string{`p = x { x = object.get({"a": false}, "a", true) }`}, "false"},
+		{"get: non-string key", []string{`p = x { x = object.get({1: "one"}, 1, "none") }`}, `"one"`},
+		{"get: err", []string{`p = x { x = object.get(data.a, "a", 0) }`}, fmt.Errorf("operand 1 must be object")},
+		{"remove: array", []string{`p = x { x = object.remove({"a": 1, "b": 2, "c": 3}, ["a", "c"]) }`}, `{"b": 2}`},
+		{"remove: set", []string{`p = x { x = object.remove({"a": 1, "b": 2, "c": 3}, {"a", "d"}) }`}, `{"b": 2, "c": 3}`},
+		{"remove: object", []string{`p = x { x = object.remove({"a": 1, "b": 2}, {"b": "x"}) }`}, `{"a": 1}`},
+		{"remove: err", []string{`p = x { x = object.remove({"a": 1}, data.a[0]) }`}, fmt.Errorf("operand 2 must be one of {array, set, object}")},
+		{"filter: array", []string{`p = x { x = object.filter({"a": 1, "b": 2, "c": 3}, ["a", "c"]) }`}, `{"a": 1, "c": 3}`},
+		{"filter: set", []string{`p = x { x = object.filter({"a": 1, "b": 2}, {"b", "d"}) }`}, `{"b": 2}`},
+		{"filter: object", []string{`p = x { x = object.filter({"a": 1, "b": 2}, {"b": "x"}) }`}, `{"b": 2}`},
+		{"union", []string{`p = x { x = object.union({"a": 1, "b": 2}, {"b": 3, "c": 4}) }`}, `{"a": 1, "b": 3, "c": 4}`},
+		{"union: recursive", []string{`p = x { x = object.union({"a": {"b": 1, "c": {"d": 2}}}, {"a": {"c": {"e": 3}}}) }`}, `{"a": {"b": 1, "c": {"d": 2, "e": 3}}}`},
+		{"union: replace non-object", []string{`p = x { x = object.union({"a": {"b": 1}}, {"a": [1]}) }`}, `{"a": [1]}`},
+		{"union: err", []string{`p = x { x = object.union({"a": 1}, data.a) }`}, fmt.Errorf("operand 2 must be object")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
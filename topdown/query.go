@@ -8,6 +8,7 @@ import (
 	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/topdown/copypropagation"
 )
 
@@ -20,19 +21,22 @@ type QueryResult map[ast.Var]*ast.Term
 
 // Query provides a configurable interface for performing query evaluation.
 type Query struct {
-	cancel           Cancel
-	query            ast.Body
-	compiler         *ast.Compiler
-	store            storage.Store
-	txn              storage.Transaction
-	input            *ast.Term
-	tracers          []Tracer
-	unknowns         []*ast.Term
-	partialNamespace string
-	metrics          metrics.Metrics
-	instr            *Instrumentation
-	genvarprefix     string
-	runtime          *ast.Term
+	cancel                 Cancel
+	query                  ast.Body
+	compiler               *ast.Compiler
+	store                  storage.Store
+	txn                    storage.Transaction
+	input                  *ast.Term
+	tracers                []Tracer
+	unknowns               []*ast.Term
+	partialNamespace       string
+	metrics                metrics.Metrics
+	instr                  *Instrumentation
+	genvarprefix           string
+	runtime                *ast.Term
+	builtins               map[string]*Builtin
+	limits                 Limits
+	interQueryBuiltinCache cache.InterQueryCache
 }
 
 // NewQuery returns a new Query object that can be run.
@@ -118,6 +122,28 @@ func (q *Query) WithRuntime(runtime *ast.Term) *Query {
 	return q
 }
 
+// WithBuiltins adds a set of built-in functions that can be called by the
+// query. The built-ins take precedence over globally registered ones.
+func (q *Query) WithBuiltins(builtins map[string]*Builtin) *Query {
+	q.builtins = builtins
+	return q
+}
+
+// WithLimits sets the resource limits to enforce during evaluation. If a
+// limit is exceeded, evaluation stops with an error for which
+// IsLimitExceeded returns true. This is optional.
+func (q *Query) WithLimits(limits Limits) *Query {
+	q.limits = limits
+	return q
+}
+
+// WithInterQueryBuiltinCache sets the inter-query cache that built-in functions
+// can use to share values across queries. This is optional.
+func (q *Query) WithInterQueryBuiltinCache(c cache.InterQueryCache) *Query {
+	q.interQueryBuiltinCache = c
+	return q
+}
+
 // PartialRun executes partial evaluation on the query with respect to unknown
 // values. Partial evaluation attempts to evaluate as much of the query as
 // possible without requiring values for the unknowns set on the query. The
@@ -129,31 +155,38 @@ func (q *Query) PartialRun(ctx context.Context) (partials []ast.Body, support []
 	if q.partialNamespace == "" {
 		q.partialNamespace = "partial" // lazily initialize partial namespace
 	}
+	l := newLimiter(q.limits)
+	ctx, stop := l.start(ctx)
+	defer stop()
 	f := &queryIDFactory{}
 	b := newBindings(0, q.instr)
 	e := &eval{
-		ctx:           ctx,
-		cancel:        q.cancel,
-		query:         q.query,
-		queryIDFact:   f,
-		queryID:       f.Next(),
-		bindings:      b,
-		compiler:      q.compiler,
-		store:         q.store,
-		baseCache:     newBaseCache(),
-		withCache:     newBaseCache(),
-		txn:           q.txn,
-		input:         q.input,
-		tracers:       q.tracers,
-		instr:         q.instr,
-		builtinCache:  builtins.Cache{},
-		virtualCache:  newVirtualCache(),
-		saveSet:       newSaveSet(q.unknowns, b),
-		saveStack:     newSaveStack(),
-		saveSupport:   newSaveSupport(),
-		saveNamespace: ast.StringTerm(q.partialNamespace),
-		genvarprefix:  q.genvarprefix,
-		runtime:       q.runtime,
+		ctx:                    ctx,
+		cancel:                 q.cancel,
+		query:                  q.query,
+		queryIDFact:            f,
+		queryID:                f.Next(),
+		bindings:               b,
+		compiler:               q.compiler,
+		store:                  q.store,
+		baseCache:              newBaseCache(),
+		withCache:              newBaseCache(),
+		txn:                    q.txn,
+		input:                  q.input,
+		tracers:                q.tracers,
+		instr:                  q.instr,
+		builtinCache:           builtins.Cache{},
+		virtualCache:           newVirtualCache(),
+		saveSet:                newSaveSet(q.unknowns, b),
+		saveStack:              newSaveStack(),
+		saveSupport:            newSaveSupport(),
+		saveNamespace:          ast.StringTerm(q.partialNamespace),
+		genvarprefix:           q.genvarprefix,
+		runtime:                q.runtime,
+		builtins:               q.builtins,
+		limiter:                l,
+		metrics:                q.metrics,
+		interQueryBuiltinCache: q.interQueryBuiltinCache,
 	}
 	q.startTimer(metrics.RegoPartialEval)
 	defer q.stopTimer(metrics.RegoPartialEval)
@@ -217,26 +250,33 @@ func (q *Query) Run(ctx context.Context) (QueryResultSet, error) {
 // Iter executes the query and invokes the iter function with query results
 // produced by evaluating the query.
 func (q *Query) Iter(ctx context.Context, iter func(QueryResult) error) error {
+	l := newLimiter(q.limits)
+	ctx, stop := l.start(ctx)
+	defer stop()
 	f := &queryIDFactory{}
 	e := &eval{
-		ctx:          ctx,
-		cancel:       q.cancel,
-		query:        q.query,
-		queryIDFact:  f,
-		queryID:      f.Next(),
-		bindings:     newBindings(0, q.instr),
-		compiler:     q.compiler,
-		store:        q.store,
-		baseCache:    newBaseCache(),
-		withCache:    newBaseCache(),
-		txn:          q.txn,
-		input:        q.input,
-		tracers:      q.tracers,
-		instr:        q.instr,
-		builtinCache: builtins.Cache{},
-		virtualCache: newVirtualCache(),
-		genvarprefix: q.genvarprefix,
-		runtime:      q.runtime,
+		ctx:                    ctx,
+		cancel:                 q.cancel,
+		query:                  q.query,
+		queryIDFact:            f,
+		queryID:                f.Next(),
+		bindings:               newBindings(0, q.instr),
+		compiler:               q.compiler,
+		store:                  q.store,
+		baseCache:              newBaseCache(),
+		withCache:              newBaseCache(),
+		txn:                    q.txn,
+		input:                  q.input,
+		tracers:                q.tracers,
+		instr:                  q.instr,
+		builtinCache:           builtins.Cache{},
+		virtualCache:           newVirtualCache(),
+		genvarprefix:           q.genvarprefix,
+		runtime:                q.runtime,
+		builtins:               q.builtins,
+		limiter:                l,
+		metrics:                q.metrics,
+		interQueryBuiltinCache: q.interQueryBuiltinCache,
 	}
 	q.startTimer(metrics.RegoQueryEval)
 	defer q.stopTimer(metrics.RegoQueryEval)
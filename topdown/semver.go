@@ -0,0 +1,153 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+// semVerRegexp is the regular expression suggested by the SemVer 2.0
+// specification.
+var semVerRegexp = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// semVersion is a parsed SemVer 2.0 version. Build metadata is not retained
+// because it does not affect precedence.
+type semVersion struct {
+	major, minor, patch string
+	preRelease          []string
+}
+
+func parseSemVer(s string) (semVersion, bool) {
+	m := semVerRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return semVersion{}, false
+	}
+	v := semVersion{major: m[1], minor: m[2], patch: m[3]}
+	if m[4] != "" {
+		v.preRelease = strings.Split(m[4], ".")
+	}
+	return v, true
+}
+
+// compare returns -1, 0 or 1 if v has lower, equal or higher precedence than
+// other.
+func (v semVersion) compare(other semVersion) int {
+
+	if c := compareNumericIdentifiers(v.major, other.major); c != 0 {
+		return c
+	}
+
+	if c := compareNumericIdentifiers(v.minor, other.minor); c != 0 {
+		return c
+	}
+
+	if c := compareNumericIdentifiers(v.patch, other.patch); c != 0 {
+		return c
+	}
+
+	// A version without pre-release identifiers has higher precedence.
+	switch {
+	case len(v.preRelease) == 0 && len(other.preRelease) == 0:
+		return 0
+	case len(v.preRelease) == 0:
+		return 1
+	case len(other.preRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.preRelease) && i < len(other.preRelease); i++ {
+		a, b := v.preRelease[i], other.preRelease[i]
+		aNum, bNum := isNumericIdentifier(a), isNumericIdentifier(b)
+		var c int
+		switch {
+		case aNum && bNum:
+			c = compareNumericIdentifiers(a, b)
+		case aNum:
+			c = -1
+		case bNum:
+			c = 1
+		default:
+			c = strings.Compare(a, b)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(v.preRelease) < len(other.preRelease):
+		return -1
+	case len(v.preRelease) > len(other.preRelease):
+		return 1
+	}
+
+	return 0
+}
+
+func isNumericIdentifier(s string) bool {
+	for i := range s {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareNumericIdentifiers compares numeric identifiers of arbitrary size.
+// The identifiers must not contain leading zeroes.
+func compareNumericIdentifiers(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func builtinSemVerIsValid(a ast.Value) (ast.Value, error) {
+	s, ok := a.(ast.String)
+	if !ok {
+		return ast.Boolean(false), nil
+	}
+
+	_, ok = parseSemVer(string(s))
+	return ast.Boolean(ok), nil
+}
+
+func builtinSemVerCompare(a, b ast.Value) (ast.Value, error) {
+	s1, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	s2, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	v1, ok := parseSemVer(string(s1))
+	if !ok {
+		return nil, builtins.NewOperandErr(1, "string %q is not a valid SemVer", string(s1))
+	}
+
+	v2, ok := parseSemVer(string(s2))
+	if !ok {
+		return nil, builtins.NewOperandErr(2, "string %q is not a valid SemVer", string(s2))
+	}
+
+	return ast.IntNumberTerm(v1.compare(v2)).Value, nil
+}
+
+func init() {
+	RegisterFunctionalBuiltin1(ast.SemVerIsValid.Name, builtinSemVerIsValid)
+	RegisterFunctionalBuiltin2(ast.SemVerCompare.Name, builtinSemVerCompare)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSemVerIsValid(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"valid", []string{`p = x { x = semver.is_valid("1.0.0") }`}, "true"},
+		{"pre-release and build", []string{`p = x { x = semver.is_valid("1.0.0-alpha.1+build.5") }`}, "true"},
+		{"build only", []string{`p = x { x = semver.is_valid("1.0.0+20130313144700") }`}, "true"},
+		{"leading v", []string{`p = x { x = semver.is_valid("v1.0.0") }`}, "false"},
+		{"missing patch", []string{`p = x { x = semver.is_valid("1.0") }`}, "false"},
+		{"leading zero", []string{`p = x { x = semver.is_valid("01.0.0") }`}, "false"},
+		{"leading zero pre-release", []string{`p = x { x = semver.is_valid("1.0.0-01") }`}, "false"},
+		{"empty pre-release identifier", []string{`p = x { x = semver.is_valid("1.0.0-alpha..1") }`}, "false"},
+		{"not a string", []string{`p = x { x = semver.is_valid(1) }`}, "false"},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"equal", []string{`p = x { x = semver.compare("1.2.3", "1.2.3") }`}, "0"},
+		{"major", []string{`p = x { x = semver.compare("2.0.0", "10.0.0") }`}, "-1"},
+		{"minor", []string{`p = x { x = semver.compare("1.10.0", "1.9.0") }`}, "1"},
+		{"patch", []string{`p = x { x = semver.compare("1.0.1", "1.0.2") }`}, "-1"},
+		{"large numbers", []string{`p = x { x = semver.compare("1.0.99999999999999999999", "1.0.100000000000000000000") }`}, "-1"},
+		{"pre-release lower", []string{`p = x { x = semver.compare("1.0.0-alpha", "1.0.0") }`}, "-1"},
+		{"pre-release higher", []string{`p = x { x = semver.compare("1.0.0", "1.0.0-rc.1") }`}, "1"},
+		{"pre-release numeric", []string{`p = x { x = semver.compare("1.0.0-beta.2", "1.0.0-beta.11") }`}, "-1"},
+		{"pre-release numeric lower than alphanumeric", []string{`p = x { x = semver.compare("1.0.0-1", "1.0.0-alpha") }`}, "-1"},
+		{"pre-release alphanumeric", []string{`p = x { x = semver.compare("1.0.0-beta", "1.0.0-alpha.1") }`}, "1"},
+		{"pre-release more identifiers", []string{`p = x { x = semver.compare("1.0.0-alpha", "1.0.0-alpha.1") }`}, "-1"},
+		{"build metadata ignored", []string{`p = x { x = semver.compare("1.0.0+001", "1.0.0+002") }`}, "0"},
+		{"invalid", []string{`p = x { x = semver.compare("1.0", "1.0.0") }`}, fmt.Errorf(`operand 1 string "1.0" is not a valid SemVer`)},
+		{"invalid rhs", []string{`p = x { x = semver.compare("1.0.0", "v1.0.0") }`}, fmt.Errorf(`operand 2 string "v1.0.0" is not a valid SemVer`)},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -83,7 +84,7 @@ func builtinParseDurationNanos(a ast.Value) (ast.Value, error) {
 }
 
 func builtinDate(a ast.Value) (ast.Value, error) {
-	t, err := utcTime(a)
+	t, err := tzTime(a)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +94,7 @@ func builtinDate(a ast.Value) (ast.Value, error) {
 }
 
 func builtinClock(a ast.Value) (ast.Value, error) {
-	t, err := utcTime(a)
+	t, err := tzTime(a)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +104,7 @@ func builtinClock(a ast.Value) (ast.Value, error) {
 }
 
 func builtinWeekday(a ast.Value) (ast.Value, error) {
-	t, err := utcTime(a)
+	t, err := tzTime(a)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +112,146 @@ func builtinWeekday(a ast.Value) (ast.Value, error) {
 	return ast.String(weekday), nil
 }
 
+func builtinAddDate(a, b, c, d ast.Value) (ast.Value, error) {
+	t, err := tzTime(a)
+	if err != nil {
+		return nil, err
+	}
+
+	years, err := builtins.IntOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	months, err := builtins.IntOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := builtins.IntOperand(d, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	result := t.AddDate(years, months, days)
+
+	// UnixNano is undefined outside of this range.
+	if result.Year() < 1678 || result.Year() > 2261 {
+		return nil, fmt.Errorf("time outside of valid range")
+	}
+
+	return ast.Number(int64ToJSONNumber(result.UnixNano())), nil
+}
+
+func builtinDiff(a, b ast.Value) (ast.Value, error) {
+	t1, err := tzTime(a)
+	if err != nil {
+		return nil, err
+	}
+
+	t2, err := tzTime(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Differences are computed in the time zone of the first instant.
+	t2 = t2.In(t1.Location())
+
+	if t1.After(t2) {
+		t1, t2 = t2, t1
+	}
+
+	y1, m1, d1 := t1.Date()
+	y2, m2, d2 := t2.Date()
+	h1, min1, s1 := t1.Clock()
+	h2, min2, s2 := t2.Clock()
+
+	diff := [6]int{y2 - y1, int(m2 - m1), d2 - d1, h2 - h1, min2 - min1, s2 - s1}
+
+	if diff[5] < 0 {
+		diff[5] += 60
+		diff[4]--
+	}
+
+	if diff[4] < 0 {
+		diff[4] += 60
+		diff[3]--
+	}
+
+	if diff[3] < 0 {
+		diff[3] += 24
+		diff[2]--
+	}
+
+	if diff[2] < 0 {
+		// Borrow the number of days in the month of the earlier instant.
+		diff[2] += time.Date(y1, m1+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		diff[1]--
+	}
+
+	if diff[1] < 0 {
+		diff[1] += 12
+		diff[0]--
+	}
+
+	result := make(ast.Array, len(diff))
+	for i := range diff {
+		result[i] = ast.IntNumberTerm(diff[i])
+	}
+
+	return result, nil
+}
+
+func builtinFormat(a ast.Value) (ast.Value, error) {
+	layout := time.RFC3339Nano
+
+	if arr, ok := a.(ast.Array); ok && len(arr) == 3 {
+		s, ok := arr[2].Value.(ast.String)
+		if !ok {
+			return nil, builtins.NewOperandErr(1, "layout must be a string")
+		}
+		layout = string(s)
+		a = arr[:2]
+	}
+
+	t, err := tzTime(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(t.Format(layout)), nil
+}
+
+// tzTime returns the time for the nanoseconds since epoch in a. The time zone
+// may be given as [ns, tz], otherwise UTC is used.
+func tzTime(a ast.Value) (time.Time, error) {
+	arr, ok := a.(ast.Array)
+	if !ok {
+		return utcTime(a)
+	}
+
+	if len(arr) != 2 {
+		return time.Time{}, builtins.NewOperandErr(1, "array must have two elements")
+	}
+
+	t, err := utcTime(arr[0].Value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tz, ok := arr[1].Value.(ast.String)
+	if !ok {
+		return time.Time{}, builtins.NewOperandErr(1, "time zone must be a string")
+	}
+
+	loc, err := loadLocation(string(tz))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.In(loc), nil
+}
+
 func utcTime(a ast.Value) (time.Time, error) {
 	value, err := builtins.NumberOperand(a, 1)
 	if err != nil {
@@ -126,6 +267,30 @@ func utcTime(a ast.Value) (time.Time, error) {
 	return time.Unix(0, i64).UTC(), nil
 }
 
+var locations = struct {
+	sync.Mutex
+	cache map[string]*time.Location
+}{cache: map[string]*time.Location{}}
+
+// loadLocation returns the IANA time zone with the given name. Loading time
+// zones reads the time zone database so locations are cached.
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+
+	if loc, ok := locations.cache[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.cache[name] = loc
+	return loc, nil
+}
+
 func int64ToJSONNumber(i int64) json.Number {
 	return json.Number(strconv.FormatInt(i, 10))
 }
@@ -138,4 +303,7 @@ func init() {
 	RegisterFunctionalBuiltin1(ast.Date.Name, builtinDate)
 	RegisterFunctionalBuiltin1(ast.Clock.Name, builtinClock)
 	RegisterFunctionalBuiltin1(ast.Weekday.Name, builtinWeekday)
+	RegisterFunctionalBuiltin4(ast.AddDate.Name, builtinAddDate)
+	RegisterFunctionalBuiltin2(ast.Diff.Name, builtinDiff)
+	RegisterFunctionalBuiltin1(ast.Format.Name, builtinFormat)
 }
@@ -5,21 +5,29 @@
 package topdown
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	_ "crypto/sha256" // registers crypto.SHA256
+	_ "crypto/sha512" // registers crypto.SHA384 and crypto.SHA512
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"math"
 	"math/big"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/topdown/builtins"
@@ -116,54 +124,52 @@ func builtinJWTDecode(a ast.Value) (ast.Value, error) {
 
 // Implements RS256 JWT signature verification
 func builtinJWTVerifyRS256(a ast.Value, b ast.Value) (ast.Value, error) {
-	return builtinJWTVerifyRSA(a, b, func(publicKey *rsa.PublicKey, digest []byte, signature []byte) error {
-		return rsa.VerifyPKCS1v15(
-			publicKey,
-			crypto.SHA256,
-			digest,
-			signature)
-	})
+	return builtinJWTVerify(a, b, "RS256")
+}
+
+// Implements RS384 JWT signature verification
+func builtinJWTVerifyRS384(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "RS384")
+}
+
+// Implements RS512 JWT signature verification
+func builtinJWTVerifyRS512(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "RS512")
 }
 
 // Implements PS256 JWT signature verification
 func builtinJWTVerifyPS256(a ast.Value, b ast.Value) (ast.Value, error) {
-	return builtinJWTVerifyRSA(a, b, func(publicKey *rsa.PublicKey, digest []byte, signature []byte) error {
-		return rsa.VerifyPSS(
-			publicKey,
-			crypto.SHA256,
-			digest,
-			signature,
-			nil)
-	})
+	return builtinJWTVerify(a, b, "PS256")
 }
 
-// Implements RSA JWT signature verification.
-func builtinJWTVerifyRSA(a ast.Value, b ast.Value, verify func(publicKey *rsa.PublicKey, digest []byte, signature []byte) error) (ast.Value, error) {
-	return builtinJWTVerify(a, b, func(publicKey interface{}, digest []byte, signature []byte) error {
-		publicKeyRsa, ok := publicKey.(*rsa.PublicKey)
-		if !ok {
-			return fmt.Errorf("incorrect public key type")
-		}
-		return verify(publicKeyRsa, digest, signature)
-	})
+// Implements PS384 JWT signature verification
+func builtinJWTVerifyPS384(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "PS384")
+}
+
+// Implements PS512 JWT signature verification
+func builtinJWTVerifyPS512(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "PS512")
 }
 
 // Implements ES256 JWT signature verification.
 func builtinJWTVerifyES256(a ast.Value, b ast.Value) (ast.Value, error) {
-	return builtinJWTVerify(a, b, func(publicKey interface{}, digest []byte, signature []byte) error {
-		publicKeyEcdsa, ok := publicKey.(*ecdsa.PublicKey)
-		if !ok {
-			return fmt.Errorf("incorrect public key type")
-		}
-		r, s := &big.Int{}, &big.Int{}
-		n := len(signature) / 2
-		r.SetBytes(signature[:n])
-		s.SetBytes(signature[n:])
-		if ecdsa.Verify(publicKeyEcdsa, digest, r, s) {
-			return nil
-		}
-		return fmt.Errorf("ECDSA signature verification error")
-	})
+	return builtinJWTVerify(a, b, "ES256")
+}
+
+// Implements ES384 JWT signature verification.
+func builtinJWTVerifyES384(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "ES384")
+}
+
+// Implements ES512 JWT signature verification.
+func builtinJWTVerifyES512(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "ES512")
+}
+
+// Implements EdDSA JWT signature verification.
+func builtinJWTVerifyEdDSA(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerify(a, b, "EdDSA")
 }
 
 // getKeyFromCert returns the public key found in a X.509 certificate.
@@ -177,24 +183,46 @@ func getKeyFromCert(certificate string) (key interface{}, err error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "PEM parse error")
 	}
-	key = cert.PublicKey
+	key = convertEd25519Key(cert.PublicKey)
 	return
 }
 
+// getKeysFromCertOrJWK returns the public keys found in a PEM encoded
+// certificate or public key, or in a JSON Web Key (Set).
+func getKeysFromCertOrJWK(certificate string) ([]verificationKey, error) {
+	if strings.HasPrefix(strings.TrimSpace(certificate), "{") {
+		return getKeysFromJWK(certificate)
+	}
+
+	if block, rest := pem.Decode([]byte(certificate)); block != nil && block.Type == "PUBLIC KEY" && len(rest) == 0 {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "PEM parse error")
+		}
+		return []verificationKey{{key: convertEd25519Key(key)}}, nil
+	}
+
+	key, err := getKeyFromCert(certificate)
+	if err != nil {
+		return nil, err
+	}
+	return []verificationKey{{key: key}}, nil
+}
+
 // Implements JWT signature verification.
-func builtinJWTVerify(a ast.Value, b ast.Value, verify func(publicKey interface{}, digest []byte, signature []byte) error) (ast.Value, error) {
+func builtinJWTVerify(a ast.Value, b ast.Value, alg string) (ast.Value, error) {
 	// Decode the JSON Web Token
 	token, err := decodeJWT(a)
 	if err != nil {
 		return nil, err
 	}
 
-	// Process PEM encoded certificate input
+	// Process PEM encoded certificate, public key or JWK input
 	astCertificate, err := builtins.StringOperand(b, 2)
 	if err != nil {
 		return nil, err
 	}
-	key, err := getKeyFromCert(string(astCertificate))
+	keys, err := getKeysFromCertOrJWK(string(astCertificate))
 	if err != nil {
 		return nil, err
 	}
@@ -204,11 +232,8 @@ func builtinJWTVerify(a ast.Value, b ast.Value, verify func(publicKey interface{
 		return nil, err
 	}
 
-	// Validate the JWT signature
-	err = verify(key,
-		getInputSHA([]byte(token.header+"."+token.payload)),
-		[]byte(signature))
-
+	// Validate the JWT signature with any of the keys
+	err = verifyWithKeys(keys, "", alg, []byte(token.header+"."+token.payload), []byte(signature))
 	if err != nil {
 		return ast.Boolean(false), nil
 	}
@@ -217,6 +242,21 @@ func builtinJWTVerify(a ast.Value, b ast.Value, verify func(publicKey interface{
 
 // Implements HS256 (secret) JWT signature verification
 func builtinJWTVerifyHS256(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerifyHMAC(a, b, "HS256")
+}
+
+// Implements HS384 (secret) JWT signature verification
+func builtinJWTVerifyHS384(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerifyHMAC(a, b, "HS384")
+}
+
+// Implements HS512 (secret) JWT signature verification
+func builtinJWTVerifyHS512(a ast.Value, b ast.Value) (ast.Value, error) {
+	return builtinJWTVerifyHMAC(a, b, "HS512")
+}
+
+// Implements HMAC (secret) JWT signature verification.
+func builtinJWTVerifyHMAC(a ast.Value, b ast.Value, alg string) (ast.Value, error) {
 	// Decode the JSON Web Token
 	token, err := decodeJWT(a)
 	if err != nil {
@@ -230,18 +270,19 @@ func builtinJWTVerifyHS256(a ast.Value, b ast.Value) (ast.Value, error) {
 	}
 	secret := string(astSecret)
 
-	mac := hmac.New(sha256.New, []byte(secret))
-	_, err = mac.Write([]byte(token.header + "." + token.payload))
+	signature, err := token.decodeSignature()
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := token.decodeSignature()
-	if err != nil {
+	hmacAlg := tokenAlgorithms[alg]
+	err = hmacAlg.verify([]byte(secret), hmacAlg.hash, []byte(token.header+"."+token.payload), []byte(signature))
+	if err == errSignatureNotVerified {
+		return ast.Boolean(false), nil
+	} else if err != nil {
 		return nil, err
 	}
-
-	return ast.Boolean(hmac.Equal([]byte(signature), mac.Sum(nil))), nil
+	return ast.Boolean(true), nil
 }
 
 // -- Full JWT verification and decoding --
@@ -250,8 +291,8 @@ func builtinJWTVerifyHS256(a ast.Value, b ast.Value) (ast.Value, error) {
 
 // tokenConstraints holds decoded JWT verification constraints.
 type tokenConstraints struct {
-	// The single asymmetric key we will verify with.
-	key interface{}
+	// The asymmetric keys we will verify with.
+	keys []verificationKey
 
 	// The single symmetric key we will verify with.
 	secret string
@@ -302,7 +343,7 @@ func tokenConstraintCert(value ast.Value, constraints *tokenConstraints) (err er
 		err = fmt.Errorf("cert constraint: must be a string")
 		return
 	}
-	if constraints.key, err = getKeyFromCert(string(cert)); err != nil {
+	if constraints.keys, err = getKeysFromCertOrJWK(string(cert)); err != nil {
 		return
 	}
 	return
@@ -373,7 +414,7 @@ func parseTokenConstraints(a ast.Value) (constraints tokenConstraints, err error
 // validate validates the constraints argument.
 func (constraints *tokenConstraints) validate() (err error) {
 	keys := 0
-	if constraints.key != nil {
+	if len(constraints.keys) > 0 {
 		keys++
 	}
 	if constraints.secret != "" {
@@ -404,9 +445,9 @@ func (constraints *tokenConstraints) verify(kid, alg, header, payload, signature
 		err = fmt.Errorf("unknown JWS algorithm: %s", alg)
 		return
 	}
-	// If we're configured with a single key then only trust that
-	if constraints.key != nil {
-		return a.verify(constraints.key, a.hash, plaintext, []byte(signature))
+	// If we're configured with keys then only trust those
+	if len(constraints.keys) > 0 {
+		return verifyWithKeys(constraints.keys, kid, alg, plaintext, []byte(signature))
 	}
 	if constraints.secret != "" {
 		return a.verify([]byte(constraints.secret), a.hash, plaintext, []byte(signature))
@@ -444,27 +485,31 @@ func (constraints *tokenConstraints) validAudience(aud ast.Value) (valid bool) {
 
 type tokenVerifyFunction func(key interface{}, hash crypto.Hash, payload []byte, signature []byte) (err error)
 type tokenVerifyAsymmetricFunction func(key interface{}, hash crypto.Hash, digest []byte, signature []byte) (err error)
+type tokenSignFunction func(key interface{}, hash crypto.Hash, payload []byte) (signature []byte, err error)
+type tokenSignAsymmetricFunction func(key interface{}, hash crypto.Hash, digest []byte) (signature []byte, err error)
 
 // jwtAlgorithm describes a JWS 'alg' value
 type tokenAlgorithm struct {
 	hash   crypto.Hash
 	verify tokenVerifyFunction
+	sign   tokenSignFunction
 }
 
 // tokenAlgorithms is the known JWT algorithms
 var tokenAlgorithms = map[string]tokenAlgorithm{
-	"RS256": {crypto.SHA256, verifyAsymmetric(verifyRSAPKCS)},
-	"RS384": {crypto.SHA384, verifyAsymmetric(verifyRSAPKCS)},
-	"RS512": {crypto.SHA512, verifyAsymmetric(verifyRSAPKCS)},
-	"PS256": {crypto.SHA256, verifyAsymmetric(verifyRSAPSS)},
-	"PS384": {crypto.SHA384, verifyAsymmetric(verifyRSAPSS)},
-	"PS512": {crypto.SHA512, verifyAsymmetric(verifyRSAPSS)},
-	"ES256": {crypto.SHA256, verifyAsymmetric(verifyECDSA)},
-	"ES384": {crypto.SHA384, verifyAsymmetric(verifyECDSA)},
-	"ES512": {crypto.SHA512, verifyAsymmetric(verifyECDSA)},
-	"HS256": {crypto.SHA256, verifyHMAC},
-	"HS384": {crypto.SHA384, verifyHMAC},
-	"HS512": {crypto.SHA512, verifyHMAC},
+	"RS256": {crypto.SHA256, verifyAsymmetric(verifyRSAPKCS), signAsymmetric(signRSAPKCS)},
+	"RS384": {crypto.SHA384, verifyAsymmetric(verifyRSAPKCS), signAsymmetric(signRSAPKCS)},
+	"RS512": {crypto.SHA512, verifyAsymmetric(verifyRSAPKCS), signAsymmetric(signRSAPKCS)},
+	"PS256": {crypto.SHA256, verifyAsymmetric(verifyRSAPSS), signAsymmetric(signRSAPSS)},
+	"PS384": {crypto.SHA384, verifyAsymmetric(verifyRSAPSS), signAsymmetric(signRSAPSS)},
+	"PS512": {crypto.SHA512, verifyAsymmetric(verifyRSAPSS), signAsymmetric(signRSAPSS)},
+	"ES256": {crypto.SHA256, verifyAsymmetric(verifyECDSA), signAsymmetric(signECDSA)},
+	"ES384": {crypto.SHA384, verifyAsymmetric(verifyECDSA), signAsymmetric(signECDSA)},
+	"ES512": {crypto.SHA512, verifyAsymmetric(verifyECDSA), signAsymmetric(signECDSA)},
+	"HS256": {crypto.SHA256, verifyHMAC, signHMAC},
+	"HS384": {crypto.SHA384, verifyHMAC, signHMAC},
+	"HS512": {crypto.SHA512, verifyHMAC, signHMAC},
+	"EdDSA": {0, verifyEd25519, signEd25519},
 }
 
 // errSignatureNotVerified is returned when a signature cannot be verified.
@@ -530,6 +575,310 @@ func verifyECDSA(key interface{}, hash crypto.Hash, digest []byte, signature []b
 	return errSignatureNotVerified
 }
 
+func verifyEd25519(key interface{}, hash crypto.Hash, payload []byte, signature []byte) (err error) {
+	publicKeyEd25519, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("incorrect public key type")
+	}
+	if ed25519.Verify(publicKeyEd25519, payload, signature) {
+		return nil
+	}
+	return errSignatureNotVerified
+}
+
+// verifyWithKeys verifies the signature with each of the keys that may have
+// been used to sign the JWT. Keys that are restricted to a different key ID
+// or algorithm are skipped.
+func verifyWithKeys(keys []verificationKey, kid, alg string, payload []byte, signature []byte) error {
+	a, ok := tokenAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unknown JWS algorithm: %s", alg)
+	}
+	for _, key := range keys {
+		if key.alg != "" && key.alg != alg {
+			continue
+		}
+		if kid != "" && key.kid != "" && key.kid != kid {
+			continue
+		}
+		if a.verify(key.key, a.hash, payload, signature) == nil {
+			return nil
+		}
+	}
+	return errSignatureNotVerified
+}
+
+func signHMAC(key interface{}, hash crypto.Hash, payload []byte) (signature []byte, err error) {
+	macKey, ok := key.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("incorrect symmetric key type")
+	}
+	mac := hmac.New(hash.New, macKey)
+	if _, err = mac.Write(payload); err != nil {
+		return
+	}
+	return mac.Sum([]byte{}), nil
+}
+
+func signAsymmetric(sign tokenSignAsymmetricFunction) tokenSignFunction {
+	return func(key interface{}, hash crypto.Hash, payload []byte) (signature []byte, err error) {
+		h := hash.New()
+		h.Write(payload)
+		return sign(key, hash, h.Sum([]byte{}))
+	}
+}
+
+func signRSAPKCS(key interface{}, hash crypto.Hash, digest []byte) (signature []byte, err error) {
+	privateKeyRsa, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("incorrect private key type")
+	}
+	return rsa.SignPKCS1v15(rand.Reader, privateKeyRsa, hash, digest)
+}
+
+func signRSAPSS(key interface{}, hash crypto.Hash, digest []byte) (signature []byte, err error) {
+	privateKeyRsa, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("incorrect private key type")
+	}
+	return rsa.SignPSS(rand.Reader, privateKeyRsa, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+}
+
+func signECDSA(key interface{}, hash crypto.Hash, digest []byte) (signature []byte, err error) {
+	privateKeyEcdsa, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("incorrect private key type")
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, privateKeyEcdsa, digest)
+	if err != nil {
+		return nil, err
+	}
+	// RFC7518 3.4 the signature is the concatenation of R and S, each
+	// padded to the size of the curve
+	n := (privateKeyEcdsa.Curve.Params().BitSize + 7) / 8
+	signature = make([]byte, 2*n)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[n-len(rb):n], rb)
+	copy(signature[2*n-len(sb):], sb)
+	return signature, nil
+}
+
+func signEd25519(key interface{}, hash crypto.Hash, payload []byte) (signature []byte, err error) {
+	privateKeyEd25519, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("incorrect private key type")
+	}
+	return ed25519.Sign(privateKeyEd25519, payload), nil
+}
+
+// JSON Web Keys. See RFC 7517 and RFC 7518 section 6.
+
+// jsonWebKey is a JSON Web Key. Only the members required to sign and verify
+// JWTs are included.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// jsonWebKeySet is a JSON Web Key Set.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// verificationKey is a key that a JWT signature can be verified with. If alg
+// or kid are set, the key is only used for JWTs with the same values.
+type verificationKey struct {
+	alg string
+	kid string
+	key interface{}
+}
+
+// getKeysFromJWK returns the public keys in a JSON Web Key or JSON Web Key
+// Set. Keys intended for encryption are ignored.
+func getKeysFromJWK(s string) ([]verificationKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal([]byte(s), &set); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %v", err)
+	}
+
+	jwks := set.Keys
+	if jwks == nil {
+		var jwk jsonWebKey
+		if err := json.Unmarshal([]byte(s), &jwk); err != nil {
+			return nil, fmt.Errorf("invalid JWK: %v", err)
+		}
+		jwks = []jsonWebKey{jwk}
+	}
+
+	keys := make([]verificationKey, 0, len(jwks))
+	for i := range jwks {
+		if jwks[i].Use == "enc" {
+			continue
+		}
+		key, err := jwks[i].publicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, verificationKey{alg: jwks[i].Alg, kid: jwks[i].Kid, key: key})
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the key used to verify signatures. For symmetric keys,
+// this is the secret.
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := jwkBigInt("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwkBigInt("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > math.MaxInt32 {
+			return nil, fmt.Errorf("JWK e is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, err := jwkCurve(jwk.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := jwkBigInt("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkBigInt("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("JWK point is not on curve %s", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK curve: %s", jwk.Crv)
+		}
+		x, err := jwkBytes("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWK x has invalid length")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return jwkBytes("k", jwk.K)
+	}
+	return nil, fmt.Errorf("unsupported JWK key type: %s", jwk.Kty)
+}
+
+// privateKey returns the key used to create signatures. For symmetric keys,
+// this is the secret.
+func (jwk *jsonWebKey) privateKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		d, err := jwkBigInt("d", jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		p, err := jwkBigInt("p", jwk.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := jwkBigInt("q", jwk.Q)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{PublicKey: *pub.(*rsa.PublicKey), D: d, Primes: []*big.Int{p, q}}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid JWK: %v", err)
+		}
+		key.Precompute()
+		return key, nil
+	case "EC":
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		d, err := jwkBigInt("d", jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pub.(*ecdsa.PublicKey), D: d}, nil
+	case "OKP":
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		seed, err := jwkBytes("d", jwk.D)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("JWK d has invalid length")
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		if !bytes.Equal(key.Public().(ed25519.PublicKey), pub.(ed25519.PublicKey)) {
+			return nil, fmt.Errorf("JWK x does not match d")
+		}
+		return key, nil
+	case "oct":
+		return jwk.publicKey()
+	}
+	return nil, fmt.Errorf("unsupported JWK key type: %s", jwk.Kty)
+}
+
+func jwkBytes(name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("JWK %s is missing", name)
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("JWK %s had invalid encoding: %v", name, err)
+	}
+	return bs, nil
+}
+
+func jwkBigInt(name, value string) (*big.Int, error) {
+	bs, err := jwkBytes(name, value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
+
+func jwkCurve(crv string) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported JWK curve: %s", crv)
+}
+
 // JWT header parsing and parameters. See tokens_test.go for unit tests.
 
 // tokenHeaderType represents a recognized JWT header field
@@ -766,8 +1115,100 @@ func builtinJWTDecodeVerify(a ast.Value, b ast.Value) (v ast.Value, err error) {
 	return arr, nil
 }
 
+// -- JWT encoding and signing --
+
+// Implements JWT encoding and signing based on RFC 7515 section 5.1. The
+// header and payload are used as-is.
+func builtinJWTEncodeSignRaw(a ast.Value, b ast.Value, c ast.Value) (ast.Value, error) {
+	header, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := builtins.StringOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	key, err := builtins.StringOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSignJWT(string(header), string(payload), string(key))
+}
+
+// Implements JWT encoding and signing with the header, payload and key given
+// as objects.
+func builtinJWTEncodeSign(a ast.Value, b ast.Value, c ast.Value) (ast.Value, error) {
+	header, err := jsonObjectOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := jsonObjectOperand(b, 2)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jsonObjectOperand(c, 3)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSignJWT(header, payload, key)
+}
+
+func encodeSignJWT(header, payload, key string) (ast.Value, error) {
+	h, err := validateJWTHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	var alg string
+	if v := h.Get(jwtAlgKey); v != nil {
+		if err := tokenHeaderString("alg", &alg, v.Value); err != nil {
+			return nil, err
+		}
+	}
+	a, ok := tokenAlgorithms[alg]
+	if !ok {
+		return nil, fmt.Errorf("unknown JWS algorithm: %s", alg)
+	}
+
+	var jwk jsonWebKey
+	if err := json.Unmarshal([]byte(key), &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %v", err)
+	}
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, fmt.Errorf("JWK algorithm %s does not match JWS algorithm %s", jwk.Alg, alg)
+	}
+	privateKey, err := jwk.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	signature, err := a.sign(privateKey, a.hash, []byte(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.String(encoded + "." + base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
 // -- Utilities --
 
+// jsonObjectOperand returns the JSON encoding of an object operand.
+func jsonObjectOperand(a ast.Value, pos int) (string, error) {
+	obj, err := builtins.ObjectOperand(a, pos)
+	if err != nil {
+		return "", err
+	}
+	x, err := ast.JSON(obj)
+	if err != nil {
+		return "", err
+	}
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
 func decodeJWT(a ast.Value) (*JSONWebToken, error) {
 	// Parse the JSON Web Token
 	astEncode, err := builtins.StringOperand(a, 1)
@@ -841,18 +1282,22 @@ func extractJSONObject(s string) (ast.Object, error) {
 	return o, nil
 }
 
-// getInputSha returns the SHA256 checksum of the input
-func getInputSHA(input []byte) (hash []byte) {
-	hasher := sha256.New()
-	hasher.Write(input)
-	return hasher.Sum(nil)
-}
-
 func init() {
 	RegisterFunctionalBuiltin1(ast.JWTDecode.Name, builtinJWTDecode)
 	RegisterFunctionalBuiltin2(ast.JWTVerifyRS256.Name, builtinJWTVerifyRS256)
 	RegisterFunctionalBuiltin2(ast.JWTVerifyPS256.Name, builtinJWTVerifyPS256)
 	RegisterFunctionalBuiltin2(ast.JWTVerifyES256.Name, builtinJWTVerifyES256)
 	RegisterFunctionalBuiltin2(ast.JWTVerifyHS256.Name, builtinJWTVerifyHS256)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyRS384.Name, builtinJWTVerifyRS384)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyPS384.Name, builtinJWTVerifyPS384)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyES384.Name, builtinJWTVerifyES384)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyHS384.Name, builtinJWTVerifyHS384)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyRS512.Name, builtinJWTVerifyRS512)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyPS512.Name, builtinJWTVerifyPS512)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyES512.Name, builtinJWTVerifyES512)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyHS512.Name, builtinJWTVerifyHS512)
+	RegisterFunctionalBuiltin2(ast.JWTVerifyEdDSA.Name, builtinJWTVerifyEdDSA)
 	RegisterFunctionalBuiltin2(ast.JWTDecodeVerify.Name, builtinJWTDecodeVerify)
+	RegisterFunctionalBuiltin3(ast.JWTEncodeSignRaw.Name, builtinJWTEncodeSignRaw)
+	RegisterFunctionalBuiltin3(ast.JWTEncodeSign.Name, builtinJWTEncodeSign)
 }
@@ -1412,6 +1412,46 @@ func TestTopDownBase64UrlBuiltins(t *testing.T) {
 	}
 }
 
+func TestTopDownBase32Builtins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"encode", []string{`p = x { base32.encode("hello", x) }`}, `"NBSWY3DP"`},
+		{"encode-2", []string{`p = x { base32.encode("there", x) }`}, `"ORUGK4TF"`},
+		{"encode padding", []string{`p = x { base32.encode("foo", x) }`}, `"MZXW6==="`},
+		{"decode", []string{`p = x { base32.decode("MZXW6===", x) }`}, `"foo"`},
+		{"decode error", []string{`p = x { base32.decode("MZXW6", x) }`}, fmt.Errorf("illegal base32 data")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestTopDownHexBuiltins(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"encode", []string{`p = x { hex.encode("hello", x) }`}, `"68656c6c6f"`},
+		{"decode", []string{`p = x { hex.decode("68656c6c6f", x) }`}, `"hello"`},
+		{"decode uppercase", []string{`p = x { hex.decode("68656C6C6F", x) }`}, `"hello"`},
+		{"decode odd length", []string{`p = x { hex.decode("686", x) }`}, fmt.Errorf("encoding/hex: odd length hex string")},
+		{"decode invalid", []string{`p = x { hex.decode("zz", x) }`}, fmt.Errorf("encoding/hex: invalid byte")},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
 func TestTopDownURLBuiltins(t *testing.T) {
 	tests := []struct {
 		note     string
@@ -2076,6 +2116,69 @@ func TestTopDownTime(t *testing.T) {
 
 	runTopDownTestCase(t, data, "weekday too big", []string{`
 		p = weekday { weekday := time.weekday(1582977600*1000*1000*1000*1000) }`}, fmt.Errorf("timestamp too big"))
+
+	runTopDownTestCase(t, data, "date with time zone", []string{`
+		p = [year, month, day] { [year, month, day] := time.date([1517796000*1000*1000*1000, "America/New_York"]) }`}, "[2018, 2, 4]")
+
+	runTopDownTestCase(t, data, "clock with time zone", []string{`
+		p = [hour, minute, second] { [hour, minute, second] := time.clock([1517796000*1000*1000*1000, "America/New_York"]) }`}, "[21, 0, 0]")
+
+	runTopDownTestCase(t, data, "clock before dst", []string{`
+		p = [hour, minute, second] { [hour, minute, second] := time.clock([1552199400*1000*1000*1000, "America/New_York"]) }`}, "[1, 30, 0]")
+
+	runTopDownTestCase(t, data, "clock after dst", []string{`
+		p = [hour, minute, second] { [hour, minute, second] := time.clock([1552203000*1000*1000*1000, "America/New_York"]) }`}, "[3, 30, 0]")
+
+	runTopDownTestCase(t, data, "weekday with time zone", []string{`
+		p = weekday { weekday := time.weekday([1517796000*1000*1000*1000, "America/New_York"]) }`}, `"Sunday"`)
+
+	runTopDownTestCase(t, data, "weekday with utc", []string{`
+		p = weekday { weekday := time.weekday([1517796000*1000*1000*1000, "UTC"]) }`}, `"Monday"`)
+
+	runTopDownTestCase(t, data, "unknown time zone", []string{`
+		p = weekday { weekday := time.weekday([1517796000*1000*1000*1000, "Mars/Olympus_Mons"]) }`}, fmt.Errorf("unknown time zone Mars/Olympus_Mons"))
+
+	runTopDownTestCase(t, data, "add date", []string{`
+		p = ns { ns := time.add_date(1517832000*1000*1000*1000, 0, 1, 0) }`}, "1520251200000000000")
+
+	runTopDownTestCase(t, data, "add date leap day", []string{`
+		p = ns { ns := time.add_date(1582977600*1000*1000*1000, 1, 0, 0) }`}, "1614600000000000000")
+
+	runTopDownTestCase(t, data, "add date negative", []string{`
+		p = ns { ns := time.add_date(1520251200*1000*1000*1000, 0, 0, -28) }`}, "1517832000000000000")
+
+	runTopDownTestCase(t, data, "add date dst", []string{`
+		p = ns { ns := time.add_date([1552150800*1000*1000*1000, "America/New_York"], 0, 0, 1) }`}, "1552233600000000000")
+
+	runTopDownTestCase(t, data, "add date utc across dst", []string{`
+		p = ns { ns := time.add_date(1552150800*1000*1000*1000, 0, 0, 1) }`}, "1552237200000000000")
+
+	runTopDownTestCase(t, data, "add date out of range", []string{`
+		p = ns { ns := time.add_date(1517832000*1000*1000*1000, 1000, 0, 0) }`}, fmt.Errorf("time outside of valid range"))
+
+	runTopDownTestCase(t, data, "diff", []string{`
+		p = d { d := time.diff(1517832000*1000*1000*1000, 1582977600*1000*1000*1000) }`}, "[2, 0, 24, 0, 0, 0]")
+
+	runTopDownTestCase(t, data, "diff reversed", []string{`
+		p = d { d := time.diff(1582977600*1000*1000*1000, 1517832000*1000*1000*1000) }`}, "[2, 0, 24, 0, 0, 0]")
+
+	runTopDownTestCase(t, data, "diff borrow days", []string{`
+		p = d { d := time.diff(1548892800*1000*1000*1000, 1551398400*1000*1000*1000) }`}, "[0, 1, 1, 0, 0, 0]")
+
+	runTopDownTestCase(t, data, "diff borrow hours", []string{`
+		p = d { d := time.diff(1517832000*1000*1000*1000, 1517914800*1000*1000*1000) }`}, "[0, 0, 0, 23, 0, 0]")
+
+	runTopDownTestCase(t, data, "diff across dst", []string{`
+		p = d { d := time.diff([1552176000*1000*1000*1000, "America/New_York"], 1552258800*1000*1000*1000) }`}, "[0, 0, 1, 0, 0, 0]")
+
+	runTopDownTestCase(t, data, "format", []string{`
+		p = s { s := time.format(1517832000*1000*1000*1000) }`}, `"2018-02-05T12:00:00Z"`)
+
+	runTopDownTestCase(t, data, "format with time zone", []string{`
+		p = s { s := time.format([1517832000*1000*1000*1000, "America/New_York"]) }`}, `"2018-02-05T07:00:00-05:00"`)
+
+	runTopDownTestCase(t, data, "format with layout", []string{`
+		p = s { s := time.format([1517832000*1000*1000*1000, "America/New_York", "Mon Jan 2 15:04:05 MST 2006"]) }`}, `"Mon Feb 5 07:00:00 EST 2018"`)
 }
 
 func TestTopDownWalkBuiltin(t *testing.T) {
@@ -2947,6 +3050,76 @@ func TestTopDownQueryCancellation(t *testing.T) {
 
 }
 
+func TestTopDownQueryLimits(t *testing.T) {
+
+	ctx := context.Background()
+
+	compiler := compileModules([]string{
+		`
+		package test
+
+		arr = [x | data.arr[x]]
+		set = {x | data.arr[x]}
+		obj = {x: y | data.arr[x] = y}
+		partial[x] { data.arr[x] }
+		slow { data.arr[_] = _; test.sleep("1ms") }
+		hosts = net.cidr_expand("10.0.0.0/24")
+		`,
+	})
+
+	arr := make([]interface{}, 1000)
+	for i := range arr {
+		arr[i] = i
+	}
+
+	store := inmem.NewFromObject(map[string]interface{}{"arr": arr})
+
+	tests := []struct {
+		note   string
+		query  string
+		limits Limits
+		exp    string
+	}{
+		{"steps ok", "data.test.arr", Limits{MaxSteps: 10000}, ""},
+		{"steps", "data.test.arr", Limits{MaxSteps: 100}, "evaluation exceeded maximum number of steps (100)"},
+		{"array comprehension", "data.test.arr", Limits{MaxCollectionSize: 10}, "collection exceeded maximum size (10)"},
+		{"set comprehension", "data.test.set", Limits{MaxCollectionSize: 10}, "collection exceeded maximum size (10)"},
+		{"object comprehension", "data.test.obj", Limits{MaxCollectionSize: 10}, "collection exceeded maximum size (10)"},
+		{"partial set", "data.test.partial", Limits{MaxCollectionSize: 10}, "collection exceeded maximum size (10)"},
+		{"collection ok", "data.test.set", Limits{MaxCollectionSize: 1000}, ""},
+		{"cidr expand", "data.test.hosts", Limits{MaxCollectionSize: 10}, "collection exceeded maximum size (10)"},
+		{"cidr expand ok", "data.test.hosts", Limits{MaxCollectionSize: 256}, ""},
+		{"timeout", "data.test.slow", Limits{Timeout: time.Millisecond * 50}, "evaluation exceeded timeout (50ms)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			txn := storage.NewTransactionOrDie(ctx, store)
+			defer store.Abort(ctx, txn)
+
+			query := NewQuery(ast.MustParseBody(tc.query)).
+				WithCompiler(compiler).
+				WithStore(store).
+				WithTransaction(txn).
+				WithLimits(tc.limits)
+
+			_, err := query.Run(ctx)
+
+			if tc.exp == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !IsLimitExceeded(err) || !strings.Contains(err.Error(), tc.exp) {
+				t.Fatalf("Expected limit error containing %q but got: %v", tc.exp, err)
+			}
+		})
+	}
+}
+
 type contextPropagationMock struct{}
 
 // contextPropagationStore will accumulate values from the contexts provided to
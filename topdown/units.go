@@ -0,0 +1,159 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+var unitsRegexp = regexp.MustCompile(`^(\d+(?:\.\d*)?|\.\d+)\s*([a-zA-Z]*)$`)
+
+// unitMultipliers maps the suffixes accepted by units.parse to multipliers.
+// Suffixes are case-sensitive to distinguish milli from mega.
+var unitMultipliers = map[string]*big.Rat{
+	"":   big.NewRat(1, 1),
+	"m":  big.NewRat(1, 1000),
+	"k":  decimalMultiplier(1),
+	"K":  decimalMultiplier(1),
+	"M":  decimalMultiplier(2),
+	"G":  decimalMultiplier(3),
+	"T":  decimalMultiplier(4),
+	"P":  decimalMultiplier(5),
+	"E":  decimalMultiplier(6),
+	"Ki": binaryMultiplier(1),
+	"Mi": binaryMultiplier(2),
+	"Gi": binaryMultiplier(3),
+	"Ti": binaryMultiplier(4),
+	"Pi": binaryMultiplier(5),
+	"Ei": binaryMultiplier(6),
+}
+
+// byteMultipliers maps the lowercase suffixes accepted by units.parse_bytes to
+// multipliers.
+var byteMultipliers = map[string]*big.Rat{
+	"":    big.NewRat(1, 1),
+	"b":   big.NewRat(1, 1),
+	"k":   decimalMultiplier(1),
+	"kb":  decimalMultiplier(1),
+	"m":   decimalMultiplier(2),
+	"mb":  decimalMultiplier(2),
+	"g":   decimalMultiplier(3),
+	"gb":  decimalMultiplier(3),
+	"t":   decimalMultiplier(4),
+	"tb":  decimalMultiplier(4),
+	"p":   decimalMultiplier(5),
+	"pb":  decimalMultiplier(5),
+	"e":   decimalMultiplier(6),
+	"eb":  decimalMultiplier(6),
+	"ki":  binaryMultiplier(1),
+	"kib": binaryMultiplier(1),
+	"mi":  binaryMultiplier(2),
+	"mib": binaryMultiplier(2),
+	"gi":  binaryMultiplier(3),
+	"gib": binaryMultiplier(3),
+	"ti":  binaryMultiplier(4),
+	"tib": binaryMultiplier(4),
+	"pi":  binaryMultiplier(5),
+	"pib": binaryMultiplier(5),
+	"ei":  binaryMultiplier(6),
+	"eib": binaryMultiplier(6),
+}
+
+func decimalMultiplier(exp int64) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(1000), big.NewInt(exp), nil))
+}
+
+func binaryMultiplier(exp int64) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(10*exp)))
+}
+
+// parseUnits returns the amount and unit suffix in s.
+func parseUnits(s string, pos int) (*big.Rat, string, error) {
+	m := unitsRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, "", builtins.NewOperandErr(pos, "could not parse amount to a number: %q", s)
+	}
+
+	amount, ok := new(big.Rat).SetString(m[1])
+	if !ok {
+		return nil, "", builtins.NewOperandErr(pos, "could not parse amount to a number: %q", s)
+	}
+
+	return amount, m[2], nil
+}
+
+func builtinUnitsParse(a ast.Value) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, unit, err := parseUnits(string(s), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	multiplier, ok := unitMultipliers[unit]
+	if !ok {
+		return nil, builtins.NewOperandErr(1, "unknown unit %q", unit)
+	}
+
+	return ratToNumber(amount.Mul(amount, multiplier)), nil
+}
+
+func builtinUnitsParseBytes(a ast.Value) (ast.Value, error) {
+	s, err := builtins.StringOperand(a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, unit, err := parseUnits(string(s), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	multiplier, ok := byteMultipliers[strings.ToLower(unit)]
+	if !ok {
+		return nil, builtins.NewOperandErr(1, "unknown unit %q", unit)
+	}
+
+	amount.Mul(amount, multiplier)
+
+	// Partial bytes are truncated.
+	return ast.Number(new(big.Int).Quo(amount.Num(), amount.Denom()).String()), nil
+}
+
+// ratToNumber returns the exact decimal representation of r. The denominator
+// of r must only have the prime factors 2 and 5.
+func ratToNumber(r *big.Rat) ast.Number {
+	if r.IsInt() {
+		return ast.Number(r.Num().String())
+	}
+
+	// Removing the factors of the denominator one at a time yields an upper
+	// bound on the number of decimal places required.
+	places := 0
+	for d := new(big.Int).Set(r.Denom()); d.Cmp(big.NewInt(1)) > 0; places++ {
+		if new(big.Int).Mod(d, big.NewInt(10)).Sign() == 0 {
+			d.Quo(d, big.NewInt(10))
+		} else if d.Bit(0) == 0 {
+			d.Quo(d, big.NewInt(2))
+		} else {
+			d.Quo(d, big.NewInt(5))
+		}
+	}
+
+	return ast.Number(strings.TrimRight(r.FloatString(places), "0"))
+}
+
+func init() {
+	RegisterFunctionalBuiltin1(ast.UnitsParse.Name, builtinUnitsParse)
+	RegisterFunctionalBuiltin1(ast.UnitsParseBytes.Name, builtinUnitsParseBytes)
+}
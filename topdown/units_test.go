@@ -0,0 +1,68 @@
+// Copyright 2019 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package topdown
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnitsParse(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"plain", []string{`p = x { x = units.parse("100") }`}, "100"},
+		{"milli", []string{`p = x { x = units.parse("1500m") }`}, "1.5"},
+		{"milli small", []string{`p = x { x = units.parse("1m") }`}, "0.001"},
+		{"kilo", []string{`p = x { x = units.parse("5K") }`}, "5000"},
+		{"kilo lowercase", []string{`p = x { x = units.parse("5k") }`}, "5000"},
+		{"mega", []string{`p = x { x = units.parse("4M") }`}, "4000000"},
+		{"exa", []string{`p = x { x = units.parse("2E") }`}, "2000000000000000000"},
+		{"kibi", []string{`p = x { x = units.parse("2Ki") }`}, "2048"},
+		{"mebi fractional", []string{`p = x { x = units.parse("1.5Mi") }`}, "1572864"},
+		{"exbi", []string{`p = x { x = units.parse("1Ei") }`}, "1152921504606846976"},
+		{"decimal", []string{`p = x { x = units.parse("0.1") }`}, "0.1"},
+		{"leading dot", []string{`p = x { x = units.parse(".5G") }`}, "500000000"},
+		{"space", []string{`p = x { x = units.parse(" 10 G ") }`}, "10000000000"},
+		{"unknown unit", []string{`p = x { x = units.parse("10Q") }`}, fmt.Errorf(`operand 1 unknown unit "Q"`)},
+		{"bytes suffix", []string{`p = x { x = units.parse("10KB") }`}, fmt.Errorf(`operand 1 unknown unit "KB"`)},
+		{"not a number", []string{`p = x { x = units.parse("ten") }`}, fmt.Errorf(`operand 1 could not parse amount to a number: "ten"`)},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}
+
+func TestUnitsParseBytes(t *testing.T) {
+	tests := []struct {
+		note     string
+		rules    []string
+		expected interface{}
+	}{
+		{"plain", []string{`p = x { x = units.parse_bytes("100") }`}, "100"},
+		{"bytes", []string{`p = x { x = units.parse_bytes("100b") }`}, "100"},
+		{"kilo", []string{`p = x { x = units.parse_bytes("5K") }`}, "5000"},
+		{"kilobytes", []string{`p = x { x = units.parse_bytes("5kb") }`}, "5000"},
+		{"megabytes", []string{`p = x { x = units.parse_bytes("4MB") }`}, "4000000"},
+		{"gibibytes", []string{`p = x { x = units.parse_bytes("10GiB") }`}, "10737418240"},
+		{"kibi", []string{`p = x { x = units.parse_bytes("2Ki") }`}, "2048"},
+		{"fractional", []string{`p = x { x = units.parse_bytes("1.5KiB") }`}, "1536"},
+		{"truncated", []string{`p = x { x = units.parse_bytes("1.0005K") }`}, "1000"},
+		{"exbibytes", []string{`p = x { x = units.parse_bytes("8EiB") }`}, "9223372036854775808"},
+		{"unknown unit", []string{`p = x { x = units.parse_bytes("10xb") }`}, fmt.Errorf(`operand 1 unknown unit "xb"`)},
+		{"negative", []string{`p = x { x = units.parse_bytes("-10") }`}, fmt.Errorf(`operand 1 could not parse amount to a number: "-10"`)},
+	}
+
+	data := loadSmallTestData()
+
+	for _, tc := range tests {
+		runTopDownTestCase(t, data, tc.note, tc.rules, tc.expected)
+	}
+}